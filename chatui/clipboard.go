@@ -0,0 +1,19 @@
+package chatui
+
+import (
+	"errors"
+
+	"github.com/atotto/clipboard"
+)
+
+var errNoClipboard = errors.New("no clipboard available")
+
+// writeClipboard copies s to the system clipboard.
+var writeClipboard = func(s string) error {
+	// e.g. headless sessions without xclip, xsel or wl-copy
+	if clipboard.Unsupported {
+		return errNoClipboard
+	}
+
+	return clipboard.WriteAll(s)
+}
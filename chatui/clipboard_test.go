@@ -0,0 +1,72 @@
+package chatui_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/chatui"
+)
+
+func TestCopyLastResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []string
+		clipErr   error
+		wantCopy  string
+		wantInfo  string
+		wantErr   string
+	}{
+		{
+			name:      "copies the last response",
+			responses: []string{"foo", "bar"},
+			wantCopy:  "bar",
+			wantInfo:  "COPIED LAST RESPONSE",
+		},
+		{
+			name:      "no responses",
+			responses: nil,
+			wantErr:   "NO RESPONSE TO COPY",
+		},
+		{
+			name:      "clipboard unavailable",
+			responses: []string{"foo"},
+			clipErr:   errors.New("no clipboard available"),
+			wantErr:   "COPY: NO CLIPBOARD AVAILABLE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var copied string
+
+			restore := chatui.SetClipboardWriter(func(s string) error {
+				if tt.clipErr != nil {
+					return tt.clipErr
+				}
+
+				copied = s
+
+				return nil
+			})
+			defer restore()
+
+			m := chatui.New(nil, nil, chatui.LLMConfig{})
+			m.SetResponses(tt.responses...)
+			m.CopyLastResponse()
+
+			info, err := m.Footer()
+
+			if copied != tt.wantCopy {
+				t.Errorf("want copied: %q, got: %q", tt.wantCopy, copied)
+			}
+
+			if info != tt.wantInfo {
+				t.Errorf("want info: %q, got: %q", tt.wantInfo, info)
+			}
+
+			if err != tt.wantErr {
+				t.Errorf("want error: %q, got: %q", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package chatui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+var (
+	TranscriptName   = transcriptName
+	PlainText        = plainText
+	WriteTranscript  = writeTranscript
+	AppendTranscript = appendTranscript
+)
+
+func SetClipboardWriter(f func(string) error) (restore func()) {
+	prev := writeClipboard
+	writeClipboard = f
+
+	return func() { writeClipboard = prev }
+}
+
+func SetBannerRenderer(f func() string) (restore func()) {
+	prev := renderBanner
+	renderBanner = f
+
+	return func() { renderBanner = prev }
+}
+
+func (m *model) ViewportHeight() int { return m.viewport.Height }
+
+func (m *model) SetResponses(rs ...string) { m.responses = rs }
+
+func (m *model) CopyLastResponse() { m.copyLastResponse() }
+
+func (m *model) FocusModelList() { m.focus(focusModelList) }
+
+func (m *model) Focus() string { return m.currentFocus.String() }
+
+func (m *model) ModelsFiltered() bool { return m.modelList.FilterState() != list.Unfiltered }
+
+// StreamUsage feeds the usage of a turn to the model as a streamed chunk
+// and returns the usage and cost shown in the footer.
+func (m *model) StreamUsage(u prompt.Usage) (usage, cost string) {
+	m.Update(streamChunk{chunk: chunk{Usage: &u}})
+	return m.usageStatus(), m.costStatus()
+}
+
+func (m *model) Footer() (info, err string) { return m.lastInfo, m.lastErr }
+
+func (m *model) History() string { return m.historyBuilder.String() }
+
+func (m *model) Responses() []string { return m.responses }
+
+// StreamResponse feeds chunks to the model as a streamed
+// answer and returns the response built from them.
+func (m *model) StreamResponse(chunks ...string) string {
+	for _, c := range chunks {
+		m.Update(streamChunk{chunk: chunk{Content: c}})
+	}
+
+	return m.responseBuilder.String()
+}
+
+// StreamReasoning feeds reasoning sent apart from the content to the model,
+// followed by the content chunks, and returns the reasoning shown while it
+// streamed and the response built from the content.
+func (m *model) StreamReasoning(reasoning []string, chunks ...string) (shown, response string) {
+	for _, r := range reasoning {
+		m.Update(streamChunk{chunk: chunk{Reasoning: r}})
+	}
+
+	shown = m.reasoningBuilder.String()
+
+	return shown, m.StreamResponse(chunks...)
+}
+
+// StartRAG runs a single turn for q and returns the number of
+// retrieved chunks and the streamed answer.
+func (m *model) StartRAG(q string) (hits int, answer string, err error) {
+	switch msg := m.startRAGCmd(context.Background(), q)().(type) {
+	case ragErr:
+		return 0, "", msg.err
+	case ragReady:
+		var b strings.Builder
+
+		for c := range msg.ch {
+			if c.Err != nil {
+				if errors.Is(c.Err, io.EOF) {
+					break
+				}
+
+				return 0, "", c.Err
+			}
+
+			b.WriteString(c.Content)
+		}
+
+		return len(msg.hits), b.String(), nil
+	default:
+		return 0, "", fmt.Errorf("unexpected message: %T", msg)
+	}
+}
+
+// Preview previews the user prompt of q, as shown on the preview key.
+func (m *model) Preview(q string) (prompt.Preview, error) {
+	msg, ok := m.previewCmd(q)().(previewMsg)
+	if !ok {
+		return prompt.Preview{}, errors.New("unexpected message")
+	}
+
+	return msg.preview, msg.err
+}
@@ -8,7 +8,9 @@ import (
 	"io"
 	"strings"
 	"time"
+	"unicode"
 
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
 	"github.com/ladzaretti/ragx-cli/llm"
 	"github.com/ladzaretti/ragx-cli/types"
 	"github.com/ladzaretti/ragx-cli/vecdb"
@@ -26,9 +28,6 @@ const (
 	listWidth      = 24
 	textareaHeight = 2
 	statusBarLines = 1
-
-	reasoningStartTag = "<think>"
-	reasoningEndTag   = "</think>"
 )
 
 // model is the bubbletea model that drives the chat interface.
@@ -40,6 +39,7 @@ type model struct {
 	spinner         spinner.Model
 	thinkingSpinner spinner.Model
 	modelList       list.Model
+	sources         viewport.Model
 
 	// chat session
 
@@ -50,11 +50,14 @@ type model struct {
 	historyBuilder   strings.Builder
 	responseBuilder  strings.Builder
 	reasoningBuilder strings.Builder
+	reasoningScanner prompt.ReasoningScanner
+	responses        []string // plain text of each completed assistant turn
 
 	// focus management
 
 	currentFocus focus
 	prefixActive bool
+	keys         types.KeysConfig // configured key bindings, see [types.KeysConfig.Key]
 
 	// state
 
@@ -62,16 +65,29 @@ type model struct {
 	reasoning     bool
 	reasoningDone bool
 	reasoningShow bool
+	reasoningSep  bool // reasoningSep reports whether the reasoning is sent apart from the content.
 	asciiShow     bool
 	selectedModel string
 	contextUsed   llm.ContextUsage
-	cancel        context.CancelFunc // cancel for the in-flight LLM request
-	lastErr       string             // shown in footer when non-empty
+	lastUsage     *prompt.Usage        // token usage of the last turn
+	sessionCost   float64              // running cost of the session turns
+	hits          []vecdb.SearchResult // chunks retrieved for the last query
+	lastInfo      string               // shown in footer when non-empty and there is no error
+
+	// transcript
+
+	output         types.OutputConfig // formatting of retrieval distances
+	transcriptPath string             // appended with every completed turn when set
+	turnStart      int                // offset of the current turn in historyBuilder
+	cancel         context.CancelFunc // cancel for the in-flight LLM request
+	lastErr        string             // shown in footer when non-empty
 
 	// layout
 
 	width         int
 	height        int
+	wrapWidth     int    // width the viewport content was last wrapped at
+	banner        string // rendered ascii banner, cached across layouts
 	listWidth     int
 	legendHeight  int
 	legendWrapped string
@@ -87,6 +103,7 @@ const (
 	focusTextarea
 	focusViewport
 	focusModelList
+	focusSources
 )
 
 func (f focus) String() string {
@@ -95,6 +112,8 @@ func (f focus) String() string {
 		return "history"
 	case focusModelList:
 		return "models"
+	case focusSources:
+		return "sources"
 	case focusTextarea:
 		return "insert"
 	default:
@@ -111,6 +130,8 @@ func (f focus) style() lipgloss.Style {
 		return historyStatusStyle
 	case focusModelList:
 		return modelsStatusStyle
+	case focusSources:
+		return sourcesStatusStyle
 	default:
 		return defaultStatusStyle
 	}
@@ -135,15 +156,62 @@ type LLMConfig struct {
 	DefaultModel       string              // DefaultModel is the model used for chat/generation when none is specified.
 	UserPromptTmpl     string              // UserPromptTmpl is a go template used to build the user query + context.
 	EmbeddingModel     string              // EmbeddingModel is the model used to produce embeddings.
+	EmbeddingDims      *int                // EmbeddingDims optionally requests a reduced embedding size.
 	RetrievalTopK      int                 // RetrievalTopK is the number of results to fetch from the vector DB for RAG. Use 0 to disable retrieval.
+	RetrievalMinScore  float64             // RetrievalMinScore drops results scoring below it, see [vecdb.Score]. Use 0 to keep all.
 	DefaultContext     int                 // DefaultContext is the fallback maximum context length (in tokens).
+	ModelContexts      map[string]int      // ModelContexts holds the provider reported context lengths of models not configuring one.
+	ContextReserve     int                 // ContextReserve is the part of the context (in tokens) not filled with retrieved chunks.
 	DefaultTemperature *float64            // DefaultTemperature is the fallback sampling temperature.
 }
 
+// Option configures the chat [model].
+type Option func(*model)
+
+// WithOutput sets the output config, used to format retrieval distances.
+func WithOutput(cfg types.OutputConfig) Option {
+	return func(m *model) {
+		m.output = cfg
+	}
+}
+
+// WithKeys sets the key bindings of the chat actions.
+// Actions without a configured key keep their default.
+func WithKeys(keys types.KeysConfig) Option {
+	return func(m *model) {
+		m.keys = keys
+	}
+}
+
+// WithTranscript appends every completed chat turn to the file at path.
+func WithTranscript(path string) Option {
+	return func(m *model) {
+		m.transcriptPath = path
+	}
+}
+
+// WithHistory replays the messages of a restored chat session into the chat
+// history, as if their turns were sent to llmModel.
+func WithHistory(llmModel string, msgs []llm.HistoryMessage) Option {
+	return func(m *model) {
+		for _, msg := range msgs {
+			switch msg.Role {
+			case "user":
+				m.ensureHistoryNewline()
+				m.writeHistory(userPrefixStyle.Render("you:") + " " + msg.Content + "\n")
+			case "assistant":
+				m.ensureHistoryNewline()
+				m.writeHistory(llmPrefixStyle.Render("llm("+llmModel+"): ") + msg.Content)
+				m.responses = append(m.responses, strings.TrimSpace(plainText(msg.Content)))
+			default:
+			}
+		}
+	}
+}
+
 // New creates a new [model].
-func New(providers types.Providers, vecdb *vecdb.VectorDB, llmConfig LLMConfig) *model {
+func New(providers types.Providers, vecdb *vecdb.VectorDB, llmConfig LLMConfig, opts ...Option) *model {
 	ta := textarea.New()
-	ta.Placeholder = "Ask anything\n(Press Ctrl+S to submit)"
 	ta.Focus()
 	ta.Prompt = ""
 	ta.FocusedStyle.CursorLine = lipgloss.NewStyle()
@@ -194,7 +262,7 @@ func New(providers types.Providers, vecdb *vecdb.VectorDB, llmConfig LLMConfig)
 	lm := list.New(items, simpleDelegate{}, lw, 10)
 	lm.Title = "MODEL SELECT"
 	lm.Select(selectedIndex)
-	lm.SetFilteringEnabled(false)
+	lm.SetFilteringEnabled(true)
 	lm.SetShowStatusBar(false)
 	lm.SetShowHelp(false)
 	lm.Styles.Title = lipgloss.NewStyle().
@@ -202,13 +270,18 @@ func New(providers types.Providers, vecdb *vecdb.VectorDB, llmConfig LLMConfig)
 		PaddingRight(1).
 		Foreground(lipgloss.Color(mochaLavender)).
 		Background(lipgloss.Color(mochaSurface0))
+	lm.FilterInput.PromptStyle = lipgloss.NewStyle().
+		PaddingLeft(1).
+		Foreground(lipgloss.Color(mochaLavender))
+	lm.FilterInput.Cursor.Style = lipgloss.NewStyle().Foreground(lipgloss.Color(mochaLavender))
 
-	return &model{
+	m := &model{
 		providers:       providers,
 		vecdb:           vecdb,
 		llmConfig:       llmConfig,
 		selectedModel:   selectedModel,
 		viewport:        viewport.New(0, 0),
+		sources:         viewport.New(0, 0),
 		modelList:       lm,
 		listWidth:       lw,
 		textarea:        ta,
@@ -219,10 +292,21 @@ func New(providers types.Providers, vecdb *vecdb.VectorDB, llmConfig LLMConfig)
 		legendHeight:    1,
 		currentFocus:    focusTextarea,
 	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	m.textarea.Placeholder = "Ask anything, or start with ! to skip retrieval\n(Press " + keyName(m.keys.Key(types.KeySubmit)) + " to submit)"
+
+	return m
 }
 
 func (*model) Init() tea.Cmd { return textinput.Blink }
 
+// SelectedModel returns the model selected for chatting.
+func (m *model) SelectedModel() string { return m.selectedModel }
+
 func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:cyclop,gocognit
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -262,16 +346,41 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:cyclop,gocog
 
 		return m, nil
 
+	case InfoMsg:
+		m.lastErr, m.lastInfo = "", strings.ToUpper(string(msg))
+
+		return m, nil
 	case ragErr:
 		m.loading = false
 		m.lastErr = strings.ToUpper(msg.err.Error())
 		m.updateViewport()
 
+		return m, nil
+	case previewMsg:
+		if msg.err != nil {
+			m.lastErr = strings.ToUpper(msg.err.Error())
+			return m, nil
+		}
+
+		m.lastErr, m.lastInfo = "", strings.ToUpper("preview: "+msg.preview.String())
+
 		return m, nil
 	case ragReady:
+		m.hits = msg.hits
+		m.updateSources()
+
+		if msg.dropped > 0 {
+			m.lastInfo = strings.ToUpper(fmt.Sprintf("dropped %d of %d chunks exceeding the context", msg.dropped, len(msg.hits)))
+		}
+
 		return m, waitChunk(msg.ch)
 
 	case streamChunk:
+		if msg.Usage != nil {
+			m.addUsage(*msg.Usage)
+			return m, waitChunk(msg.ch)
+		}
+
 		if m.loading { // first chunk has arrived
 			prefix := llmPrefixStyle.Render("llm(" + m.selectedModel + "): ")
 			m.ensureHistoryNewline()
@@ -281,7 +390,12 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:cyclop,gocog
 		m.loading = false
 
 		if msg.Err != nil {
-			m.reasoning, m.reasoningDone = false, false
+			if errors.Is(msg.Err, io.EOF) {
+				m.writeStreamEvents(m.reasoningScanner.Flush())
+			}
+
+			m.reasoning, m.reasoningDone, m.reasoningSep = false, false, false
+			m.reasoningScanner = prompt.ReasoningScanner{}
 
 			switch {
 			case errors.Is(msg.Err, io.EOF):
@@ -299,7 +413,14 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:cyclop,gocog
 				}
 
 				m.writeHistory(m.responseBuilder.String())
+				m.responses = append(m.responses, strings.TrimSpace(plainText(m.responseBuilder.String())))
 				m.responseBuilder.Reset()
+				m.saveTurn()
+			case errors.Is(msg.Err, llm.ErrStreamCanceled):
+				// keep the partial answer visible, without an error in the footer
+				m.writeHistory(m.responseBuilder.String())
+				m.responseBuilder.Reset()
+				m.reasoningBuilder.Reset()
 			default:
 				m.lastErr = strings.ToUpper(msg.Err.Error())
 				m.reasoningBuilder.Reset()
@@ -308,25 +429,18 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:cyclop,gocog
 			return m, nil
 		}
 
-		reasoningStarted := false
+		if msg.Reasoning != "" {
+			return m, m.writeReasoningChunk(msg)
+		}
 
-		switch strings.TrimSpace(msg.Content) {
-		case reasoningStartTag:
-			m.reasoning, reasoningStarted = true, true
-		case reasoningEndTag:
-			m.reasoning, m.reasoningDone = false, true
+		// the first content chunk ends the reasoning sent apart from it
+		if m.reasoningSep {
+			m.reasoning, m.reasoningDone, m.reasoningSep = false, true, false
 			m.reasoningBuilder.Reset()
-		default:
-			// discard whitespaces-only chunk after reasoning is done.
-			if m.reasoningDone && strings.TrimSpace(msg.Content) == "" {
-				m.reasoningDone = false
-				return m, waitChunk(msg.ch)
-			}
-
-			m.writeResponseChunk(msg.Content)
-			m.updateViewport()
 		}
 
+		reasoningStarted := m.writeStreamEvents(m.reasoningScanner.Scan(msg.Content))
+
 		if m.currentFocus != focusViewport {
 			m.viewport.GotoBottom()
 		}
@@ -364,7 +478,7 @@ func (m *model) defaultUpdate(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m *model) View() string {
 	left := []string{m.viewport.View()}
 	if m.asciiShow {
-		left = append([]string{asciiComponentView}, left...)
+		left = append([]string{m.bannerView()}, left...)
 	}
 
 	main := lipgloss.JoinVertical(lipgloss.Left, left...)
@@ -378,9 +492,12 @@ func (m *model) View() string {
 		legendItemStyle.Render(strings.ToUpper(modeLabel)),
 	}
 
-	if m.lastErr != "" {
+	switch {
+	case m.lastErr != "":
 		footerItems = append(footerItems, errorStatusStyle.Render(m.lastErr))
-	} else {
+	case m.lastInfo != "":
+		footerItems = append(footerItems, infoStatusStyle.Render(m.lastInfo))
+	default:
 		var (
 			context          = cmp.Or(m.contextUsed.Max, m.llmConfig.DefaultContext)
 			used, percentage = m.contextUsed.Used, 0
@@ -395,6 +512,14 @@ func (m *model) View() string {
 			truncate(embedSelectedModelStatusStyle, m.llmConfig.EmbeddingModel, 22),
 			contextStatusStyle.Render(fmt.Sprintf("Ctx %d%%", percentage)),
 		)
+
+		if usage := m.usageStatus(); usage != "" {
+			footerItems = append(footerItems, usageStatusStyle.Render(usage))
+		}
+
+		if cost := m.costStatus(); cost != "" {
+			footerItems = append(footerItems, costStatusStyle.Render(cost))
+		}
 	}
 
 	m.statusWrapped = barStyle.Width(m.width).
@@ -425,6 +550,10 @@ func (m *model) View() string {
 		return m.renderModelPopup()
 	}
 
+	if m.currentFocus == focusSources {
+		return m.renderSourcesPopup()
+	}
+
 	return b.String()
 }
 
@@ -436,15 +565,18 @@ func (m *model) handleKey(k tea.KeyMsg) (tea.Model, tea.Cmd) { //nolint:cyclop
 	case "ctrl+c":
 		return m, tea.Quit
 
-	case "ctrl+n":
+	case m.keys.Key(types.KeyNewChat):
 		m.historyBuilder.Reset()
+		m.responses = m.responses[:0]
+		m.turnStart = 0
 		m.viewport.SetContent("")
 		m.contextUsed.Used = 0
+		m.resetUsage()
 		m.focus(focusTextarea)
 
 		return m, textinput.Blink
 
-	case "ctrl+a":
+	case m.keys.Key(types.KeyPrefix):
 		m.prefixActive = !m.prefixActive
 
 		if m.prefixActive {
@@ -461,7 +593,7 @@ func (m *model) handleKey(k tea.KeyMsg) (tea.Model, tea.Cmd) { //nolint:cyclop
 
 		return m, tea.Batch(cmd, textinput.Blink)
 
-	case "esc": //nolint:goconst
+	case m.keys.Key(types.KeyCancel):
 		if m.prefixActive {
 			m.prefixActive = false
 
@@ -471,13 +603,13 @@ func (m *model) handleKey(k tea.KeyMsg) (tea.Model, tea.Cmd) { //nolint:cyclop
 			return m, textinput.Blink
 		}
 
-	case "ctrl+s":
+	case m.keys.Key(types.KeySubmit):
 		if m.loading {
 			return m, nil
 		}
 
 		prompt := strings.TrimSpace(m.textarea.Value())
-		if prompt == "" {
+		if strings.TrimSpace(strings.TrimPrefix(prompt, noRetrievalPrefix)) == "" {
 			return m, nil
 		}
 
@@ -496,6 +628,8 @@ func (m *model) handleKey(k tea.KeyMsg) (tea.Model, tea.Cmd) { //nolint:cyclop
 		return m.handleViewport(k)
 	case focusModelList:
 		return m.handleModelList(k)
+	case focusSources:
+		return m.handleSources(k)
 	case focusTextarea:
 		return m.handleTextarea(k)
 	default:
@@ -507,25 +641,68 @@ func (m *model) handleKey(k tea.KeyMsg) (tea.Model, tea.Cmd) { //nolint:cyclop
 //nolint:unparam
 var prefixMap = map[string]func(*model) (tea.Model, tea.Cmd){
 	"q": func(m *model) (tea.Model, tea.Cmd) { return m, tea.Quit },
-	"h": func(m *model) (tea.Model, tea.Cmd) { m.focus(focusViewport); return m, nil },
-	"m": func(m *model) (tea.Model, tea.Cmd) { m.focus(focusModelList); return m, nil },
+	"s": func(m *model) (tea.Model, tea.Cmd) {
+		if m.currentFocus == focusSources {
+			m.focus(focusTextarea)
+			return m, textinput.Blink
+		}
+
+		m.updateSources()
+		m.focus(focusSources)
+
+		return m, nil
+	},
 	"a": func(m *model) (tea.Model, tea.Cmd) {
 		m.asciiShow = !m.asciiShow
 		m.focus(focusTextarea)
 
-		resize := func() tea.Msg {
-			return tea.WindowSizeMsg{Width: m.width, Height: m.height}
-		}
+		// only the viewport height depends on the banner,
+		// so there is no need for a full resize round trip.
+		m, cmd := m.updateLayout(layoutMsg{
+			Width:  m.width,
+			Height: m.height,
+		})
 
-		return m, tea.Batch(textinput.Blink, resize)
+		return m, tea.Batch(cmd, textinput.Blink)
 	},
 	"r": func(m *model) (tea.Model, tea.Cmd) {
 		m.reasoningShow = !m.reasoningShow
 		m.focus(focusTextarea)
 		return m, textinput.Blink
 	},
-	"l": func(m *model) (tea.Model, tea.Cmd) {
+	"w": func(m *model) (tea.Model, tea.Cmd) {
+		m.saveHistory()
+		m.focus(focusTextarea)
+		return m, textinput.Blink
+	},
+	"y": func(m *model) (tea.Model, tea.Cmd) {
+		m.copyLastResponse()
+		m.focus(focusTextarea)
+		return m, textinput.Blink
+	},
+	"p": func(m *model) (tea.Model, tea.Cmd) {
+		m.focus(focusTextarea)
+
+		query := strings.TrimSpace(m.textarea.Value())
+		if strings.TrimSpace(strings.TrimPrefix(query, noRetrievalPrefix)) == "" {
+			return m, textinput.Blink
+		}
+
+		return m, tea.Batch(textinput.Blink, m.previewCmd(query))
+	},
+}
+
+// prefixActions are the prefix key actions with configurable keys, by action.
+// Their keys take precedence over the fixed keys of [prefixMap].
+//
+//nolint:unparam
+var prefixActions = map[string]func(*model) (tea.Model, tea.Cmd){
+	types.KeyHistory: func(m *model) (tea.Model, tea.Cmd) { m.focus(focusViewport); return m, nil },
+	types.KeyModels:  func(m *model) (tea.Model, tea.Cmd) { m.focus(focusModelList); return m, nil },
+	types.KeyClear: func(m *model) (tea.Model, tea.Cmd) {
 		m.historyBuilder.Reset()
+		m.responses = m.responses[:0]
+		m.turnStart = 0
 		m.viewport.SetContent("")
 		m.focus(focusTextarea)
 		return m, textinput.Blink
@@ -534,6 +711,13 @@ var prefixMap = map[string]func(*model) (tea.Model, tea.Cmd){
 
 func (m *model) handlePrefixKey(k string) (tea.Model, tea.Cmd) {
 	m.prefixActive = false
+
+	for _, action := range types.KeyActions {
+		if f, ok := prefixActions[action]; ok && m.keys.Key(action) == k {
+			return f(m)
+		}
+	}
+
 	if f, ok := prefixMap[k]; ok {
 		return f(m)
 	}
@@ -550,7 +734,7 @@ func (m *model) handlePrefixKey(k string) (tea.Model, tea.Cmd) {
 
 func (m *model) handleViewport(k tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch k.String() {
-	case "esc":
+	case "esc": //nolint:goconst
 		m.focus(focusTextarea)
 
 		return m, textinput.Blink
@@ -565,6 +749,9 @@ func (m *model) handleViewport(k tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// handleModelList selects the highlighted model on enter or esc, even while
+// filtering. Any other key, including "/" to start filtering and the typed
+// filter text, is passed through to the list.
 func (m *model) handleModelList(k tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch k.String() {
 	case "esc", "enter":
@@ -572,6 +759,7 @@ func (m *model) handleModelList(k tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.selectedModel = string(it)
 		}
 
+		m.resetModelFilter()
 		m.focus(focusTextarea)
 
 		return m, textinput.Blink
@@ -581,13 +769,44 @@ func (m *model) handleModelList(k tea.KeyMsg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 
 	m.modelList, cmd = m.modelList.Update(k)
+	m.refreshLegend()
 
 	return m, cmd
 }
 
-func (m *model) handleTextarea(k tea.KeyMsg) (tea.Model, tea.Cmd) {
+// resetModelFilter clears the model list filter and moves
+// the cursor back onto the selected model.
+func (m *model) resetModelFilter() {
+	m.modelList.ResetFilter()
+
+	for i, it := range m.modelList.Items() {
+		if it, ok := it.(listItem); ok && string(it) == m.selectedModel {
+			m.modelList.Select(i)
+			break
+		}
+	}
+}
+
+func (m *model) handleSources(k tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch k.String() {
 	case "esc":
+		m.focus(focusTextarea)
+
+		return m, textinput.Blink
+
+	default:
+	}
+
+	var cmd tea.Cmd
+
+	m.sources, cmd = m.sources.Update(k)
+
+	return m, cmd
+}
+
+func (m *model) handleTextarea(k tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch k.String() {
+	case m.keys.Key(types.KeyCancel):
 		if m.cancel != nil {
 			m.cancel()
 			m.cancel = nil
@@ -620,8 +839,10 @@ func (m *model) sendPrompt(q string) (tea.Model, tea.Cmd) {
 
 	m.loading = true
 	m.lastErr = ""
+	m.lastInfo = ""
 
 	m.ensureHistoryNewline()
+	m.turnStart = m.historyBuilder.Len()
 	m.writeHistory(userPrefixStyle.Render("you:") + " " + q + "\n")
 	m.updateViewport()
 
@@ -653,13 +874,24 @@ func (m *model) updateLayout(w tea.WindowSizeMsg) (tea.Model, tea.Cmd) {
 	m.viewport.Height = max(availHeight, 1)
 	m.modelList.SetSize(m.listWidth, availHeight)
 
-	wrapped := lipgloss.NewStyle().Width(m.viewport.Width).Render(m.historyBuilder.String())
-
-	m.viewport.SetContent(wrapped)
+	// re-wrapping the content is only needed when the width changes.
+	if m.wrapWidth != m.viewport.Width {
+		m.wrapWidth = m.viewport.Width
+		m.updateViewport()
+	}
 
 	return m, nil
 }
 
+// bannerView returns the ascii banner, rendering it on first use.
+func (m *model) bannerView() string {
+	if m.banner == "" {
+		m.banner = renderBanner()
+	}
+
+	return m.banner
+}
+
 func (m *model) updateViewport() {
 	view := m.historyBuilder.String()
 
@@ -709,23 +941,35 @@ func (m *model) legend() string {
 	switch {
 	case m.prefixActive:
 		return lipgloss.JoinHorizontal(lipgloss.Left,
-			legendItem("H", "HISTORY"), divider,
+			legendItem(m.keyLabel(types.KeyHistory), "HISTORY"), divider,
 			legendItem("R", m.reasoningLegendLabel()), divider,
-			legendItem("M", "CHANGE MODEL"), divider,
-			legendItem("L", "CLEAR"), divider,
+			legendItem(m.keyLabel(types.KeyModels), "CHANGE MODEL"), divider,
+			legendItem("S", "SOURCES"), divider,
+			legendItem(m.keyLabel(types.KeyClear), "CLEAR"), divider,
+			legendItem("W", "SAVE"), divider,
+			legendItem("Y", "COPY"), divider,
+			legendItem("P", "PREVIEW"), divider,
 			legendItem("A", m.asciiLegendLabel()), divider,
 			legendItem("Q", "QUIT"), divider,
+			legendItem(m.keyLabel(types.KeyCancel), "CANCEL"),
+		)
+
+	case m.currentFocus == focusModelList && m.modelList.SettingFilter():
+		return lipgloss.JoinHorizontal(lipgloss.Left,
+			legendItem("▲ ▼", "SCROLL"), divider,
+			legendItem("ENTER", "SELECT MODEL"), divider,
 			legendItem("ESC", "CANCEL"),
 		)
 
 	case m.currentFocus == focusModelList:
 		return lipgloss.JoinHorizontal(lipgloss.Left,
 			legendItem("▲/K ▼/J", "SCROLL"), divider,
+			legendItem("/", "FILTER"), divider,
 			legendItem("ENTER", "SELECT MODEL"), divider,
 			legendItem("ESC", "CANCEL"),
 		)
 
-	case m.currentFocus == focusViewport:
+	case m.currentFocus == focusViewport, m.currentFocus == focusSources:
 		return lipgloss.JoinHorizontal(lipgloss.Left,
 			legendItem("▲/K ▼/J", "SCROLL"), divider,
 			legendItem("ESC", "BACK"),
@@ -733,19 +977,46 @@ func (m *model) legend() string {
 
 	default:
 		return lipgloss.JoinHorizontal(lipgloss.Left,
-			legendItem("^S", "SEND"), divider,
-			legendItem("ESC", "CANCEL"), divider,
-			legendItem("^A", "PREFIX"), divider,
-			legendItem("^N", "NEW CHAT"), divider,
+			legendItem(m.keyLabel(types.KeySubmit), "SEND"), divider,
+			legendItem(m.keyLabel(types.KeyCancel), "CANCEL"), divider,
+			legendItem(m.keyLabel(types.KeyPrefix), "PREFIX"), divider,
+			legendItem(m.keyLabel(types.KeyNewChat), "NEW CHAT"), divider,
 			legendItem("^C", "QUIT"),
 		)
 	}
 }
 
+// keyLabel returns the legend label of the key bound to action,
+// e.g. "^S" for ctrl+s.
+func (m *model) keyLabel(action string) string {
+	k := m.keys.Key(action)
+
+	if rest, ok := strings.CutPrefix(k, "ctrl+"); ok {
+		return "^" + strings.ToUpper(rest)
+	}
+
+	return strings.ToUpper(k)
+}
+
+// keyName formats a key for prose, e.g. "Ctrl+S" for ctrl+s.
+func keyName(k string) string {
+	parts := strings.Split(k, "+")
+
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+
+	return strings.Join(parts, "+")
+}
+
 func (m *model) renderModelPopup() string {
 	w, h := m.width, m.height
 
 	listW := clamp(30, 54, w-12)
+	// the title row doubles as the filter input row,
+	// so filtering needs no extra height.
 	listH := clamp(8, 16, h-8)
 
 	m.modelList.SetSize(listW, listH)
@@ -755,6 +1026,44 @@ func (m *model) renderModelPopup() string {
 	return lipgloss.Place(w, h, lipgloss.Center, lipgloss.Center, modal)
 }
 
+// updateSources renders the chunks retrieved for the last query
+// into the sources viewport.
+func (m *model) updateSources() {
+	if len(m.hits) == 0 {
+		m.sources.SetContent(dimStyle.Render("no sources retrieved"))
+		return
+	}
+
+	var b strings.Builder
+
+	for i, h := range m.hits {
+		source, index := prompt.DecodeMeta(h.Meta)
+
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+
+		fmt.Fprintf(&b, "%2d. %s:%d %s", i+1, source, index,
+			sourceDistanceStyle.Render("("+m.output.FormatDistance(h.Distance)+")"))
+	}
+
+	m.sources.SetContent(b.String())
+	m.sources.GotoTop()
+}
+
+func (m *model) renderSourcesPopup() string {
+	w, h := m.width, m.height
+
+	m.sources.Width = clamp(30, 80, w-12)
+	m.sources.Height = clamp(4, 20, h-10)
+
+	title := modalTitleStyle.Render(fmt.Sprintf("SOURCES (%d)", len(m.hits)))
+
+	modal := modalFrameStyle.Render(lipgloss.JoinVertical(lipgloss.Left, title, "", m.sources.View()))
+
+	return lipgloss.Place(w, h, lipgloss.Center, lipgloss.Center, modal)
+}
+
 func clamp(minV, maxV, v int) int {
 	if v < minV {
 		return minV
@@ -795,12 +1104,100 @@ func (m *model) writeHistory(s string) {
 	m.historyBuilder.WriteString(s)
 }
 
-func (m *model) writeResponseChunk(s string) {
-	if m.reasoning {
-		m.reasoningBuilder.WriteString(s)
-	} else {
-		m.responseBuilder.WriteString(s)
+// saveHistory writes the chat history to a timestamped transcript file
+// in the working directory, reporting the outcome in the footer.
+func (m *model) saveHistory() {
+	path := transcriptName(time.Now())
+
+	if err := writeTranscript(path, m.historyBuilder.String()); err != nil {
+		m.lastErr = strings.ToUpper(err.Error())
+		return
+	}
+
+	m.lastErr, m.lastInfo = "", "SAVED "+path
+}
+
+// copyLastResponse copies the last assistant response to the system clipboard,
+// reporting the outcome in the footer.
+func (m *model) copyLastResponse() {
+	if len(m.responses) == 0 {
+		m.lastErr = "NO RESPONSE TO COPY"
+		return
+	}
+
+	if err := writeClipboard(m.responses[len(m.responses)-1]); err != nil {
+		m.lastErr = strings.ToUpper("copy: " + err.Error())
+		return
+	}
+
+	m.lastErr, m.lastInfo = "", "COPIED LAST RESPONSE"
+}
+
+// saveTurn appends the last completed turn to the transcript file, if any.
+func (m *model) saveTurn() {
+	if m.transcriptPath == "" {
+		return
+	}
+
+	history := m.historyBuilder.String()
+	if m.turnStart > len(history) {
+		return
+	}
+
+	if err := appendTranscript(m.transcriptPath, history[m.turnStart:]+"\n"); err != nil {
+		m.lastErr = strings.ToUpper(err.Error())
+	}
+}
+
+// writeStreamEvents writes the reasoning and the answer content of events,
+// discarding the white space between them, and reports whether reasoning started.
+func (m *model) writeStreamEvents(events []prompt.ReasoningEvent) (reasoningStarted bool) {
+	for _, e := range events {
+		switch e.Kind {
+		case prompt.EventReasoningStart:
+			m.reasoning, reasoningStarted = true, true
+		case prompt.EventReasoningEnd:
+			m.reasoning, m.reasoningDone = false, true
+			m.reasoningBuilder.Reset()
+		case prompt.EventReasoning:
+			m.reasoningBuilder.WriteString(e.Text)
+		case prompt.EventContent:
+			text := e.Text
+			if m.reasoningDone {
+				if text = strings.TrimLeftFunc(text, unicode.IsSpace); text == "" {
+					continue
+				}
+
+				m.reasoningDone = false
+			}
+
+			m.responseBuilder.WriteString(text)
+		}
 	}
+
+	m.updateViewport()
+
+	return reasoningStarted
+}
+
+// writeReasoningChunk writes a chunk of reasoning sent apart from the content,
+// rather than inline between reasoning tags.
+func (m *model) writeReasoningChunk(msg streamChunk) tea.Cmd {
+	cmds := []tea.Cmd{waitChunk(msg.ch)}
+
+	if !m.reasoning {
+		m.reasoning, m.reasoningSep = true, true
+		cmds = append(cmds, m.thinkingSpinner.Tick)
+	}
+
+	m.reasoningBuilder.WriteString(msg.Reasoning)
+	m.updateViewport()
+
+	if m.currentFocus != focusViewport {
+		m.viewport.GotoBottom()
+	}
+
+	return tea.Batch(cmds...)
 }
 
 func (m *model) reasoningLegendLabel() string {
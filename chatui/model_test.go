@@ -0,0 +1,183 @@
+package chatui_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/chatui"
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/types"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// filterMatches runs cmd and returns the model list filter results
+// among its messages, without waiting on the cursor blink commands.
+func filterMatches(t *testing.T, cmd tea.Cmd) list.FilterMatchesMsg {
+	t.Helper()
+
+	ch := make(chan list.FilterMatchesMsg, 1)
+
+	var run func(tea.Cmd)
+
+	run = func(cmd tea.Cmd) {
+		if cmd == nil {
+			return
+		}
+
+		switch msg := cmd().(type) {
+		case tea.BatchMsg:
+			for _, c := range msg {
+				go run(c)
+			}
+		case list.FilterMatchesMsg:
+			ch <- msg
+		}
+	}
+
+	go run(cmd)
+
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for filter matches")
+	}
+
+	return nil
+}
+
+func TestModelList_Filter(t *testing.T) {
+	providers := types.Providers{
+		{AvailableModels: []string{"llama3:8b", "qwen2.5:14b"}},
+		{AvailableModels: []string{"mistral", "qwen2.5:7b"}},
+	}
+
+	m := chatui.New(providers, nil, chatui.LLMConfig{DefaultModel: "llama3:8b"})
+	m.FocusModelList()
+
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("/")})
+
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("qwen2.5:7")})
+	m.Update(filterMatches(t, cmd))
+
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	if got, want := m.SelectedModel(), "qwen2.5:7b"; got != want {
+		t.Errorf("want selected model: %q, got: %q", want, got)
+	}
+
+	if m.ModelsFiltered() {
+		t.Error("want the filter reset after selecting a model")
+	}
+}
+
+func TestLayout_BannerRenderedOnce(t *testing.T) {
+	renders := 0
+
+	restore := chatui.SetBannerRenderer(func() string {
+		renders++
+		return "banner"
+	})
+	t.Cleanup(restore)
+
+	m := chatui.New(types.Providers{}, nil, chatui.LLMConfig{})
+
+	for _, w := range []int{80, 100, 60} {
+		m.Update(tea.WindowSizeMsg{Width: w, Height: 40})
+		m.View()
+	}
+
+	withBanner := m.ViewportHeight()
+
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlA})
+
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	if resized(cmd) {
+		t.Error("want no synthetic resize when toggling the banner")
+	}
+
+	m.View()
+
+	if got := m.ViewportHeight(); got <= withBanner {
+		t.Errorf("want the viewport to grow when the banner is hidden, got height: %d, was: %d", got, withBanner)
+	}
+
+	if renders != 1 {
+		t.Errorf("want the banner rendered once, got: %d", renders)
+	}
+}
+
+// resized reports whether cmd, or any command it batches,
+// yields a [tea.WindowSizeMsg]. Cursor blink commands are skipped.
+func resized(cmd tea.Cmd) bool {
+	if cmd == nil {
+		return false
+	}
+
+	ch := make(chan tea.Msg, 1)
+	go func() { ch <- cmd() }()
+
+	select {
+	case msg := <-ch:
+		switch msg := msg.(type) {
+		case tea.WindowSizeMsg:
+			return true
+		case tea.BatchMsg:
+			for _, c := range msg {
+				if resized(c) {
+					return true
+				}
+			}
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	return false
+}
+
+func TestKeys_Configured(t *testing.T) {
+	m := chatui.New(types.Providers{}, nil, chatui.LLMConfig{}, chatui.WithKeys(types.KeysConfig{
+		types.KeyPrefix:  "ctrl+x",
+		types.KeyHistory: "g",
+	}))
+
+	m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+
+	// the default history key is no longer bound
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlX})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("h")})
+
+	if got := m.Focus(); got != "insert" {
+		t.Fatalf("want focus: %q, got: %q", "insert", got)
+	}
+
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlX})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("g")})
+
+	if got := m.Focus(); got != "history" {
+		t.Errorf("want focus: %q, got: %q", "history", got)
+	}
+}
+
+func TestWithHistory(t *testing.T) {
+	msgs := []llm.HistoryMessage{
+		{Role: "user", Content: "foo"},
+		{Role: "assistant", Content: "bar"},
+		{Role: "user", Content: "baz"},
+		{Role: "assistant", Content: "qux"},
+	}
+
+	m := chatui.New(nil, nil, chatui.LLMConfig{}, chatui.WithHistory("model", msgs))
+
+	want := "you: foo\nllm(model): bar\nyou: baz\nllm(model): qux"
+	if got := chatui.PlainText(m.History()); got != want {
+		t.Errorf("want history:\n%q\ngot:\n%q", want, got)
+	}
+
+	if got := m.Responses(); !slices.Equal(got, []string{"bar", "qux"}) {
+		t.Errorf("want responses to copy: [bar qux], got: %q", got)
+	}
+}
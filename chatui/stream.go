@@ -1,14 +1,15 @@
 package chatui
 
 import (
-	"cmp"
 	"context"
-	"slices"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/ladzaretti/ragx-cli/cli/prompt"
 	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/ragx"
 	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
 )
 
 type chunk = prompt.Chunk
@@ -18,10 +19,24 @@ type streamChunk struct {
 	ch <-chan chunk
 }
 
-type ragReady struct{ ch <-chan chunk }
+type ragReady struct {
+	ch      <-chan chunk
+	hits    []vecdb.SearchResult
+	dropped int // dropped is the number of hits left out of the prompt to fit the context.
+}
 
 type ragErr struct{ err error }
 
+// previewMsg reports the preview of a user prompt, see [model.previewCmd].
+type previewMsg struct {
+	preview prompt.Preview
+	err     error
+}
+
+// InfoMsg is an informational message shown in the footer. It can be sent
+// to the running program from outside of it, e.g. by session callbacks.
+type InfoMsg string
+
 func waitChunk(ch <-chan chunk) tea.Cmd {
 	return func() tea.Msg {
 		c, ok := <-ch
@@ -33,62 +48,134 @@ func waitChunk(ch <-chan chunk) tea.Cmd {
 	}
 }
 
-func (m *model) startRAGCmd(ctx context.Context, query string) tea.Cmd {
-	var (
-		vdb      = m.vecdb
-		llmModel = m.selectedModel
-		config   = m.llmConfig
-	)
+// noRetrievalPrefix marks a prompt that is sent to the LLM as is,
+// without retrieving context for it (e.g. "!summarize your last answer").
+const noRetrievalPrefix = "!"
 
+func (m *model) startRAGCmd(ctx context.Context, query string) tea.Cmd {
 	provider, err := m.providers.ProviderFor(m.selectedModel)
 	if err != nil {
 		return func() tea.Msg { return ragErr{err} }
 	}
 
+	build := m.userPromptFunc(provider, query)
+
 	return func() tea.Msg {
-		q, err := provider.Client.Embed(ctx, llm.EmbedRequest{Input: query, Model: config.EmbeddingModel})
+		up, err := build(ctx)
 		if err != nil {
 			return ragErr{err}
 		}
 
+		ch := prompt.SendStream(ctx, provider.Session, m.chatRequest(up.prompt))
+
+		return ragReady{ch: ch, hits: up.hits, dropped: up.dropped}
+	}
+}
+
+// previewCmd builds the user prompt of query as submitting it would,
+// and reports its preview instead of sending it.
+func (m *model) previewCmd(query string) tea.Cmd {
+	provider, err := m.providers.ProviderFor(m.selectedModel)
+	if err != nil {
+		return func() tea.Msg { return previewMsg{err: err} }
+	}
+
+	var (
+		build  = m.userPromptFunc(provider, query)
+		mc, _  = m.modelConfig(m.selectedModel)
+		tokens = llm.ApproxTokenCounter{}
+	)
+
+	return func() tea.Msg {
+		up, err := build(context.Background())
+		if err != nil {
+			return previewMsg{err: err}
+		}
+
+		kept := up.hits[:len(up.hits)-up.dropped]
+
+		return previewMsg{preview: prompt.NewPreview(tokens, up.prompt, kept, mc.PriceIn)}
+	}
+}
+
+// userPrompt is the user prompt of a turn and the hits it was built from.
+type userPrompt struct {
+	prompt  string
+	hits    []vecdb.SearchResult
+	dropped int // dropped is the number of lowest ranked hits left out of the prompt to fit the context.
+}
+
+// userPromptFunc returns the func building the user prompt of query from
+// the context retrieved for it, unless retrieval is disabled or skipped.
+// The model state is read up front, so that the func can run in a command.
+func (m *model) userPromptFunc(provider types.Provider, query string) func(context.Context) (userPrompt, error) {
+	var (
+		vdb    = m.vecdb
+		config = m.llmConfig
+		budget = m.promptBudget()
+	)
+
+	if p, ok := strings.CutPrefix(query, noRetrievalPrefix); ok || config.RetrievalTopK == 0 {
+		return func(context.Context) (userPrompt, error) {
+			return userPrompt{prompt: strings.TrimSpace(p)}, nil
+		}
+	}
+
+	return func(ctx context.Context) (userPrompt, error) {
+		q, err := provider.Client.Embed(ctx, llm.EmbedRequest{
+			Input:      query,
+			Model:      config.EmbeddingModel,
+			Dimensions: config.EmbeddingDims,
+		})
+		if err != nil {
+			return userPrompt{}, err
+		}
+
 		hits, err := vdb.SearchKNN(toFloat32Slice(q.Vector), config.RetrievalTopK)
 		if err != nil {
-			return ragErr{err}
+			return userPrompt{}, err
 		}
 
+		hits = vecdb.FilterMinScore(hits, config.RetrievalMinScore)
+
 		opts := []prompt.PromptOpt{
 			prompt.WithUserPromptTmpl(config.UserPromptTmpl),
 		}
 
-		p, err := prompt.BuildUserPrompt(query, hits, prompt.DecodeMeta, opts...)
+		p, dropped, err := prompt.FitUserPrompt(query, hits, prompt.DecodeMeta, llm.ApproxTokenCounter{}, budget, opts...)
 		if err != nil {
-			return ragErr{err}
+			return userPrompt{}, err
 		}
 
-		var (
-			temperature   *float64
-			contextLength int
-		)
-
-		i := slices.IndexFunc(
-			m.llmConfig.Models,
-			func(m types.ModelConfig) bool { return m.ID == llmModel },
-		)
-		if i != -1 {
-			temperature = cmp.Or(m.llmConfig.Models[i].Temperature, m.llmConfig.DefaultTemperature)
-			contextLength = cmp.Or(m.llmConfig.Models[i].Context, m.llmConfig.DefaultContext)
-		}
+		return userPrompt{prompt: p, hits: hits, dropped: dropped}, nil
+	}
+}
 
-		req := llm.ChatCompletionRequest{
-			Model:         llmModel,
-			Temperature:   temperature,
-			ContextLength: contextLength,
-			Prompt:        p,
-		}
+// chatRequest builds a chat request for the selected model,
+// see [ragx.Models.ChatRequest].
+func (m *model) chatRequest(userPrompt string) llm.ChatCompletionRequest {
+	return m.models().ChatRequest(m.selectedModel, userPrompt)
+}
 
-		ch := prompt.SendStream(ctx, provider.Session, req)
+// promptBudget returns the tokens the user prompt of the selected model may
+// take: its context length less the reserve, or zero if its context length
+// is unknown or does not exceed the reserve.
+func (m *model) promptBudget() int {
+	return max(m.models().ContextLength(m.selectedModel)-m.llmConfig.ContextReserve, 0)
+}
+
+// modelConfig returns the configuration of the given model, if any.
+func (m *model) modelConfig(id string) (types.ModelConfig, bool) {
+	return m.models().Config(id)
+}
 
-		return ragReady{ch: ch}
+// models returns the chat settings of the configured models.
+func (m *model) models() ragx.Models {
+	return ragx.Models{
+		Configured:  m.llmConfig.Models,
+		Temperature: m.llmConfig.DefaultTemperature,
+		Context:     m.llmConfig.DefaultContext,
+		Detected:    m.llmConfig.ModelContexts,
 	}
 }
 
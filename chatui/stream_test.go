@@ -0,0 +1,261 @@
+package chatui_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/chatui"
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+const chatCompletionStream = `data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{"role":"assistant","content":"bar"},"finish_reason":null}]}
+
+data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`
+
+// fakeLLMServer serves the chat model "foo" and records the
+// embedding calls and the last prompt it receives.
+type fakeLLMServer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	embeds     int
+	lastPrompt string
+}
+
+func newFakeLLMServer(t *testing.T) *fakeLLMServer {
+	t.Helper()
+
+	var (
+		s   = &fakeLLMServer{}
+		mux = http.NewServeMux()
+	)
+
+	mux.HandleFunc("/v1/embeddings", func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		s.embeds++
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"object":"list","model":"bar","data":[{"object":"embedding","index":0,"embedding":[1,0]}]}`)
+	})
+
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		if n := len(req.Messages); n > 0 {
+			s.mu.Lock()
+			s.lastPrompt = req.Messages[n-1].Content
+			s.mu.Unlock()
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, chatCompletionStream)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *fakeLLMServer) stats() (embeds int, lastPrompt string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.embeds, s.lastPrompt
+}
+
+func TestStartRAG_SkipRetrieval(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		topK       int
+		wantEmbeds int
+		wantHits   int
+		wantPrompt func(string) bool
+	}{
+		{
+			name:       "retrieves context",
+			query:      "what is foo?",
+			topK:       3,
+			wantEmbeds: 1,
+			wantHits:   1,
+			wantPrompt: func(p string) bool { return strings.HasPrefix(p, "USER QUERY:") && strings.Contains(p, "TEXT: foo") },
+		},
+		{
+			name:       "prefix skips retrieval",
+			query:      "! summarize your last answer",
+			topK:       3,
+			wantEmbeds: 0,
+			wantHits:   0,
+			wantPrompt: func(p string) bool { return p == "summarize your last answer" },
+		},
+		{
+			name:       "zero top-k skips retrieval",
+			query:      "what is foo?",
+			topK:       0,
+			wantEmbeds: 0,
+			wantHits:   0,
+			wantPrompt: func(p string) bool { return p == "what is foo?" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeLLMServer(t)
+
+			logger := slog.New(slog.DiscardHandler)
+			client := llm.NewClient(llm.WithBaseURL(srv.URL+"/v1"), llm.WithLogger(logger))
+
+			providers := types.Providers{{
+				Client:          client,
+				Session:         llm.NewChat(client, "", llm.WithSessionLogger(logger)),
+				AvailableModels: []string{"foo", "bar"},
+			}}
+
+			db, err := vecdb.New(2)
+			if err != nil {
+				t.Fatalf("new vecdb: %v", err)
+			}
+
+			t.Cleanup(func() { _ = db.Close() })
+
+			if err := db.Insert([]vecdb.Chunk{{Content: "foo", Vec: vecdb.Vector{1, 0}}}); err != nil {
+				t.Fatalf("insert: %v", err)
+			}
+
+			m := chatui.New(providers, db, chatui.LLMConfig{
+				DefaultModel:   "foo",
+				EmbeddingModel: "bar",
+				UserPromptTmpl: prompt.DefaultUserPromptTmpl,
+				RetrievalTopK:  tt.topK,
+			})
+
+			hits, answer, err := m.StartRAG(tt.query)
+			if err != nil {
+				t.Fatalf("start rag: %v", err)
+			}
+
+			if answer != "bar" {
+				t.Errorf("want answer: %q, got: %q", "bar", answer)
+			}
+
+			if hits != tt.wantHits {
+				t.Errorf("want %d hits, got: %d", tt.wantHits, hits)
+			}
+
+			embeds, lastPrompt := srv.stats()
+
+			if embeds != tt.wantEmbeds {
+				t.Errorf("want %d embedding calls, got: %d", tt.wantEmbeds, embeds)
+			}
+
+			if !tt.wantPrompt(lastPrompt) {
+				t.Errorf("unexpected prompt: %q", lastPrompt)
+			}
+		})
+	}
+}
+
+func TestPreview(t *testing.T) {
+	srv := newFakeLLMServer(t)
+
+	logger := slog.New(slog.DiscardHandler)
+	client := llm.NewClient(llm.WithBaseURL(srv.URL+"/v1"), llm.WithLogger(logger))
+
+	providers := types.Providers{{
+		Client:          client,
+		Session:         llm.NewChat(client, "", llm.WithSessionLogger(logger)),
+		AvailableModels: []string{"foo", "bar"},
+	}}
+
+	db, err := vecdb.New(2)
+	if err != nil {
+		t.Fatalf("new vecdb: %v", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := db.Insert([]vecdb.Chunk{{Content: "foo", Vec: vecdb.Vector{1, 0}, Meta: vecdb.Meta{Source: "foo.md"}}}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	m := chatui.New(providers, db, chatui.LLMConfig{
+		Models:         []types.ModelConfig{{ID: "foo", PriceIn: 1}},
+		DefaultModel:   "foo",
+		EmbeddingModel: "bar",
+		UserPromptTmpl: prompt.DefaultUserPromptTmpl,
+		RetrievalTopK:  3,
+	})
+
+	p, err := m.Preview("what is foo?")
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+
+	if p.Chunks != 1 || len(p.Sources) != 1 || p.Sources[0] != "foo.md" {
+		t.Errorf("want a single chunk of foo.md, got: %+v", p)
+	}
+
+	if p.Tokens == 0 || p.Cost != float64(p.Tokens)/1000 {
+		t.Errorf("want the cost of %d tokens, got: %+v", p.Tokens, p)
+	}
+
+	if _, lastPrompt := srv.stats(); lastPrompt != "" {
+		t.Errorf("want no prompt sent, got: %q", lastPrompt)
+	}
+}
+
+func TestStreamResponse_WhitespaceAfterReasoning(t *testing.T) {
+	m := chatui.New(nil, nil, chatui.LLMConfig{})
+
+	got := m.StreamResponse("<think>", "hmm", "</think>", "\n", "\n\n", " ", "foo", "\n", "bar")
+
+	if want := "foo\nbar"; got != want {
+		t.Errorf("want response: %q, got: %q", want, got)
+	}
+}
+
+func TestStreamResponse_SeparateReasoning(t *testing.T) {
+	m := chatui.New(nil, nil, chatui.LLMConfig{})
+
+	shown, got := m.StreamReasoning([]string{"hmm", " ok"}, "\n\n", "foo", "\n", "bar")
+
+	if want := "hmm ok"; shown != want {
+		t.Errorf("want reasoning: %q, got: %q", want, shown)
+	}
+
+	if want := "foo\nbar"; got != want {
+		t.Errorf("want response: %q, got: %q", want, got)
+	}
+}
+
+func TestStreamResponse_SplitReasoningTags(t *testing.T) {
+	m := chatui.New(nil, nil, chatui.LLMConfig{})
+
+	got := m.StreamResponse("<th", "ink>hm", "m</thi", "nk>\n\nfoo", " bar")
+
+	if want := "foo bar"; got != want {
+		t.Errorf("want response: %q, got: %q", want, got)
+	}
+}
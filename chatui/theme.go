@@ -17,11 +17,14 @@ const (
 ╚═╝      ╚═╝  ╚═╝╚═╝  ╚═╝ ╚═════╝ ╚═╝  ╚═╝`
 )
 
-var asciiComponentView = lipgloss.NewStyle().
+var asciiStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.Color(mochaLavender)). // or mochaBlue
 	Bold(true).
-	PaddingLeft(1).
-	Render(ascii)
+	PaddingLeft(1)
+
+// renderBanner renders the ascii banner. The banner does not depend on
+// the layout, so it is rendered once per model and reused across resizes.
+var renderBanner = func() string { return asciiStyle.Render(ascii) }
 
 // catppuccin Mocha palette (hex codes).
 const (
@@ -41,6 +44,7 @@ const (
 	mochaLavender = "#b4befe"
 	mochaPeach    = "#fab387"
 	mochaTeal     = "#94e2d5"
+	mochaFlamingo = "#f2cdcd"
 )
 
 var (
@@ -60,13 +64,19 @@ var (
 	prefixStatusStyle             = lipgloss.NewStyle().Background(lipgloss.Color(mochaLavender)).Foreground(lipgloss.Color(mochaCrust)).Bold(true).Padding(0, 1)
 	historyStatusStyle            = lipgloss.NewStyle().Background(lipgloss.Color(mochaBlue)).Foreground(lipgloss.Color(mochaCrust)).Bold(true).Padding(0, 1)
 	modelsStatusStyle             = lipgloss.NewStyle().Background(lipgloss.Color(mochaYellow)).Foreground(lipgloss.Color(mochaCrust)).Bold(true).Padding(0, 1)
+	sourcesStatusStyle            = lipgloss.NewStyle().Background(lipgloss.Color(mochaFlamingo)).Foreground(lipgloss.Color(mochaCrust)).Bold(true).Padding(0, 1)
 	defaultStatusStyle            = lipgloss.NewStyle().Background(lipgloss.Color(mochaSurface0)).Foreground(lipgloss.Color(mochaText)).Bold(true).Padding(0, 1)
+	infoStatusStyle               = lipgloss.NewStyle().Background(lipgloss.Color(mochaBlue)).Foreground(lipgloss.Color(mochaCrust)).Padding(0, 1)
 	errorStatusStyle              = lipgloss.NewStyle().Background(lipgloss.Color(mochaRed)).Foreground(lipgloss.Color(mochaCrust)).Bold(true).Padding(0, 1)
 	contextStatusStyle            = lipgloss.NewStyle().Background(lipgloss.Color(mochaGreen)).Foreground(lipgloss.Color(mochaCrust)).Bold(true).Padding(0, 1)
+	usageStatusStyle              = lipgloss.NewStyle().Background(lipgloss.Color(mochaLavender)).Foreground(lipgloss.Color(mochaCrust)).Bold(true).Padding(0, 1)
+	costStatusStyle               = lipgloss.NewStyle().Background(lipgloss.Color(mochaYellow)).Foreground(lipgloss.Color(mochaCrust)).Bold(true).Padding(0, 1)
 	selectedModelStatusStyle      = lipgloss.NewStyle().Background(lipgloss.Color(mochaPeach)).Foreground(lipgloss.Color(mochaCrust)).Bold(true).Padding(0, 1)
 	embedSelectedModelStatusStyle = lipgloss.NewStyle().Background(lipgloss.Color(mochaTeal)).Foreground(lipgloss.Color(mochaCrust)).Bold(true).Padding(0, 1)
 
-	modalFrameStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(mochaText)).Padding(1, 2)
+	modalFrameStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color(mochaText)).Padding(1, 2)
+	modalTitleStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color(mochaLavender)).Background(lipgloss.Color(mochaSurface0)).Padding(0, 1)
+	sourceDistanceStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(mochaOverlay2))
 
 	barStyle = lipgloss.NewStyle().
 			Background(lipgloss.Color(mochaMantle)).
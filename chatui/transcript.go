@@ -0,0 +1,49 @@
+package chatui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+const transcriptTimeLayout = "20060102-150405"
+
+// transcriptName returns the default transcript filename for a chat saved at t.
+func transcriptName(t time.Time) string {
+	return "ragx-chat-" + t.Format(transcriptTimeLayout) + ".md"
+}
+
+// plainText strips the terminal styling from s, leaving plain Markdown.
+func plainText(s string) string { return ansi.Strip(s) }
+
+// writeTranscript writes the plain text of history to path, replacing any existing file.
+func writeTranscript(path, history string) error {
+	if err := os.WriteFile(filepath.Clean(path), []byte(plainText(history)), 0o600); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+
+	return nil
+}
+
+// appendTranscript appends the plain text of turn to path, creating it if needed.
+func appendTranscript(path, turn string) (retErr error) {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open transcript: %w", err)
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil && retErr == nil {
+			retErr = fmt.Errorf("close transcript: %w", err)
+		}
+	}()
+
+	if _, err := f.WriteString(plainText(turn)); err != nil {
+		return fmt.Errorf("append transcript: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package chatui_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/chatui"
+)
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "plain text unchanged",
+			in:   "you: foo\n",
+			want: "you: foo\n",
+		},
+		{
+			name: "sgr styling stripped",
+			in:   "\x1b[1;38;2;137;180;250myou:\x1b[0m foo\n\x1b[1;38;2;203;166;247mllm(bar): \x1b[0m**baz**",
+			want: "you: foo\nllm(bar): **baz**",
+		},
+		{
+			name: "non styling sequences stripped",
+			in:   "\x1b[2Kfoo\x1b]8;;https://example.com\x1b\\bar\x1b]8;;\x1b\\",
+			want: "foobar",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chatui.PlainText(tt.in); got != tt.want {
+				t.Errorf("want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTranscriptName(t *testing.T) {
+	ts := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	if got, want := chatui.TranscriptName(ts), "ragx-chat-20250102-150405.md"; got != want {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestAppendTranscript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.md")
+
+	for _, turn := range []string{"\x1b[1myou:\x1b[0m foo\n", "\x1b[1myou:\x1b[0m bar\n"} {
+		if err := chatui.AppendTranscript(path, turn); err != nil {
+			t.Fatalf("append transcript: %v", err)
+		}
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+
+	if want := "you: foo\nyou: bar\n"; string(got) != want {
+		t.Errorf("want: %q, got: %q", want, string(got))
+	}
+}
+
+func TestWriteTranscript_Error(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "chat.md")
+
+	if err := chatui.WriteTranscript(path, "foo"); err == nil {
+		t.Errorf("expected an error writing to a missing directory")
+	}
+}
@@ -0,0 +1,58 @@
+package chatui
+
+import (
+	"fmt"
+
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/types"
+)
+
+// turnCost returns the cost of a turn with usage u,
+// given the per 1K tokens prices of mc.
+func turnCost(mc types.ModelConfig, u prompt.Usage) float64 {
+	return float64(u.PromptTokens)/1000*mc.PriceIn + float64(u.CompletionTokens)/1000*mc.PriceOut
+}
+
+func priced(mc types.ModelConfig) bool { return mc.PriceIn > 0 || mc.PriceOut > 0 }
+
+// addUsage records the usage of the last turn of the selected
+// model and adds its cost to the running session cost.
+func (m *model) addUsage(u prompt.Usage) {
+	m.lastUsage = &u
+
+	if mc, ok := m.modelConfig(m.selectedModel); ok {
+		m.sessionCost += turnCost(mc, u)
+	}
+}
+
+// resetUsage clears the usage and cost of the session.
+func (m *model) resetUsage() {
+	m.lastUsage = nil
+	m.sessionCost = 0
+}
+
+// usageStatus formats the token usage of the last turn, e.g. "In 1200 Out 350".
+// Usage estimated from the message length, rather than reported by the
+// provider, is prefixed with "~".
+func (m *model) usageStatus() string {
+	if m.lastUsage == nil {
+		return ""
+	}
+
+	prefix := ""
+	if m.lastUsage.Estimated {
+		prefix = "~"
+	}
+
+	return fmt.Sprintf("%sIn %d Out %d", prefix, m.lastUsage.PromptTokens, m.lastUsage.CompletionTokens)
+}
+
+// costStatus formats the running session cost. It is empty unless
+// the selected model has prices or a cost was already accumulated.
+func (m *model) costStatus() string {
+	if mc, ok := m.modelConfig(m.selectedModel); (!ok || !priced(mc)) && m.sessionCost == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("$%.4f", m.sessionCost)
+}
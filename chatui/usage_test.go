@@ -0,0 +1,71 @@
+package chatui_test
+
+import (
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/chatui"
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/types"
+)
+
+func TestStreamUsage(t *testing.T) {
+	models := []types.ModelConfig{
+		{ID: "foo", PriceIn: 0.5, PriceOut: 1.5},
+		{ID: "bar"},
+	}
+
+	tests := []struct {
+		name      string
+		model     string
+		turns     []prompt.Usage
+		wantUsage string
+		wantCost  string
+	}{
+		{
+			name:  "no usage yet",
+			model: "foo",
+		},
+		{
+			name:  "running cost of a priced model",
+			model: "foo",
+			turns: []prompt.Usage{
+				{PromptTokens: 1000, CompletionTokens: 2000},
+				{PromptTokens: 3000, CompletionTokens: 1000},
+			},
+			wantUsage: "In 3000 Out 1000",
+			wantCost:  "$6.5000",
+		},
+		{
+			name:      "estimated usage",
+			model:     "foo",
+			turns:     []prompt.Usage{{PromptTokens: 200, CompletionTokens: 100, Estimated: true}},
+			wantUsage: "~In 200 Out 100",
+			wantCost:  "$0.2500",
+		},
+		{
+			name:      "model without prices",
+			model:     "bar",
+			turns:     []prompt.Usage{{PromptTokens: 10, CompletionTokens: 5}},
+			wantUsage: "In 10 Out 5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := chatui.New(nil, nil, chatui.LLMConfig{Models: models, DefaultModel: tt.model})
+
+			var usage, cost string
+			for _, u := range tt.turns {
+				usage, cost = m.StreamUsage(u)
+			}
+
+			if usage != tt.wantUsage {
+				t.Errorf("want usage: %q, got: %q", tt.wantUsage, usage)
+			}
+
+			if len(tt.turns) > 0 && cost != tt.wantCost {
+				t.Errorf("want cost: %q, got: %q", tt.wantCost, cost)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"io"
@@ -8,6 +9,7 @@ import (
 	"github.com/ladzaretti/ragx-cli/chatui"
 	"github.com/ladzaretti/ragx-cli/clierror"
 	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/llm"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
@@ -18,6 +20,10 @@ var ErrInvalidModel = errors.New("invalid model selected")
 type ChatOptions struct {
 	*genericclioptions.StdioOptions
 	*llmOptions
+
+	transcriptPath string
+	pathsFrom      string
+	sessionName    string
 }
 
 var _ genericclioptions.CmdOptions = &ChatOptions{}
@@ -32,20 +38,42 @@ func NewChatOptions(stdio *genericclioptions.StdioOptions, llmOptions *llmOption
 
 func (*ChatOptions) Complete() error { return nil }
 
-func (*ChatOptions) Validate() error { return nil }
+func (o *ChatOptions) Validate() error {
+	if o.sessionName == "" {
+		return nil
+	}
+
+	if _, err := chatSessionPath(o.sessionName); err != nil {
+		return errf("--session: %w", err)
+	}
+
+	return nil
+}
 
 func (o *ChatOptions) Run(ctx context.Context, args ...string) error {
-	if !o.Piped && len(args) == 0 {
+	if o.pathsFrom != "" {
+		paths, err := readPathsFrom(o.pathsFrom, o.In, o.ErrOut)
+		if err != nil {
+			return err
+		}
+
+		args = append(args, paths...)
+	}
+
+	// with --paths-from -, stdin holds the paths rather than the data
+	piped := o.Piped && o.pathsFrom != pathsFromStdin
+
+	if !piped && len(args) == 0 {
 		return ErrNoEmbedInput
 	}
 
-	if o.Piped && len(args) > 0 {
+	if piped && len(args) > 0 {
 		return ErrConflictingEmbedInputs
 	}
 
 	var in io.Reader
 
-	if o.Piped {
+	if piped {
 		in = o.In
 	}
 
@@ -54,28 +82,104 @@ func (o *ChatOptions) Run(ctx context.Context, args ...string) error {
 		return errf("embed: %w", err)
 	}
 
+	config := chatui.LLMConfig{
+		Models:             o.llmConfig.Models,
+		DefaultModel:       o.llmConfig.DefaultModel,
+		UserPromptTmpl:     o.promptConfig.UserPromptTmpl,
+		EmbeddingModel:     o.embeddingConfig.Model,
+		EmbeddingDims:      o.embeddingDimensions(),
+		RetrievalTopK:      o.embeddingConfig.TopK,
+		RetrievalMinScore:  o.retrievalConfig.MinScore,
+		DefaultTemperature: o.defaultTemperature,
+		DefaultContext:     o.defaultContext,
+		ModelContexts:      o.modelContexts,
+		ContextReserve:     o.promptConfig.ContextReserve,
+	}
+
+	session, sessionPath, err := o.readSession()
+	if err != nil {
+		return err
+	}
+
+	// the session continues with the model it was saved with
+	config.DefaultModel = cmp.Or(session.Model, config.DefaultModel)
+
 	var (
-		config = chatui.LLMConfig{
-			Models:             o.llmConfig.Models,
-			DefaultModel:       o.llmConfig.DefaultModel,
-			UserPromptTmpl:     o.promptConfig.UserPromptTmpl,
-			EmbeddingModel:     o.embeddingConfig.Model,
-			RetrievalTopK:      o.embeddingConfig.TopK,
-			DefaultTemperature: o.defaultTemperature,
-			DefaultContext:     o.defaultContext,
-		}
-		tui = chatui.New(o.providers, o.vectordb, config)
-		p   = tea.NewProgram(tui,
+		tui = chatui.New(o.providers, o.vectordb, config,
+			chatui.WithTranscript(o.transcriptPath),
+			chatui.WithOutput(o.outputConfig),
+			chatui.WithKeys(o.keysConfig),
+			chatui.WithHistory(config.DefaultModel, session.Messages),
+		)
+		p = tea.NewProgram(tui,
 			tea.WithAltScreen(),
 			tea.WithReportFocus(),
 		)
 	)
 
+	for _, provider := range o.providers {
+		provider.Session.NewChat(llm.WithContextRetryNotify(func(attempted, limit int) {
+			p.Send(chatui.InfoMsg(contextRetryNotice(attempted, limit)))
+		}))
+	}
+
+	if len(session.Messages) > 0 {
+		provider, err := o.providers.ProviderFor(config.DefaultModel)
+		if err != nil {
+			return errf("session: %w", err)
+		}
+
+		if err := provider.Session.SetHistory(session.Messages); err != nil {
+			return errf("session: %w", err)
+		}
+	}
+
 	if _, err := p.Run(); err != nil {
 		return errf("chatui: %v\n", err)
 	}
 
-	return nil
+	if sessionPath == "" {
+		return nil
+	}
+
+	provider, err := o.providers.ProviderFor(tui.SelectedModel())
+	if err != nil {
+		return errf("save session: %w", err)
+	}
+
+	return writeChatSession(sessionPath, tui.SelectedModel(), provider.Session)
+}
+
+// readSession reads the chat session named by --session, if set,
+// and returns it with the path to save it back to. The model of
+// a session is cleared if no provider serves it anymore.
+func (o *ChatOptions) readSession() (session chatSession, path string, err error) {
+	if o.sessionName == "" {
+		return chatSession{}, "", nil
+	}
+
+	path, err = chatSessionPath(o.sessionName)
+	if err != nil {
+		return chatSession{}, "", errf("session: %w", err)
+	}
+
+	session, skipped, err := readChatSession(path)
+	if err != nil {
+		return chatSession{}, "", err
+	}
+
+	if skipped > 0 {
+		o.Logger.Warn("skipped incompatible chat session messages", "session", o.sessionName, "skipped", skipped)
+	}
+
+	if session.Model != "" {
+		if _, err := o.providers.ProviderFor(session.Model); err != nil {
+			o.Logger.Warn("chat session model is not available, continuing with the default model", "session", o.sessionName, "model", session.Model)
+			session.Model = ""
+		}
+	}
+
+	return session, path, nil
 }
 
 // NewCmdChat creates the <cmd> cobra command.
@@ -93,7 +197,12 @@ func NewCmdChat(defaults *DefaultRAGOptions) *cobra.Command {
 then launches an interactive TUI for chatting with the LLM. Directories are walked recursively.
 
 When paths are provided, files are included if they match any -M/--match regex (full path).
-If no -M filter is given, all files under the provided paths are embedded.`,
+If no -M filter is given, all files under the provided paths are embedded.
+When walking a directory, files ignored by its .gitignore or by embedding.ignore are skipped.
+With --paths-from, paths are also read one per line from a file, or from stdin when given "-".
+
+Prompts starting with "!" are sent to the LLM as is, without retrieving context
+(e.g. "!summarize your last answer").`,
 		Example: `  # embed all .go files in current dir and start the TUI
   ragx chat . -M '\.go$'
 
@@ -101,11 +210,29 @@ If no -M filter is given, all files under the provided paths are embedded.`,
   ragx chat ./docs ./src -M '(?i)\.(md|txt)$'
 
   # embed stdin and start the TUI
-  cat readme.md | ragx chat`,
+  cat readme.md | ragx chat
+
+  # keep the embeddings across runs, re-embedding only the changed files
+  ragx chat . --db-path repo.db --prune
+
+  # keep a transcript of every completed turn
+  ragx chat ./docs --transcript notes.md
+
+  # continue the investigation chat of the previous run
+  ragx chat ./docs --session investigation`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return clierror.Check(genericclioptions.ExecuteCommand(cmd.Context(), o, args...))
 		},
 	}
 
+	cmd.Flags().StringVarP(&o.pathsFrom, "paths-from", "", "", "read newline-separated paths to embed from a file (use - for stdin)")
+	cmd.Flags().StringVarP(&o.transcriptPath, "transcript", "", "", "append every completed chat turn to this file as plain Markdown")
+	cmd.Flags().StringVarP(&o.sessionName, "session", "", "", "restore the named chat session on start and save it back on exit, to continue across runs")
+	cmd.Flags().IntVarP(&o.llmOptions.maxChunks, "max-chunks", "", 0, "embed at most this many chunks, taken in file order, to sample a large corpus (0 for all)")
+	cmd.Flags().StringArrayVarP(&o.llmOptions.excludeContent, "exclude-content", "", nil, "drop chunks whose content matches this regex before embedding (repeatable)")
+	cmd.Flags().BoolVarP(&o.llmOptions.sanitizeUTF8, "sanitize-utf8", "", false, "replace invalid UTF-8 sequences instead of skipping the file (overrides embedding.sanitize_utf8)")
+	cmd.Flags().StringVarP(&o.llmOptions.dbPath, "db-path", "", "", "keep the embeddings in this vector database file, re-embedding only the files changed since the last run")
+	cmd.Flags().BoolVarP(&o.llmOptions.prune, "prune", "", false, "remove the stored chunks of files under the given paths that no longer exist (requires --db-path)")
+
 	return cmd
 }
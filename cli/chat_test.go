@@ -0,0 +1,94 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/llm/fake"
+)
+
+func TestChatSession(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateDir)
+
+	history := []llm.HistoryMessage{
+		{Role: "user", Content: "foo"},
+		{Role: "assistant", Content: "bar"},
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		session := (&fake.Backend{}).NewChat("")
+		if err := session.SetHistory(history); err != nil {
+			t.Fatalf("set history: %v", err)
+		}
+
+		if err := cli.SaveChatSession("baz", "foo", session); err != nil {
+			t.Fatalf("save session: %v", err)
+		}
+
+		model, msgs, skipped, err := cli.ReadChatSession("baz")
+		if err != nil {
+			t.Fatalf("read session: %v", err)
+		}
+
+		if model != "foo" || skipped != 0 {
+			t.Errorf("want model foo and no skipped messages, got model: %q, skipped: %d", model, skipped)
+		}
+
+		if diff := cmp.Diff(history, msgs); diff != "" {
+			t.Errorf("messages mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("incompatible messages are skipped", func(t *testing.T) {
+		raw := `{
+  "version": 2,
+  "model": "foo",
+  "messages": [
+    {"role": "user", "content": "foo"},
+    {"role": "tool", "content": "qux", "tool_call_id": "1"},
+    {"role": "assistant", "content": ""},
+    {"role": "assistant", "content": "bar"}
+  ]
+}`
+
+		dir := filepath.Join(stateDir, "ragx", "sessions")
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, "qux.json"), []byte(raw), 0o600); err != nil {
+			t.Fatalf("write session: %v", err)
+		}
+
+		_, msgs, skipped, err := cli.ReadChatSession("qux")
+		if err != nil {
+			t.Fatalf("read session: %v", err)
+		}
+
+		if skipped != 2 {
+			t.Errorf("want 2 skipped messages, got: %d", skipped)
+		}
+
+		if diff := cmp.Diff(history, msgs); diff != "" {
+			t.Errorf("messages mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("missing session starts empty", func(t *testing.T) {
+		model, msgs, _, err := cli.ReadChatSession("missing")
+		if err != nil || model != "" || len(msgs) != 0 {
+			t.Errorf("want an empty session, got model: %q, messages: %+v, err: %v", model, msgs, err)
+		}
+	})
+
+	t.Run("path name", func(t *testing.T) {
+		if _, _, _, err := cli.ReadChatSession("../foo"); err == nil {
+			t.Error("want an error for a session name that is a path")
+		}
+	})
+}
@@ -3,51 +3,93 @@ package cli
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
+	"time"
 	"unicode/utf8"
+
+	"github.com/ladzaretti/ragx-cli/cli/extract"
+	"github.com/ladzaretti/ragx-cli/ragx"
+	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 var (
-	ErrInvalidChunkSize    = errors.New("size must be > 0")
-	ErrInvalidChunkOverlap = errors.New("overlap must satisfy 0 <= overlap < size")
+	// Deprecated: use [ragx.ErrInvalidChunkSize].
+	ErrInvalidChunkSize = ragx.ErrInvalidChunkSize
+	// Deprecated: use [ragx.ErrInvalidChunkOverlap].
+	ErrInvalidChunkOverlap = ragx.ErrInvalidChunkOverlap
+
+	ErrFileTooLarge = errors.New("file too large")
+	ErrBinaryFile   = errors.New("binary file")
+	ErrNonUTF8File  = errors.New("non-utf-8 file")
+	ErrEmptyFile    = errors.New("empty file")
+
+	ErrHTTPStatus     = errors.New("unexpected http status")
+	ErrNonTextContent = errors.New("non-text content")
+
+	ErrNoDocumentText = extract.ErrNoText
+	ErrEncryptedPDF   = extract.ErrEncryptedPDF
 )
 
 // ChunkText splits text into fixed size chunks with overlap.
+//
+// Deprecated: use [ragx.ChunkText].
 func ChunkText(text string, size, overlap int) ([]string, error) {
-	if size <= 0 {
-		return nil, ErrInvalidChunkSize
-	}
+	return ragx.ChunkText(text, size, overlap)
+}
 
-	if overlap < 0 || overlap >= size {
-		return nil, ErrInvalidChunkOverlap
-	}
+// maxExtractRatio bounds the content decompressed while extracting the text
+// of a document, as a multiple of embedding.max_file_bytes.
+const maxExtractRatio = 10
 
-	step := size - overlap
-	r := []rune(text)
-	n := len(r)
+// binarySniffLen is the number of leading bytes checked for a NUL byte
+// or control characters to detect binary files.
+const binarySniffLen = 8 << 10
 
-	var out []string
-	for i := 0; i < n; i += step {
-		end := min(i+size, n)
+// maxControlRatio is the share of control characters among the sniffed
+// bytes above which a file is detected as binary.
+const maxControlRatio = 0.3
 
-		out = append(out, string(r[i:end]))
+// fetchTimeout bounds fetching a URL, including reading its body.
+const fetchTimeout = 30 * time.Second
 
-		if end == n {
-			break
-		}
-	}
+// fetchClient fetches the URLs given instead of paths.
+var fetchClient = &http.Client{Timeout: fetchTimeout}
 
-	return out, nil
+// isURL reports whether arg is an http or https URL rather than a path.
+func isURL(arg string) bool {
+	u, err := url.Parse(arg)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
 }
 
 // ListFiles returns all files under dir recursively.
 // If predicate is nil, all files are returned.
 func ListFiles(dir string, predicate func(string) bool) ([]string, error) {
+	return listFiles(dir, nil, predicate)
+}
+
+// listFiles is like [ListFiles], without walking the directories under dir
+// for which skipDir, if set, reports true.
+func listFiles(dir string, skipDir, predicate func(string) bool) ([]string, error) {
 	var filenames []string
 
 	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
@@ -56,6 +98,10 @@ func ListFiles(dir string, predicate func(string) bool) ([]string, error) {
 		}
 
 		if d.IsDir() {
+			if path != dir && skipDir != nil && skipDir(path) {
+				return fs.SkipDir
+			}
+
 			return nil
 		}
 
@@ -69,13 +115,42 @@ func ListFiles(dir string, predicate func(string) bool) ([]string, error) {
 	return filenames, err
 }
 
-func discover(files []string, matchREs []*regexp.Regexp) ([]string, error) {
+// discover returns the files under the given paths that match any of matchREs.
+// When walking a directory, files ignored by the directory .gitignore or by
+// the extra ignore patterns are skipped; explicitly given files are kept.
+// http and https URLs are kept as is, if they match.
+// The files are sorted and deduplicated, so that indexing is reproducible
+// regardless of the argument order and the platform walk order.
+func discover(files []string, matchREs []*regexp.Regexp, ignore []string) ([]string, error) {
 	var (
 		seen = make([]string, 0, 32)
 		errs []error
 	)
 
+	matches := func(path string) bool {
+		if len(matchREs) == 0 {
+			return true
+		}
+
+		path = filepath.ToSlash(path)
+		for _, re := range matchREs {
+			if re.MatchString(path) {
+				return true
+			}
+		}
+
+		return false
+	}
+
 	for _, filename := range files {
+		if isURL(filename) {
+			if matches(filename) {
+				seen = append(seen, filename)
+			}
+
+			continue
+		}
+
 		root, err := filepath.Abs(filename)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("abs %q: %w", filename, err))
@@ -88,30 +163,41 @@ func discover(files []string, matchREs []*regexp.Regexp) ([]string, error) {
 			continue
 		}
 
-		matches := func(path string) bool {
-			if len(matchREs) == 0 {
-				return true
+		if !fi.IsDir() {
+			if matches(root) {
+				seen = append(seen, root)
 			}
 
-			path = filepath.ToSlash(path)
-			for _, re := range matchREs {
-				if re.MatchString(path) {
-					return true
-				}
+			continue
+		}
+
+		ignores, err := loadIgnoreMatcher(root, ignore)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("load ignore patterns %q: %w", root, err))
+			continue
+		}
+
+		include := func(path string) bool {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return false
 			}
 
-			return false
+			return !ignores.ignored(filepath.ToSlash(rel)) && matches(path)
 		}
 
-		if !fi.IsDir() {
-			if matches(root) {
-				seen = append(seen, root)
+		// ignored directories are not walked at all, so that large or
+		// unreadable ones such as .git/ do not slow down or fail discovery
+		skipDir := func(path string) bool {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return false
 			}
 
-			continue
+			return ignores.ignoredDir(filepath.ToSlash(rel))
 		}
 
-		files, err := ListFiles(root, matches)
+		files, err := listFiles(root, skipDir, include)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("list %q: %w", root, err))
 			continue
@@ -120,66 +206,541 @@ func discover(files []string, matchREs []*regexp.Regexp) ([]string, error) {
 		seen = append(seen, files...)
 	}
 
-	return seen, errors.Join(errs...)
+	slices.Sort(seen)
+
+	return slices.Compact(seen), errors.Join(errs...)
 }
 
 type dataChunks struct {
 	source string
 	chunks []string
+	kind   string
+
+	// title and tags are read from the markdown frontmatter, if enabled.
+	title string
+	tags  []string
+
+	// embedText holds the normalized text of the chunks to embed,
+	// if it differs from the chunks as shown. See [normalizeMarkup].
+	embedText []string
+
+	// stamp is the stat of the source file when it was chunked,
+	// stored along the chunks to skip the file while it is unchanged.
+	stamp vecdb.SourceStamp
 }
 
-func chunkFiles(ctx context.Context, display func(text string), paths []string, chunkSize, overlap int) ([]*dataChunks, error) {
-	chunked := make([]*dataChunks, 0, len(paths))
+// indexSource returns the chunks of cf to embed and store.
+func (cf *dataChunks) indexSource() ragx.Source {
+	return ragx.Source{
+		Meta: vecdb.Meta{
+			Source:   cf.source,
+			Kind:     cf.kind,
+			Title:    cf.title,
+			Tags:     cf.tags,
+			ModTime:  cf.stamp.ModTime,
+			Size:     cf.stamp.Size,
+			Chunking: cf.stamp.Chunking,
+		},
+		Chunks: cf.chunks,
+		Inputs: cf.embedText,
+	}
+}
+
+// pathChunks returns a single chunk describing the path of source, so that
+// questions about where something lives can retrieve the file by name.
+func pathChunks(source string) *dataChunks {
+	dir, file := filepath.Split(source)
+
+	text := fmt.Sprintf("file: %s\ndirectory: %s\npath: %s", file, filepath.ToSlash(filepath.Clean(dir)), filepath.ToSlash(source))
+
+	return &dataChunks{
+		source: source,
+		chunks: []string{text},
+		kind:   vecdb.KindPath,
+	}
+}
+
+// skipStats counts the files skipped while chunking, by reason.
+type skipStats struct {
+	tooLarge int
+	binary   int
+	nonText  int
+	other    int
+}
 
-	for _, path := range paths {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
+func (s skipStats) total() int { return s.tooLarge + s.binary + s.nonText + s.other }
+
+// String summarizes the skipped files in a single line,
+// e.g. "skipped 124 files (120 binary, 4 non-text)".
+func (s skipStats) String() string {
+	var reasons []string
+
+	for _, r := range []struct {
+		n      int
+		reason string
+	}{
+		{s.tooLarge, "too large"},
+		{s.binary, "binary"},
+		{s.nonText, "non-text"},
+		{s.other, "unreadable"},
+	} {
+		if r.n > 0 {
+			reasons = append(reasons, fmt.Sprintf("%d %s", r.n, r.reason))
 		}
+	}
+
+	noun := "files"
+	if s.total() == 1 {
+		noun = "file"
+	}
 
-		chunks, err := chunkFile(path, chunkSize, overlap)
+	return fmt.Sprintf("skipped %d %s (%s)", s.total(), noun, strings.Join(reasons, ", "))
+}
+
+// chunkFiles reads and chunks paths concurrently, fetching the ones that
+// are URLs. Files that cannot be chunked are skipped and logged at debug
+// level, URLs at warn level; the caller reports the returned [skipStats]
+// as a summary. The order of the returned chunks follows paths.
+func chunkFiles(ctx context.Context, logger *slog.Logger, paths []string, cfg types.EmbeddingConfig) ([]*dataChunks, skipStats, error) {
+	var (
+		results = make([]*dataChunks, len(paths))
+		errs    = make([]error, len(paths))
+		skipped skipStats
+	)
+
+	g, gctx := errgroup.WithContext(ctx)
+	sem := semaphore.NewWeighted(chunkConcurrency)
+
+	for i, path := range paths {
+		if err := sem.Acquire(gctx, 1); err != nil {
+			break
+		}
+
+		g.Go(func() error {
+			defer sem.Release(1)
+
+			if isURL(path) {
+				results[i], errs[i] = chunkURL(gctx, path, cfg)
+			} else {
+				results[i], errs[i] = chunkFile(path, cfg)
+			}
+
+			return nil
+		})
+	}
+
+	_ = g.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, skipped, err
+	}
+
+	chunked := make([]*dataChunks, 0, len(paths))
+
+	for i, err := range errs {
 		if err != nil {
-			display(fmt.Sprintf("skipping %q: %v", path, err))
+			switch {
+			case errors.Is(err, ErrFileTooLarge), errors.Is(err, extract.ErrTooLarge):
+				skipped.tooLarge++
+			case errors.Is(err, ErrBinaryFile):
+				skipped.binary++
+			case errors.Is(err, ErrNonUTF8File), errors.Is(err, ErrEmptyFile), errors.Is(err, ErrNonTextContent),
+				errors.Is(err, ErrNoDocumentText):
+				skipped.nonText++
+			default:
+				skipped.other++
+			}
+
+			if isURL(paths[i]) {
+				logger.Warn("skipping url", "url", paths[i], "err", err)
+			} else {
+				logger.Debug("skipping file", "path", paths[i], "err", err)
+			}
+
 			continue
 		}
 
-		chunked = append(chunked, chunks)
+		chunked = append(chunked, results[i])
+	}
+
+	return chunked, skipped, nil
+}
+
+// chunkFile reads and chunks the file at path. Files larger than
+// cfg.MaxFileBytes, if positive, and binary files are rejected before
+// being read in full. Files that are not valid UTF-8 are rejected too,
+// unless cfg.SanitizeUTF8 is set. With cfg.Frontmatter, the frontmatter of a markdown
+// file is parsed into the chunk metadata instead of being chunked as text.
+// Documents of the formats listed in cfg.Extractors are chunked from their
+// extracted text. The chunks are stamped with the stat of the file.
+func chunkFile(path string, cfg types.EmbeddingConfig) (*dataChunks, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat file: %w", err)
+	}
+
+	cf, err := chunkFileContent(path, fi, cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	return chunked, nil
+	cf.stamp = fileStamp(fi, chunkingFingerprint(cfg))
+
+	return cf, nil
 }
 
-func chunkFile(path string, chunkSize, overlap int) (*dataChunks, error) {
+// fileStamp returns the stamp stored along the chunks of the file fi,
+// chunked with the config of the given fingerprint.
+func fileStamp(fi fs.FileInfo, chunking string) vecdb.SourceStamp {
+	return vecdb.SourceStamp{ModTime: fi.ModTime().UnixNano(), Size: fi.Size(), Chunking: chunking}
+}
+
+// chunkingFingerprint returns a digest of the options of cfg that shape the
+// chunks of a file, so that files chunked differently are embedded again.
+func chunkingFingerprint(cfg types.EmbeddingConfig) string {
+	extractors := slices.Clone(cfg.Extractors)
+	slices.Sort(extractors)
+
+	raw, err := json.Marshal(struct {
+		ChunkSize        int      `json:"chunk_size"`
+		Overlap          int      `json:"overlap"`
+		Frontmatter      bool     `json:"frontmatter"`
+		FrontmatterTitle bool     `json:"frontmatter_title"`
+		DecodeEntities   bool     `json:"decode_entities"`
+		StripMarkup      bool     `json:"strip_markup"`
+		SanitizeUTF8     bool     `json:"sanitize_utf8"`
+		Extractors       []string `json:"extractors"`
+	}{cfg.ChunkSize, cfg.Overlap, cfg.Frontmatter, cfg.FrontmatterTitle, cfg.DecodeEntities, cfg.StripMarkup, cfg.SanitizeUTF8, extractors})
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(raw)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// chunkFileContent chunks the file at path, with the stat fi, for [chunkFile].
+func chunkFileContent(path string, fi fs.FileInfo, cfg types.EmbeddingConfig) (*dataChunks, error) {
+	if maxFileBytes := cfg.MaxFileBytes; maxFileBytes > 0 && fi.Size() > maxFileBytes {
+		return nil, fmt.Errorf("%w: %d bytes (max %d)", ErrFileTooLarge, fi.Size(), maxFileBytes)
+	}
+
+	if extractText, ok := extract.For(path, cfg.Extractors); ok {
+		text, err := extractText(path, maxExtractBytes(cfg.MaxFileBytes))
+		if err != nil {
+			return nil, fmt.Errorf("extract text: %w", err)
+		}
+
+		return chunkBytes(path, []byte(text), cfg)
+	}
+
+	reason, err := binaryReason(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+
+	if reason != "" {
+		return nil, fmt.Errorf("%w: %s", ErrBinaryFile, reason)
+	}
+
 	b, err := os.ReadFile(filepath.Clean(path))
 	if err != nil {
 		return nil, fmt.Errorf("read file: %w", err)
 	}
 
+	return chunkBytes(path, b, cfg)
+}
+
+// maxExtractBytes returns the bound of the content decompressed while
+// extracting the text of a document of at most maxFileBytes, if positive.
+func maxExtractBytes(maxFileBytes int64) int64 {
+	return min(maxFileBytes, math.MaxInt64/maxExtractRatio) * maxExtractRatio
+}
+
+// chunkURL fetches and chunks the document at rawURL, like [chunkFile].
+// Responses other than 200 OK, larger than cfg.MaxFileBytes, if positive,
+// or of a non-text content type are rejected. HTML is reduced to its text.
+func chunkURL(ctx context.Context, rawURL string, cfg types.EmbeddingConfig) (*dataChunks, error) {
+	b, err := fetchURL(ctx, rawURL, cfg.MaxFileBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return chunkBytes(rawURL, b, cfg)
+}
+
+// chunkBytes chunks b, the content of the document at source.
+func chunkBytes(source string, b []byte, cfg types.EmbeddingConfig) (*dataChunks, error) {
 	if !utf8.Valid(b) {
-		return nil, errors.New("non-utf-8 file")
+		if !cfg.SanitizeUTF8 {
+			return nil, ErrNonUTF8File
+		}
+
+		b = bytes.ToValidUTF8(b, []byte(string(utf8.RuneError)))
 	}
 
 	if bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}) { // Strip BOM
 		b = b[3:]
 	}
 
-	chunks, err := ChunkText(string(b), chunkSize, overlap)
+	var (
+		text = string(b)
+		fm   frontmatter
+	)
+
+	if cfg.Frontmatter && isMarkdown(source) {
+		fm, text, _ = splitFrontmatter(text)
+	}
+
+	chunks, err := ragx.ChunkText(text, cfg.ChunkSize, cfg.Overlap)
 	if err != nil {
 		return nil, fmt.Errorf("chunk text: %w", err)
 	}
 
 	if len(chunks) == 0 {
-		return nil, errors.New("empty file")
+		return nil, ErrEmptyFile
+	}
+
+	// the title gives the leading chunk the context of the whole document
+	if cfg.FrontmatterTitle && fm.title != "" {
+		chunks[0] = fm.title + "\n\n" + chunks[0]
 	}
 
 	return &dataChunks{
-			source: path,
-			chunks: chunks,
+			source:    source,
+			chunks:    chunks,
+			title:     fm.title,
+			tags:      fm.tags,
+			embedText: normalizeMarkup(source, chunks, cfg),
 		},
 		nil
 }
 
+// fetchURL returns the body of the document at rawURL, reduced to its text
+// if it is HTML. Bodies larger than maxBytes, if positive, are rejected.
+func fetchURL(ctx context.Context, rawURL string, maxBytes int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+	}
+
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes (max %d)", ErrFileTooLarge, resp.ContentLength, maxBytes)
+	}
+
+	body := io.Reader(resp.Body)
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+
+	if maxBytes > 0 && int64(len(b)) > maxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrFileTooLarge, maxBytes)
+	}
+
+	switch mediaType := contentType(resp.Header.Get("Content-Type"), b); {
+	case mediaType == "text/html", mediaType == "application/xhtml+xml":
+		return []byte(extract.HTMLText(string(b))), nil
+	case isTextMediaType(mediaType):
+		return b, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNonTextContent, mediaType)
+	}
+}
+
+// contentType returns the media type of a response body from its
+// Content-Type header, or sniffed from b if the header is missing
+// or too generic to tell.
+func contentType(header string, b []byte) string {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(b))
+	}
+
+	return mediaType
+}
+
+// isTextMediaType reports whether mediaType is a text format worth chunking.
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript",
+		"application/yaml", "application/x-yaml", "application/toml":
+		return true
+	default:
+		return false
+	}
+}
+
+// binaryReason returns why the file at path is detected as binary, judging
+// by its first [binarySniffLen] bytes: a NUL byte, or a share of control
+// characters above [maxControlRatio]. It returns "" for a text file.
+func binaryReason(path string) (string, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	buf := make([]byte, binarySniffLen)
+
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+
+	buf = buf[:n]
+
+	if bytes.IndexByte(buf, 0) != -1 {
+		return "contains a NUL byte", nil
+	}
+
+	if n == 0 {
+		return "", nil
+	}
+
+	control := 0
+
+	for _, b := range buf {
+		if isControl(b) {
+			control++
+		}
+	}
+
+	if ratio := float64(control) / float64(n); ratio > maxControlRatio {
+		return fmt.Sprintf("%.0f%% control characters", ratio*100), nil
+	}
+
+	return "", nil
+}
+
+// isControl reports whether b is a control character that is
+// unusual in text. White space, backspace and the escape of
+// terminal colors, e.g. in logs, are not counted.
+func isControl(b byte) bool {
+	switch b {
+	case '\t', '\n', '\v', '\f', '\r', '\b', 0x1b:
+		return false
+	default:
+		return b < 0x20 || b == 0x7f
+	}
+}
+
+// printChunks prints each chunk of chunkedFiles with its source and index
+// using printLine, stopping after maxChunks chunks if positive.
+func printChunks(printLine func(string), chunkedFiles []*dataChunks, maxChunks int) {
+	var (
+		total   = totalChunks(chunkedFiles)
+		printed = 0
+	)
+
+	for _, cf := range chunkedFiles {
+		for i, c := range cf.chunks {
+			if maxChunks > 0 && printed == maxChunks {
+				printLine(fmt.Sprintf("... %d more chunks not printed (see --max-print)", total-printed))
+				return
+			}
+
+			printLine(fmt.Sprintf("==> %s:%d (%d chars) <==\n%s", cf.source, i, utf8.RuneCountInString(c), c))
+
+			printed++
+		}
+	}
+}
+
+// limitChunks returns the leading chunks of chunkedFiles, in order,
+// up to maxChunks chunks in total. A non-positive maxChunks keeps all chunks.
+func limitChunks(chunkedFiles []*dataChunks, maxChunks int) []*dataChunks {
+	if maxChunks <= 0 || totalChunks(chunkedFiles) <= maxChunks {
+		return chunkedFiles
+	}
+
+	limited := make([]*dataChunks, 0, len(chunkedFiles))
+
+	for _, cf := range chunkedFiles {
+		if maxChunks == 0 {
+			break
+		}
+
+		if len(cf.chunks) > maxChunks {
+			cp := *cf
+			cp.chunks = cf.chunks[:maxChunks]
+
+			if cf.embedText != nil {
+				cp.embedText = cf.embedText[:maxChunks]
+			}
+
+			cf = &cp
+		}
+
+		limited = append(limited, cf)
+		maxChunks -= len(cf.chunks)
+	}
+
+	return limited
+}
+
+// excludeChunks drops the chunks whose content matches any of res,
+// and returns the remaining files with the number of dropped chunks.
+// Files left without chunks are dropped as well.
+func excludeChunks(chunkedFiles []*dataChunks, res []*regexp.Regexp) ([]*dataChunks, int) {
+	if len(res) == 0 {
+		return chunkedFiles, 0
+	}
+
+	var (
+		kept     = make([]*dataChunks, 0, len(chunkedFiles))
+		excluded = 0
+	)
+
+	for _, cf := range chunkedFiles {
+		cp := *cf
+		cp.chunks, cp.embedText = nil, nil
+
+		for i, c := range cf.chunks {
+			if slices.ContainsFunc(res, func(re *regexp.Regexp) bool { return re.MatchString(c) }) {
+				excluded++
+				continue
+			}
+
+			cp.chunks = append(cp.chunks, c)
+
+			if cf.embedText != nil {
+				cp.embedText = append(cp.embedText, cf.embedText[i])
+			}
+		}
+
+		if len(cp.chunks) == 0 {
+			continue
+		}
+
+		kept = append(kept, &cp)
+	}
+
+	return kept, excluded
+}
+
 func totalChunks(chunkedFiles []*dataChunks) (n int) {
 	for _, cf := range chunkedFiles {
 		n += len(cf.chunks)
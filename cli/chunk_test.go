@@ -1,60 +1,409 @@
 package cli_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/types"
 )
 
-func TestChunkText(t *testing.T) {
-	const (
-		size    = 5
-		overlap = 2 // step = 3
-	)
+func TestChunkFiles_SkipsLargeAndBinaryFiles(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"small.md":  "foo bar",
+		"large.log": strings.Repeat("x", 2048),
+		"image.bin": "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"late.bin":  strings.Repeat("y", 9000) + "\x00",
+	})
+
+	path := func(name string) string { return filepath.Join(root, name) }
+
+	paths := []string{path("small.md"), path("large.log"), path("image.bin"), path("late.bin")}
+
+	sources, tooLarge, binary, err := cli.ChunkFiles(paths, 1024)
+	if err != nil {
+		t.Fatalf("chunk files: %v", err)
+	}
+
+	if !slices.Equal([]string{path("small.md")}, sources) {
+		t.Errorf("want only small.md chunked, got: %q", sources)
+	}
+
+	if tooLarge != 2 {
+		t.Errorf("want 2 files skipped as too large, got: %d", tooLarge)
+	}
+
+	if binary != 1 {
+		t.Errorf("want 1 file skipped as binary, got: %d", binary)
+	}
+
+	// a NUL byte past the sniffed prefix is not detected as binary
+	sources, _, binary, err = cli.ChunkFiles([]string{path("late.bin")}, 0)
+	if err != nil {
+		t.Fatalf("chunk files: %v", err)
+	}
+
+	if binary != 0 || len(sources) != 1 {
+		t.Errorf("want late.bin chunked without a size limit, got sources: %q, binary: %d", sources, binary)
+	}
+}
 
+func TestChunkFile_BinaryDetection(t *testing.T) {
 	tests := []struct {
-		name  string
-		input string
-		want  []string
+		name       string
+		content    string
+		wantReason string // wantReason is empty for text files.
+	}{
+		{name: "text", content: "foo bar\nbaz\n"},
+		{name: "nul bytes", content: "foo\x00\x00bar", wantReason: "NUL byte"},
+		{name: "utf-8 with control chars", content: "\x1b[31mfoo\x1b[0m\tbär\fbaz\r\n\x07"},
+		{name: "mostly control chars", content: strings.Repeat("\x01\x02\x03a", 10), wantReason: "75% control characters"},
+	}
+
+	root := t.TempDir()
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(root, fmt.Sprintf("file%d", i))
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("write file: %v", err)
+			}
+
+			_, _, _, err := cli.ChunkFile(path, types.EmbeddingConfig{ChunkSize: 100})
+
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Errorf("want a text file, got: %v", err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, cli.ErrBinaryFile) || !strings.Contains(err.Error(), tt.wantReason) {
+				t.Errorf("want a binary file error with %q, got: %v", tt.wantReason, err)
+			}
+		})
+	}
+}
+
+func TestChunkFiles_PreservesOrder(t *testing.T) {
+	files := make(map[string]string, 100)
+	names := make([]string, 0, 100)
+
+	for i := range 100 {
+		name := fmt.Sprintf("%03d.md", i)
+		files[name] = "foo"
+		names = append(names, name)
+	}
+
+	files["skip.bin"] = "\x00"
+
+	root := writeTree(t, files)
+
+	paths := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		if i == 50 {
+			paths = append(paths, filepath.Join(root, "skip.bin"))
+		}
+
+		paths = append(paths, filepath.Join(root, name))
+	}
+
+	sources, _, binary, err := cli.ChunkFiles(paths, 0)
+	if err != nil {
+		t.Fatalf("chunk files: %v", err)
+	}
+
+	if binary != 1 {
+		t.Errorf("want 1 file skipped as binary, got: %d", binary)
+	}
+
+	want := slices.DeleteFunc(slices.Clone(paths), func(p string) bool { return strings.HasSuffix(p, ".bin") })
+	if !slices.Equal(want, sources) {
+		t.Errorf("want sources in input order, got: %q", sources)
+	}
+}
+
+func TestChunkFile_Frontmatter(t *testing.T) {
+	const doc = `---
+title: "Foo: the guide"
+tags:
+  - foo
+  - 'bar'
+draft: false
+---
+body text
+`
+
+	root := writeTree(t, map[string]string{"foo.md": doc, "foo.txt": doc, "flow.md": "---\ntags: [foo, \"bar\"]\n---\nbody"})
+
+	tests := []struct {
+		name      string
+		file      string
+		cfg       types.EmbeddingConfig
+		wantFirst string
+		wantTitle string
+		wantTags  []string
 	}{
 		{
-			name:  "basic overlap",
-			input: "abcdefghij",
-			want:  []string{"abcde", "defgh", "ghij"},
+			name:      "disabled",
+			file:      "foo.md",
+			cfg:       types.EmbeddingConfig{ChunkSize: 1000},
+			wantFirst: doc,
 		},
 		{
-			name:  "tail shorter than size",
-			input: "abcdefghi",
-			want:  []string{"abcde", "defgh", "ghi"},
+			name:      "metadata",
+			file:      "foo.md",
+			cfg:       types.EmbeddingConfig{ChunkSize: 1000, Frontmatter: true},
+			wantFirst: "body text\n",
+			wantTitle: "Foo: the guide",
+			wantTags:  []string{"foo", "bar"},
 		},
 		{
-			name:  "short input",
-			input: "abc",
-			want:  []string{"abc"},
+			name:      "title prepended",
+			file:      "foo.md",
+			cfg:       types.EmbeddingConfig{ChunkSize: 1000, Frontmatter: true, FrontmatterTitle: true},
+			wantFirst: "Foo: the guide\n\nbody text\n",
+			wantTitle: "Foo: the guide",
+			wantTags:  []string{"foo", "bar"},
 		},
 		{
-			name:  "empty input",
-			input: "",
-			want:  nil,
+			name:      "flow tags",
+			file:      "flow.md",
+			cfg:       types.EmbeddingConfig{ChunkSize: 1000, Frontmatter: true},
+			wantFirst: "body",
+			wantTags:  []string{"foo", "bar"},
 		},
 		{
-			name:  "unicode runes",
-			input: "🍕🍕🍕🍕🍕🍕",
-			want:  []string{"🍕🍕🍕🍕🍕", "🍕🍕🍕"},
+			name:      "not markdown",
+			file:      "foo.txt",
+			cfg:       types.EmbeddingConfig{ChunkSize: 1000, Frontmatter: true},
+			wantFirst: doc,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := cli.ChunkText(tt.input, size, overlap)
+			chunks, title, tags, err := cli.ChunkFile(filepath.Join(root, tt.file), tt.cfg)
 			if err != nil {
-				t.Errorf("unexpected error: %v", err)
+				t.Fatalf("chunk file: %v", err)
+			}
+
+			if len(chunks) != 1 || chunks[0] != tt.wantFirst {
+				t.Errorf("want chunks: [%q], got: %q", tt.wantFirst, chunks)
 			}
 
-			if !slices.Equal(tt.want, got) {
-				t.Errorf("want chunks: %#v, got:%#v", tt.want, got)
+			if title != tt.wantTitle {
+				t.Errorf("want title %q, got %q", tt.wantTitle, title)
+			}
+
+			if !slices.Equal(tags, tt.wantTags) {
+				t.Errorf("want tags %q, got %q", tt.wantTags, tags)
 			}
 		})
 	}
 }
+
+func TestChunkFiles_SummarizesSkips(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"ok.md":     "foo",
+		"a.bin":     "\x00",
+		"b.bin":     "\x00\x01",
+		"latin1.md": "caf\xe9",
+		"empty.md":  "",
+	})
+
+	paths := []string{
+		filepath.Join(root, "ok.md"),
+		filepath.Join(root, "a.bin"),
+		filepath.Join(root, "b.bin"),
+		filepath.Join(root, "latin1.md"),
+		filepath.Join(root, "empty.md"),
+	}
+
+	var (
+		infoLog  bytes.Buffer
+		debugLog bytes.Buffer
+	)
+
+	skipped, summary, err := cli.ChunkFilesSummary(slog.New(slog.NewTextHandler(&infoLog, nil)), paths)
+	if err != nil {
+		t.Fatalf("chunk files: %v", err)
+	}
+
+	if skipped != 4 {
+		t.Errorf("want 4 skipped files, got: %d", skipped)
+	}
+
+	if want := "skipped 4 files (2 binary, 2 non-text)"; summary != want {
+		t.Errorf("want summary: %q, got: %q", want, summary)
+	}
+
+	if infoLog.Len() > 0 {
+		t.Errorf("want no per-file logs at the default level, got: %q", infoLog.String())
+	}
+
+	debug := slog.New(slog.NewTextHandler(&debugLog, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if _, _, err := cli.ChunkFilesSummary(debug, paths); err != nil {
+		t.Fatalf("chunk files: %v", err)
+	}
+
+	if got := strings.Count(debugLog.String(), "skipping file"); got != 4 {
+		t.Errorf("want 4 per-file debug logs, got: %d", got)
+	}
+}
+
+func TestPrintChunks(t *testing.T) {
+	var (
+		sources = []string{"a.md", "b.go"}
+		chunks  = [][]string{{"foo", "bar"}, {"package main"}}
+	)
+
+	tests := []struct {
+		name      string
+		maxChunks int
+		want      []string
+	}{
+		{
+			name: "all chunks",
+			want: []string{
+				"==> a.md:0 (3 chars) <==\nfoo",
+				"==> a.md:1 (3 chars) <==\nbar",
+				"==> b.go:0 (12 chars) <==\npackage main",
+			},
+		},
+		{
+			name:      "bounded by max",
+			maxChunks: 2,
+			want: []string{
+				"==> a.md:0 (3 chars) <==\nfoo",
+				"==> a.md:1 (3 chars) <==\nbar",
+				"... 1 more chunks not printed (see --max-print)",
+			},
+		},
+		{
+			name:      "max above total",
+			maxChunks: 5,
+			want: []string{
+				"==> a.md:0 (3 chars) <==\nfoo",
+				"==> a.md:1 (3 chars) <==\nbar",
+				"==> b.go:0 (12 chars) <==\npackage main",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cli.PrintChunks(sources, chunks, tt.maxChunks); !slices.Equal(tt.want, got) {
+				t.Errorf("want lines: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func BenchmarkChunkFiles(b *testing.B) {
+	const n = 2000
+
+	root := b.TempDir()
+	paths := make([]string, 0, n)
+
+	for i := range n {
+		path := filepath.Join(root, fmt.Sprintf("%04d.md", i))
+		if err := os.WriteFile(path, []byte(strings.Repeat("foo bar baz ", 200)), 0o600); err != nil {
+			b.Fatalf("write: %v", err)
+		}
+
+		paths = append(paths, path)
+	}
+
+	for b.Loop() {
+		if _, _, _, err := cli.ChunkFiles(paths, 0); err != nil {
+			b.Fatalf("chunk files: %v", err)
+		}
+	}
+}
+
+func TestChunkURL(t *testing.T) {
+	mux := http.NewServeMux()
+
+	serve := func(path, contentType, body string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			_, _ = io.WriteString(w, body)
+		})
+	}
+
+	serve("/doc.txt", "text/plain; charset=utf-8", "foo bar")
+	serve("/page", "text/html", `<!DOCTYPE html><html><head><style>p { color: red; }</style>
+<script>alert("baz")</script></head><body><p>foo &amp; bar</p><p>qux</p></body></html>`)
+	serve("/image", "image/png", "\x89PNG\r\n\x1a\n")
+	serve("/large.txt", "text/plain", strings.Repeat("x", 2048))
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name    string
+		path    string
+		want    []string
+		wantErr error
+	}{
+		{name: "text", path: "/doc.txt", want: []string{"foo bar"}},
+		{name: "html reduced to text", path: "/page", want: []string{"foo & bar\nqux"}},
+		{name: "non-text content", path: "/image", wantErr: cli.ErrNonTextContent},
+		{name: "too large", path: "/large.txt", wantErr: cli.ErrFileTooLarge},
+		{name: "not found", path: "/missing", wantErr: cli.ErrHTTPStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := cli.ChunkURL(srv.URL+tt.path, types.EmbeddingConfig{ChunkSize: 100, MaxFileBytes: 1024})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want error: %v, got: %v", tt.wantErr, err)
+			}
+
+			if !slices.Equal(tt.want, chunks) {
+				t.Errorf("want chunks: %q, got: %q", tt.want, chunks)
+			}
+		})
+	}
+
+	t.Run("skipped with the files", func(t *testing.T) {
+		root := writeTree(t, map[string]string{"small.md": "foo bar"})
+
+		paths := []string{filepath.Join(root, "small.md"), srv.URL + "/doc.txt", srv.URL + "/missing", srv.URL + "/image"}
+
+		sources, _, _, err := cli.ChunkFiles(paths, 1024)
+		if err != nil {
+			t.Fatalf("chunk files: %v", err)
+		}
+
+		if want := paths[:2]; !slices.Equal(want, sources) {
+			t.Errorf("want sources: %q, got: %q", want, sources)
+		}
+	})
+
+	t.Run("discovered by match", func(t *testing.T) {
+		urls := []string{srv.URL + "/doc.txt", srv.URL + "/page"}
+
+		files, err := cli.Discover(urls, []*regexp.Regexp{regexp.MustCompile(`\.txt$`)}, nil)
+		if err != nil {
+			t.Fatalf("discover: %v", err)
+		}
+
+		if want := urls[:1]; !slices.Equal(want, files) {
+			t.Errorf("want files: %q, got: %q", want, files)
+		}
+	})
+}
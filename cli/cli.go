@@ -1,15 +1,19 @@
 package cli
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 
 	"github.com/ladzaretti/ragx-cli/clierror"
 	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/llm"
 	"github.com/ladzaretti/ragx-cli/types"
 	"github.com/ladzaretti/ragx-cli/vecdb"
 
@@ -27,16 +31,22 @@ var (
 	ErrInvalidSelectedModel   = errors.New("selected model not found in available models")
 	ErrNoEmbedInput           = errors.New("no input provided for embedding")
 	ErrConflictingEmbedInputs = errors.New("cannot embed from both piped input and file arguments")
+	ErrEmbeddingMismatch      = errors.New("vector database was built with a different embedding model")
+	ErrPruneWithoutDBPath     = errors.New("--prune requires --db-path")
 )
 
 const (
+	// defaults of embedding.concurrency and embedding.batch_size
 	embedConcurrency = 8
 	embedBatchSize   = 64
+	chunkConcurrency = embedConcurrency
 )
 
 const (
 	appName                  = "ragx"
 	envConfigPathKeyOverride = "ragx_CONFIG_PATH"
+	envProfileKey            = "RAGX_PROFILE"
+	envErrorFormatKey        = "RAGX_ERROR_FORMAT"
 	defaultBaseURL           = "http://localhost:11434/v1"
 	defaultConfigName        = ".ragx.toml"
 	defaultLogFilename       = ".log"
@@ -44,15 +54,13 @@ const (
 	defaultChunkSize         = 2000
 	defaultOverlap           = 200
 	defaultTopK              = 20
-)
-
-const (
-	reasoningStartTag = "<think>"
-	reasoningEndTag   = "</think>"
+	defaultMaxFileBytes      = 5 << 20 // 5 MiB
+	defaultContextReserve    = 2048
 )
 
 var defaultProvider = types.ProviderConfig{
 	BaseURL: defaultBaseURL,
+	Kind:    types.ProviderKindOllama,
 }
 
 type cleanupFunc func() error
@@ -68,6 +76,7 @@ type DefaultRAGOptions struct {
 
 	cleanupFuncs  []cleanupFunc
 	matchPatterns []string
+	errorFormat   string
 
 	steps []step
 }
@@ -102,7 +111,16 @@ func (o *DefaultRAGOptions) Complete() error {
 }
 
 func (o *DefaultRAGOptions) complete() error { //nolint:revive
-	matchREs, err := compileREs(o.matchPatterns...)
+	if o.llmOptions.maxChunks < 0 {
+		return errf("--max-chunks must be zero or positive")
+	}
+
+	matchREs, err := compileREs("match", o.matchPatterns...)
+	if err != nil {
+		return err
+	}
+
+	excludeREs, err := compileREs("exclude-content", o.llmOptions.excludeContent...)
 	if err != nil {
 		return err
 	}
@@ -110,15 +128,26 @@ func (o *DefaultRAGOptions) complete() error { //nolint:revive
 	o.llmOptions.llmConfig = o.configOptions.resolved.LLM
 	o.llmOptions.promptConfig = *o.configOptions.resolved.Prompt
 	o.llmOptions.embeddingConfig = *o.configOptions.resolved.Embedding
+	o.llmOptions.embeddingConfig.SanitizeUTF8 = o.llmOptions.embeddingConfig.SanitizeUTF8 || o.llmOptions.sanitizeUTF8
+	o.llmOptions.retrievalConfig = *o.configOptions.resolved.Retrieval
+	o.llmOptions.outputConfig = *o.configOptions.resolved.Output
+	o.llmOptions.keysConfig = o.configOptions.resolved.Keys
 	o.llmOptions.embeddingREs = matchREs
+	o.llmOptions.excludeContentREs = excludeREs
 	o.llmOptions.defaultContext = max(o.configOptions.flags.contextLength, 0)
-	o.llmOptions.defaultTemperature = func(v float64) *float64 {
-		if v == -1 {
-			return nil
-		}
 
-		return &v
-	}(o.configOptions.flags.temperature)
+	// an unset --temp keeps the config and provider temperatures
+	if o.configOptions.flags.temperatureSet {
+		temperature := o.configOptions.flags.temperature
+		o.llmOptions.defaultTemperature = &temperature
+	}
+
+	if o.configOptions.flags.keepAliveSet {
+		keepAlive := o.configOptions.flags.keepAlive
+		o.llmOptions.keepAlive = &keepAlive
+	}
+
+	o.llmOptions.configHash = o.llmOptions.hashConfig()
 
 	return nil
 }
@@ -138,6 +167,10 @@ func (o *DefaultRAGOptions) Validate() error {
 func (o *DefaultRAGOptions) Run(ctx context.Context, args ...string) error {
 	for _, s := range o.steps {
 		if err := s(ctx, args...); err != nil {
+			if errors.Is(err, errStepsDone) {
+				return nil
+			}
+
 			return err
 		}
 	}
@@ -148,10 +181,27 @@ func (o *DefaultRAGOptions) Run(ctx context.Context, args ...string) error {
 func (o *DefaultRAGOptions) planFor(cmd *cobra.Command) {
 	o.steps = o.steps[:0]
 
+	// queries answered from --raw-context need neither embeddings nor a vector database
+	if f := cmd.Flags().Lookup("raw-context"); f != nil && f.Changed {
+		o.addStep(func(_ context.Context, _ ...string) error { return o.initLogger() })
+		o.addStep(func(_ context.Context, _ ...string) error { return validateModelParams(o) })
+		o.addStep(func(_ context.Context, _ ...string) error { return o.llmOptions.initProviders(o.Logger) })
+		o.addStep(o.initLLMModels)
+		o.addStep(func(_ context.Context, _ ...string) error { return validateSelectedModels(o.llmOptions) })
+
+		return
+	}
+
 	switch cmd.CalledAs() {
-	case "query", "chat", "tui":
+	case "query", "chat", "tui", "eval":
 		o.addStep(func(_ context.Context, _ ...string) error { return o.initLogger() })
 		o.addStep(func(_ context.Context, _ ...string) error { return validateQueryParams(o) })
+
+		if cmd.Name() == "query" && forwardsToDaemon(cmd) {
+			o.addStep(o.detectDaemon)
+		}
+
+		o.addStep(o.initEmbedCache)
 		o.addStep(func(_ context.Context, _ ...string) error { return o.llmOptions.initProviders(o.Logger) })
 		o.addStep(o.initLLMModels)
 		o.addStep(func(_ context.Context, _ ...string) error { return validateSelectedModels(o.llmOptions) })
@@ -161,6 +211,43 @@ func (o *DefaultRAGOptions) planFor(cmd *cobra.Command) {
 		o.addStep(func(_ context.Context, _ ...string) error { return o.initLogger() })
 		o.addStep(func(_ context.Context, _ ...string) error { return o.llmOptions.initProviders(o.Logger) })
 		o.addStep(o.initLLMModels)
+	case "selftest":
+		o.addStep(func(_ context.Context, _ ...string) error { return o.initLogger() })
+		o.addStep(func(_ context.Context, _ ...string) error { return validateQueryParams(o) })
+		o.addStep(func(_ context.Context, _ ...string) error { return o.llmOptions.initProviders(o.Logger) })
+		o.addStep(o.initLLMModels)
+		o.addStep(func(_ context.Context, _ ...string) error { return validateSelectedModels(o.llmOptions) })
+		o.addStep(o.initVecDim)
+	case "doctor":
+		o.addStep(func(_ context.Context, _ ...string) error { return o.initLogger() })
+		o.addStep(func(_ context.Context, _ ...string) error { return o.llmOptions.initProviders(o.Logger) })
+	case "reindex":
+		o.addStep(func(_ context.Context, _ ...string) error { return o.initLogger() })
+		o.addStep(o.initEmbedCache)
+		o.addStep(func(_ context.Context, _ ...string) error { return o.llmOptions.initProviders(o.Logger) })
+		o.addStep(o.initLLMModels)
+		o.addStep(o.initVecDim)
+		o.addStep(o.initVecdb)
+	case "stats":
+		o.addStep(func(_ context.Context, _ ...string) error { return o.initLogger() })
+		o.addStep(o.openVecdb)
+	case "daemon":
+		o.addStep(func(_ context.Context, _ ...string) error { return o.initLogger() })
+		o.addStep(func(_ context.Context, _ ...string) error { return validateQueryParams(o) })
+		o.addStep(o.initEmbedCache)
+		o.addStep(func(_ context.Context, _ ...string) error { return o.llmOptions.initProviders(o.Logger) })
+		o.addStep(o.initLLMModels)
+		o.addStep(func(_ context.Context, _ ...string) error { return validateSelectedModels(o.llmOptions) })
+		o.addStep(o.initVecDim)
+	case "serve":
+		o.addStep(func(_ context.Context, _ ...string) error { return o.initLogger() })
+		o.addStep(func(_ context.Context, _ ...string) error { return validateQueryParams(o) })
+		o.addStep(o.initEmbedCache)
+		o.addStep(func(_ context.Context, _ ...string) error { return o.llmOptions.initProviders(o.Logger) })
+		o.addStep(o.initLLMModels)
+		o.addStep(func(_ context.Context, _ ...string) error { return validateSelectedModels(o.llmOptions) })
+		o.addStep(o.initVecDim)
+		o.addStep(o.openVecdb)
 	default:
 	}
 }
@@ -170,9 +257,20 @@ func (o *DefaultRAGOptions) addStep(s step) {
 }
 
 func (o *DefaultRAGOptions) massageFlags(f *pflag.FlagSet) {
-	if !f.Lookup("temp").Changed {
-		o.configOptions.flags.temperature = -1
+	o.configOptions.flags.temperatureSet = f.Changed("temp")
+	o.configOptions.flags.keepAliveSet = f.Lookup("keep-alive").Changed
+	o.configOptions.flags.topKSet = f.Lookup("top-k").Changed || f.Lookup("topk").Changed
+}
+
+// setErrorFormat sets the format errors are printed in,
+// from the --error-format flag or else the environment.
+func (o *DefaultRAGOptions) setErrorFormat() error {
+	f := cmp.Or(o.errorFormat, os.Getenv(envErrorFormatKey), clierror.FormatText)
+	if err := clierror.SetFormat(f); err != nil {
+		return fmt.Errorf("error format: %w", err)
 	}
+
+	return nil
 }
 
 func (o *DefaultRAGOptions) initLogger() error {
@@ -189,7 +287,17 @@ func (o *DefaultRAGOptions) initLogger() error {
 	level, _ := genericclioptions.ParseLevel(o.configOptions.resolved.Logging.Level)
 	o.SetLevel(level)
 
-	logger := slog.New(slog.NewTextHandler(f, &slog.HandlerOptions{Level: level}))
+	opts := &slog.HandlerOptions{
+		Level:     level,
+		AddSource: o.configOptions.resolved.Logging.AddSource,
+	}
+
+	var handler slog.Handler = slog.NewTextHandler(f, opts)
+	if o.configOptions.resolved.Logging.Format == types.LogFormatJSON {
+		handler = slog.NewJSONHandler(f, opts)
+	}
+
+	logger := slog.New(handler)
 
 	o.Opts(genericclioptions.WithLogger(logger))
 
@@ -197,18 +305,82 @@ func (o *DefaultRAGOptions) initLogger() error {
 }
 
 func (o *DefaultRAGOptions) initLLMModels(ctx context.Context, _ ...string) error {
+	contexts := map[string]int{}
+
 	for _, p := range o.llmOptions.providers {
-		m, err := p.Client.ListModels(ctx)
+		// servers that cannot list their models are assumed to serve the configured ones
+		if !p.Preset.ListModels {
+			p.AvailableModels = o.llmOptions.configuredModels()
+			continue
+		}
+
+		models, err := p.Client.ListModels(ctx)
 		if err != nil {
 			return errf("llm list models: %v", err)
 		}
 
-		p.AvailableModels = m
+		p.AvailableModels = make([]string, 0, len(models))
+
+		for _, m := range models {
+			p.AvailableModels = append(p.AvailableModels, m.ID)
+
+			if _, ok := contexts[m.ID]; !ok && m.ContextLength > 0 {
+				contexts[m.ID] = m.ContextLength
+			}
+		}
 	}
 
+	o.probeContextWindows(ctx, contexts)
+
+	// detected contexts are kept apart from the configured models,
+	// which would otherwise list every model the providers serve
+	o.llmOptions.modelContexts = contexts
+
 	return nil
 }
 
+// contextWindower is implemented by clients that can query the
+// context window a model is served with.
+type contextWindower interface {
+	ModelContextWindow(ctx context.Context, model string) (int, bool)
+}
+
+// probeContextWindows adds to contexts the context window of the chat models
+// that neither configure one nor have it reported by the models list,
+// queried from the first provider serving them that reports it.
+// Models whose window is not reported keep the configured default.
+func (o *DefaultRAGOptions) probeContextWindows(ctx context.Context, contexts map[string]int) {
+	var (
+		cfg    = o.llmOptions.llmConfig
+		models = []string{cfg.DefaultModel}
+	)
+
+	for _, m := range cfg.Models {
+		models = append(models, m.ID)
+	}
+
+	for _, model := range models {
+		configured := slices.ContainsFunc(cfg.Models, func(m types.ModelConfig) bool { return m.ID == model && m.Context > 0 })
+		if _, ok := contexts[model]; ok || model == "" || configured {
+			continue
+		}
+
+		for _, p := range o.llmOptions.providers.ProvidersFor(model) {
+			cw, ok := p.Client.(contextWindower)
+			if !p.Preset.ContextWindow || !ok {
+				continue
+			}
+
+			if n, ok := cw.ModelContextWindow(ctx, model); ok {
+				o.Logger.Debug("detected context window", "model", model, "context", n)
+				contexts[model] = n
+
+				break
+			}
+		}
+	}
+}
+
 func (o *DefaultRAGOptions) initVecDim(ctx context.Context, _ ...string) error {
 	model := o.llmOptions.embeddingConfig.Model
 
@@ -216,31 +388,143 @@ func (o *DefaultRAGOptions) initVecDim(ctx context.Context, _ ...string) error {
 		return ErrMissingEmbeddingModel
 	}
 
-	d, err := o.llmOptions.dimFor(ctx, model)
+	// a requested reduced size is used as is; indexing checks it
+	// against the embeddings actually returned.
+	if d := o.llmOptions.embeddingConfig.Dimensions; d > 0 {
+		o.llmOptions.dim = d
+
+		return nil
+	}
+
+	provider, err := o.llmOptions.providers.ProviderFor(model)
+	if err != nil {
+		return fmt.Errorf("init embedding dim: provider for: %w", err)
+	}
+
+	var (
+		cache = o.loadDimCache()
+		key   = dimCacheKey(provider.BaseURL, model)
+	)
+
+	if d, ok := cache.get(key); ok && !o.configOptions.flags.refreshDim {
+		o.Logger.Debug("using cached embedding dim", "model", model, "dim", d)
+		o.llmOptions.dim = d
+
+		return nil
+	}
+
+	d, err := dimFor(ctx, provider, model)
 	if err != nil {
 		return fmt.Errorf("init embedding dim: %w", err)
 	}
 
 	o.llmOptions.dim = d
 
+	if err := cache.set(key, d); err != nil {
+		o.Logger.Warn("cache embedding dim", "err", err)
+	}
+
 	return nil
 }
 
+// loadDimCache loads the embedding dim cache.
+// The cache is best effort; on failure an empty in-memory cache is returned.
+func (o *DefaultRAGOptions) loadDimCache() *dimCache {
+	path, err := defaultDimCachePath()
+	if err != nil {
+		o.Logger.Warn("dim cache path", "err", err)
+		return &dimCache{dims: map[string]int{}}
+	}
+
+	cache, err := loadDimCache(path)
+	if err != nil {
+		o.Logger.Warn("load dim cache", "err", err)
+		return &dimCache{path: path, dims: map[string]int{}}
+	}
+
+	return cache
+}
+
 func (o *DefaultRAGOptions) initVecdb(_ context.Context, _ ...string) error {
 	if o.llmOptions.dim == 0 {
 		return ErrMissingDimension
 	}
 
-	v, err := vecdb.New(o.llmOptions.dim)
+	opts := []vecdb.Opt{vecdb.WithModel(o.llmOptions.embeddingConfig.Model)}
+	if p := o.llmOptions.dbPath; p != "" {
+		opts = append(opts, vecdb.WithPath(p))
+	}
+
+	v, err := vecdb.New(o.llmOptions.dim, opts...)
+	if errors.Is(err, vecdb.ErrDimMismatch) || errors.Is(err, vecdb.ErrModelMismatch) {
+		return embeddingMismatch(o.llmOptions.dbPath, err)
+	}
+
 	if err != nil {
 		return errf("create vector database:%v", err)
 	}
 
 	o.llmOptions.vectordb = v
+	o.cleanupFuncs = append(o.cleanupFuncs, v.Close)
+
+	return nil
+}
+
+// initEmbedCache opens the embedding cache, if configured.
+func (o *DefaultRAGOptions) initEmbedCache(_ context.Context, _ ...string) error {
+	path := o.llmOptions.embeddingConfig.CachePath
+	if path == "" {
+		return nil
+	}
+
+	c, err := llm.OpenEmbedCache(path)
+	if err != nil {
+		return errf("open embedding cache: %v", err)
+	}
+
+	o.llmOptions.embedCache = c
+	o.cleanupFuncs = append(o.cleanupFuncs, c.Close)
+
+	return nil
+}
+
+// openVecdb opens the persistent vector database read-only.
+func (o *DefaultRAGOptions) openVecdb(_ context.Context, _ ...string) error {
+	v, err := vecdb.Open(o.llmOptions.dbPath)
+	if err != nil {
+		return errf("open vector database: %v", err)
+	}
+
+	o.llmOptions.vectordb = v
+	o.cleanupFuncs = append(o.cleanupFuncs, v.Close)
+
+	// without a resolved dim (stats) there is nothing to search with
+	if o.llmOptions.dim == 0 {
+		return nil
+	}
+
+	if d := v.Dim(); d != o.llmOptions.dim {
+		return embeddingMismatch(o.llmOptions.dbPath,
+			fmt.Errorf("%w: database has %d, want %d", vecdb.ErrDimMismatch, d, o.llmOptions.dim))
+	}
+
+	if m, want := v.Model(), o.llmOptions.embeddingConfig.Model; m != "" && m != want {
+		return embeddingMismatch(o.llmOptions.dbPath,
+			fmt.Errorf("%w: database has %q, want %q", vecdb.ErrModelMismatch, m, want))
+	}
 
 	return nil
 }
 
+// embeddingMismatch reports a database that cannot be searched with the
+// configured embedding model, and how to get out of it.
+// The existing vectors cannot be converted, so the chunks must be embedded again.
+func embeddingMismatch(path string, err error) error {
+	return fmt.Errorf("%w: %s: %v; switch back to the embedding model it was built with, "+
+		"use a different --db-path, or delete it and embed the files again with 'ragx reindex'",
+		ErrEmbeddingMismatch, path, err)
+}
+
 // NewDefaultRAGCommand creates the root cobra command.
 func NewDefaultRAGCommand(iostreams *genericclioptions.IOStreams, args []string) *cobra.Command {
 	o := NewDefaultRAGOptions(iostreams)
@@ -248,6 +532,7 @@ func NewDefaultRAGCommand(iostreams *genericclioptions.IOStreams, args []string)
 	cmd := &cobra.Command{
 		Use:  "ragx",
 		Args: cobra.NoArgs,
+		// the default completion command is replaced by the documented "ragx completion"
 		CompletionOptions: cobra.CompletionOptions{
 			DisableDefaultCmd: true,
 		}, Short: "",
@@ -255,6 +540,10 @@ func NewDefaultRAGCommand(iostreams *genericclioptions.IOStreams, args []string)
 Embed data, run retrieval, and query local or remote OpenAI API-compatible LLMs.`,
 		SilenceUsage: true,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.setErrorFormat(); err != nil {
+				return clierror.Check(err)
+			}
+
 			o.massageFlags(cmd.Flags())
 			o.planFor(cmd)
 
@@ -269,18 +558,33 @@ Embed data, run retrieval, and query local or remote OpenAI API-compatible LLMs.
 
 	cmd.PersistentFlags().Float64VarP(&o.configOptions.flags.temperature, "temp", "t", 0, "default sampling temperature (0.0-2.0)")
 	cmd.PersistentFlags().IntVarP(&o.configOptions.flags.contextLength, "context", "x", 0, "default context length in tokens")
-	cmd.PersistentFlags().IntVarP(&o.configOptions.flags.topK, "topk", "k", 0, "number of retrieved chunks")
+	cmd.PersistentFlags().DurationVarP(&o.configOptions.flags.keepAlive, "keep-alive", "", 0, "keep the model loaded for this long between requests (ollama providers; negative keeps it loaded)")
+	cmd.PersistentFlags().StringVarP(&o.configOptions.flags.embedCache, "embed-cache", "", "", "path to an on-disk embedding cache (overrides embedding.cache_path)")
+	cmd.PersistentFlags().IntVarP(&o.configOptions.flags.batchSize, "embed-batch-size", "", 0, "number of chunks per embedding request (overrides embedding.batch_size)")
+	cmd.PersistentFlags().IntVarP(&o.configOptions.flags.concurrency, "embed-concurrency", "", 0, "number of files embedded concurrently (overrides embedding.concurrency)")
+	cmd.PersistentFlags().BoolVarP(&o.configOptions.flags.refreshDim, "refresh-dim", "", false, "re-probe the embedding dimension instead of using the cached one")
+	cmd.PersistentFlags().IntVarP(&o.configOptions.flags.topK, "top-k", "k", 0, "number of retrieved chunks, 0 disables retrieval (overrides embedding.top_k)")
+	cmd.PersistentFlags().IntVarP(&o.configOptions.flags.topK, "topk", "", 0, "number of retrieved chunks")
+	_ = cmd.PersistentFlags().MarkDeprecated("topk", "use --top-k instead")
 	cmd.PersistentFlags().StringVarP(&o.configOptions.flags.model, "model", "m", "", "set LLM model")
 	cmd.PersistentFlags().StringVarP(&o.configOptions.flags.configPath, "config", "c", "", fmt.Sprintf("path to config file (default: %q in the home directory)", defaultConfigName))
+	cmd.PersistentFlags().BoolVarP(&o.configOptions.flags.noConfig, "no-config", "", false, "ignore config files and use only defaults, flags and env")
+	cmd.PersistentFlags().StringArrayVarP(&o.configOptions.flags.set, "set", "", nil, "set a config value by its dotted key, applied last (e.g. embedding.top_k=10; repeatable)")
+	cmd.PersistentFlags().StringVarP(&o.configOptions.flags.profile, "profile", "p", "", fmt.Sprintf("config profile to apply over the top-level config (env: %s)", envProfileKey))
 	cmd.PersistentFlags().StringVarP(&o.configOptions.flags.embeddingModel, "embedding-model", "e", "", "set embedding model")
+	cmd.PersistentFlags().StringVarP(&o.configOptions.flags.system, "system", "", "", "system prompt for this run (overrides prompt.system_prompt and prompt.system_prompt_file)")
 	cmd.PersistentFlags().StringVarP(&o.configOptions.flags.logDir, "log-dir", "d", "", "set log directory")
 	cmd.PersistentFlags().StringVarP(&o.configOptions.flags.logFilename, "log-file", "f", "", "set log filename")
 	cmd.PersistentFlags().StringVarP(&o.configOptions.flags.logLevel, "log-level", "l", "", "set log level (debug, info, warn, error)")
+	cmd.PersistentFlags().StringVarP(&o.errorFormat, "error-format", "", "", fmt.Sprintf("format of printed errors: text or json (env: %s)", envErrorFormatKey))
 	cmd.PersistentFlags().StringSliceVarP(&o.matchPatterns, "match", "M", nil, "regex pattern(s) to match files (e.g. '^.*\\.md$', '(?i)\\.txt$')")
 
 	hiddenFlags := []string{
 		"base-url",
 		"config",
+		"no-config",
+		"set",
+		"profile",
 		"dim",
 		"embedding-model",
 		"topk",
@@ -291,33 +595,59 @@ Embed data, run retrieval, and query local or remote OpenAI API-compatible LLMs.
 		"model",
 		"temp",
 		"context",
+		"system",
+		"keep-alive",
+		"refresh-dim",
+		"embed-cache",
+		"embed-batch-size",
+		"embed-concurrency",
 	}
 
 	genericclioptions.MarkFlagsHidden(cmd, hiddenFlags...)
 
+	_ = cmd.RegisterFlagCompletionFunc("model", o.completeModels)
+	_ = cmd.RegisterFlagCompletionFunc("embedding-model", o.completeModels)
+
 	cmd.AddCommand(NewCmdChat(o))
 	cmd.AddCommand(NewCmdQuery(o))
+	cmd.AddCommand(NewCmdEval(o))
 	cmd.AddCommand(NewCmdConfig(o))
 	cmd.AddCommand(NewCmdListModels(o))
+	cmd.AddCommand(NewCmdStats(o))
+	cmd.AddCommand(NewCmdReindex(o))
+	cmd.AddCommand(NewCmdServe(o))
+	cmd.AddCommand(NewCmdDaemon(o))
+	cmd.AddCommand(NewCmdDoctor(o))
+	cmd.AddCommand(NewCmdSelftest(o))
+	cmd.AddCommand(newCompletionCommand(o))
 	cmd.AddCommand(newVersionCommand(o))
 
 	return cmd
 }
 
-func validateQueryParams(o *DefaultRAGOptions) error {
-	var (
-		model          = o.configOptions.resolved.LLM.DefaultModel
-		embeddingModel = o.configOptions.resolved.Embedding.Model
-	)
-
-	if model == "" {
+// validateModelParams checks the parameters needed to query
+// the LLM, without retrieval.
+func validateModelParams(o *DefaultRAGOptions) error {
+	if o.configOptions.resolved.LLM.DefaultModel == "" {
 		return ErrMissingLLMModel
 	}
 
-	if embeddingModel == "" {
+	return nil
+}
+
+func validateQueryParams(o *DefaultRAGOptions) error {
+	if err := validateModelParams(o); err != nil {
+		return err
+	}
+
+	if o.configOptions.resolved.Embedding.Model == "" {
 		return ErrMissingEmbeddingModel
 	}
 
+	if o.llmOptions.prune && o.llmOptions.dbPath == "" {
+		return ErrPruneWithoutDBPath
+	}
+
 	errs := make([]error, 0, len(o.matchPatterns))
 
 	for _, p := range o.matchPatterns {
@@ -363,7 +693,8 @@ func executeCleanup(fs []cleanupFunc) error {
 	return errors.Join(errs...)
 }
 
-func compileREs(exprs ...string) ([]*regexp.Regexp, error) {
+// compileREs compiles the regexes given to the named flag.
+func compileREs(flag string, exprs ...string) ([]*regexp.Regexp, error) {
 	var (
 		matchREs = make([]*regexp.Regexp, 0, len(exprs))
 		errs     = make([]error, 0, len(exprs))
@@ -372,7 +703,7 @@ func compileREs(exprs ...string) ([]*regexp.Regexp, error) {
 	for _, expr := range exprs {
 		re, err := regexp.Compile(expr)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("invalid --match regex %q: %w", expr, err))
+			errs = append(errs, fmt.Errorf("invalid --%s regex %q: %w", flag, expr, err))
 			continue
 		}
 
@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// completionTimeout bounds listing the provider models for shell completion.
+	completionTimeout = 3 * time.Second
+
+	// completionCacheTTL is how long listed models are reused by completion,
+	// so repeated tabs do not list the models of every provider again.
+	completionCacheTTL = 5 * time.Second
+
+	completionCacheFilename = "completion-models.json"
+)
+
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+func newCompletionCommand(defaults *DefaultRAGOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion bash|zsh|fish|powershell",
+		Short: "Generate a shell completion script",
+		Long: `Generate the completion script of ragx for the given shell.
+
+Model flags (--model, --embedding-model) complete from the models listed
+by the configured providers.`,
+		Example: `# bash, for the current session
+  source <(ragx completion bash)
+
+  # zsh, installed into the first fpath directory
+  ragx completion zsh > "${fpath[1]}/_ragx"
+
+  # fish
+  ragx completion fish > ~/.config/fish/completions/ragx.fish`,
+		ValidArgs:             completionShells,
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		DisableFlagsInUseLine: true,
+		SilenceErrors:         true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, out := cmd.Root(), defaults.Out
+
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(out, true)
+			case "zsh":
+				return root.GenZshCompletion(out)
+			case "fish":
+				return root.GenFishCompletion(out, true)
+			default:
+				return root.GenPowerShellCompletionWithDesc(out)
+			}
+		},
+	}
+
+	genericclioptions.MarkAllFlagsHidden(cmd, "help")
+
+	return cmd
+}
+
+// completeModels completes a model flag from the models listed by the
+// configured providers. Completion runs without the command hooks, so the
+// config and providers are initialized here; any failure, such as an
+// unreachable server, completes nothing.
+func (o *DefaultRAGOptions) completeModels(cmd *cobra.Command, _ []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	o.massageFlags(cmd.Flags())
+
+	if err := o.configOptions.Complete(); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	if err := o.complete(); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	models, err := o.listModels(ctx)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []cobra.Completion
+
+	for _, m := range models {
+		if strings.HasPrefix(m, toComplete) {
+			completions = append(completions, m)
+		}
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// listModels returns the sorted models of the configured providers,
+// reusing the models listed by a recent completion, if any.
+func (o *DefaultRAGOptions) listModels(ctx context.Context) ([]string, error) {
+	key := completionCacheKey(o.llmOptions.llmConfig.Providers)
+
+	path, pathErr := defaultCompletionCachePath()
+	if pathErr == nil {
+		if models, ok := readCompletionCache(path, key, time.Now()); ok {
+			return models, nil
+		}
+	}
+
+	if err := o.llmOptions.initProviders(slog.New(slog.DiscardHandler)); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+
+	if err := o.initLLMModels(ctx); err != nil {
+		return nil, err
+	}
+
+	var models []string
+	for _, p := range o.llmOptions.providers {
+		models = append(models, p.AvailableModels...)
+	}
+
+	slices.Sort(models)
+	models = slices.Compact(models)
+
+	if pathErr == nil {
+		// best effort, the next completion lists the models again
+		_ = writeCompletionCache(path, completionCacheEntry{Key: key, Models: models, ListedAt: time.Now()})
+	}
+
+	return models, nil
+}
+
+// completionCacheEntry holds the models listed by the last completion.
+type completionCacheEntry struct {
+	Key      string    `json:"key"`
+	Models   []string  `json:"models"`
+	ListedAt time.Time `json:"listed_at"`
+}
+
+// completionCacheKey identifies the providers whose models are cached.
+func completionCacheKey(providers []types.ProviderConfig) string {
+	var sb strings.Builder
+	for _, p := range providers {
+		sb.WriteString(p.Kind + " " + p.BaseURL + "\n")
+	}
+
+	return sb.String()
+}
+
+// readCompletionCache returns the cached models of key,
+// if they were listed less than [completionCacheTTL] before now.
+func readCompletionCache(path, key string, now time.Time) ([]string, bool) {
+	raw, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, false
+	}
+
+	var e completionCacheEntry
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return nil, false
+	}
+
+	if e.Key != key || now.Sub(e.ListedAt) >= completionCacheTTL || now.Before(e.ListedAt) {
+		return nil, false
+	}
+
+	return e.Models, true
+}
+
+func writeCompletionCache(path string, e completionCacheEntry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Clean(path), raw, 0o600)
+}
+
+func defaultCompletionCachePath() (string, error) {
+	dir, err := defaultStateDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, completionCacheFilename), nil
+}
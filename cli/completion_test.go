@@ -0,0 +1,113 @@
+package cli_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/llm/fake"
+)
+
+func TestCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		t.Run(shell, func(t *testing.T) {
+			iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+			cmd := cli.NewDefaultRAGCommand(iostreams, []string{"completion", shell, "--no-config"})
+			if err := cmd.ExecuteContext(context.Background()); err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+
+			if !strings.Contains(out.String(), "ragx") {
+				t.Errorf("want a completion script for ragx, got:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestCompletion_Models(t *testing.T) {
+	backend := &fake.Backend{Models: []string{"foo", "bar", "foo-mini"}}
+	config := writeTestConfig(t, "http://127.0.0.1:0")
+
+	cli.UseBackend(t, backend)
+
+	tests := []struct {
+		flag       string
+		toComplete string
+		want       []string
+	}{
+		{flag: "--model", toComplete: "", want: []string{"bar", "foo", "foo-mini"}},
+		{flag: "--model", toComplete: "foo", want: []string{"foo", "foo-mini"}},
+		{flag: "--embedding-model", toComplete: "b", want: []string{"bar"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flag+"="+tt.toComplete, func(t *testing.T) {
+			if got := completeFlag(t, config, tt.flag, tt.toComplete); !slices.Equal(tt.want, got) {
+				t.Errorf("want completions %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCompletion_ModelsCached(t *testing.T) {
+	backend := &fake.Backend{Models: []string{"foo"}}
+	config := writeTestConfig(t, "http://127.0.0.1:0")
+
+	cli.UseBackend(t, backend)
+
+	if got := completeFlag(t, config, "--model", ""); !slices.Equal([]string{"foo"}, got) {
+		t.Fatalf("want completions %q, got %q", []string{"foo"}, got)
+	}
+
+	// models listed by a recent completion are reused
+	backend.Models = []string{"foo", "bar"}
+
+	if got := completeFlag(t, config, "--model", ""); !slices.Equal([]string{"foo"}, got) {
+		t.Errorf("want cached completions %q, got %q", []string{"foo"}, got)
+	}
+}
+
+func TestCompletion_ModelsOffline(t *testing.T) {
+	config := writeTestConfig(t, "http://127.0.0.1:0")
+
+	if got := completeFlag(t, config, "--model", ""); len(got) != 0 {
+		t.Errorf("want no completions, got %q", got)
+	}
+}
+
+// completeFlag returns the completions of the query flag.
+func completeFlag(t *testing.T, config, flag, toComplete string) []string {
+	t.Helper()
+
+	iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	args := []string{"__complete", "query", "--config", config, flag, toComplete}
+
+	var out strings.Builder
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, args)
+	cmd.SetOut(&out)
+
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	// completions are listed one per line, followed by the ":<directive>" line
+	var got []string
+
+	for line := range strings.Lines(out.String()) {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, ":") {
+			got = append(got, line)
+		}
+	}
+
+	if !strings.Contains(out.String(), ":4") {
+		t.Errorf("want the no file completion directive, got:\n%s", out.String())
+	}
+
+	return got
+}
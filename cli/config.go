@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ladzaretti/ragx-cli/cli/prompt"
@@ -31,9 +32,13 @@ type configOptions struct {
 
 type EnvConfig struct {
 	providers []types.ProviderConfig
+	profile   string
 }
 
-func (env *EnvConfig) load() { env.providers = providersFromEnv() }
+func (env *EnvConfig) load() {
+	env.providers = providersFromEnv()
+	env.profile = os.Getenv(envProfileKey)
+}
 
 func providersFromEnv() []types.ProviderConfig {
 	baseURL, ok := os.LookupEnv("OPENAI_API_BASE")
@@ -52,14 +57,26 @@ func providersFromEnv() []types.ProviderConfig {
 // Flags holds cli overrides for configuration.
 type Flags struct {
 	configPath     string
+	noConfig       bool
+	profile        string
+	set            []string
 	model          string
 	temperature    float64
+	temperatureSet bool
 	contextLength  int
 	embeddingModel string
+	system         string
 	topK           int
+	topKSet        bool
 	logDir         string
 	logFilename    string
 	logLevel       string
+	keepAlive      time.Duration
+	keepAliveSet   bool
+	refreshDim     bool
+	embedCache     string
+	batchSize      int
+	concurrency    int
 }
 
 type Duration time.Duration
@@ -82,7 +99,12 @@ func NewConfigOptions(stdio *genericclioptions.StdioOptions) *configOptions {
 func (o *configOptions) Resolved() *Config { return o.resolved }
 
 func (o *configOptions) Complete() error {
-	c, err := LoadFileConfig(o.flags.configPath)
+	load := LoadFileConfig
+	if o.flags.noConfig {
+		load = func(string) (*Config, error) { return LoadDefaultConfig() }
+	}
+
+	c, err := load(o.flags.configPath)
 	if err != nil {
 		return err
 	}
@@ -91,47 +113,125 @@ func (o *configOptions) Complete() error {
 
 	o.fileConfig = c
 
-	if err := o.resolve(); err != nil {
+	return o.resolve()
+}
+
+// resolve layers the configuration sources by precedence:
+// --set > flags > env > selected profile > top-level file config > defaults.
+func (o *configOptions) resolve() error {
+	base := o.fileConfig.clone()
+
+	if name := o.profile(); name != "" {
+		c, err := o.fileConfig.withProfile(name)
+		if err != nil {
+			return err
+		}
+
+		base = c
+	}
+
+	o.resolved = base
+
+	o.resolved.path = cmp.Or(o.flags.configPath, base.path)
+
+	if err := o.resolved.loadPromptFiles(); err != nil {
 		return err
 	}
 
+	o.resolved.LLM.DefaultModel = cmp.Or(o.flags.model, base.LLM.DefaultModel)
+	o.resolved.LLM.Providers = append(o.resolved.LLM.Providers, o.envConfig.providers...)
+
 	if len(o.resolved.LLM.Providers) == 0 {
 		o.resolved.LLM.Providers = append(o.resolved.LLM.Providers, defaultProvider)
 	}
 
-	return o.resolve()
-}
+	if err := o.resolved.resolveAPIKeys(); err != nil {
+		return err
+	}
 
-func (o *configOptions) resolve() error {
-	o.resolved = o.fileConfig
+	if err := o.resolved.resolveCAFiles(); err != nil {
+		return err
+	}
 
-	o.resolved.path = cmp.Or(o.flags.configPath, o.fileConfig.path)
+	for _, p := range o.resolved.LLM.Providers {
+		if p.InsecureSkipVerify {
+			fmt.Fprintf(o.ErrOut, "warning: TLS certificate verification is disabled for %s\n", p.BaseURL)
+		}
+	}
 
-	o.resolved.LLM.DefaultModel = cmp.Or(o.flags.model, o.fileConfig.LLM.DefaultModel)
-	o.resolved.LLM.Providers = append(o.resolved.LLM.Providers, o.envConfig.providers...)
+	// an empty --system keeps the configured or default system prompt
+	o.resolved.Prompt.System = cmp.Or(o.flags.system, base.Prompt.System, defaultSystemPrompt(base.Output))
+	o.resolved.Prompt.UserPromptTmpl = cmp.Or(base.Prompt.UserPromptTmpl, prompt.DefaultUserPromptTmpl)
 
-	o.resolved.Prompt.System = cmp.Or(o.fileConfig.Prompt.System, prompt.DefaultSystemPrompt)
-	o.resolved.Prompt.UserPromptTmpl = cmp.Or(o.fileConfig.Prompt.UserPromptTmpl, prompt.DefaultUserPromptTmpl)
+	o.resolved.Embedding.Model = cmp.Or(o.flags.embeddingModel, base.Embedding.Model)
 
-	o.resolved.Embedding.Model = cmp.Or(o.flags.embeddingModel, o.fileConfig.Embedding.Model)
-	o.resolved.Embedding.TopK = cmp.Or(o.flags.topK, o.fileConfig.Embedding.TopK)
+	// unlike the config, an explicit zero top-k disables retrieval
+	if o.flags.topKSet {
+		if o.flags.topK < 0 {
+			return &ConfigError{Opt: "top-k", Err: errors.New("must be zero or positive")}
+		}
 
-	o.resolved.Logging.Dir = cmp.Or(o.flags.logDir, o.fileConfig.Logging.Dir)
-	o.resolved.Logging.Filename = cmp.Or(o.flags.logFilename, o.fileConfig.Logging.Filename)
-	o.resolved.Logging.Level = cmp.Or(os.Getenv("LOG_LEVEL"), o.flags.logLevel, o.fileConfig.Logging.Level)
+		o.resolved.Embedding.TopK = o.flags.topK
+	}
 
-	return nil
+	o.resolved.Embedding.CachePath = cmp.Or(o.flags.embedCache, base.Embedding.CachePath)
+	o.resolved.Embedding.BatchSize = cmp.Or(o.flags.batchSize, base.Embedding.BatchSize)
+	o.resolved.Embedding.Concurrency = cmp.Or(o.flags.concurrency, base.Embedding.Concurrency)
+
+	o.resolved.Logging.Dir = cmp.Or(o.flags.logDir, base.Logging.Dir)
+	o.resolved.Logging.Filename = cmp.Or(o.flags.logFilename, base.Logging.Filename)
+	o.resolved.Logging.Level = cmp.Or(os.Getenv("LOG_LEVEL"), o.flags.logLevel, base.Logging.Level)
+	o.resolved.Logging.Format = cmp.Or(os.Getenv("LOG_FORMAT"), base.Logging.Format)
+
+	if len(o.flags.set) == 0 {
+		return nil
+	}
+
+	for _, kv := range o.flags.set {
+		if err := o.resolved.set(kv); err != nil {
+			return err
+		}
+	}
+
+	return o.resolved.validate()
+}
+
+// profile returns the name of the selected profile, if any.
+func (o *configOptions) profile() string {
+	return cmp.Or(o.flags.profile, o.envConfig.profile)
+}
+
+// defaultSystemPrompt returns the default system prompt, with its
+// fallback answer replaced by the configured no context message.
+func defaultSystemPrompt(output *types.OutputConfig) string {
+	if output == nil || output.NoContextMessage == "" {
+		return prompt.DefaultSystemPrompt
+	}
+
+	return strings.ReplaceAll(prompt.DefaultSystemPrompt, prompt.NoContextAnswer, output.NoContextMessage)
 }
 
 func (o *configOptions) Validate() (retErr error) {
+	if o.flags.noConfig && o.flags.configPath != "" {
+		return errf("--no-config cannot be used with --config")
+	}
+
 	if _, err := genericclioptions.ParseLevel(o.resolved.Logging.Level); err != nil {
 		return err
 	}
 
+	// LOG_FORMAT may override the validated file config
+	if err := validateLogFormat(o.resolved.Logging.Format); err != nil {
+		return &ConfigError{Opt: "LOG_FORMAT", Err: err}
+	}
+
 	for _, p := range o.envConfig.providers {
 		retErr = errors.Join(retErr, validateProviderConfig(p))
 	}
 
+	// flags may override the validated file config
+	retErr = errors.Join(retErr, validateEmbeddingThroughput(o.resolved.Embedding))
+
 	return
 }
 
@@ -143,6 +243,9 @@ func NewCmdConfig(defaults *DefaultRAGOptions) *cobra.Command {
 		"base-url",
 		"dim",
 		"embedding-model",
+		"embed-cache",
+		"embed-batch-size",
+		"embed-concurrency",
 		"topk",
 		"match",
 		"model",
@@ -150,7 +253,8 @@ func NewCmdConfig(defaults *DefaultRAGOptions) *cobra.Command {
 		"context",
 	}
 
-	o := NewConfigOptions(defaults.StdioOptions)
+	// the root command resolves the config, including its flags
+	o := defaults.configOptions
 
 	cmd := &cobra.Command{
 		Use:   "config",
@@ -173,12 +277,14 @@ If --config is not provided, the default path (~/%s) is used.`, defaultConfigNam
 
 			c := struct {
 				Path     string `json:"path"`
+				Profile  string `json:"profile,omitempty"`
 				Parsed   any    `json:"parsed_config"`   //nolint:tagliatelle
 				Resolved any    `json:"resolved_config"` //nolint:tagliatelle
 			}{
 				Path:     o.fileConfig.path,
-				Parsed:   o.fileConfig,
-				Resolved: o.resolved,
+				Profile:  o.profile(),
+				Parsed:   o.fileConfig.Redacted(),
+				Resolved: o.resolved.Redacted(),
 			}
 
 			o.Printf("%s", stringifyPretty(c))
@@ -212,6 +318,22 @@ func stringifyPretty(v any) string {
 	return buf.String()
 }
 
+// stringify returns the single-line JSON representation of v.
+// If marshalling fails, it returns the error message instead.
+func stringify(v any) string {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprintf("stringify error: %v", err)
+	}
+
+	return buf.String()
+}
+
 type generateConfigOptions struct {
 	*genericclioptions.StdioOptions
 }
@@ -1,15 +1,24 @@
 package cli
 
 import (
+	"bytes"
 	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/ladzaretti/ragx-cli/cli/extract"
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/ragx"
 	"github.com/ladzaretti/ragx-cli/types"
 	"github.com/pelletier/go-toml/v2"
 )
@@ -37,17 +46,54 @@ type Config struct {
 	LLM       types.LLMConfig        `json:"llm"                 toml:"llm"`
 	Prompt    *types.PromptConfig    `json:"prompt,omitempty"    toml:"prompt,omitempty"`
 	Embedding *types.EmbeddingConfig `json:"embedding,omitempty" toml:"embedding,omitempty"`
+	Retrieval *types.RetrievalConfig `json:"retrieval,omitempty" toml:"retrieval,omitempty"`
+	Output    *types.OutputConfig    `json:"output,omitempty"    toml:"output,omitempty"`
+	Keys      types.KeysConfig       `json:"keys,omitempty"      toml:"keys,commented"     comment:"Chat key bindings by action, in bubbletea key notation; history, models and clear are pressed after the prefix key\n(defaults: submit = 'ctrl+s', cancel = 'esc', prefix = 'ctrl+a', new_chat = 'ctrl+n', history = 'h', models = 'm', clear = 'l')\ne.g. keys = { submit = 'ctrl+d', prefix = 'ctrl+x' }"`
 	Logging   *types.LoggingConfig   `json:"logging,omitempty"   toml:"logging,commented"`
+	Profiles  map[string]*Profile    `json:"profiles,omitempty"  toml:"profiles,commented" comment:"Named overrides of the llm, embedding and prompt sections, selected with --profile or RAGX_PROFILE\n[profiles.remote.llm]\ndefault_model = 'gpt-4o-mini'\n[[profiles.remote.llm.providers]]\nkind = 'openai'\napi_key = '<KEY>'\n[profiles.remote.embedding]\nembedding_model = 'text-embedding-3-small'"`
 
 	path string
 }
 
+// Profile is a named set of overrides of the llm, embedding and prompt
+// sections, selected with --profile or RAGX_PROFILE, e.g.:
+//
+//	[profiles.remote.llm]
+//	default_model = 'gpt-4o-mini'
+//
+//	[[profiles.remote.llm.providers]]
+//	kind = 'openai'
+//	api_key = '<KEY>'
+type Profile struct {
+	LLM       *types.LLMConfig       `json:"llm,omitempty"       toml:"llm,omitempty"`
+	Embedding *types.EmbeddingConfig `json:"embedding,omitempty" toml:"embedding,omitempty"`
+	Prompt    *types.PromptConfig    `json:"prompt,omitempty"    toml:"prompt,omitempty"`
+}
+
 func validateModelConfig(m types.ModelConfig) error {
 	if m.ID == "" {
 		return &ConfigError{Opt: "ID", Err: errors.New("model ID cannot be empty")}
 	}
 
-	return validateTemperature(m.Temperature)
+	errs := []error{validateTemperature(m.Temperature)}
+
+	if m.MaxTokens != nil && *m.MaxTokens <= 0 {
+		errs = append(errs, &ConfigError{Opt: "max_tokens", Err: errors.New("must be positive")})
+	}
+
+	if m.TopP != nil && (*m.TopP < 0 || *m.TopP > 1) {
+		errs = append(errs, &ConfigError{Opt: "top_p", Err: errors.New("must be between 0 and 1")})
+	}
+
+	if m.PriceIn < 0 {
+		errs = append(errs, &ConfigError{Opt: "price_in", Err: errors.New("must not be negative")})
+	}
+
+	if m.PriceOut < 0 {
+		errs = append(errs, &ConfigError{Opt: "price_out", Err: errors.New("must not be negative")})
+	}
+
+	return errors.Join(errs...)
 }
 
 func validateProviderConfig(p types.ProviderConfig) error {
@@ -73,12 +119,34 @@ func validateProviderConfig(p types.ProviderConfig) error {
 				Err: errors.New("must not include query parameters or fragments"),
 			})
 		}
+
+		// path prefixes are allowed, e.g. https://api.groq.com/openai/v1
+		if !strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), "/v1") {
+			errs = append(errs, &ConfigError{
+				Opt: "base_url",
+				Err: fmt.Errorf("missing /v1 in %q (e.g. http://localhost:11434/v1)", p.BaseURL),
+			})
+		}
+	}
+
+	if p.Kind != "" && !slices.Contains(types.ProviderKinds, p.Kind) {
+		errs = append(errs, &ConfigError{
+			Opt: "kind",
+			Err: fmt.Errorf("unsupported kind %q (supported: %s)", p.Kind, strings.Join(types.ProviderKinds, ", ")),
+		})
 	}
 
 	if err := validateTemperature(p.Temperature); err != nil {
 		errs = append(errs, err)
 	}
 
+	if p.MaxConcurrency < 0 {
+		errs = append(errs, &ConfigError{
+			Opt: "max_concurrency",
+			Err: errors.New("must not be negative"),
+		})
+	}
+
 	return errors.Join(errs...)
 }
 
@@ -87,7 +155,11 @@ func newFileConfig() *Config {
 		LLM:       types.LLMConfig{},
 		Prompt:    &types.PromptConfig{},
 		Embedding: &types.EmbeddingConfig{},
+		Retrieval: &types.RetrievalConfig{},
+		Output:    &types.OutputConfig{JSONFields: map[string]string{}},
+		Keys:      types.KeysConfig{},
 		Logging:   &types.LoggingConfig{},
+		Profiles:  map[string]*Profile{},
 	}
 }
 
@@ -95,6 +167,313 @@ func (c *Config) ConfigPath() (string, bool) {
 	return c.path, c.path != ""
 }
 
+// clone returns a copy of c whose sections can be modified
+// without affecting c. Profiles are shared.
+func (c *Config) clone() *Config {
+	cp := *c
+
+	cp.LLM.Providers = slices.Clone(c.LLM.Providers)
+	cp.LLM.Models = slices.Clone(c.LLM.Models)
+	cp.Prompt = clonePtr(c.Prompt)
+	cp.Embedding = clonePtr(c.Embedding)
+	cp.Retrieval = clonePtr(c.Retrieval)
+	cp.Output = clonePtr(c.Output)
+	cp.Keys = maps.Clone(c.Keys)
+	cp.Logging = clonePtr(c.Logging)
+
+	return &cp
+}
+
+// Redacted returns a deep copy of c for display, with the API keys of
+// its providers masked and the passwords of their base URLs removed.
+func (c Config) Redacted() Config {
+	cp := *c.clone()
+
+	cp.LLM.Providers = redactProviders(cp.LLM.Providers)
+
+	if c.Profiles == nil {
+		return cp
+	}
+
+	cp.Profiles = make(map[string]*Profile, len(c.Profiles))
+
+	for name, p := range c.Profiles {
+		if p == nil || p.LLM == nil {
+			cp.Profiles[name] = p
+			continue
+		}
+
+		llm := *p.LLM
+		llm.Providers = redactProviders(slices.Clone(p.LLM.Providers))
+
+		pp := *p
+		pp.LLM = &llm
+		cp.Profiles[name] = &pp
+	}
+
+	return cp
+}
+
+// redactProviders redacts the secrets of providers in place. All header
+// values are masked, as any of them may carry a credential.
+func redactProviders(providers []types.ProviderConfig) []types.ProviderConfig {
+	for i := range providers {
+		providers[i].APIKey = redactSecret(providers[i].APIKey)
+		providers[i].BaseURL = redactURL(providers[i].BaseURL)
+
+		if headers := providers[i].Headers; headers != nil {
+			redacted := make(map[string]string, len(headers))
+			for k, v := range headers {
+				redacted[k] = redactSecret(v)
+			}
+
+			providers[i].Headers = redacted
+		}
+	}
+
+	return providers
+}
+
+// redactSecret masks secret, keeping the last 4 characters of long secrets
+// so that keys can still be told apart.
+func redactSecret(secret string) string {
+	const keep = 4
+
+	switch {
+	case secret == "":
+		return ""
+	case len(secret) < 4*keep:
+		return "***"
+	default:
+		return "***" + secret[len(secret)-keep:]
+	}
+}
+
+// redactURL masks the password of the user info of rawURL or,
+// without a password, the user name, which is then likely a token.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+
+	if _, ok := u.User.Password(); ok {
+		return u.Redacted()
+	}
+
+	u.User = url.User("xxxxx")
+
+	return u.String()
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+
+	v := *p
+
+	return &v
+}
+
+// withProfile returns a copy of c with the sections of the named profile
+// layered over the top-level ones. Fields unset in the profile keep their
+// top-level values, while providers, models and ignore patterns set in the
+// profile replace the top-level ones. The result is validated.
+func (c *Config) withProfile(name string) (*Config, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, &ConfigError{Opt: "profiles", Err: fmt.Errorf("unknown profile %q", name)}
+	}
+
+	if p == nil {
+		p = &Profile{}
+	}
+
+	merged := c.clone()
+	merged.Profiles = nil
+
+	if p.LLM != nil {
+		merged.LLM.DefaultModel = cmp.Or(p.LLM.DefaultModel, c.LLM.DefaultModel)
+
+		if len(p.LLM.Providers) > 0 {
+			merged.LLM.Providers = slices.Clone(p.LLM.Providers)
+		}
+
+		if len(p.LLM.Models) > 0 {
+			merged.LLM.Models = slices.Clone(p.LLM.Models)
+		}
+	}
+
+	if e := p.Embedding; e != nil && merged.Embedding != nil {
+		m := merged.Embedding
+
+		m.Model = cmp.Or(e.Model, m.Model)
+		m.ChunkSize = cmp.Or(e.ChunkSize, m.ChunkSize)
+		m.Overlap = cmp.Or(e.Overlap, m.Overlap)
+		m.TopK = cmp.Or(e.TopK, m.TopK)
+		m.Dimensions = cmp.Or(e.Dimensions, m.Dimensions)
+		m.MaxFileBytes = cmp.Or(e.MaxFileBytes, m.MaxFileBytes)
+		m.BatchSize = cmp.Or(e.BatchSize, m.BatchSize)
+		m.Concurrency = cmp.Or(e.Concurrency, m.Concurrency)
+		m.CachePath = cmp.Or(e.CachePath, m.CachePath)
+		m.IndexPaths = e.IndexPaths || m.IndexPaths
+		m.Frontmatter = e.Frontmatter || m.Frontmatter
+		m.FrontmatterTitle = e.FrontmatterTitle || m.FrontmatterTitle
+		m.DecodeEntities = e.DecodeEntities || m.DecodeEntities
+		m.StripMarkup = e.StripMarkup || m.StripMarkup
+		m.SanitizeUTF8 = e.SanitizeUTF8 || m.SanitizeUTF8
+
+		if len(e.Ignore) > 0 {
+			m.Ignore = slices.Clone(e.Ignore)
+		}
+
+		if len(e.SourceWeights) > 0 {
+			m.SourceWeights = slices.Clone(e.SourceWeights)
+		}
+
+		if len(e.Extractors) > 0 {
+			m.Extractors = slices.Clone(e.Extractors)
+		}
+	}
+
+	if pr := p.Prompt; pr != nil && merged.Prompt != nil {
+		merged.Prompt.System = cmp.Or(pr.System, merged.Prompt.System)
+		merged.Prompt.UserPromptTmpl = cmp.Or(pr.UserPromptTmpl, merged.Prompt.UserPromptTmpl)
+		merged.Prompt.SystemFile = cmp.Or(pr.SystemFile, merged.Prompt.SystemFile)
+		merged.Prompt.UserPromptTmplFile = cmp.Or(pr.UserPromptTmplFile, merged.Prompt.UserPromptTmplFile)
+		merged.Prompt.ContextReserve = cmp.Or(pr.ContextReserve, merged.Prompt.ContextReserve)
+	}
+
+	if err := merged.validate(); err != nil {
+		return nil, fmt.Errorf("profile %q: %w", name, err)
+	}
+
+	return merged, nil
+}
+
+// loadPromptFiles reads the prompt files, if set, over the inline prompts.
+// Relative paths are resolved against the config file directory.
+func (c *Config) loadPromptFiles() error {
+	if c.Prompt == nil {
+		return nil
+	}
+
+	if p := c.Prompt.SystemFile; p != "" {
+		b, err := os.ReadFile(c.resolvePath(p))
+		if err != nil {
+			return &ConfigError{Opt: "prompt.system_prompt_file", Err: err}
+		}
+
+		c.Prompt.System = string(b)
+	}
+
+	if p := c.Prompt.UserPromptTmplFile; p != "" {
+		b, err := os.ReadFile(c.resolvePath(p))
+		if err != nil {
+			return &ConfigError{Opt: "prompt.user_prompt_tmpl_file", Err: err}
+		}
+
+		if err := prompt.ValidateUserPromptTmpl(string(b)); err != nil {
+			return &ConfigError{Opt: "prompt.user_prompt_tmpl_file", Err: err}
+		}
+
+		c.Prompt.UserPromptTmpl = string(b)
+	}
+
+	return nil
+}
+
+// resolvePath resolves p against the config file directory,
+// unless p is absolute or no config file was loaded.
+func (c *Config) resolvePath(p string) string {
+	if filepath.IsAbs(p) || c.path == "" {
+		return p
+	}
+
+	return filepath.Join(filepath.Dir(c.path), p)
+}
+
+// apiKeyCmdTimeout bounds the run time of an api_key_cmd.
+const apiKeyCmdTimeout = 30 * time.Second
+
+// resolveAPIKeys sets the API key of every provider without one
+// from its api_key_file or, failing that, from its api_key_cmd output.
+func (c *Config) resolveAPIKeys() error {
+	for i := range c.LLM.Providers {
+		p := &c.LLM.Providers[i]
+
+		switch {
+		case p.APIKey != "":
+		case p.APIKeyFile != "":
+			b, err := os.ReadFile(c.resolvePath(p.APIKeyFile))
+			if err != nil {
+				return &ConfigError{Opt: fmt.Sprintf("llm.providers[%d].api_key_file", i), Err: err}
+			}
+
+			p.APIKey = strings.TrimSpace(string(b))
+		case p.APIKeyCmd != "":
+			key, err := runAPIKeyCmd(p.APIKeyCmd)
+			if err != nil {
+				return &ConfigError{Opt: fmt.Sprintf("llm.providers[%d].api_key_cmd", i), Err: err}
+			}
+
+			p.APIKey = key
+		default:
+		}
+	}
+
+	return nil
+}
+
+// resolveCAFiles resolves the ca_file of every provider
+// against the config file directory.
+func (c *Config) resolveCAFiles() error {
+	for i := range c.LLM.Providers {
+		p := &c.LLM.Providers[i]
+		if p.CAFile == "" {
+			continue
+		}
+
+		path, err := filepath.Abs(c.resolvePath(p.CAFile))
+		if err != nil {
+			return &ConfigError{Opt: fmt.Sprintf("llm.providers[%d].ca_file", i), Err: err}
+		}
+
+		p.CAFile = path
+	}
+
+	return nil
+}
+
+// runAPIKeyCmd runs command with the shell and returns its trimmed output,
+// like the credential helpers of git and docker.
+func runAPIKeyCmd(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), apiKeyCmdTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command) //nolint:gosec // the command is configured by the user
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+
+		return "", err
+	}
+
+	key := strings.TrimSpace(string(out))
+	if key == "" {
+		return "", errors.New("printed no key")
+	}
+
+	return key, nil
+}
+
 // setDefaults fills zero-valued optional fields.
 func (c *Config) setDefaults() error {
 	if c == nil {
@@ -109,14 +488,52 @@ func (c *Config) setDefaults() error {
 	c.Logging.Dir = cmp.Or(c.Logging.Dir, dir)
 	c.Logging.Filename = cmp.Or(c.Logging.Filename, defaultLogFilename)
 	c.Logging.Level = cmp.Or(c.Logging.Level, defaultLogLevel)
+	c.Logging.Format = cmp.Or(c.Logging.Format, types.LogFormatText)
 
 	c.Embedding.ChunkSize = cmp.Or(c.Embedding.ChunkSize, defaultChunkSize)
 	c.Embedding.Overlap = cmp.Or(c.Embedding.Overlap, int(defaultOverlap))
 	c.Embedding.TopK = cmp.Or(c.Embedding.TopK, defaultTopK)
+	c.Embedding.MaxFileBytes = cmp.Or(c.Embedding.MaxFileBytes, defaultMaxFileBytes)
+	c.Embedding.BatchSize = cmp.Or(c.Embedding.BatchSize, embedBatchSize)
+	c.Embedding.Concurrency = cmp.Or(c.Embedding.Concurrency, embedConcurrency)
+
+	if c.Prompt != nil {
+		c.Prompt.ContextReserve = cmp.Or(c.Prompt.ContextReserve, defaultContextReserve)
+	}
+
+	c.Retrieval.Mode = cmp.Or(c.Retrieval.Mode, ragx.RetrievalVector)
+
+	if c.Output.DistancePrecision == nil {
+		p := types.DefaultDistancePrecision
+		c.Output.DistancePrecision = &p
+	}
+
+	c.Output.DistanceUnit = cmp.Or(c.Output.DistanceUnit, types.DistanceUnitDistance)
+
+	presetBaseURLs(c.LLM.Providers)
+
+	for _, profile := range c.Profiles {
+		if profile == nil || profile.LLM == nil {
+			continue
+		}
+
+		presetBaseURLs(profile.LLM.Providers)
+	}
 
 	return nil
 }
 
+// presetBaseURLs sets the unset base URLs of providers of an explicit kind
+// to that of the kind preset. Without a kind, an unset base URL is left to
+// fail validation rather than sending requests to the OpenAI API.
+func presetBaseURLs(providers []types.ProviderConfig) {
+	for i, p := range providers {
+		if p.BaseURL == "" && p.Kind != "" {
+			providers[i].BaseURL = types.PresetFor(p.Kind).BaseURL
+		}
+	}
+}
+
 func (c *Config) validate() error {
 	if c == nil {
 		return &ConfigError{Err: errors.New("cannot validate a nil config")}
@@ -126,6 +543,10 @@ func (c *Config) validate() error {
 		return &ConfigError{Opt: "logging.log_filename", Err: errors.New("must not contain slashes")}
 	}
 
+	if err := validateLogFormat(c.Logging.Format); err != nil {
+		return &ConfigError{Opt: "logging.format", Err: err}
+	}
+
 	if c.Embedding != nil {
 		if c.Embedding.ChunkSize < 0 {
 			return &ConfigError{Opt: "retrieval.chunk_size", Err: errors.New("must be zero or positive")}
@@ -134,14 +555,169 @@ func (c *Config) validate() error {
 		if c.Embedding.TopK < 0 {
 			return &ConfigError{Opt: "retrieval.top_k", Err: errors.New("must be zero or positive")}
 		}
+
+		if c.Embedding.Dimensions < 0 {
+			return &ConfigError{Opt: "embedding.dimensions", Err: errors.New("must be zero or positive")}
+		}
+
+		if c.Embedding.MaxFileBytes < 0 {
+			return &ConfigError{Opt: "embedding.max_file_bytes", Err: errors.New("must be zero or positive")}
+		}
+
+		if err := validateEmbeddingThroughput(c.Embedding); err != nil {
+			return err
+		}
+
+		for _, p := range c.Embedding.Ignore {
+			if err := validateIgnorePattern(p); err != nil {
+				return &ConfigError{Opt: "embedding.ignore", Err: err}
+			}
+		}
+
+		if _, err := ragx.CompileSourceWeights(c.Embedding.SourceWeights); err != nil {
+			return &ConfigError{Opt: "embedding.source_weights", Err: err}
+		}
+
+		for _, name := range c.Embedding.Extractors {
+			if !slices.Contains(extract.Formats, name) {
+				err := fmt.Errorf("unsupported format %q (supported: %s)", name, strings.Join(extract.Formats, ", "))
+				return &ConfigError{Opt: "embedding.extractors", Err: err}
+			}
+		}
+	}
+
+	if c.Prompt != nil && c.Prompt.UserPromptTmpl != "" {
+		if err := prompt.ValidateUserPromptTmpl(c.Prompt.UserPromptTmpl); err != nil {
+			return &ConfigError{Opt: "prompt.user_prompt_tmpl", Err: err}
+		}
+	}
+
+	if c.Prompt != nil && c.Prompt.ContextReserve < 0 {
+		return &ConfigError{Opt: "prompt.context_reserve", Err: errors.New("must be zero or positive")}
+	}
+
+	if c.Retrieval != nil && !slices.Contains(retrievalModes, c.Retrieval.Mode) {
+		return &ConfigError{Opt: "retrieval.mode", Err: fmt.Errorf("unsupported mode %q (supported: %s)", c.Retrieval.Mode, strings.Join(retrievalModes, ", "))}
+	}
+
+	if c.Retrieval != nil && (c.Retrieval.MinScore < 0 || c.Retrieval.MinScore > 1) {
+		return &ConfigError{Opt: "retrieval.min_score", Err: errors.New("must be between 0 and 1")}
 	}
 
 	return errors.Join(
 		c.validateProviders(),
 		c.validateModels(),
+		c.validateOutput(),
+		c.validateKeys(),
 	)
 }
 
+// validateEmbeddingThroughput checks the embedding batch size and concurrency.
+func validateEmbeddingThroughput(c *types.EmbeddingConfig) error {
+	if c.BatchSize < 1 {
+		return &ConfigError{Opt: "embedding.batch_size", Err: errors.New("must be at least 1")}
+	}
+
+	if c.Concurrency < 1 {
+		return &ConfigError{Opt: "embedding.concurrency", Err: errors.New("must be at least 1")}
+	}
+
+	return nil
+}
+
+// validateLogFormat reports whether format is a supported log format.
+// An empty format selects the default, text.
+func validateLogFormat(format string) error {
+	if format != "" && !slices.Contains(types.LogFormats, format) {
+		return fmt.Errorf("unsupported format %q (supported: %s)", format, strings.Join(types.LogFormats, ", "))
+	}
+
+	return nil
+}
+
+func (c *Config) validateOutput() error {
+	if c.Output == nil {
+		return nil
+	}
+
+	if c.Output.NoContextMaxDistance < 0 {
+		return &ConfigError{Opt: "output.no_context_max_distance", Err: errors.New("must not be negative")}
+	}
+
+	if p := c.Output.DistancePrecision; p != nil && (*p < 0 || *p > maxDistancePrecision) {
+		return &ConfigError{Opt: "output.distance_precision", Err: fmt.Errorf("must be between 0 and %d", maxDistancePrecision)}
+	}
+
+	if u := c.Output.DistanceUnit; u != "" && !slices.Contains(types.DistanceUnits, u) {
+		return &ConfigError{Opt: "output.distance_unit", Err: fmt.Errorf("unsupported unit %q (supported: %s)", u, strings.Join(types.DistanceUnits, ", "))}
+	}
+
+	fields := c.Output.JSONFields
+
+	for k, v := range fields {
+		opt := "output.json_fields." + k
+
+		if !slices.Contains(jsonFieldKeys, k) {
+			return &ConfigError{Opt: opt, Err: fmt.Errorf("unknown field (supported: %s)", strings.Join(jsonFieldKeys, ", "))}
+		}
+
+		if strings.TrimSpace(v) == "" {
+			return &ConfigError{Opt: opt, Err: errors.New("must not be empty")}
+		}
+	}
+
+	names := make(map[string]string, len(jsonFieldKeys))
+
+	for _, k := range jsonFieldKeys {
+		name := cmp.Or(fields[k], k)
+
+		if prev, ok := names[name]; ok {
+			return &ConfigError{Opt: "output.json_fields." + k, Err: fmt.Errorf("name %q already used by %q", name, prev)}
+		}
+
+		names[name] = k
+	}
+
+	return nil
+}
+
+// keyGroups are the groups of chat actions whose keys are pressed in the
+// same mode, so that a key may be bound to at most one action of a group.
+var keyGroups = [][]string{
+	{types.KeySubmit, types.KeyCancel, types.KeyPrefix, types.KeyNewChat},
+	{types.KeyHistory, types.KeyModels, types.KeyClear},
+}
+
+func (c *Config) validateKeys() error {
+	for action, key := range c.Keys {
+		opt := "keys." + action
+
+		if !slices.Contains(types.KeyActions, action) {
+			return &ConfigError{Opt: opt, Err: fmt.Errorf("unknown action (supported: %s)", strings.Join(types.KeyActions, ", "))}
+		}
+
+		if strings.TrimSpace(key) == "" {
+			return &ConfigError{Opt: opt, Err: errors.New("must not be empty")}
+		}
+	}
+
+	for _, group := range keyGroups {
+		bound := make(map[string]string, len(group))
+
+		for _, action := range group {
+			key := c.Keys.Key(action)
+
+			if prev, ok := bound[key]; ok {
+				return &ConfigError{Opt: "keys." + action, Err: fmt.Errorf("key %q already bound to %q", key, prev)}
+			}
+
+			bound[key] = action
+		}
+	}
+
+	return nil
+}
+
 func (c *Config) validateProviders() error {
 	errs := make([]error, 0, len(c.LLM.Providers))
 
@@ -149,6 +725,12 @@ func (c *Config) validateProviders() error {
 		if err := validateProviderConfig(p); err != nil {
 			errs = append(errs, fmt.Errorf("providers[%d]: %w", i, err))
 		}
+
+		if p.CAFile != "" {
+			if _, err := loadCAPool(c.resolvePath(p.CAFile)); err != nil {
+				errs = append(errs, &ConfigError{Opt: fmt.Sprintf("llm.providers[%d].ca_file", i), Err: err})
+			}
+		}
 	}
 
 	return errors.Join(errs...)
@@ -194,6 +776,18 @@ func LoadFileConfig(path string) (*Config, error) {
 	return c, c.validate()
 }
 
+// LoadDefaultConfig returns the default config without
+// reading any config file.
+func LoadDefaultConfig() (*Config, error) {
+	c := newFileConfig()
+
+	if err := c.setDefaults(); err != nil {
+		return nil, err
+	}
+
+	return c, c.validate()
+}
+
 // GenerateDefault returns a TOML string with default values and comments.
 func GenerateDefault() string {
 	c := newFileConfig()
@@ -223,7 +817,9 @@ func openLogFile(dir, name string) (*os.File, error) {
 	return os.OpenFile(filepath.Clean(filename), flag, 0o600) //nolint:gosec // internal filename
 }
 
-func defaultLogDir() (string, error) {
+func defaultLogDir() (string, error) { return defaultStateDir() }
+
+func defaultStateDir() (string, error) {
 	if stateDir, ok := os.LookupEnv("XDG_STATE_HOME"); ok {
 		return filepath.Join(stateDir, appName), nil
 	}
@@ -264,9 +860,178 @@ func parseFileConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("config: parse file: %w", err)
 	}
 
+	if err := config.expandEnv(); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
+// expandEnv expands environment variable references in the values
+// that commonly hold secrets or differ between machines.
+func (c *Config) expandEnv() error {
+	errs := []error{
+		expandProvidersEnv("llm.providers", c.LLM.Providers),
+		expandEmbeddingEnv("embedding", c.Embedding),
+	}
+
+	for name, p := range c.Profiles {
+		if p == nil {
+			continue
+		}
+
+		if p.LLM != nil {
+			errs = append(errs, expandProvidersEnv("profiles."+name+".llm.providers", p.LLM.Providers))
+		}
+
+		errs = append(errs, expandEmbeddingEnv("profiles."+name+".embedding", p.Embedding))
+	}
+
+	return errors.Join(errs...)
+}
+
+func expandProvidersEnv(key string, providers []types.ProviderConfig) error {
+	errs := make([]error, 0, len(providers))
+
+	for i := range providers {
+		p := &providers[i]
+
+		errs = append(errs,
+			expandEnvField(fmt.Sprintf("%s[%d].api_key", key, i), &p.APIKey),
+			expandEnvField(fmt.Sprintf("%s[%d].base_url", key, i), &p.BaseURL),
+		)
+
+		for _, k := range slices.Sorted(maps.Keys(p.Headers)) {
+			v := p.Headers[k]
+			errs = append(errs, expandEnvField(fmt.Sprintf("%s[%d].headers.%s", key, i, k), &v))
+			p.Headers[k] = v
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func expandEmbeddingEnv(key string, e *types.EmbeddingConfig) error {
+	if e == nil {
+		return nil
+	}
+
+	return expandEnvField(key+".embedding_model", &e.Model)
+}
+
+func expandEnvField(key string, s *string) error {
+	v, err := expandEnv(*s, os.LookupEnv)
+	if err != nil {
+		return &ConfigError{Opt: key, Err: err}
+	}
+
+	*s = v
+
+	return nil
+}
+
+// expandEnv replaces ${VAR} and ${VAR:-default} references in s using lookup.
+// The default applies when VAR is unset or empty; "$$" is a literal "$", and
+// any other "$" is kept as is. Referencing an unset variable without a default
+// is an error. Errors do not quote s, which may hold a secret, e.g. an api_key.
+func expandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+
+			continue
+		case '{':
+		default:
+			b.WriteByte('$')
+			continue
+		}
+
+		end := strings.IndexByte(s[i+2:], '}')
+		if end == -1 {
+			return "", errors.New("unterminated variable reference")
+		}
+
+		ref := s[i+2 : i+2+end]
+		name, def, hasDefault := strings.Cut(ref, ":-")
+
+		if name == "" {
+			return "", errors.New("empty variable reference")
+		}
+
+		v, ok := lookup(name)
+
+		switch {
+		case ok && (v != "" || !hasDefault):
+			b.WriteString(v)
+		case hasDefault:
+			b.WriteString(def)
+		default:
+			return "", fmt.Errorf("environment variable %q is not set", name)
+		}
+
+		i += 2 + end
+	}
+
+	return b.String(), nil
+}
+
+// set patches c with a key=value assignment, where key is the dotted path
+// of a config field (e.g. embedding.top_k) and value is a TOML value.
+// Values that are not valid TOML are taken as strings, so that quoting
+// is optional for strings. Unknown keys and mistyped values are errors.
+func (c *Config) set(assignment string) error {
+	key, value, ok := strings.Cut(assignment, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+	if !ok || key == "" {
+		return &ConfigError{Opt: assignment, Err: errors.New("want key=value")}
+	}
+
+	candidates := make([]string, 0, 2)
+
+	if err := toml.Unmarshal([]byte("v = "+value), &map[string]any{}); err == nil {
+		candidates = append(candidates, value)
+	}
+
+	if quoted, err := toml.Marshal(map[string]string{"v": value}); err == nil {
+		candidates = append(candidates, strings.TrimSpace(strings.TrimPrefix(string(quoted), "v = ")))
+	}
+
+	var firstErr error
+
+	for _, v := range candidates {
+		doc := []byte(key + " = " + v)
+
+		// decode into a copy first, so that a failed assignment leaves c intact
+		if err := decodeStrict(doc, c.clone()); err != nil {
+			firstErr = cmp.Or(firstErr, err)
+			continue
+		}
+
+		return decodeStrict(doc, c)
+	}
+
+	var strict *toml.StrictMissingError
+	if errors.As(firstErr, &strict) {
+		return &ConfigError{Opt: key, Err: errors.New("unknown key")}
+	}
+
+	return &ConfigError{Opt: key, Err: firstErr}
+}
+
+func decodeStrict(doc []byte, v any) error {
+	return toml.NewDecoder(bytes.NewReader(doc)).DisallowUnknownFields().Decode(v)
+}
+
 func validateTemperature(t *float64) error {
 	if t == nil {
 		return nil
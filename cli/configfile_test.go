@@ -0,0 +1,1039 @@
+package cli_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/llm/fake"
+	"github.com/ladzaretti/ragx-cli/types"
+)
+
+func TestLoadFileConfig_ProviderPresets(t *testing.T) {
+	tests := []struct {
+		kind        string
+		wantBaseURL string
+		wantPreset  types.ProviderPreset
+		wantErr     string
+	}{
+		{
+			kind:       "",
+			wantPreset: types.ProviderPreset{BaseURL: "https://api.openai.com/v1", ListModels: true},
+			wantErr:    "missing host",
+		},
+		{
+			kind:        types.ProviderKindOpenAI,
+			wantBaseURL: "https://api.openai.com/v1",
+			wantPreset:  types.ProviderPreset{BaseURL: "https://api.openai.com/v1", ListModels: true},
+		},
+		{
+			kind:        types.ProviderKindOllama,
+			wantBaseURL: "http://localhost:11434/v1",
+			wantPreset:  types.ProviderPreset{BaseURL: "http://localhost:11434/v1", KeepAlive: true, ListModels: true, ContextWindow: true},
+		},
+		{
+			kind:        types.ProviderKindLlamaCPP,
+			wantBaseURL: "http://localhost:8080/v1",
+			wantPreset:  types.ProviderPreset{BaseURL: "http://localhost:8080/v1", ContextWindow: true},
+		},
+		{
+			kind:        types.ProviderKindLMStudio,
+			wantBaseURL: "http://localhost:1234/v1",
+			wantPreset:  types.ProviderPreset{BaseURL: "http://localhost:1234/v1", ListModels: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("kind="+tt.kind, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			config := fmt.Sprintf("[[llm.providers]]\nkind = '%s'\n", tt.kind)
+
+			if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+
+			if got := types.PresetFor(tt.kind); got != tt.wantPreset {
+				t.Errorf("want preset: %+v, got: %+v", tt.wantPreset, got)
+			}
+
+			c, err := cli.LoadFileConfig(path)
+
+			// without a kind, an unset base url is not defaulted
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want error containing %q, got: %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("load config: %v", err)
+			}
+
+			if got := c.LLM.Providers[0].BaseURL; got != tt.wantBaseURL {
+				t.Errorf("want base url: %q, got: %q", tt.wantBaseURL, got)
+			}
+		})
+	}
+}
+
+func TestLoadFileConfig_UnsetBaseURLVariable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	config := "[[llm.providers]]\nbase_url = '${RAGX_TEST_URL:-}'\napi_key = 'sk-foo'\n"
+
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	if _, err := cli.LoadFileConfig(path); err == nil || !strings.Contains(err.Error(), "missing host") {
+		t.Errorf("want a missing host error, got: %v", err)
+	}
+}
+
+func TestLoadFileConfig_ExplicitBaseURLOverridesPreset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	config := "[[llm.providers]]\nkind = 'ollama'\nbase_url = 'http://gpu-box:11434/v1'\n"
+
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	c, err := cli.LoadFileConfig(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	if got, want := c.LLM.Providers[0].BaseURL, "http://gpu-box:11434/v1"; got != want {
+		t.Errorf("want base url: %q, got: %q", want, got)
+	}
+}
+
+func TestLoadFileConfig_UnknownProviderKind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+
+	if err := os.WriteFile(path, []byte("[[llm.providers]]\nkind = 'foo'\n"), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	if _, err := cli.LoadFileConfig(path); err == nil {
+		t.Errorf("expected an error for an unknown provider kind")
+	}
+}
+
+func TestLoadFileConfig_EmbeddingThroughput(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          string
+		wantBatchSize   int
+		wantConcurrency int
+		wantErr         bool
+	}{
+		{
+			name:            "defaults when unset",
+			config:          "[embedding]\n",
+			wantBatchSize:   64,
+			wantConcurrency: 8,
+		},
+		{
+			name:            "configured",
+			config:          "[embedding]\nbatch_size = 16\nconcurrency = 2\n",
+			wantBatchSize:   16,
+			wantConcurrency: 2,
+		},
+		{
+			name:    "negative batch size",
+			config:  "[embedding]\nbatch_size = -1\n",
+			wantErr: true,
+		},
+		{
+			name:    "negative concurrency",
+			config:  "[embedding]\nconcurrency = -1\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+
+			c, err := cli.LoadFileConfig(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("load config: %v", err)
+			}
+
+			if got := c.Embedding.BatchSize; got != tt.wantBatchSize {
+				t.Errorf("want batch size: %d, got: %d", tt.wantBatchSize, got)
+			}
+
+			if got := c.Embedding.Concurrency; got != tt.wantConcurrency {
+				t.Errorf("want concurrency: %d, got: %d", tt.wantConcurrency, got)
+			}
+		})
+	}
+}
+
+func TestLoadFileConfig_LogFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string
+		wantFormat string
+		wantErr    bool
+	}{
+		{name: "defaults to text", config: "[logging]\n", wantFormat: types.LogFormatText},
+		{name: "json", config: "[logging]\nformat = 'json'\n", wantFormat: types.LogFormatJSON},
+		{name: "unknown format", config: "[logging]\nformat = 'foo'\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+
+			c, err := cli.LoadFileConfig(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("load config: %v", err)
+			}
+
+			if got := c.Logging.Format; got != tt.wantFormat {
+				t.Errorf("want format: %q, got: %q", tt.wantFormat, got)
+			}
+		})
+	}
+}
+
+func TestLogging_JSONFormat(t *testing.T) {
+	var (
+		config = writeTestConfig(t, "http://127.0.0.1:0")
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	// the logging section is the last one of the test config
+	f, err := os.OpenFile(config, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("open config: %v", err)
+	}
+
+	if _, err := f.WriteString("format = 'json'\nadd_source = true\n"); err != nil {
+		t.Fatalf("append config: %v", err)
+	}
+
+	_ = f.Close()
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	t.Setenv("LOG_LEVEL", "debug")
+	cli.UseBackend(t, &fake.Backend{Models: []string{"foo", "bar"}})
+
+	iostreams := genericclioptions.NewTestIOStreamsDiscard(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, "--dry-run", data, "-q", "qux"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	logs, err := os.ReadFile(filepath.Join(filepath.Dir(config), ".log"))
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(logs)), "\n")
+
+	for _, line := range lines {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("want a JSON log record, got %q: %v", line, err)
+		}
+
+		if _, ok := record["source"]; !ok {
+			t.Errorf("want the record source, got %q", line)
+		}
+	}
+}
+
+func TestLoadFileConfig_Keys(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string
+		wantSubmit string
+		wantErr    bool
+	}{
+		{
+			name:       "defaults when unset",
+			config:     "",
+			wantSubmit: "ctrl+s",
+		},
+		{
+			name:       "configured",
+			config:     "[keys]\nsubmit = 'ctrl+d'\nhistory = 'g'\n",
+			wantSubmit: "ctrl+d",
+		},
+		{
+			name:    "unknown action",
+			config:  "[keys]\nquit = 'ctrl+q'\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty key",
+			config:  "[keys]\nsubmit = ''\n",
+			wantErr: true,
+		},
+		{
+			name:    "key bound twice",
+			config:  "[keys]\nsubmit = 'ctrl+a'\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+
+			c, err := cli.LoadFileConfig(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("load config: %v", err)
+			}
+
+			if got := c.Keys.Key(types.KeySubmit); got != tt.wantSubmit {
+				t.Errorf("want submit key: %q, got: %q", tt.wantSubmit, got)
+			}
+		})
+	}
+}
+
+func TestConfig_Profiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	config := `[llm]
+default_model = 'foo'
+
+[[llm.providers]]
+kind = 'ollama'
+
+[embedding]
+embedding_model = 'bar'
+top_k = 7
+
+[profiles.remote.llm]
+default_model = 'baz'
+
+[[profiles.remote.llm.providers]]
+kind = 'openai'
+api_key = 'secret'
+
+[profiles.remote.embedding]
+embedding_model = 'qux'
+
+[profiles.broken.llm]
+[[profiles.broken.llm.providers]]
+kind = 'foo'
+`
+
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	resolve := func(t *testing.T, args ...string) (*cli.Config, error) {
+		t.Helper()
+
+		iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, append([]string{"config", "--config", path}, args...))
+		cmd.SilenceErrors = true
+
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			return nil, err
+		}
+
+		var res struct {
+			Resolved cli.Config `json:"resolved_config"` //nolint:tagliatelle
+		}
+
+		if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+			t.Fatalf("unmarshal: %v\n%s", err, out.String())
+		}
+
+		return &res.Resolved, nil
+	}
+
+	t.Run("top-level", func(t *testing.T) {
+		c, err := resolve(t)
+		if err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		if c.LLM.DefaultModel != "foo" || c.Embedding.Model != "bar" || c.LLM.Providers[0].Kind != types.ProviderKindOllama {
+			t.Errorf("want the top-level config, got: %+v", c.LLM)
+		}
+	})
+
+	for _, tt := range []struct {
+		name string
+		args []string
+		env  string
+	}{
+		{name: "flag", args: []string{"--profile", "remote"}},
+		{name: "env", env: "remote"},
+		{name: "flag over env", args: []string{"-p", "remote"}, env: "broken"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RAGX_PROFILE", tt.env)
+
+			c, err := resolve(t, tt.args...)
+			if err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+
+			if c.LLM.DefaultModel != "baz" || c.Embedding.Model != "qux" {
+				t.Errorf("want the profile models, got: %q, %q", c.LLM.DefaultModel, c.Embedding.Model)
+			}
+
+			if c.Embedding.TopK != 7 {
+				t.Errorf("want the top-level top_k, got: %d", c.Embedding.TopK)
+			}
+
+			if len(c.LLM.Providers) != 1 || c.LLM.Providers[0].BaseURL != "https://api.openai.com/v1" {
+				t.Errorf("want the profile provider only, got: %+v", c.LLM.Providers)
+			}
+		})
+	}
+
+	t.Run("unknown profile", func(t *testing.T) {
+		if _, err := resolve(t, "--profile", "foo"); err == nil {
+			t.Errorf("expected an error for an unknown profile")
+		}
+	})
+
+	t.Run("invalid profile", func(t *testing.T) {
+		if _, err := resolve(t, "--profile", "broken"); err == nil {
+			t.Errorf("expected an error for an invalid profile")
+		}
+	})
+}
+
+func TestConfig_RedactsSecrets(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	var (
+		path    = filepath.Join(t.TempDir(), "config.toml")
+		key     = "sk-foo-0123456789abcdef"
+		profKey = "sk-bar-0123456789abcdef"
+		pass    = "hunter2"
+		token   = "tok-0123456789abcdef"
+	)
+
+	t.Setenv("RAGX_TEST_TOKEN", token)
+
+	config := fmt.Sprintf(`[llm]
+default_model = 'foo'
+
+[[llm.providers]]
+kind = 'openai'
+api_key = '%s'
+headers = { 'Authorization' = 'Bearer ${RAGX_TEST_TOKEN}' }
+
+[[llm.providers]]
+kind = 'ollama'
+base_url = 'http://baz:%s@localhost:11434/v1'
+
+[embedding]
+embedding_model = 'bar'
+
+[profiles.remote.llm]
+[[profiles.remote.llm.providers]]
+kind = 'openai'
+api_key = '%s'
+`, key, pass, profKey)
+
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"config", "--config", path})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	for _, secret := range []string{key, profKey, pass, token} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("want %q redacted, got:\n%s", secret, out.String())
+		}
+	}
+
+	if !strings.Contains(out.String(), "***cdef") {
+		t.Errorf("want the key masked to its last 4 characters, got:\n%s", out.String())
+	}
+
+	c, err := cli.LoadFileConfig(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	_ = c.Redacted()
+
+	if got := c.LLM.Providers[0].APIKey; got != key {
+		t.Errorf("want the original key kept, got: %q", got)
+	}
+
+	if got, want := c.LLM.Providers[0].Headers["Authorization"], "Bearer "+token; got != want {
+		t.Errorf("want the original header %q kept, got: %q", want, got)
+	}
+}
+
+func TestConfig_APIKeySources(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "key"), []byte("  sk-file-0123456789-FILE\n"), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	resolve := func(t *testing.T, providers string) (*cli.Config, error) {
+		t.Helper()
+
+		path := filepath.Join(dir, "config.toml")
+		if err := os.WriteFile(path, []byte("[llm]\ndefault_model = 'foo'\n\n"+providers), 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+
+		iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"config", "--config", path})
+		cmd.SilenceErrors = true
+
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			return nil, err
+		}
+
+		var res struct {
+			Resolved cli.Config `json:"resolved_config"` //nolint:tagliatelle
+		}
+
+		if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+			t.Fatalf("unmarshal: %v\n%s", err, out.String())
+		}
+
+		return &res.Resolved, nil
+	}
+
+	t.Run("precedence", func(t *testing.T) {
+		c, err := resolve(t, `[[llm.providers]]
+kind = 'openai'
+api_key = 'sk-inline-0123456789-INLN'
+api_key_file = 'key'
+api_key_cmd = 'echo sk-cmd-0123456789-CMD1'
+
+[[llm.providers]]
+kind = 'openai'
+api_key_file = 'key'
+api_key_cmd = 'echo sk-cmd-0123456789-CMD1'
+
+[[llm.providers]]
+kind = 'openai'
+api_key_cmd = 'echo sk-cmd-0123456789-CMD1'
+`)
+		if err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		var got []string
+		for _, p := range c.LLM.Providers {
+			got = append(got, p.APIKey)
+		}
+
+		// the resolved keys are printed redacted, to their last 4 characters
+		if want := []string{"***INLN", "***FILE", "***CMD1"}; !slices.Equal(want, got) {
+			t.Errorf("want api keys: %q, got: %q", want, got)
+		}
+	})
+
+	for _, tt := range []struct {
+		name     string
+		provider string
+		wantOpt  string
+		wantMsg  string
+	}{
+		{
+			name:     "failing command",
+			provider: "api_key_cmd = 'echo locked >&2; exit 3'",
+			wantOpt:  "llm.providers[0].api_key_cmd",
+			wantMsg:  "locked",
+		},
+		{
+			name:     "empty command output",
+			provider: "api_key_cmd = 'true'",
+			wantOpt:  "llm.providers[0].api_key_cmd",
+			wantMsg:  "printed no key",
+		},
+		{
+			name:     "missing file",
+			provider: "api_key_file = 'missing'",
+			wantOpt:  "llm.providers[0].api_key_file",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolve(t, "[[llm.providers]]\nkind = 'openai'\n"+tt.provider+"\n")
+
+			var cfgErr *cli.ConfigError
+			if !errors.As(err, &cfgErr) || cfgErr.Opt != tt.wantOpt || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("want a %s config error with %q, got: %v", tt.wantOpt, tt.wantMsg, err)
+			}
+		})
+	}
+}
+
+func TestConfig_NoConfig(t *testing.T) {
+	// an unparsable config at the default path fails any run that reads it
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[llm\n"), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	t.Setenv("ragx_CONFIG_PATH", path)
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	run := func(args ...string) error {
+		iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, append([]string{"config"}, args...))
+		cmd.SilenceErrors = true
+
+		return cmd.ExecuteContext(context.Background())
+	}
+
+	if err := run(); err == nil {
+		t.Fatalf("expected the config at the default path to be read")
+	}
+
+	if err := run("--no-config"); err != nil {
+		t.Errorf("want the config file ignored, got: %v", err)
+	}
+
+	if err := run("--no-config", "--config", path); err == nil {
+		t.Errorf("expected an error for --no-config with --config")
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{"FOO": "foo", "EMPTY": ""}
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "${FOO}", want: "foo"},
+		{in: "http://${FOO}:11434/v1", want: "http://foo:11434/v1"},
+		{in: "${FOO:-bar}", want: "foo"},
+		{in: "${BAR:-bar}", want: "bar"},
+		{in: "${EMPTY:-bar}", want: "bar"},
+		{in: "${EMPTY}", want: ""},
+		{in: "${BAR:-}", want: ""},
+		{in: "$${FOO}", want: "${FOO}"},
+		{in: "a$b$", want: "a$b$"},
+		{in: "${BAR}", wantErr: true},
+		{in: "${FOO", wantErr: true},
+		{in: "${}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := cli.ExpandEnv(tt.in, lookup)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got: %q", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expand: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadFileConfig_ExpandEnv(t *testing.T) {
+	config := `[[llm.providers]]
+base_url = '${RAGX_TEST_HOST:-http://localhost:11434}/v1'
+api_key = '${RAGX_TEST_KEY}'
+headers = { 'OpenAI-Organization' = '${RAGX_TEST_ORG:-org-1}' }
+
+[embedding]
+embedding_model = '${RAGX_TEST_EMBEDDING_MODEL:-foo}'
+`
+
+	write := func(t *testing.T) string {
+		t.Helper()
+
+		path := filepath.Join(t.TempDir(), "config.toml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+
+		return path
+	}
+
+	t.Run("set", func(t *testing.T) {
+		t.Setenv("RAGX_TEST_KEY", "secret")
+
+		c, err := cli.LoadFileConfig(write(t))
+		if err != nil {
+			t.Fatalf("load config: %v", err)
+		}
+
+		p := c.LLM.Providers[0]
+
+		if p.APIKey != "secret" || p.BaseURL != "http://localhost:11434/v1" || c.Embedding.Model != "foo" {
+			t.Errorf("want expanded values, got: %+v, embedding model: %q", p, c.Embedding.Model)
+		}
+
+		if got := p.Headers["OpenAI-Organization"]; got != "org-1" {
+			t.Errorf("want expanded header: %q, got: %q", "org-1", got)
+		}
+	})
+
+	t.Run("unset without default", func(t *testing.T) {
+		_, err := cli.LoadFileConfig(write(t))
+
+		var cerr *cli.ConfigError
+		if !errors.As(err, &cerr) || cerr.Opt != "llm.providers[0].api_key" {
+			t.Errorf("want a config error naming the key, got: %v", err)
+		}
+	})
+
+	t.Run("unterminated reference keeps the value out of the error", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		if err := os.WriteFile(path, []byte("[[llm.providers]]\napi_key = 'sk-secret-${RAGX_TEST_KEY'\n"), 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+
+		_, err := cli.LoadFileConfig(path)
+
+		var cerr *cli.ConfigError
+		if !errors.As(err, &cerr) || cerr.Opt != "llm.providers[0].api_key" {
+			t.Errorf("want a config error naming the key, got: %v", err)
+		}
+
+		if err != nil && strings.Contains(err.Error(), "sk-secret") {
+			t.Errorf("want the value redacted, got: %v", err)
+		}
+	})
+}
+
+func TestConfig_Set(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[llm]\ndefault_model = 'foo'\n"), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	resolve := func(t *testing.T, sets ...string) (*cli.Config, error) {
+		t.Helper()
+
+		args := []string{"config", "--config", path}
+		for _, s := range sets {
+			args = append(args, "--set", s)
+		}
+
+		iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, args)
+		cmd.SilenceErrors = true
+
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			return nil, err
+		}
+
+		var res struct {
+			Resolved cli.Config `json:"resolved_config"` //nolint:tagliatelle
+		}
+
+		if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+			t.Fatalf("unmarshal: %v\n%s", err, out.String())
+		}
+
+		return &res.Resolved, nil
+	}
+
+	t.Run("scalar and nested keys", func(t *testing.T) {
+		c, err := resolve(t,
+			"llm.default_model=bar",
+			"embedding.top_k=10",
+			"embedding.ignore=['vendor/']",
+			"output.json_fields.answer=response",
+			"prompt.system_prompt = be brief",
+		)
+		if err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		if c.LLM.DefaultModel != "bar" {
+			t.Errorf("want default model: %q, got: %q", "bar", c.LLM.DefaultModel)
+		}
+
+		if c.Embedding.TopK != 10 {
+			t.Errorf("want top_k: 10, got: %d", c.Embedding.TopK)
+		}
+
+		if len(c.Embedding.Ignore) != 1 || c.Embedding.Ignore[0] != "vendor/" {
+			t.Errorf("want ignore: [vendor/], got: %q", c.Embedding.Ignore)
+		}
+
+		if got := c.Output.JSONFields["answer"]; got != "response" {
+			t.Errorf("want json field: %q, got: %q", "response", got)
+		}
+
+		if c.Prompt.System != "be brief" {
+			t.Errorf("want system prompt: %q, got: %q", "be brief", c.Prompt.System)
+		}
+	})
+
+	for _, set := range []string{
+		"embedding.top_kk=10",
+		"foo=bar",
+		"embedding.top_k=ten",
+		"embedding.top_k=-1",
+		"embedding",
+	} {
+		t.Run("invalid "+set, func(t *testing.T) {
+			if _, err := resolve(t, set); err == nil {
+				t.Errorf("expected an error for --set %s", set)
+			}
+		})
+	}
+}
+
+func TestConfig_PromptFiles(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	dir := t.TempDir()
+
+	write := func(t *testing.T, name, content string) string {
+		t.Helper()
+
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+
+		return path
+	}
+
+	write(t, "system.md", "be brief")
+	write(t, "user.tmpl", "{{ .Query }}")
+
+	resolve := func(t *testing.T, config string) (*cli.Config, error) {
+		t.Helper()
+
+		path := write(t, "config.toml", config)
+
+		iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"config", "--config", path})
+		cmd.SilenceErrors = true
+
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			return nil, err
+		}
+
+		var res struct {
+			Resolved cli.Config `json:"resolved_config"` //nolint:tagliatelle
+		}
+
+		if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+			t.Fatalf("unmarshal: %v\n%s", err, out.String())
+		}
+
+		return &res.Resolved, nil
+	}
+
+	t.Run("files override inline prompts", func(t *testing.T) {
+		c, err := resolve(t, `[prompt]
+system_prompt = 'inline'
+system_prompt_file = 'system.md'
+user_prompt_tmpl = '{{ .Chunks }}'
+user_prompt_tmpl_file = 'user.tmpl'
+`)
+		if err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		if c.Prompt.System != "be brief" {
+			t.Errorf("want system prompt: %q, got: %q", "be brief", c.Prompt.System)
+		}
+
+		if c.Prompt.UserPromptTmpl != "{{ .Query }}" {
+			t.Errorf("want user prompt template: %q, got: %q", "{{ .Query }}", c.Prompt.UserPromptTmpl)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := resolve(t, "[prompt]\nsystem_prompt_file = 'missing.md'\n")
+
+		var cfgErr *cli.ConfigError
+		if !errors.As(err, &cfgErr) || cfgErr.Opt != "prompt.system_prompt_file" {
+			t.Errorf("want a prompt.system_prompt_file config error, got: %v", err)
+		}
+	})
+}
+
+func TestLoadFileConfig_CAFile(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.pem"), []byte("foo"), 0o600); err != nil {
+		t.Fatalf("write ca: %v", err)
+	}
+
+	for _, caFile := range []string{"missing.pem", "bad.pem"} {
+		t.Run(caFile, func(t *testing.T) {
+			path := filepath.Join(dir, "config.toml")
+
+			config := fmt.Sprintf("[[llm.providers]]\nbase_url = 'https://localhost/v1'\nca_file = '%s'\n", caFile)
+			if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+
+			_, err := cli.LoadFileConfig(path)
+
+			var cerr *cli.ConfigError
+			if !errors.As(err, &cerr) || cerr.Opt != "llm.providers[0].ca_file" {
+				t.Errorf("want a config error naming the key, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateProviderConfig_BaseURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		wantErr string
+	}{
+		{baseURL: "https://api.openai.com/v1"},
+		{baseURL: "https://api.groq.com/openai/v1"},
+		{baseURL: "https://host/api/v1"},
+		{baseURL: "http://localhost:11434/v1/"},
+		{baseURL: "http://localhost:11434", wantErr: "missing /v1"},
+		{baseURL: "http://localhost:11434/v1beta", wantErr: "missing /v1"},
+		{baseURL: "http://localhost:11434/v1?foo=bar", wantErr: "query parameters"},
+		{baseURL: "http://localhost:11434/v1#foo", wantErr: "fragments"},
+		{baseURL: "/v1", wantErr: "missing host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			err := cli.ValidateProviderConfig(types.ProviderConfig{BaseURL: tt.baseURL})
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("want valid, got: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("want error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,697 @@
+package cli
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	daemonSocketFilename = "daemon.sock"
+
+	// daemonDialTimeout bounds detecting a running daemon, so that
+	// queries run locally without a noticeable delay when there is none.
+	daemonDialTimeout = 200 * time.Millisecond
+
+	// maxDaemonIndexes bounds the embedded indexes kept warm by the daemon.
+	maxDaemonIndexes = 8
+
+	maxDaemonRequestBytes = 1 << 20
+	maxDaemonEventBytes   = 16 << 20
+)
+
+// Daemon request operations.
+const (
+	DaemonOpStatus = "status"
+	DaemonOpQuery  = "query"
+)
+
+// Daemon response events.
+const (
+	daemonEventToken  = "token"
+	daemonEventResult = "result"
+	daemonEventError  = "error"
+)
+
+var ErrDaemonRunning = errors.New("a ragx daemon is already listening")
+
+// DaemonRequest is a request sent to the daemon, as a single line of JSON.
+type DaemonRequest struct {
+	Op    string   `json:"op"`
+	Query string   `json:"query,omitempty"`
+	Paths []string `json:"paths,omitempty"` // Paths are absolute, as the daemon runs in another directory.
+	Match []string `json:"match,omitempty"`
+	Model string   `json:"model,omitempty"`
+	TopK  int      `json:"top_k"`
+}
+
+// DaemonStatus is the response to a status request.
+type DaemonStatus struct {
+	PID            int      `json:"pid"`
+	EmbeddingModel string   `json:"embedding_model"`
+	Models         []string `json:"models"`
+	ConfigHash     string   `json:"config_hash"`
+}
+
+// daemonEvent is a line of the response to a query request: a "token" per
+// answer token, then a "result" with the full query result, or an "error".
+type daemonEvent struct {
+	Event    string       `json:"event"`
+	Content  string       `json:"content,omitempty"`
+	Result   *QueryResult `json:"result,omitempty"`
+	Warnings []string     `json:"warnings,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// DaemonEngine answers the requests served by the daemon.
+type DaemonEngine interface {
+	Status() DaemonStatus
+	// Query answers req, calling onToken for each answer token,
+	// and returns the result with its citation warnings.
+	Query(ctx context.Context, req DaemonRequest, onToken func(string)) (QueryResult, []string, error)
+}
+
+type DaemonOptions struct {
+	*genericclioptions.StdioOptions
+	llmOptions *llmOptions
+
+	socket string
+
+	mu      sync.Mutex
+	indexes map[string]*daemonIndex
+}
+
+// daemonIndex is a vector database embedded from the files of a query.
+type daemonIndex struct {
+	db     *vecdb.VectorDB
+	usedAt time.Time
+}
+
+var (
+	_ genericclioptions.CmdOptions = &DaemonOptions{}
+	_ DaemonEngine                 = &DaemonOptions{}
+)
+
+// NewDaemonOptions initializes the options struct.
+func NewDaemonOptions(stdio *genericclioptions.StdioOptions, llmOptions *llmOptions) *DaemonOptions {
+	return &DaemonOptions{
+		StdioOptions: stdio,
+		llmOptions:   llmOptions,
+		indexes:      map[string]*daemonIndex{},
+	}
+}
+
+func (o *DaemonOptions) Complete() error {
+	if o.socket != "" {
+		return nil
+	}
+
+	socket, err := defaultDaemonSocketPath()
+	if err != nil {
+		return errf("daemon socket path: %w", err)
+	}
+
+	o.socket = socket
+
+	return nil
+}
+
+func (*DaemonOptions) Validate() error { return nil }
+
+func (o *DaemonOptions) Run(ctx context.Context, _ ...string) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	ln, err := listenDaemon(o.socket)
+	if err != nil {
+		return err
+	}
+
+	defer o.closeIndexes()
+
+	o.Logger.Info("daemon listening", "socket", o.socket)
+	o.Printf("listening on %s\n", o.socket)
+
+	if err := serveDaemon(ctx, ln, o, o.Logger); err != nil {
+		return errf("serve: %w", err)
+	}
+
+	o.Logger.Info("daemon stopped")
+
+	return nil
+}
+
+func (o *DaemonOptions) Status() DaemonStatus {
+	var models []string
+	for _, p := range o.llmOptions.providers {
+		models = append(models, p.AvailableModels...)
+	}
+
+	slices.Sort(models)
+
+	return DaemonStatus{
+		PID:            os.Getpid(),
+		EmbeddingModel: o.llmOptions.embeddingConfig.Model,
+		Models:         slices.Compact(models),
+		ConfigHash:     o.llmOptions.configHash,
+	}
+}
+
+// Query answers req from the files under its paths. The files are embedded
+// once and kept warm until they change, so repeated queries skip embedding.
+func (o *DaemonOptions) Query(ctx context.Context, req DaemonRequest, onToken func(string)) (QueryResult, []string, error) {
+	if strings.TrimSpace(req.Query) == "" {
+		return QueryResult{}, nil, errors.New("missing query")
+	}
+
+	if len(req.Paths) == 0 {
+		return QueryResult{}, nil, ErrNoEmbedInput
+	}
+
+	for _, p := range req.Paths {
+		if !filepath.IsAbs(p) {
+			return QueryResult{}, nil, fmt.Errorf("path %q is not absolute", p)
+		}
+	}
+
+	model := cmp.Or(req.Model, o.llmOptions.llmConfig.DefaultModel)
+
+	if _, err := o.llmOptions.providers.ProviderFor(model); err != nil {
+		return QueryResult{}, nil, fmt.Errorf("provider for %q: %w", model, err)
+	}
+
+	hits, err := o.retrieve(ctx, req)
+	if err != nil {
+		return QueryResult{}, nil, err
+	}
+
+	// with retrieval disabled, there is no context to miss
+	if msg, ok := noContextAnswer(o.llmOptions.outputConfig, hits); ok && req.TopK > 0 {
+		o.Logger.Info("no relevant context retrieved, skipping llm call", "hits", len(hits))
+		onToken(msg)
+
+		return newQueryResult(req.Query, msg, hits), nil, nil
+	}
+
+	ch, err := o.llmOptions.sendQuery(ctx, o.Logger, model, req.Query, hits)
+	if err != nil {
+		return QueryResult{}, nil, err
+	}
+
+	var answer strings.Builder
+
+	printFunc := func(s string) {
+		answer.WriteString(s)
+		onToken(s)
+	}
+
+	if err := drainStream(ctx, ch, printFunc, func(string) {}, func() {}); err != nil {
+		return QueryResult{}, nil, fmt.Errorf("response stream: %w", err)
+	}
+
+	_, errs := prompt.ParseCitations(answer.String(), hits)
+
+	warnings := make([]string, 0, len(errs))
+	for _, err := range errs {
+		warnings = append(warnings, err.Error())
+	}
+
+	return newQueryResult(req.Query, strings.TrimSpace(answer.String()), hits), warnings, nil
+}
+
+// retrieve retrieves the chunks for the query from the index of its files,
+// embedding them first if they are not indexed yet or have changed.
+// Requests are serialized, as they share the vector database of the options.
+func (o *DaemonOptions) retrieve(ctx context.Context, req DaemonRequest) ([]vecdb.SearchResult, error) {
+	matchREs, err := compileREs("match", req.Match...)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	discovered, err := discover(req.Paths, matchREs, o.llmOptions.embeddingConfig.Ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := indexKey(discovered)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, ok := o.indexes[key]
+	if !ok {
+		idx, err = o.embedIndex(ctx, matchREs, req.Paths)
+		if err != nil {
+			return nil, err
+		}
+
+		o.indexes[key] = idx
+	} else {
+		o.Logger.Debug("using warm index", "files", len(discovered))
+	}
+
+	idx.usedAt = time.Now()
+	o.evictIndexes()
+
+	o.llmOptions.vectordb = idx.db
+
+	hits, err := o.llmOptions.retrieveTopK(ctx, func(string) {}, req.Query, req.TopK)
+	if err != nil {
+		return nil, err
+	}
+
+	return vecdb.FilterMinScore(hits, o.llmOptions.retrievalConfig.MinScore), nil
+}
+
+func (o *DaemonOptions) embedIndex(ctx context.Context, matchREs []*regexp.Regexp, paths []string) (*daemonIndex, error) {
+	db, err := vecdb.New(o.llmOptions.dim, vecdb.WithModel(o.llmOptions.embeddingConfig.Model))
+	if err != nil {
+		return nil, fmt.Errorf("create vector database: %w", err)
+	}
+
+	o.llmOptions.vectordb = db
+
+	var (
+		discard  = func(string) {}
+		progress = func(string, int, int) {}
+	)
+
+	if err := o.llmOptions.discoverAndEmbed(ctx, o.Logger, discard, discard, progress, matchREs, paths...); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("embed: %w", err)
+	}
+
+	o.Logger.Info("embedded index", "paths", len(paths))
+
+	return &daemonIndex{db: db}, nil
+}
+
+// evictIndexes closes the least recently used indexes
+// beyond [maxDaemonIndexes].
+func (o *DaemonOptions) evictIndexes() {
+	for len(o.indexes) > maxDaemonIndexes {
+		var (
+			oldest string
+			usedAt time.Time
+		)
+
+		for k, idx := range o.indexes {
+			if oldest == "" || idx.usedAt.Before(usedAt) {
+				oldest, usedAt = k, idx.usedAt
+			}
+		}
+
+		_ = o.indexes[oldest].db.Close()
+		delete(o.indexes, oldest)
+	}
+}
+
+func (o *DaemonOptions) closeIndexes() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for k, idx := range o.indexes {
+		_ = idx.db.Close()
+		delete(o.indexes, k)
+	}
+}
+
+// indexKey identifies the index of files by their paths, sizes
+// and modification times, so that a changed file is embedded again.
+// URLs are identified by themselves only.
+func indexKey(files []string) (string, error) {
+	h := sha256.New()
+
+	for _, f := range files {
+		if isURL(f) {
+			_, _ = fmt.Fprintf(h, "%s\n", f)
+			continue
+		}
+
+		fi, err := os.Stat(f)
+		if err != nil {
+			return "", fmt.Errorf("stat %q: %w", f, err)
+		}
+
+		_, _ = fmt.Fprintf(h, "%s\x00%d\x00%d\n", f, fi.Size(), fi.ModTime().UnixNano())
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listenDaemon listens on the unix socket at path, replacing a stale
+// socket left by a daemon that did not shut down cleanly.
+func listenDaemon(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, errf("create socket dir: %w", err)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		conn, err := net.DialTimeout("unix", path, daemonDialTimeout)
+		if err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%w on %s", ErrDaemonRunning, path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, errf("remove stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errf("listen: %w", err)
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, errf("chmod socket: %w", err)
+	}
+
+	return ln, nil
+}
+
+// serveDaemon serves the requests of the connections accepted by ln
+// until ctx is done. Each connection carries a single request.
+func serveDaemon(ctx context.Context, ln net.Listener, engine DaemonEngine, logger *slog.Logger) error {
+	var wg sync.WaitGroup
+
+	defer wg.Wait()
+
+	stop := context.AfterFunc(ctx, func() { _ = ln.Close() })
+	defer stop()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer func() { _ = conn.Close() }()
+
+			if err := handleDaemonConn(ctx, conn, engine); err != nil {
+				logger.Error("daemon request", "err", err)
+			}
+		}()
+	}
+}
+
+func handleDaemonConn(ctx context.Context, conn net.Conn, engine DaemonEngine) error {
+	var req DaemonRequest
+
+	enc := json.NewEncoder(conn)
+
+	if err := json.NewDecoder(io.LimitReader(conn, maxDaemonRequestBytes)).Decode(&req); err != nil {
+		return enc.Encode(daemonEvent{Event: daemonEventError, Error: fmt.Sprintf("decode request: %v", err)})
+	}
+
+	switch req.Op {
+	case DaemonOpStatus:
+		return enc.Encode(engine.Status())
+	case DaemonOpQuery:
+	default:
+		return enc.Encode(daemonEvent{Event: daemonEventError, Error: fmt.Sprintf("unknown op %q", req.Op)})
+	}
+
+	var encErr error
+
+	onToken := func(s string) {
+		if encErr == nil {
+			encErr = enc.Encode(daemonEvent{Event: daemonEventToken, Content: s})
+		}
+	}
+
+	res, warnings, err := engine.Query(ctx, req, onToken)
+	if encErr != nil {
+		return fmt.Errorf("write token: %w", encErr)
+	}
+
+	if err != nil {
+		return enc.Encode(daemonEvent{Event: daemonEventError, Error: err.Error()})
+	}
+
+	return enc.Encode(daemonEvent{Event: daemonEventResult, Result: &res, Warnings: warnings})
+}
+
+// dialDaemon connects to the daemon listening on socket and sends req.
+func dialDaemon(ctx context.Context, socket string, req DaemonRequest) (net.Conn, error) {
+	d := net.Dialer{Timeout: daemonDialTimeout}
+
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	return conn, nil
+}
+
+// daemonStatus returns the status of the daemon listening on socket.
+func daemonStatus(ctx context.Context, socket string) (DaemonStatus, error) {
+	conn, err := dialDaemon(ctx, socket, DaemonRequest{Op: DaemonOpStatus})
+	if err != nil {
+		return DaemonStatus{}, err
+	}
+
+	defer func() { _ = conn.Close() }()
+
+	_ = conn.SetReadDeadline(time.Now().Add(daemonDialTimeout))
+
+	var status DaemonStatus
+	if err := json.NewDecoder(conn).Decode(&status); err != nil {
+		return DaemonStatus{}, fmt.Errorf("read status: %w", err)
+	}
+
+	return status, nil
+}
+
+// queryDaemon sends the query req to the daemon listening on socket,
+// calling onToken for each answer token as it arrives.
+func queryDaemon(ctx context.Context, socket string, req DaemonRequest, onToken func(string)) (QueryResult, []string, error) {
+	req.Op = DaemonOpQuery
+
+	conn, err := dialDaemon(ctx, socket, req)
+	if err != nil {
+		return QueryResult{}, nil, err
+	}
+
+	defer func() { _ = conn.Close() }()
+
+	// unblock reading the events when ctx is canceled, e.g. by ctrl+c
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 0, 64*1024), maxDaemonEventBytes)
+
+	for sc.Scan() {
+		var e daemonEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return QueryResult{}, nil, fmt.Errorf("decode event: %w", err)
+		}
+
+		switch e.Event {
+		case daemonEventToken:
+			onToken(e.Content)
+		case daemonEventResult:
+			if e.Result == nil {
+				return QueryResult{}, nil, errors.New("daemon: missing result")
+			}
+
+			return *e.Result, e.Warnings, nil
+		case daemonEventError:
+			return QueryResult{}, nil, fmt.Errorf("daemon: %s", e.Error)
+		default:
+			return QueryResult{}, nil, fmt.Errorf("daemon: unknown event %q", e.Event)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return QueryResult{}, nil, err
+	}
+
+	if err := sc.Err(); err != nil {
+		return QueryResult{}, nil, fmt.Errorf("read response: %w", err)
+	}
+
+	return QueryResult{}, nil, errors.New("daemon: connection closed before the result")
+}
+
+func defaultDaemonSocketPath() (string, error) {
+	dir, err := defaultStateDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, daemonSocketFilename), nil
+}
+
+// NewCmdDaemon creates the daemon cobra command.
+func NewCmdDaemon(defaults *DefaultRAGOptions) *cobra.Command {
+	o := NewDaemonOptions(
+		defaults.StdioOptions,
+		defaults.llmOptions,
+	)
+
+	cmd := &cobra.Command{
+		Use:   "daemon [--socket <path>]",
+		Short: "Keep providers and embedded indexes warm for query",
+		Long: `Runs in the foreground and serves queries over a local unix socket, keeping
+the provider clients and the indexes embedded for previous queries warm, so that
+repeated "ragx query" calls over the same paths skip embedding.
+
+While a daemon is listening on the default socket, "ragx query" forwards to it
+when it resolved the same configuration, including --config, --profile and --set,
+and the query uses only flags the daemon supports.
+An index is embedded again when any of its files changes.
+
+Use --no-daemon to always answer a query locally.`,
+		Example: `  # start the daemon in the background
+  ragx daemon &
+
+  # the first query embeds docs, the next ones reuse the index
+  ragx query docs -q "<query>"`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return clierror.Check(genericclioptions.ExecuteCommand(cmd.Context(), o, args...))
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.socket, "socket", "", "", "path of the unix socket to listen on (default: daemon.sock in the state directory)")
+
+	genericclioptions.MarkFlagsHidden(cmd, "dim", "match")
+
+	return cmd
+}
+
+// daemonLocalFlags are the query flags the daemon does not support;
+// a query using any of them is answered locally.
+var daemonLocalFlags = []string{
+	"no-daemon", "dry-run", "show-messages", "batch", "session", "raw-context",
+	"summarize", "paths-from", "print-chunks", "max-chunks", "exclude-content",
+	"hybrid", "min-score", "no-stream", "temp", "context", "timings",
+	"sanitize-utf8", "system", "db-path", "prune",
+}
+
+// forwardsToDaemon reports whether the query may be forwarded to a daemon.
+func forwardsToDaemon(cmd *cobra.Command) bool {
+	return !slices.ContainsFunc(daemonLocalFlags, func(name string) bool {
+		f := cmd.Flags().Lookup(name)
+		return f != nil && f.Changed
+	})
+}
+
+// hashConfig returns a digest of the resolved configuration,
+// so that a query is forwarded only to a daemon resolving the same one.
+// The model and top-k are left out, as they are sent with each request.
+func (o *llmOptions) hashConfig() string {
+	llmConfig := o.llmConfig
+	llmConfig.DefaultModel = ""
+
+	embeddingConfig := o.embeddingConfig
+	embeddingConfig.TopK = 0
+
+	raw, err := json.Marshal(struct {
+		LLM         types.LLMConfig       `json:"llm"`
+		Prompt      types.PromptConfig    `json:"prompt"`
+		Embedding   types.EmbeddingConfig `json:"embedding"`
+		Retrieval   types.RetrievalConfig `json:"retrieval"`
+		Output      types.OutputConfig    `json:"output"`
+		Temperature *float64              `json:"temperature"`
+		KeepAlive   *time.Duration        `json:"keep_alive"`
+	}{llmConfig, o.promptConfig, embeddingConfig, o.retrievalConfig, o.outputConfig, o.defaultTemperature, o.keepAlive})
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(raw)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// errStepsDone stops running the remaining steps, successfully.
+var errStepsDone = errors.New("steps done")
+
+// detectDaemon detects a daemon that can answer the query. If one is found,
+// the query is forwarded to it and the remaining local steps are skipped.
+func (o *DefaultRAGOptions) detectDaemon(ctx context.Context, _ ...string) error {
+	// piped data is embedded locally
+	if o.Piped {
+		return nil
+	}
+
+	socket, err := defaultDaemonSocketPath()
+	if err != nil {
+		return nil //nolint:nilerr // the query runs locally
+	}
+
+	if _, err := os.Stat(socket); err != nil {
+		return nil //nolint:nilerr // no daemon
+	}
+
+	status, err := daemonStatus(ctx, socket)
+	if err != nil {
+		o.Logger.Debug("daemon unavailable", "socket", socket, "err", err)
+		return nil
+	}
+
+	model := o.llmOptions.llmConfig.DefaultModel
+
+	if status.EmbeddingModel != o.llmOptions.embeddingConfig.Model || !slices.Contains(status.Models, model) {
+		o.Logger.Info("daemon models mismatch, answering locally",
+			"pid", status.PID, "embedding_model", status.EmbeddingModel, "model", model)
+
+		return nil
+	}
+
+	if h := o.llmOptions.configHash; h == "" || status.ConfigHash != h {
+		o.Logger.Info("daemon config mismatch, answering locally", "pid", status.PID)
+		return nil
+	}
+
+	o.Logger.Info("forwarding to daemon", "socket", socket, "pid", status.PID)
+	o.llmOptions.daemonSocket = socket
+
+	return errStepsDone
+}
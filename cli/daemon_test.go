@@ -0,0 +1,235 @@
+package cli_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/llm/fake"
+)
+
+// stubEngine answers every query with its tokens and records the requests.
+type stubEngine struct {
+	tokens     []string
+	warnings   []string
+	err        error
+	configHash string
+
+	mu       sync.Mutex
+	requests []cli.DaemonRequest
+}
+
+func (e *stubEngine) Status() cli.DaemonStatus {
+	return cli.DaemonStatus{PID: 42, EmbeddingModel: "bar", Models: []string{"foo"}, ConfigHash: e.configHash}
+}
+
+func (e *stubEngine) Query(_ context.Context, req cli.DaemonRequest, onToken func(string)) (cli.QueryResult, []string, error) {
+	e.mu.Lock()
+	e.requests = append(e.requests, req)
+	e.mu.Unlock()
+
+	if e.err != nil {
+		return cli.QueryResult{}, nil, e.err
+	}
+
+	for _, tok := range e.tokens {
+		onToken(tok)
+	}
+
+	return cli.QueryResult{Query: req.Query, Answer: strings.Join(e.tokens, "")}, e.warnings, nil
+}
+
+func (e *stubEngine) Requests() []cli.DaemonRequest {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return slices.Clone(e.requests)
+}
+
+func TestDaemon_Protocol(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "d.sock")
+	engine := &stubEngine{tokens: []string{"foo", " bar"}, warnings: []string{"unverified citation"}}
+
+	cli.ServeDaemon(t, socket, engine)
+
+	ctx := context.Background()
+
+	t.Run("status", func(t *testing.T) {
+		status, err := cli.GetDaemonStatus(ctx, socket)
+		if err != nil {
+			t.Fatalf("status: %v", err)
+		}
+
+		if status.PID != 42 || status.EmbeddingModel != "bar" || !slices.Equal(status.Models, []string{"foo"}) {
+			t.Errorf("unexpected status: %+v", status)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		var tokens []string
+
+		req := cli.DaemonRequest{Query: "qux", Paths: []string{"/foo"}, Match: []string{`\.md$`}, Model: "foo", TopK: 3}
+
+		res, warnings, err := cli.QueryDaemon(ctx, socket, req, func(s string) { tokens = append(tokens, s) })
+		if err != nil {
+			t.Fatalf("query: %v", err)
+		}
+
+		if want := []string{"foo", " bar"}; !slices.Equal(want, tokens) {
+			t.Errorf("want streamed tokens %q, got %q", want, tokens)
+		}
+
+		if res.Query != "qux" || res.Answer != "foo bar" {
+			t.Errorf("unexpected result: %+v", res)
+		}
+
+		if want := []string{"unverified citation"}; !slices.Equal(want, warnings) {
+			t.Errorf("want warnings %q, got %q", want, warnings)
+		}
+
+		req.Op = cli.DaemonOpQuery
+
+		got := engine.Requests()
+		if len(got) != 1 || !reflect.DeepEqual(req, got[0]) {
+			t.Errorf("want request %+v, got %+v", req, got)
+		}
+	})
+
+	t.Run("unknown op", func(t *testing.T) {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+
+		defer func() { _ = conn.Close() }()
+
+		if _, err := conn.Write([]byte(`{"op":"foo"}` + "\n")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+
+		if !strings.Contains(line, `"event":"error"`) || !strings.Contains(line, `unknown op \"foo\"`) {
+			t.Errorf("want an unknown op error event, got: %s", line)
+		}
+	})
+}
+
+func TestDaemon_QueryError(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "d.sock")
+
+	cli.ServeDaemon(t, socket, &stubEngine{err: errors.New("foo failed")})
+
+	_, _, err := cli.QueryDaemon(context.Background(), socket, cli.DaemonRequest{Query: "qux"}, func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "foo failed") {
+		t.Errorf("want the engine error, got: %v", err)
+	}
+}
+
+func TestDaemon_AlreadyRunning(t *testing.T) {
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	socket := filepath.Join(t.TempDir(), "d.sock")
+
+	cli.ServeDaemon(t, socket, &stubEngine{})
+
+	iostreams := genericclioptions.NewTestIOStreamsDiscard(ttyStdin())
+	config := writeTestConfig(t, "http://127.0.0.1:0")
+
+	cli.UseBackend(t, &fake.Backend{Models: []string{"foo", "bar"}})
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"daemon", "--config", config, "--socket", socket})
+	cmd.SilenceErrors = true
+
+	err := cmd.ExecuteContext(context.Background())
+	if !errors.Is(err, cli.ErrDaemonRunning) {
+		t.Errorf("want ErrDaemonRunning, got: %v", err)
+	}
+}
+
+func TestQuery_ForwardsToDaemon(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+		engine = &stubEngine{tokens: []string{"from", " daemon"}, configHash: cli.ConfigHash(t, config)}
+	)
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	socket, err := cli.DefaultDaemonSocketPath()
+	if err != nil {
+		t.Fatalf("socket path: %v", err)
+	}
+
+	cli.ServeDaemon(t, socket, engine)
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantForward bool
+	}{
+		{name: "forwarded", args: nil, wantForward: true},
+		{name: "local flag", args: []string{"--dry-run"}, wantForward: false},
+		{name: "no daemon", args: []string{"--no-daemon"}, wantForward: false},
+		{name: "other config", args: []string{"--set", "embedding.chunk_size=100"}, wantForward: false},
+		{name: "request top-k", args: []string{"--top-k", "3"}, wantForward: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(engine.Requests())
+
+			iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+			args := append([]string{"query", "--config", config, data, "-q", "qux"}, tt.args...)
+
+			cmd := cli.NewDefaultRAGCommand(iostreams, args)
+			if err := cmd.ExecuteContext(context.Background()); err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+
+			requests := engine.Requests()[before:]
+
+			if got := len(requests) == 1; got != tt.wantForward {
+				t.Fatalf("want forwarded %v, got requests: %+v", tt.wantForward, requests)
+			}
+
+			if !tt.wantForward {
+				return
+			}
+
+			if got, want := out.String(), "from daemon\n"; got != want {
+				t.Errorf("want output %q, got %q", want, got)
+			}
+
+			req := requests[0]
+			if req.Query != "qux" || req.Model != "foo" || !slices.Equal(req.Paths, []string{data}) {
+				t.Errorf("unexpected request: %+v", req)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const dimCacheFilename = "dims.json"
+
+// dimCache persists the probed embedding dimension of each embedding model
+// by provider, so that the model does not have to be probed on every run.
+type dimCache struct {
+	path string
+	dims map[string]int
+}
+
+// loadDimCache loads the cache stored at path.
+// A missing file yields an empty cache.
+func loadDimCache(path string) (*dimCache, error) {
+	c := &dimCache{
+		path: path,
+		dims: map[string]int{},
+	}
+
+	raw, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return c, nil
+		}
+
+		return nil, fmt.Errorf("read dim cache: %w", err)
+	}
+
+	if err := json.Unmarshal(raw, &c.dims); err != nil {
+		return nil, fmt.Errorf("parse dim cache: %w", err)
+	}
+
+	return c, nil
+}
+
+// dimCacheKey identifies the embedding model served at baseURL, as
+// providers may serve different models under the same name.
+func dimCacheKey(baseURL, model string) string {
+	return strings.TrimSuffix(baseURL, "/") + " " + model
+}
+
+func (c *dimCache) get(key string) (int, bool) {
+	d, ok := c.dims[key]
+	return d, ok && d > 0
+}
+
+// set stores the dimension of key and writes the cache to disk.
+func (c *dimCache) set(key string, dim int) error {
+	c.dims[key] = dim
+
+	raw, err := json.MarshalIndent(c.dims, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal dim cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o750); err != nil {
+		return fmt.Errorf("create dim cache dir: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Clean(c.path), raw, 0o600); err != nil {
+		return fmt.Errorf("write dim cache: %w", err)
+	}
+
+	return nil
+}
+
+func defaultDimCachePath() (string, error) {
+	dir, err := defaultStateDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, dimCacheFilename), nil
+}
@@ -0,0 +1,146 @@
+package cli_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+func TestEmbeddingDimCache(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	runs := []struct {
+		name       string
+		args       []string
+		wantProbes int64
+	}{
+		{
+			name:       "first run probes the dim",
+			args:       nil,
+			wantProbes: 1,
+		},
+		{
+			name:       "second run uses the cached dim",
+			args:       nil,
+			wantProbes: 1,
+		},
+		{
+			name:       "refresh re-probes the dim",
+			args:       []string{"--refresh-dim"},
+			wantProbes: 2,
+		},
+	}
+
+	for _, r := range runs {
+		iostreams := genericclioptions.NewTestIOStreamsDiscard(ttyStdin())
+
+		args := append([]string{"query", "--config", config, "--dry-run", data, "-q", "foo"}, r.args...)
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, args)
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("%s: execute: %v", r.name, err)
+		}
+
+		if got := srv.probes.Load(); got != r.wantProbes {
+			t.Errorf("%s: want %d probes, got %d", r.name, r.wantProbes, got)
+		}
+	}
+}
+
+func TestEmbeddingDimensions_Mismatch(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	raw, err := os.ReadFile(config)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+
+	// the fake server returns 2 dimensional embeddings.
+	raw = []byte(strings.Replace(string(raw), "embedding_model = 'bar'", "embedding_model = 'bar'\ndimensions = 3", 1))
+
+	if err := os.WriteFile(config, raw, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	iostreams := genericclioptions.NewTestIOStreamsDiscard(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, "--dry-run", data, "-q", "foo"})
+	cmd.SilenceErrors = true
+
+	if err := cmd.ExecuteContext(context.Background()); !errors.Is(err, vecdb.ErrDimMismatch) {
+		t.Fatalf("want ErrDimMismatch, got: %v", err)
+	}
+
+	if n := srv.probes.Load(); n != 0 {
+		t.Errorf("want no embedding dimension probes, got: %d", n)
+	}
+}
+
+func TestEmbeddingDimCache_PerProvider(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+		state  = filepath.Join(os.Getenv("XDG_STATE_HOME"), "ragx")
+	)
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	if err := os.MkdirAll(state, 0o750); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+
+	// another provider serves a 3 dimensional model under the same name.
+	cached := `{"http://other/v1 bar": 3}`
+	if err := os.WriteFile(filepath.Join(state, "dims.json"), []byte(cached), 0o600); err != nil {
+		t.Fatalf("write dim cache: %v", err)
+	}
+
+	for range 2 {
+		iostreams := genericclioptions.NewTestIOStreamsDiscard(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, "--dry-run", data, "-q", "foo"})
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+
+	if got := srv.probes.Load(); got != 1 {
+		t.Errorf("want 1 probe, got %d", got)
+	}
+}
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/types"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultDoctorTimeout = 5 * time.Second
+
+var ErrDoctorChecksFailed = errors.New("doctor: some checks failed")
+
+type DoctorOptions struct {
+	*genericclioptions.StdioOptions
+	llmOptions *llmOptions
+
+	timeout time.Duration
+}
+
+var _ genericclioptions.CmdOptions = &DoctorOptions{}
+
+// NewDoctorOptions initializes the options struct.
+func NewDoctorOptions(stdio *genericclioptions.StdioOptions, llmOptions *llmOptions) *DoctorOptions {
+	return &DoctorOptions{
+		StdioOptions: stdio,
+		llmOptions:   llmOptions,
+		timeout:      defaultDoctorTimeout,
+	}
+}
+
+func (*DoctorOptions) Complete() error { return nil }
+
+func (o *DoctorOptions) Validate() error {
+	if o.timeout <= 0 {
+		return errf("--timeout must be positive")
+	}
+
+	return nil
+}
+
+func (o *DoctorOptions) Run(ctx context.Context, _ ...string) error {
+	failed := 0
+
+	report := func(ok bool, name, detail string) {
+		status := "OK"
+		if !ok {
+			status = "FAIL"
+			failed++
+		}
+
+		o.Printf("%-4s  %s: %s\n", status, name, detail)
+	}
+
+	// models served by each provider, by provider index
+	served := make([][]string, len(o.llmOptions.providers))
+
+	for i, p := range o.llmOptions.providers {
+		name := "provider " + o.llmOptions.llmConfig.Providers[i].BaseURL
+
+		// servers that cannot list their models are assumed to serve the configured ones
+		if !p.Preset.ListModels {
+			served[i] = o.llmOptions.configuredModels()
+			report(true, name, "cannot list models; assuming the configured ones are served")
+
+			continue
+		}
+
+		models, latency, err := o.listModels(ctx, p)
+		if err != nil {
+			report(false, name, fmt.Sprintf("%v (%s)", err, latency))
+			continue
+		}
+
+		served[i] = models
+		report(true, name, fmt.Sprintf("%d models (%s)", len(models), latency))
+	}
+
+	checks := []struct{ key, model string }{
+		{"llm.default_model", o.llmOptions.llmConfig.DefaultModel},
+		{"embedding.embedding_model", o.llmOptions.embeddingConfig.Model},
+	}
+
+	for _, c := range checks {
+		name := c.key
+
+		if c.model == "" {
+			report(false, name, "not set")
+			continue
+		}
+
+		name += fmt.Sprintf(" %q", c.model)
+
+		i := slices.IndexFunc(served, func(models []string) bool { return slices.Contains(models, c.model) })
+		if i == -1 {
+			report(false, name, "not served by any reachable provider")
+			continue
+		}
+
+		report(true, name, "served by "+o.llmOptions.llmConfig.Providers[i].BaseURL)
+	}
+
+	if failed > 0 {
+		o.Printf("\n%d checks failed\n", failed)
+		return ErrDoctorChecksFailed
+	}
+
+	o.Printf("\nall checks passed\n")
+
+	return nil
+}
+
+// listModels lists the models of p within the doctor timeout,
+// returning the request latency.
+func (o *DoctorOptions) listModels(ctx context.Context, p *types.Provider) ([]string, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	models, err := p.Client.ListModels(ctx)
+
+	latency := time.Since(start).Round(time.Millisecond)
+
+	if err != nil {
+		return nil, latency, err
+	}
+
+	ids := make([]string, 0, len(models))
+	for _, m := range models {
+		ids = append(ids, m.ID)
+	}
+
+	return ids, latency, nil
+}
+
+// NewCmdDoctor creates the doctor cobra command.
+func NewCmdDoctor(defaults *DefaultRAGOptions) *cobra.Command {
+	o := NewDoctorOptions(
+		defaults.StdioOptions,
+		defaults.llmOptions,
+	)
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check connectivity to the configured providers",
+		Long: `Checks that every configured provider is reachable by listing its models,
+and that the default and embedding models are served by one of them.
+
+Exits with a non-zero status if any check fails.`,
+		Example: `  # check the active configuration
+  ragx doctor
+
+  # allow slow servers more time to respond
+  ragx doctor --timeout 30s`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return clierror.Check(genericclioptions.ExecuteCommand(cmd.Context(), o))
+		},
+	}
+
+	cmd.Flags().DurationVarP(&o.timeout, "timeout", "", defaultDoctorTimeout, "timeout of each provider request")
+
+	hiddenFlags := []string{
+		"dim",
+		"embed-cache",
+		"embed-batch-size",
+		"embed-concurrency",
+		"topk",
+		"match",
+		"temp",
+		"context",
+		"system",
+	}
+
+	genericclioptions.MarkFlagsHidden(cmd, hiddenFlags...)
+
+	return cmd
+}
@@ -0,0 +1,80 @@
+package cli_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+)
+
+func TestDoctor(t *testing.T) {
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	run := func(t *testing.T, config string) (string, error) {
+		t.Helper()
+
+		iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"doctor", "--config", config})
+		cmd.SilenceErrors = true
+
+		err := cmd.ExecuteContext(context.Background())
+
+		return out.String(), err
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		srv := newFakeLLMServer(t)
+
+		out, err := run(t, writeTestConfig(t, srv.URL))
+		if err != nil {
+			t.Fatalf("execute: %v\n%s", err, out)
+		}
+
+		for _, want := range []string{
+			"OK    provider " + srv.URL + "/v1: 2 models",
+			`OK    llm.default_model "foo": served by ` + srv.URL + "/v1",
+			`OK    embedding.embedding_model "bar": served by ` + srv.URL + "/v1",
+			"all checks passed",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("want %q in the output, got:\n%s", want, out)
+			}
+		}
+	})
+
+	t.Run("unreachable provider", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(srv.Close)
+
+		out, err := run(t, writeTestConfig(t, srv.URL))
+		if !errors.Is(err, cli.ErrDoctorChecksFailed) {
+			t.Fatalf("want error: %v, got: %v", cli.ErrDoctorChecksFailed, err)
+		}
+
+		for _, want := range []string{
+			"FAIL  provider " + srv.URL + "/v1",
+			`FAIL  llm.default_model "foo": not served by any reachable provider`,
+			"3 checks failed",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("want %q in the output, got:\n%s", want, out)
+			}
+		}
+	})
+}
@@ -0,0 +1,385 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+
+	openai "github.com/openai/openai-go/v2"
+	"github.com/spf13/cobra"
+)
+
+var ErrMissingQuestions = errors.New("missing required --questions flag")
+
+// EvalQuestion is a single line of the eval questions file.
+type EvalQuestion struct {
+	Question        string   `json:"question"`
+	ExpectedSources []string `json:"expected_sources,omitempty"`
+}
+
+// EvalResult holds the outcome of running a single [EvalQuestion].
+type EvalResult struct {
+	Question         string   `json:"question"`
+	Answer           string   `json:"answer,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	ExpectedSources  []string `json:"expected_sources,omitempty"`
+	RetrievedSources []string `json:"retrieved_sources"`
+	RecallAtK        *float64 `json:"recall_at_k,omitempty"`
+	LatencyMS        int64    `json:"latency_ms"`
+	PromptTokens     int64    `json:"prompt_tokens"`
+	CompletionTokens int64    `json:"completion_tokens"`
+}
+
+// EvalSummary aggregates the metrics of all [EvalResult]s.
+type EvalSummary struct {
+	Model          string   `json:"model"`
+	EmbeddingModel string   `json:"embedding_model"`
+	TopK           int      `json:"top_k"`
+	Questions      int      `json:"questions"`
+	Failed         int      `json:"failed"`
+	MeanRecallAtK  *float64 `json:"mean_recall_at_k,omitempty"`
+	MeanLatencyMS  int64    `json:"mean_latency_ms"`
+	TotalTokens    int64    `json:"total_tokens"`
+}
+
+type evalReport struct {
+	Summary EvalSummary `json:"summary"`
+	Results []any       `json:"results"`
+}
+
+type EvalOptions struct {
+	*genericclioptions.StdioOptions
+	llmOptions *llmOptions
+
+	questionsPath string
+}
+
+var _ genericclioptions.CmdOptions = &EvalOptions{}
+
+// NewEvalOptions initializes the options struct.
+func NewEvalOptions(stdio *genericclioptions.StdioOptions, llmOptions *llmOptions) *EvalOptions {
+	return &EvalOptions{
+		StdioOptions: stdio,
+		llmOptions:   llmOptions,
+	}
+}
+
+func (*EvalOptions) Complete() error { return nil }
+
+func (o *EvalOptions) Validate() error {
+	if o.questionsPath == "" {
+		return ErrMissingQuestions
+	}
+
+	return nil
+}
+
+func (o *EvalOptions) Run(ctx context.Context, args ...string) error {
+	if !o.Piped && len(args) == 0 {
+		return ErrNoEmbedInput
+	}
+
+	if o.Piped && len(args) > 0 {
+		return ErrConflictingEmbedInputs
+	}
+
+	questions, err := readEvalQuestions(o.questionsPath)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader
+
+	if o.Piped {
+		in = o.In
+	}
+
+	if err := o.llmOptions.embed(ctx, o.Logger, in, o.llmOptions.embeddingREs, args...); err != nil {
+		return errf("embed: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	spinner := newSpinner(cancel, "")
+
+	go spinner.run()
+
+	defer spinner.stop()
+
+	results := make([]EvalResult, 0, len(questions))
+
+	for i, q := range questions {
+		setStatus := func(s string) {
+			spinner.sendStatusWithEllipsis(fmt.Sprintf("[%d/%d] %s", i+1, len(questions), s))
+		}
+
+		r := o.evalOne(ctx, setStatus, q)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		results = append(results, r)
+	}
+
+	spinner.stop()
+
+	report := evalReport{
+		Summary: summarizeEval(results),
+		Results: make([]any, 0, len(results)),
+	}
+
+	for _, r := range results {
+		renamed, err := renameJSONFields(r, o.llmOptions.outputConfig.JSONFields)
+		if err != nil {
+			return err
+		}
+
+		report.Results = append(report.Results, renamed)
+	}
+
+	report.Summary.Model = o.llmOptions.llmConfig.DefaultModel
+	report.Summary.EmbeddingModel = o.llmOptions.embeddingConfig.Model
+	report.Summary.TopK = o.llmOptions.embeddingConfig.TopK
+
+	o.Print(stringifyPretty(report))
+
+	return nil
+}
+
+// evalOne runs a single question through the retrieval and generation pipeline.
+// Failures are recorded on the result rather than aborting the whole run.
+func (o *EvalOptions) evalOne(ctx context.Context, setStatus func(string), q EvalQuestion) (res EvalResult) {
+	res = EvalResult{
+		Question:        q.Question,
+		ExpectedSources: q.ExpectedSources,
+	}
+
+	start := time.Now()
+	defer func() { res.LatencyMS = time.Since(start).Milliseconds() }()
+
+	hits, err := o.llmOptions.retrieve(ctx, setStatus, q.Question)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	res.RetrievedSources = retrievedSources(hits)
+
+	if len(q.ExpectedSources) > 0 {
+		recall := RecallAtK(q.ExpectedSources, res.RetrievedSources)
+		res.RecallAtK = &recall
+	}
+
+	opts := []prompt.PromptOpt{
+		prompt.WithUserPromptTmpl(o.llmOptions.promptConfig.UserPromptTmpl),
+	}
+
+	p, err := prompt.BuildUserPrompt(q.Question, hits, prompt.DecodeMeta, opts...)
+	if err != nil {
+		res.Error = fmt.Sprintf("build user prompt: %v", err)
+		return res
+	}
+
+	model := o.llmOptions.llmConfig.DefaultModel
+
+	provider, err := o.llmOptions.providers.ProviderFor(model)
+	if err != nil {
+		res.Error = fmt.Sprintf("provider for: %v", err)
+		return res
+	}
+
+	setStatus("sending to " + model)
+
+	// every question is answered independently of the previous ones.
+	session := provider.Session.NewChat()
+
+	answer, err := session.Send(ctx, o.llmOptions.chatRequest(model, p))
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	res.Answer = strings.TrimSpace(answer.Content)
+
+	if u, ok := answer.Usage.(openai.CompletionUsage); ok {
+		res.PromptTokens, res.CompletionTokens = u.PromptTokens, u.CompletionTokens
+	}
+
+	return res
+}
+
+// RecallAtK returns the fraction of expected sources found among the retrieved ones.
+//
+// An expected source matches a retrieved source if they are equal,
+// or if the retrieved source path ends with the expected relative path.
+func RecallAtK(expected, retrieved []string) float64 {
+	if len(expected) == 0 {
+		return 0
+	}
+
+	found := 0
+
+	for _, want := range expected {
+		want = filepath.ToSlash(filepath.Clean(want))
+
+		for _, got := range retrieved {
+			got = filepath.ToSlash(got)
+
+			if got == want || strings.HasSuffix(got, "/"+strings.TrimPrefix(want, "./")) {
+				found++
+				break
+			}
+		}
+	}
+
+	return float64(found) / float64(len(expected))
+}
+
+func summarizeEval(results []EvalResult) (s EvalSummary) {
+	var (
+		recallSum   float64
+		recallCount int
+		latencySum  int64
+	)
+
+	s.Questions = len(results)
+
+	for _, r := range results {
+		if r.Error != "" {
+			s.Failed++
+		}
+
+		if r.RecallAtK != nil {
+			recallSum += *r.RecallAtK
+			recallCount++
+		}
+
+		latencySum += r.LatencyMS
+		s.TotalTokens += r.PromptTokens + r.CompletionTokens
+	}
+
+	if recallCount > 0 {
+		mean := recallSum / float64(recallCount)
+		s.MeanRecallAtK = &mean
+	}
+
+	if len(results) > 0 {
+		s.MeanLatencyMS = latencySum / int64(len(results))
+	}
+
+	return s
+}
+
+// retrievedSources returns the distinct sources of hits in rank order.
+func retrievedSources(hits []vecdb.SearchResult) []string {
+	var (
+		sources = make([]string, 0, len(hits))
+		seen    = make(map[string]struct{}, len(hits))
+	)
+
+	for _, h := range hits {
+		source, _ := prompt.DecodeMeta(h.Meta)
+		if _, ok := seen[source]; ok {
+			continue
+		}
+
+		seen[source] = struct{}{}
+		sources = append(sources, source)
+	}
+
+	return sources
+}
+
+func readEvalQuestions(path string) ([]EvalQuestion, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("open questions: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	return parseEvalQuestions(f)
+}
+
+func parseEvalQuestions(r io.Reader) ([]EvalQuestion, error) {
+	var (
+		questions []EvalQuestion
+		scanner   = bufio.NewScanner(r)
+		n         = 0
+	)
+
+	for scanner.Scan() {
+		n++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var q EvalQuestion
+		if err := json.Unmarshal([]byte(line), &q); err != nil {
+			return nil, fmt.Errorf("questions line %d: %w", n, err)
+		}
+
+		if strings.TrimSpace(q.Question) == "" {
+			return nil, fmt.Errorf("questions line %d: missing question", n)
+		}
+
+		questions = append(questions, q)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read questions: %w", err)
+	}
+
+	return questions, nil
+}
+
+// NewCmdEval creates the eval cobra command.
+func NewCmdEval(defaults *DefaultRAGOptions) *cobra.Command {
+	o := NewEvalOptions(
+		defaults.StdioOptions,
+		defaults.llmOptions,
+	)
+
+	cmd := &cobra.Command{
+		Use:   "eval [flags] [path]... --questions <file>",
+		Short: "Evaluate retrieval and answers against a set of questions",
+		Long: `Embeds content from one or more paths (files or directories) or from stdin,
+then runs every question from a JSONL file through the RAG pipeline.
+
+Each line of the questions file is a JSON object:
+  {"question": "<text>", "expected_sources": ["<path>", ...]}
+
+expected_sources is optional; when given, retrieval recall@k is computed
+against the sources of the retrieved chunks. Results, latency and token
+usage are written to stdout as JSON.`,
+		Example: `  # evaluate the current model on the markdown docs
+  ragx eval ./docs -M '\.md$' --questions questions.jsonl
+
+  # compare two models
+  ragx eval ./docs --questions q.jsonl -m llama3.1:8b > a.json
+  ragx eval ./docs --questions q.jsonl -m qwen3:8b > b.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return clierror.Check(genericclioptions.ExecuteCommand(cmd.Context(), o, args...))
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.questionsPath, "questions", "Q", "", "path to a JSONL file of questions")
+
+	return cmd
+}
@@ -0,0 +1,60 @@
+package cli_test
+
+import (
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+)
+
+func TestRecallAtK(t *testing.T) {
+	retrieved := []string{
+		"/home/foo/docs/install.md",
+		"/home/foo/docs/usage.md",
+		"/home/foo/readme.md",
+	}
+
+	tests := []struct {
+		name     string
+		expected []string
+		want     float64
+	}{
+		{
+			name:     "all expected retrieved",
+			expected: []string{"docs/install.md", "readme.md"},
+			want:     1,
+		},
+		{
+			name:     "partial hit",
+			expected: []string{"docs/usage.md", "docs/config.md"},
+			want:     0.5,
+		},
+		{
+			name:     "absolute path hit",
+			expected: []string{"/home/foo/readme.md"},
+			want:     1,
+		},
+		{
+			name:     "dot relative hit",
+			expected: []string{"./docs/install.md"},
+			want:     1,
+		},
+		{
+			name:     "suffix must match a path segment",
+			expected: []string{"me.md"},
+			want:     0,
+		},
+		{
+			name:     "no expected sources",
+			expected: nil,
+			want:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cli.RecallAtK(tt.expected, retrieved); got != tt.want {
+				t.Errorf("want recall@k: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+var RenameJSONFields = renameJSONFields
+
+func (o *QueryOptions) SetRaw(raw bool) { o.raw = raw }
+
+func (o *QueryOptions) PrintStream(ctx context.Context, ch <-chan prompt.Chunk) error {
+	return o.printStream(ctx, ch, o.Print, func(string) {}, func() {})
+}
+
+var CreateClient = createClient
+
+// UseBackend serves all configured providers from b for the rest of the test.
+func UseBackend(t *testing.T, b llm.Backend) {
+	t.Helper()
+
+	orig := newBackend
+	newBackend = func(*slog.Logger, types.ProviderConfig, *time.Duration, ...llm.Option) llm.Backend { return b }
+
+	t.Cleanup(func() { newBackend = orig })
+}
+
+var Discover = discover
+
+var NoContextAnswer = noContextAnswer
+
+// ChunkFiles chunks paths and returns the chunked sources and
+// the number of files skipped for being too large or binary.
+func ChunkFiles(paths []string, maxFileBytes int64) (sources []string, tooLarge, binary int, err error) {
+	chunked, skipped, err := chunkFiles(context.Background(), slog.New(slog.DiscardHandler), paths, types.EmbeddingConfig{ChunkSize: 10, MaxFileBytes: maxFileBytes})
+	for _, c := range chunked {
+		sources = append(sources, c.source)
+	}
+
+	return sources, skipped.tooLarge, skipped.binary, err
+}
+
+// ChunkFile chunks the file at path with cfg and returns
+// its chunks and frontmatter metadata.
+func ChunkFile(path string, cfg types.EmbeddingConfig) (chunks []string, title string, tags []string, err error) {
+	cf, err := chunkFile(path, cfg)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return cf.chunks, cf.title, cf.tags, nil
+}
+
+// ChunkURL fetches and chunks the document at rawURL with cfg
+// and returns its chunks.
+func ChunkURL(rawURL string, cfg types.EmbeddingConfig) ([]string, error) {
+	cf, err := chunkURL(context.Background(), rawURL, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cf.chunks, nil
+}
+
+// ChunkFilesSummary chunks paths logging to logger and
+// returns the total number of skipped files and their summary.
+func ChunkFilesSummary(logger *slog.Logger, paths []string) (skipped int, summary string, err error) {
+	_, stats, err := chunkFiles(context.Background(), logger, paths, types.EmbeddingConfig{ChunkSize: 10})
+	return stats.total(), stats.String(), err
+}
+
+// PrintChunks prints the chunks of each source, up to maxChunks,
+// and returns the printed lines.
+func PrintChunks(sources []string, chunks [][]string, maxChunks int) []string {
+	files := make([]*dataChunks, 0, len(sources))
+	for i, s := range sources {
+		files = append(files, &dataChunks{source: s, chunks: chunks[i]})
+	}
+
+	var lines []string
+
+	printChunks(func(s string) { lines = append(lines, s) }, files, maxChunks)
+
+	return lines
+}
+
+// SummarizeHits summarizes hits with summarize above threshold characters.
+func SummarizeHits(summarize func(ctx context.Context, query, text string) (string, error), query string, hits []vecdb.SearchResult, threshold int) ([]vecdb.SearchResult, error) {
+	return summarizeHits(context.Background(), func(string) {}, summarize, query, hits, threshold)
+}
+
+var ProgressStatus = progressStatus
+
+// ETAEstimator estimates the remaining time of a task from its progress.
+type ETAEstimator struct{ e etaEstimator }
+
+func (e *ETAEstimator) Add(at time.Time, done, total int) (time.Duration, bool) {
+	return e.e.add(at, done, total)
+}
+
+var FormatETA = formatETA
+
+// NewEmbedProgress returns the recorders of an embedding progress reported to send.
+func NewEmbedProgress(files, chunks int, send func(string)) (addChunks func(n int), fileDone func()) {
+	p := newEmbedProgress(files, chunks, func(s string, _, _ int) { send(s) })
+	return p.addChunks, p.fileDone
+}
+
+// EmbedAll embeds a single chunk file per source into db using providers,
+// each embedding up to concurrency files at a time unless capped.
+func EmbedAll(providers types.Providers, db *vecdb.VectorDB, model string, concurrency int, sources ...string) error {
+	o := &llmOptions{
+		providers: providers,
+		vectordb:  db,
+		embeddingConfig: types.EmbeddingConfig{
+			Model:       model,
+			BatchSize:   1,
+			Concurrency: concurrency,
+		},
+	}
+
+	files := make([]*dataChunks, 0, len(sources))
+	for _, s := range sources {
+		files = append(files, &dataChunks{source: s, chunks: []string{s}})
+	}
+
+	return o.embedAll(context.Background(), slog.New(slog.DiscardHandler), func(string, int, int) {}, files, nil)
+}
+
+var ExpandEnv = expandEnv
+
+var ValidateProviderConfig = validateProviderConfig
+
+// ConfigHash returns the configuration hash resolved from the config file at path,
+// as compared with the one of a daemon before forwarding a query to it.
+func ConfigHash(t *testing.T, path string) string {
+	t.Helper()
+
+	o := NewDefaultRAGOptions(genericclioptions.NewTestIOStreamsDiscard(nil))
+	o.configOptions.flags.configPath = path
+
+	if err := o.Complete(); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	return o.llmOptions.configHash
+}
+
+var (
+	QueryDaemon             = queryDaemon
+	GetDaemonStatus         = daemonStatus
+	DefaultDaemonSocketPath = defaultDaemonSocketPath
+)
+
+// ServeDaemon serves engine on a unix socket at path until the end of the test.
+func ServeDaemon(t *testing.T, path string, engine DaemonEngine) {
+	t.Helper()
+
+	ln, err := listenDaemon(path)
+	if err != nil {
+		t.Fatalf("listen daemon: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() { done <- serveDaemon(ctx, ln, engine, slog.New(slog.DiscardHandler)) }()
+
+	t.Cleanup(func() {
+		cancel()
+
+		if err := <-done; err != nil {
+			t.Errorf("serve daemon: %v", err)
+		}
+	})
+}
+
+// SaveChatSession saves the history of session as the named chat session.
+func SaveChatSession(name, model string, session llm.Session) error {
+	path, err := chatSessionPath(name)
+	if err != nil {
+		return err
+	}
+
+	return writeChatSession(path, model, session)
+}
+
+// ReadChatSession reads the named chat session and returns its model,
+// its restorable messages and the number of skipped messages.
+func ReadChatSession(name string) (model string, msgs []llm.HistoryMessage, skipped int, err error) {
+	path, err := chatSessionPath(name)
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	s, skipped, err := readChatSession(path)
+
+	return s.Model, s.Messages, skipped, err
+}
@@ -0,0 +1,259 @@
+// Package extract extracts the text of documents in binary formats,
+// so that they can be chunked and embedded like text files.
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrNoText       = errors.New("no text found in document")
+	ErrEncryptedPDF = errors.New("encrypted pdf")
+	ErrTooLarge     = errors.New("decompressed document too large")
+)
+
+// Func returns the text of the document at path. The content decompressed
+// while extracting it is bounded by maxBytes in total, if positive.
+type Func func(path string, maxBytes int64) (string, error)
+
+// funcs are the extractors by file extension, without the dot.
+var funcs = map[string]Func{
+	"pdf":  PDF,
+	"docx": DOCX,
+	"epub": EPUB,
+}
+
+// Formats lists the supported formats, by file extension without the dot.
+var Formats = slices.Sorted(maps.Keys(funcs))
+
+// For returns the extractor of the format of the file at path,
+// if the format is among the enabled ones.
+func For(path string, enabled []string) (Func, bool) {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if !slices.Contains(enabled, ext) {
+		return nil, false
+	}
+
+	f, ok := funcs[ext]
+
+	return f, ok
+}
+
+// DOCX returns the text of the paragraphs of a Word document.
+func DOCX(path string, maxBytes int64) (string, error) {
+	zr, err := zip.OpenReader(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("open docx: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+
+	b, err := readZipFile(&zr.Reader, "word/document.xml", newBudget(maxBytes))
+	if err != nil {
+		return "", fmt.Errorf("read docx: %w", err)
+	}
+
+	var (
+		sb     strings.Builder
+		inText bool
+	)
+
+	dec := xml.NewDecoder(bytes.NewReader(b))
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("parse docx: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				sb.WriteByte('\t')
+			case "br":
+				sb.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				sb.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(t)
+			}
+		}
+	}
+
+	return documentText(sb.String())
+}
+
+// epubContainer is the META-INF/container.xml of an EPUB,
+// locating its package document.
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage is the part of an EPUB package document
+// listing its content documents in reading order.
+type epubPackage struct {
+	Manifest []struct {
+		ID   string `xml:"id,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// EPUB returns the text of the content documents of an EPUB book,
+// in reading order.
+func EPUB(file string, maxBytes int64) (string, error) {
+	zr, err := zip.OpenReader(filepath.Clean(file))
+	if err != nil {
+		return "", fmt.Errorf("open epub: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+
+	budget := newBudget(maxBytes)
+
+	var container epubContainer
+	if err := decodeZipXML(&zr.Reader, "META-INF/container.xml", budget, &container); err != nil {
+		return "", err
+	}
+
+	if len(container.Rootfiles) == 0 {
+		return "", errors.New("epub: no package document")
+	}
+
+	opf := container.Rootfiles[0].FullPath
+
+	var pkg epubPackage
+	if err := decodeZipXML(&zr.Reader, opf, budget, &pkg); err != nil {
+		return "", err
+	}
+
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		hrefs[item.ID] = item.Href
+	}
+
+	var sb strings.Builder
+
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+
+		// hrefs are relative to the package document
+		b, err := readZipFile(&zr.Reader, path.Join(path.Dir(opf), href), budget)
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(HTMLText(string(b)))
+		sb.WriteString("\n\n")
+	}
+
+	return documentText(sb.String())
+}
+
+func decodeZipXML(zr *zip.Reader, name string, budget *budget, v any) error {
+	b, err := readZipFile(zr, name, budget)
+	if err != nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("parse %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func readZipFile(zr *zip.Reader, name string, budget *budget) ([]byte, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return io.ReadAll(budget.reader(f))
+}
+
+// documentText trims the extracted text of a document,
+// rejecting documents without any.
+func documentText(text string) (string, error) {
+	text = strings.TrimSpace(blankLinesRE.ReplaceAllString(text, "\n\n"))
+	if text == "" {
+		return "", ErrNoText
+	}
+
+	return text, nil
+}
+
+// budget bounds the bytes decompressed while extracting a document.
+type budget struct {
+	limited bool
+	left    int64
+}
+
+// newBudget returns a budget of maxBytes, unlimited if not positive.
+func newBudget(maxBytes int64) *budget {
+	return &budget{limited: maxBytes > 0, left: maxBytes}
+}
+
+// reader returns r, charging the bytes read from it to b.
+// Reading beyond the budget fails with [ErrTooLarge].
+func (b *budget) reader(r io.Reader) io.Reader {
+	if !b.limited {
+		return r
+	}
+
+	return &budgetReader{r: r, b: b}
+}
+
+// exceeded reports whether more bytes than budgeted were read.
+func (b *budget) exceeded() bool { return b.limited && b.left < 0 }
+
+type budgetReader struct {
+	r io.Reader
+	b *budget
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	// reading one byte beyond the budget tells an exact fit from an overflow
+	if limit := r.b.left + 1; int64(len(p)) > limit {
+		p = p[:max(limit, 0)]
+	}
+
+	n, err := r.r.Read(p)
+	r.b.left -= int64(n)
+
+	if r.b.exceeded() {
+		return n, ErrTooLarge
+	}
+
+	return n, err
+}
@@ -0,0 +1,287 @@
+package extract_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli/extract"
+)
+
+func TestFor(t *testing.T) {
+	tests := []struct {
+		path    string
+		enabled []string
+		want    bool
+	}{
+		{path: "doc.pdf", enabled: []string{"pdf"}, want: true},
+		{path: "DOC.PDF", enabled: []string{"pdf"}, want: true},
+		{path: "doc.docx", enabled: []string{"pdf"}, want: false},
+		{path: "doc.txt", enabled: []string{"txt"}, want: false},
+	}
+
+	for _, tt := range tests {
+		if _, got := extract.For(tt.path, tt.enabled); got != tt.want {
+			t.Errorf("%s %v: want %v, got %v", tt.path, tt.enabled, tt.want, got)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	const (
+		helvetica = `<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>`
+		composite = `<< /Type /Font /Subtype /Type0 /BaseFont /ABCDEF+Calibri /Encoding /Identity-H /DescendantFonts [9 0 R] /ToUnicode 10 0 R >>`
+	)
+
+	root := t.TempDir()
+
+	docx := writeZip(t, filepath.Join(root, "doc.docx"), map[string]string{
+		"word/document.xml": `<?xml version="1.0"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>foo</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve">bar</w:t></w:r></w:p>
+<w:p><w:r><w:t>baz</w:t><w:br/><w:t>qux</w:t></w:r></w:p>
+</w:body></w:document>`,
+	})
+
+	epub := writeZip(t, filepath.Join(root, "book.epub"), map[string]string{
+		"mimetype": "application/epub+zip",
+		"META-INF/container.xml": `<?xml version="1.0"?>
+<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container"><rootfiles>
+<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+</rootfiles></container>`,
+		"OEBPS/content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf"><manifest>
+<item id="ch1" href="text/ch1.xhtml" media-type="application/xhtml+xml"/>
+<item id="ch2" href="text/ch2.xhtml" media-type="application/xhtml+xml"/>
+</manifest><spine><itemref idref="ch2"/><itemref idref="ch1"/></spine></package>`,
+		"OEBPS/text/ch1.xhtml": `<html><body><p>foo &amp; bar</p></body></html>`,
+		"OEBPS/text/ch2.xhtml": `<html><head><style>p {}</style></head><body><h1>baz</h1></body></html>`,
+	})
+
+	encrypted := filepath.Join(root, "encrypted.pdf")
+	if err := os.WriteFile(encrypted, []byte("%PDF-1.4\n1 0 obj\n<< /Encrypt 2 0 R >>\nendobj\n"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		extract extract.Func
+		path    string
+		want    string
+		wantErr error
+	}{
+		{name: "docx", extract: extract.DOCX, path: docx, want: "foo\tbar\nbaz\nqux"},
+		{name: "epub in spine order", extract: extract.EPUB, path: epub, want: "baz\n\nfoo & bar"},
+		{
+			name:    "pdf",
+			extract: extract.PDF,
+			path: writePDF(t, filepath.Join(root, "doc.pdf"), "/F1 5 0 R",
+				`BT /F1 12 Tf 72 720 Td (foo \(1\)) Tj 0 -14 Td [(b) -10 (ar) -250 (baz)] TJ T* <717578> Tj ET`,
+				helvetica,
+				pdfStream("/Type /XObject /Subtype /Image", "BT (x) Tj ET"),
+			),
+			want: "foo (1)\nbar baz\nqux",
+		},
+		{
+			name:    "pdf form xobject",
+			extract: extract.PDF,
+			path: writePDF(t, filepath.Join(root, "form.pdf"), "/F1 5 0 R",
+				`BT /F1 12 Tf (foo) Tj ET /Fm1 Do`,
+				helvetica,
+				pdfStream("/Type /XObject /Subtype /Form /BBox [0 0 100 100]", "BT /F1 12 Tf (bar) Tj ET"),
+			),
+			want: "foo\n\nbar",
+		},
+		{
+			name:    "pdf composite font",
+			extract: extract.PDF,
+			path: writePDF(t, filepath.Join(root, "composite.pdf"), "/F1 5 0 R",
+				`BT /F1 12 Tf [<0026> -300 <0027>] TJ ET`,
+				composite,
+			),
+			wantErr: extract.ErrNoText,
+		},
+		{
+			name:    "pdf composite font in an object stream",
+			extract: extract.PDF,
+			path: writePDF(t, filepath.Join(root, "objstm.pdf"), "/F1 5 0 R",
+				`BT /F1 12 Tf <00260027> Tj ET`,
+				pdfStream("/Type /ObjStm /N 1 /First 4 /Filter /FlateDecode", deflate(t, "5 0 "+composite)),
+			),
+			wantErr: extract.ErrNoText,
+		},
+		{
+			name:    "pdf custom encoding",
+			extract: extract.PDF,
+			path: writePDF(t, filepath.Join(root, "custom.pdf"), "/F1 5 0 R",
+				`BT /F1 12 Tf (AB) Tj ET`,
+				`<< /Type /Font /Subtype /Type1 /BaseFont /ABCDEF+CMR10 /Encoding << /Differences [65 /f /o] >> >>`,
+			),
+			wantErr: extract.ErrNoText,
+		},
+		{
+			name:    "pdf embedded subset without encoding",
+			extract: extract.PDF,
+			path: writePDF(t, filepath.Join(root, "subset.pdf"), "/F1 5 0 R",
+				`BT /F1 12 Tf (AB) Tj ET`,
+				`<< /Type /Font /Subtype /TrueType /BaseFont /ABCDEF+Arial >>`,
+			),
+			wantErr: extract.ErrNoText,
+		},
+		{
+			name:    "pdf mixed fonts",
+			extract: extract.PDF,
+			path: writePDF(t, filepath.Join(root, "mixed.pdf"), "/F1 5 0 R /F2 6 0 R",
+				`BT /F1 12 Tf (foo) Tj /F2 12 Tf 0 -14 Td <0026> Tj /F1 12 Tf 0 -14 Td (bar) Tj ET`,
+				helvetica,
+				composite,
+			),
+			want: "foo\n\nbar",
+		},
+		{name: "encrypted pdf", extract: extract.PDF, path: encrypted, wantErr: extract.ErrEncryptedPDF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.extract(tt.path, 0)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want error: %v, got: %v", tt.wantErr, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("want text: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	var (
+		root    = t.TempDir()
+		content = "BT (" + strings.Repeat("foo ", 1000) + ") Tj ET"
+		text    = strings.TrimSpace(strings.Repeat("foo ", 1000))
+		pdf     = writePDF(t, filepath.Join(root, "doc.pdf"), "", content)
+		docx    = writeDOCX(t, filepath.Join(root, "doc.docx"), text)
+	)
+
+	tests := []struct {
+		name     string
+		extract  extract.Func
+		path     string
+		maxBytes int64
+		wantErr  error
+	}{
+		{name: "pdf unlimited", extract: extract.PDF, path: pdf, maxBytes: 0},
+		{name: "pdf within", extract: extract.PDF, path: pdf, maxBytes: int64(len(content))},
+		{name: "pdf beyond", extract: extract.PDF, path: pdf, maxBytes: int64(len(content)) - 1, wantErr: extract.ErrTooLarge},
+		{name: "docx within", extract: extract.DOCX, path: docx, maxBytes: 1 << 20},
+		{name: "docx beyond", extract: extract.DOCX, path: docx, maxBytes: 100, wantErr: extract.ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.extract(tt.path, tt.maxBytes)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want error: %v, got: %v", tt.wantErr, err)
+			}
+
+			if tt.wantErr == nil && got != text {
+				t.Errorf("want text of %d bytes, got %d", len(text), len(got))
+			}
+		})
+	}
+}
+
+// writePDF writes a single page PDF showing content, FlateDecode compressed,
+// with the font resources fonts. The objects are numbered from 5 on.
+func writePDF(t *testing.T, path, fonts, content string, objects ...string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	buf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	buf.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n")
+	fmt.Fprintf(&buf, "3 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /Font << %s >> >> /Contents 4 0 R >>\nendobj\n", fonts)
+	fmt.Fprintf(&buf, "4 0 obj\n%s\nendobj\n", pdfStream("/Filter /FlateDecode", deflate(t, content)))
+
+	for i, o := range objects {
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+5, o)
+	}
+
+	buf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	return path
+}
+
+// pdfStream returns a stream object of data with the dictionary entries dict.
+func pdfStream(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(t *testing.T, s string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	zw := zlib.NewWriter(&buf)
+
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatalf("deflate: %v", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("deflate: %v", err)
+	}
+
+	return buf.String()
+}
+
+func writeZip(t *testing.T, path string, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	return path
+}
+
+// writeDOCX writes a Word document of a single paragraph of text.
+func writeDOCX(t *testing.T, path string, text string) string {
+	t.Helper()
+
+	return writeZip(t, path, map[string]string{
+		"word/document.xml": `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body><w:p><w:r><w:t>` +
+			text + `</w:t></w:r></w:p></w:body></w:document>`,
+	})
+}
@@ -0,0 +1,33 @@
+package extract
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlCommentRE = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlTagRE     = regexp.MustCompile(`</?[a-zA-Z][a-zA-Z0-9-]*(?:\s[^<>]*)?/?>`)
+	htmlNonTextRE = regexp.MustCompile(`(?is)<script\b.*?</script\s*>|<style\b.*?</style\s*>|<!doctype[^>]*>`)
+	htmlBreakRE   = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|div|li|tr|h[1-6]|pre|blockquote|section|article|header|footer)\s*>`)
+	blankLinesRE  = regexp.MustCompile(`\n[ \t]*(?:\n[ \t]*)+`)
+)
+
+// StripHTML removes the HTML comments and tags of text, keeping their content.
+// Tags cut by a chunk boundary are kept as is.
+func StripHTML(text string) string {
+	text = htmlCommentRE.ReplaceAllString(text, "")
+	return htmlTagRE.ReplaceAllString(text, "")
+}
+
+// HTMLText reduces an HTML document to its text: the doctype, scripts
+// and styles are removed, block level tags end lines, the other tags
+// are stripped and entities decoded.
+func HTMLText(doc string) string {
+	doc = htmlNonTextRE.ReplaceAllString(doc, "")
+	doc = htmlBreakRE.ReplaceAllString(doc, "\n")
+	doc = html.UnescapeString(StripHTML(doc))
+
+	return strings.TrimSpace(blankLinesRE.ReplaceAllString(doc, "\n\n"))
+}
@@ -0,0 +1,490 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfTJSpace is the TJ kerning, in thousandths of a text space unit,
+// beyond which a gap between two strings is taken for a word space.
+const pdfTJSpace = -200
+
+var (
+	pdfFilterRE = regexp.MustCompile(`/Filter\s*(\[[^\]]*\]|/\w+)`)
+
+	// pdfNonContentRE matches the keys of stream dictionaries that are not
+	// page content: typed streams (images, fonts, xref and object streams,
+	// metadata) and embedded font files.
+	pdfNonContentRE = regexp.MustCompile(`/(Type|Subtype|Length[123])\b`)
+
+	// pdfFormRE matches the dictionaries of form XObjects, typed streams
+	// that are content nonetheless.
+	pdfFormRE = regexp.MustCompile(`/Subtype\s*/Form\b`)
+
+	pdfObjStmRE = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+)
+
+// pdfStream is a decoded stream of a PDF file.
+type pdfStream struct {
+	dict []byte // dict is the stream dictionary, from its "obj" keyword.
+	data []byte
+}
+
+// isContent reports whether s is page or form content.
+func (s pdfStream) isContent() bool {
+	return !pdfNonContentRE.Match(s.dict) || pdfFormRE.Match(s.dict)
+}
+
+// PDF returns the text shown by the content streams of a PDF file.
+// It handles uncompressed and FlateDecode streams and strings of fonts with
+// a standard encoding. Strings of other fonts, such as composite or custom
+// encoded ones, are dropped, as their codes are glyph ids rather than
+// characters; a file without any other text fails with [ErrNoText].
+// Encrypted files are rejected.
+func PDF(path string, maxBytes int64) (string, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.Contains(b, []byte("/Encrypt")) {
+		return "", ErrEncryptedPDF
+	}
+
+	streams, err := pdfStreams(b, newBudget(maxBytes))
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		sb          strings.Builder
+		undecodable = pdfUndecodableFonts(pdfObjects(b, streams))
+	)
+
+	for _, s := range streams {
+		if s.isContent() {
+			sb.WriteString(pdfContentText(s.data, undecodable))
+			sb.WriteByte('\n')
+		}
+	}
+
+	return documentText(sb.String())
+}
+
+// pdfStreams returns the decoded content and object streams of the PDF
+// file b, in file order, charging the inflated ones to budget. Streams
+// that cannot be decoded are skipped.
+func pdfStreams(b []byte, budget *budget) ([]pdfStream, error) {
+	var (
+		streams []pdfStream
+		keyword = []byte("stream")
+		end     = []byte("endstream")
+	)
+
+	for off := 0; ; {
+		i := bytes.Index(b[off:], keyword)
+		if i == -1 {
+			return streams, nil
+		}
+
+		i += off
+		off = i + len(keyword)
+
+		if i >= 3 && string(b[i-3:i]) == "end" {
+			continue
+		}
+
+		start := off
+		if bytes.HasPrefix(b[start:], []byte("\r\n")) {
+			start += 2
+		} else if start < len(b) && b[start] == '\n' {
+			start++
+		} else {
+			continue
+		}
+
+		j := bytes.Index(b[start:], end)
+		if j == -1 {
+			return streams, nil
+		}
+
+		data := bytes.TrimRight(b[start:start+j], "\r\n")
+		off = start + j + len(end)
+
+		dict := b[:i]
+		if k := bytes.LastIndex(dict, []byte("obj")); k != -1 {
+			dict = dict[k:]
+		}
+
+		if !(pdfStream{dict: dict}).isContent() && !pdfObjStmRE.Match(dict) {
+			continue
+		}
+
+		content, ok := pdfDecodeStream(dict, data, budget)
+		if budget.exceeded() {
+			return nil, ErrTooLarge
+		}
+
+		if ok {
+			streams = append(streams, pdfStream{dict: dict, data: content})
+		}
+	}
+}
+
+// pdfDecodeStream decodes the data of a stream with the dictionary dict,
+// if unfiltered or FlateDecode filtered. Inflated data is read from budget.
+func pdfDecodeStream(dict, data []byte, budget *budget) ([]byte, bool) {
+	m := pdfFilterRE.FindSubmatch(dict)
+	if m == nil {
+		return data, true
+	}
+
+	if filters := strings.Fields(strings.Trim(string(m[1]), "[]")); len(filters) != 1 || filters[0] != "/FlateDecode" {
+		return nil, false
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	defer func() { _ = zr.Close() }()
+
+	content, err := io.ReadAll(budget.reader(zr))
+	if err != nil && len(content) == 0 {
+		return nil, false
+	}
+
+	return content, true
+}
+
+// pdfOperand is an operand of a content stream operator.
+type pdfOperand struct {
+	str   []byte       // str is set on strings.
+	name  []byte       // name is set on names, without the slash.
+	num   float64      // num is set on numbers.
+	isNum bool         // isNum reports whether the operand is a number.
+	array []pdfOperand // array is set on arrays.
+}
+
+// pdfContentText returns the text shown by the text operators of a content
+// stream, breaking lines on line moves and at the end of text objects.
+// Strings shown with the fonts of the undecodable resource names are dropped.
+func pdfContentText(content []byte, undecodable map[string]bool) string {
+	var (
+		sb       strings.Builder
+		operands []pdfOperand
+		arrays   [][]pdfOperand // arrays holds the enclosing arrays of an open array.
+		lastY    float64
+		font     string // font is the resource name of the current font.
+	)
+
+	push := func(o pdfOperand) {
+		if n := len(arrays); n > 0 {
+			arrays[n-1] = append(arrays[n-1], o)
+			return
+		}
+
+		operands = append(operands, o)
+	}
+
+	lex := pdfLexer{b: content}
+
+	for {
+		tok, kind := lex.next()
+
+		switch kind {
+		case pdfEOF:
+			return sb.String()
+		case pdfString:
+			if !undecodable[font] {
+				push(pdfOperand{str: tok})
+				continue
+			}
+
+			push(pdfOperand{})
+		case pdfName:
+			push(pdfOperand{name: tok})
+		case pdfArrayStart:
+			arrays = append(arrays, nil)
+		case pdfArrayEnd:
+			if n := len(arrays); n > 0 {
+				a := arrays[n-1]
+				arrays = arrays[:n-1]
+				push(pdfOperand{array: a})
+			}
+		case pdfOther:
+			push(pdfOperand{})
+		case pdfKeyword:
+			if f, err := strconv.ParseFloat(string(tok), 64); err == nil {
+				push(pdfOperand{num: f, isNum: true})
+				continue
+			}
+
+			switch op := string(tok); op {
+			case "Tf":
+				if n := len(operands); n >= 2 {
+					font = string(operands[n-2].name)
+				}
+			case "Tj":
+				writePDFString(&sb, lastOperand(operands).str)
+			case "'", `"`:
+				sb.WriteByte('\n')
+				writePDFString(&sb, lastOperand(operands).str)
+			case "TJ":
+				for _, o := range lastOperand(operands).array {
+					if o.isNum && o.num < pdfTJSpace && !undecodable[font] {
+						sb.WriteByte(' ')
+					}
+
+					writePDFString(&sb, o.str)
+				}
+			case "T*", "ET":
+				sb.WriteByte('\n')
+			case "Td", "TD":
+				if ty := lastOperand(operands); ty.isNum && ty.num != 0 {
+					sb.WriteByte('\n')
+				}
+			case "Tm":
+				if y := lastOperand(operands); y.isNum {
+					if y.num != lastY {
+						sb.WriteByte('\n')
+					} else {
+						sb.WriteByte(' ')
+					}
+
+					lastY = y.num
+				}
+			case "ID":
+				lex.skipInlineImage()
+			}
+
+			operands = operands[:0]
+			arrays = arrays[:0]
+		}
+	}
+}
+
+func lastOperand(operands []pdfOperand) pdfOperand {
+	if len(operands) == 0 {
+		return pdfOperand{}
+	}
+
+	return operands[len(operands)-1]
+}
+
+// writePDFString writes the text of a PDF string: UTF-16BE after
+// a byte order mark, Latin-1 otherwise. Control characters are dropped.
+func writePDFString(sb *strings.Builder, s []byte) {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+
+		for _, r := range utf16.Decode(units) {
+			if r >= ' ' {
+				sb.WriteRune(r)
+			}
+		}
+
+		return
+	}
+
+	for _, c := range s {
+		if c >= ' ' && c != 0x7F {
+			sb.WriteRune(rune(c))
+		}
+	}
+}
+
+type pdfTokenKind int
+
+const (
+	pdfEOF        pdfTokenKind = iota
+	pdfString                  // a literal or hex string, decoded
+	pdfArrayStart              // [
+	pdfArrayEnd                // ]
+	pdfKeyword                 // an operator or a number
+	pdfName                    // a name, without the slash
+	pdfOther                   // a dictionary delimiter
+)
+
+// pdfLexer splits a content stream into tokens.
+type pdfLexer struct {
+	b []byte
+	i int
+}
+
+func (l *pdfLexer) next() ([]byte, pdfTokenKind) {
+	for l.i < len(l.b) {
+		c := l.b[l.i]
+
+		switch {
+		case isPDFSpace(c):
+			l.i++
+		case c == '%':
+			for l.i < len(l.b) && l.b[l.i] != '\n' && l.b[l.i] != '\r' {
+				l.i++
+			}
+		case c == '(':
+			return l.literalString(), pdfString
+		case c == '<' && l.i+1 < len(l.b) && l.b[l.i+1] == '<',
+			c == '>' && l.i+1 < len(l.b) && l.b[l.i+1] == '>':
+			l.i += 2
+			return nil, pdfOther
+		case c == '<':
+			return l.hexString(), pdfString
+		case c == '[':
+			l.i++
+			return nil, pdfArrayStart
+		case c == ']':
+			l.i++
+			return nil, pdfArrayEnd
+		case c == '/':
+			l.i++
+			return l.regular(), pdfName
+		case isPDFDelimiter(c):
+			l.i++
+			return nil, pdfOther
+		default:
+			return l.regular(), pdfKeyword
+		}
+	}
+
+	return nil, pdfEOF
+}
+
+// regular consumes a run of regular characters.
+func (l *pdfLexer) regular() []byte {
+	start := l.i
+	for l.i < len(l.b) && !isPDFSpace(l.b[l.i]) && !isPDFDelimiter(l.b[l.i]) {
+		l.i++
+	}
+
+	return l.b[start:l.i]
+}
+
+// literalString consumes a parenthesized string and returns its bytes.
+func (l *pdfLexer) literalString() []byte {
+	var (
+		s     []byte
+		depth = 1
+	)
+
+	for l.i++; l.i < len(l.b); l.i++ {
+		c := l.b[l.i]
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				l.i++
+				return s
+			}
+		case '\\':
+			l.i++
+			if l.i == len(l.b) {
+				return s
+			}
+
+			c = l.b[l.i]
+
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// a line continuation
+				if l.i+1 < len(l.b) && l.b[l.i+1] == '\n' {
+					l.i++
+				}
+
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					n := int(c - '0')
+					for k := 0; k < 2 && l.i+1 < len(l.b) && l.b[l.i+1] >= '0' && l.b[l.i+1] <= '7'; k++ {
+						l.i++
+						n = n*8 + int(l.b[l.i]-'0')
+					}
+
+					c = byte(n)
+				}
+			}
+		}
+
+		s = append(s, c)
+	}
+
+	return s
+}
+
+// hexString consumes a hex string and returns its bytes.
+func (l *pdfLexer) hexString() []byte {
+	var digits []byte
+
+	for l.i++; l.i < len(l.b) && l.b[l.i] != '>'; l.i++ {
+		if c := l.b[l.i]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+
+	l.i++
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	s, _ := hex.DecodeString(string(digits))
+
+	return s
+}
+
+// skipInlineImage consumes the data of an inline image, up to its EI operator.
+func (l *pdfLexer) skipInlineImage() {
+	for l.i < len(l.b) {
+		i := bytes.Index(l.b[l.i:], []byte("EI"))
+		if i == -1 {
+			l.i = len(l.b)
+			return
+		}
+
+		l.i += i + 2
+
+		if isPDFSpace(l.b[l.i-3]) && (l.i == len(l.b) || isPDFSpace(l.b[l.i])) {
+			return
+		}
+	}
+}
+
+func isPDFSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	default:
+		return false
+	}
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) != -1
+}
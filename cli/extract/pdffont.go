@@ -0,0 +1,153 @@
+package extract
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+var (
+	pdfObjRE = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+	// pdfFontRE matches font dictionaries, but not font descriptors.
+	pdfFontRE = regexp.MustCompile(`/Type\s*/Font\b`)
+
+	// pdfFontResourcesRE matches the font resources of a resource
+	// dictionary, given inline or by reference.
+	pdfFontResourcesRE = regexp.MustCompile(`/Font\s*(?:<<([^<>]*)>>|(\d+)\s+\d+\s+R)`)
+	pdfNamedRefRE      = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+(\d+)\s+\d+\s+R`)
+
+	pdfUndecodableFontRE = regexp.MustCompile(`/Subtype\s*/(?:Type0|Type3)\b|/BaseFont\s*/(?:Symbol|ZapfDingbats)\b`)
+	pdfSubsetFontRE      = regexp.MustCompile(`/BaseFont\s*/[A-Z]{6}\+`)
+	pdfEncodingRE        = regexp.MustCompile(`/Encoding\s*(/\w+)?`)
+	pdfObjStmHeaderRE    = regexp.MustCompile(`/(N|First)\s+(\d+)`)
+)
+
+// pdfStandardEncodings are the font encodings whose character codes are
+// taken for Latin-1 characters.
+var pdfStandardEncodings = []string{"/WinAnsiEncoding", "/MacRomanEncoding", "/StandardEncoding", "/PDFDocEncoding"}
+
+// pdfObjects returns the dictionaries of the objects of the PDF file b and
+// of its object streams, by object number. Stream data is left out.
+func pdfObjects(b []byte, streams []pdfStream) map[int][]byte {
+	objects := map[int][]byte{}
+
+	for _, m := range pdfObjRE.FindAllSubmatchIndex(b, -1) {
+		body := b[m[1]:]
+		if i := bytes.Index(body, []byte("endobj")); i != -1 {
+			body = body[:i]
+		}
+
+		if i := bytes.Index(body, []byte("stream")); i != -1 {
+			body = body[:i]
+		}
+
+		if n, err := strconv.Atoi(string(b[m[2]:m[3]])); err == nil {
+			objects[n] = body
+		}
+	}
+
+	for _, s := range streams {
+		if pdfObjStmRE.Match(s.dict) {
+			pdfObjStmObjects(s, objects)
+		}
+	}
+
+	return objects
+}
+
+// pdfObjStmObjects adds the objects of the object stream s to objects.
+// The stream starts with pairs of object numbers and offsets, relative
+// to the first object at the /First offset.
+func pdfObjStmObjects(s pdfStream, objects map[int][]byte) {
+	var n, first int
+
+	for _, m := range pdfObjStmHeaderRE.FindAllSubmatch(s.dict, -1) {
+		v, _ := strconv.Atoi(string(m[2]))
+		if string(m[1]) == "N" {
+			n = v
+		} else {
+			first = v
+		}
+	}
+
+	if first <= 0 || first > len(s.data) {
+		return
+	}
+
+	var (
+		fields  = bytes.Fields(s.data[:first])
+		numbers = make([]int, 0, n)
+		offsets = make([]int, 0, n)
+	)
+
+	for i := 0; i+1 < len(fields) && len(numbers) < n; i += 2 {
+		num, err1 := strconv.Atoi(string(fields[i]))
+		off, err2 := strconv.Atoi(string(fields[i+1]))
+
+		if err1 != nil || err2 != nil || off < 0 || first+off > len(s.data) {
+			return
+		}
+
+		numbers = append(numbers, num)
+		offsets = append(offsets, first+off)
+	}
+
+	for i, num := range numbers {
+		end := len(s.data)
+		if i+1 < len(offsets) && offsets[i+1] >= offsets[i] {
+			end = offsets[i+1]
+		}
+
+		objects[num] = s.data[offsets[i]:end]
+	}
+}
+
+// pdfUndecodableFonts returns the resource names of the fonts whose strings
+// cannot be decoded, see [pdfFontDecodable]. Resource names are scoped to
+// pages, so a name is undecodable if any of the fonts it names is.
+func pdfUndecodableFonts(objects map[int][]byte) map[string]bool {
+	undecodable := map[string]bool{}
+
+	addFonts := func(refs []byte) {
+		for _, m := range pdfNamedRefRE.FindAllSubmatch(refs, -1) {
+			num, _ := strconv.Atoi(string(m[2]))
+
+			font, ok := objects[num]
+			if ok && pdfFontRE.Match(font) && !pdfFontDecodable(font) {
+				undecodable[string(m[1])] = true
+			}
+		}
+	}
+
+	for _, body := range objects {
+		for _, m := range pdfFontResourcesRE.FindAllSubmatch(body, -1) {
+			if m[1] != nil {
+				addFonts(m[1])
+				continue
+			}
+
+			num, _ := strconv.Atoi(string(m[2]))
+			addFonts(objects[num])
+		}
+	}
+
+	return undecodable
+}
+
+// pdfFontDecodable reports whether the character codes of the font with
+// the dictionary font are characters: a simple, non-symbolic font with a
+// standard encoding, or without an encoding and not an embedded subset,
+// whose built-in encoding is then arbitrary. ToUnicode maps are not read.
+func pdfFontDecodable(font []byte) bool {
+	if pdfUndecodableFontRE.Match(font) {
+		return false
+	}
+
+	if m := pdfEncodingRE.FindSubmatch(font); m != nil {
+		return slices.Contains(pdfStandardEncodings, string(m[1]))
+	}
+
+	return !pdfSubsetFontRE.Match(font)
+}
@@ -0,0 +1,79 @@
+package cli_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/types"
+)
+
+func TestChunkFile_Extractors(t *testing.T) {
+	root := t.TempDir()
+
+	docx := writeZip(t, filepath.Join(root, "doc.docx"), map[string]string{
+		"word/document.xml": `<?xml version="1.0"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>foo</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve">bar</w:t></w:r></w:p>
+<w:p><w:r><w:t>baz</w:t><w:br/><w:t>qux</w:t></w:r></w:p>
+</w:body></w:document>`,
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		extractors []string
+		want       []string
+		wantErr    error
+	}{
+		{name: "enabled", path: docx, extractors: []string{"docx"}, want: []string{"foo\tbar\nbaz\nqux"}},
+		{name: "not enabled", path: docx, extractors: []string{"pdf"}, wantErr: cli.ErrBinaryFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, _, _, err := cli.ChunkFile(tt.path, types.EmbeddingConfig{ChunkSize: 100, Extractors: tt.extractors})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want error: %v, got: %v", tt.wantErr, err)
+			}
+
+			if !slices.Equal(tt.want, chunks) {
+				t.Errorf("want chunks: %q, got: %q", tt.want, chunks)
+			}
+		})
+	}
+}
+
+func writeZip(t *testing.T, path string, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	return path
+}
@@ -0,0 +1,199 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const gitignoreName = ".gitignore"
+
+// defaultIgnorePatterns are always ignored when walking directories.
+var defaultIgnorePatterns = []string{".git/"}
+
+// ignorePattern is a single gitignore style pattern.
+type ignorePattern struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// ignoreMatcher matches paths relative to a root directory against
+// gitignore style patterns. It supports comments, negation ("!"),
+// directory only patterns (trailing "/"), anchoring (a leading or
+// inner "/") and "**" wildcards. Later patterns take precedence.
+type ignoreMatcher struct {
+	patterns []ignorePattern
+}
+
+func newIgnoreMatcher(lines ...string) *ignoreMatcher {
+	m := &ignoreMatcher{}
+
+	for _, l := range lines {
+		if p, ok := parseIgnorePattern(l); ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+
+	return m
+}
+
+// loadIgnoreMatcher builds a matcher for root from the default patterns,
+// the .gitignore file at root, if any, and the given extra patterns.
+func loadIgnoreMatcher(root string, extra []string) (*ignoreMatcher, error) {
+	lines := append([]string(nil), defaultIgnorePatterns...)
+
+	gitignore, err := readLines(filepath.Join(root, gitignoreName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	lines = append(lines, gitignore...)
+	lines = append(lines, extra...)
+
+	return newIgnoreMatcher(lines...), nil
+}
+
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	var p ignorePattern
+
+	if rest, ok := strings.CutPrefix(line, "!"); ok {
+		p.negate, line = true, rest
+	}
+
+	line = strings.TrimPrefix(line, `\`) // escaped leading "#" or "!"
+
+	if rest, ok := strings.CutSuffix(line, "/"); ok {
+		p.dirOnly, line = true, rest
+	}
+
+	// patterns without a slash match at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	p.segments = strings.Split(line, "/")
+	if !anchored {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+
+	return p, true
+}
+
+// validateIgnorePattern reports whether line is a well formed pattern.
+func validateIgnorePattern(line string) error {
+	p, _ := parseIgnorePattern(line)
+
+	for _, seg := range p.segments {
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("%q: %w", line, err)
+		}
+	}
+
+	return nil
+}
+
+// ignored reports whether the file at rel, a slash separated path relative
+// to the matcher root, is ignored. A file is also ignored if any of
+// its parent directories is, as git does not re-include such files.
+func (m *ignoreMatcher) ignored(rel string) bool {
+	segments := strings.Split(rel, "/")
+
+	for i := 1; i < len(segments); i++ {
+		if m.match(segments[:i], true) {
+			return true
+		}
+	}
+
+	return m.match(segments, false)
+}
+
+// ignoredDir reports whether the directory at rel, a slash separated path
+// relative to the matcher root, or any of its parent directories is ignored.
+func (m *ignoreMatcher) ignoredDir(rel string) bool {
+	segments := strings.Split(rel, "/")
+
+	for i := 1; i <= len(segments); i++ {
+		if m.match(segments[:i], true) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *ignoreMatcher) match(segments []string, isDir bool) bool {
+	ignored := false
+
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+
+		if matchSegments(p.segments, segments) {
+			ignored = !p.negate
+		}
+	}
+
+	return ignored
+}
+
+// matchSegments matches path segments against pattern segments,
+// where a "**" pattern segment matches zero or more path segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+func readLines(name string) ([]string, error) {
+	f, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var (
+		lines   []string
+		scanner = bufio.NewScanner(f)
+	)
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines, scanner.Err()
+}
@@ -0,0 +1,198 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+)
+
+// writeTree creates the given files, relative to a temporary root.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	return root
+}
+
+func TestDiscover_Ignore(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore":                "# build output\nbuild/\n*.log\n!keep.log\n/top.md\n",
+		".git/config":               "",
+		"main.go":                   "",
+		"readme.md":                 "",
+		"top.md":                    "",
+		"docs/top.md":               "",
+		"debug.log":                 "",
+		"keep.log":                  "",
+		"build/out.go":              "",
+		"node_modules/pkg/index.js": "",
+		"vendor/lib/lib.go":         "",
+		"web/app.min.js":            "",
+		"web/app.js":                "",
+		"docs/guide/intro.md":       "",
+	})
+
+	tests := []struct {
+		name     string
+		matchREs []*regexp.Regexp
+		ignore   []string
+		want     []string
+	}{
+		{
+			name: "gitignore only",
+			want: []string{
+				".gitignore",
+				"docs/guide/intro.md",
+				"docs/top.md",
+				"keep.log",
+				"main.go",
+				"node_modules/pkg/index.js",
+				"readme.md",
+				"vendor/lib/lib.go",
+				"web/app.js",
+				"web/app.min.js",
+			},
+		},
+		{
+			name:   "config ignore on top of gitignore",
+			ignore: []string{"vendor/", "node_modules/", "*.min.js", "docs/**/intro.md"},
+			want: []string{
+				".gitignore",
+				"docs/top.md",
+				"keep.log",
+				"main.go",
+				"readme.md",
+				"web/app.js",
+			},
+		},
+		{
+			name:     "match allowlist applies after the ignore denylist",
+			matchREs: []*regexp.Regexp{regexp.MustCompile(`\.go$`)},
+			ignore:   []string{"vendor/"},
+			want:     []string{"main.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := cli.Discover([]string{root}, tt.matchREs, tt.ignore)
+			if err != nil {
+				t.Fatalf("discover: %v", err)
+			}
+
+			got := make([]string, 0, len(files))
+
+			for _, f := range files {
+				rel, err := filepath.Rel(root, f)
+				if err != nil {
+					t.Fatalf("rel: %v", err)
+				}
+
+				got = append(got, filepath.ToSlash(rel))
+			}
+
+			slices.Sort(got)
+
+			if !slices.Equal(tt.want, got) {
+				t.Errorf("want files:\n%q\ngot:\n%q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDiscover_SkipsIgnoredDirs(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("unreadable directories are readable by root")
+	}
+
+	root := writeTree(t, map[string]string{
+		"main.go":                    "",
+		"node_modules/pkg/index.js":  "",
+		"node_modules/private/a.txt": "",
+	})
+
+	private := filepath.Join(root, "node_modules", "private")
+
+	if err := os.Chmod(private, 0); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+
+	t.Cleanup(func() { _ = os.Chmod(private, 0o750) })
+
+	files, err := cli.Discover([]string{root}, nil, []string{"node_modules/"})
+	if err != nil {
+		t.Fatalf("want unreadable ignored directories not walked, got: %v", err)
+	}
+
+	if want := []string{filepath.Join(root, "main.go")}; !slices.Equal(want, files) {
+		t.Errorf("want files: %q, got: %q", want, files)
+	}
+}
+
+func TestDiscover_ExplicitFileNotIgnored(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore": "*.log\n",
+		"debug.log":  "",
+	})
+
+	file := filepath.Join(root, "debug.log")
+
+	files, err := cli.Discover([]string{file}, nil, nil)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	if !slices.Equal([]string{file}, files) {
+		t.Errorf("want explicitly given file kept, got: %q", files)
+	}
+}
+
+func TestDiscover_Sorted(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"b.md":     "",
+		"a/z.md":   "",
+		"a/b/c.md": "",
+		"c.md":     "",
+	})
+
+	var (
+		b = filepath.Join(root, "b.md")
+		c = filepath.Join(root, "c.md")
+		a = filepath.Join(root, "a")
+	)
+
+	want := []string{
+		filepath.Join(root, "a", "b", "c.md"),
+		filepath.Join(root, "a", "z.md"),
+		b,
+		c,
+	}
+
+	for _, args := range [][]string{{c, b, a}, {a, b, c}, {b, a, c, b}} {
+		files, err := cli.Discover(args, nil, nil)
+		if err != nil {
+			t.Fatalf("discover: %v", err)
+		}
+
+		if !slices.Equal(want, files) {
+			t.Errorf("discover %q:\nwant files:\n%q\ngot:\n%q", args, want, files)
+		}
+	}
+}
@@ -71,11 +71,15 @@ func NewCmdListModels(defaults *DefaultRAGOptions) *cobra.Command {
 	hiddenFlags := []string{
 		"dim",
 		"embedding-model",
+		"embed-cache",
+		"embed-batch-size",
+		"embed-concurrency",
 		"topk",
 		"match",
 		"model",
 		"temp",
 		"context",
+		"system",
 	}
 
 	genericclioptions.MarkFlagsHidden(cmd, hiddenFlags...)
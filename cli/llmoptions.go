@@ -3,32 +3,69 @@ package cli
 import (
 	"cmp"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
 	"github.com/ladzaretti/ragx-cli/genericclioptions"
 	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/ragx"
 	"github.com/ladzaretti/ragx-cli/types"
 	"github.com/ladzaretti/ragx-cli/vecdb"
 
 	"golang.org/x/sync/errgroup"
-	"golang.org/x/sync/semaphore"
 )
 
+var retrievalModes = []string{ragx.RetrievalVector, ragx.RetrievalHybrid}
+
 type llmOptions struct {
 	llmConfig       types.LLMConfig
 	promptConfig    types.PromptConfig
 	embeddingConfig types.EmbeddingConfig
+	retrievalConfig types.RetrievalConfig
+	outputConfig    types.OutputConfig
+	keysConfig      types.KeysConfig
 
 	providers          types.Providers
 	vectordb           *vecdb.VectorDB
+	dbPath             string
 	dim                int
 	defaultContext     int
+	modelContexts      map[string]int // modelContexts holds the provider reported context lengths of models not configuring one.
 	defaultTemperature *float64
+	keepAlive          *time.Duration
 	embeddingREs       []*regexp.Regexp
+	embedCache         *llm.EmbedCache
+	printChunks        bool             // printChunks prints the chunks before embedding them.
+	maxPrintChunks     int              // maxPrintChunks bounds the printed chunks, if positive.
+	maxChunks          int              // maxChunks bounds the embedded chunks, if positive.
+	excludeContent     []string         // excludeContent holds the --exclude-content regexes.
+	excludeContentREs  []*regexp.Regexp // excludeContentREs drop the matching chunks before embedding.
+	sanitizeUTF8       bool             // sanitizeUTF8 is set by --sanitize-utf8.
+	prune              bool             // prune removes the chunks of deleted files from the --db-path database.
+	daemonSocket       string           // daemonSocket is the socket of the daemon queries are forwarded to, if any.
+	configHash         string           // configHash digests the resolved configuration, see [llmOptions.hashConfig].
+	timings            *timings         // timings accumulates the phase durations for --timings, if set.
+	queryEmbedding     *queryEmbedding  // queryEmbedding is the query embedded ahead of retrieval, if any.
+}
+
+// queryEmbedding is a query embedded ahead of its retrieval.
+type queryEmbedding struct {
+	query  string
+	vector []float64
 }
 
 var _ genericclioptions.BaseOptions = &llmOptions{}
@@ -41,7 +78,14 @@ func (o *llmOptions) initProviders(logger *slog.Logger) error {
 	o.providers = make([]*types.Provider, 0, len(o.llmConfig.Providers))
 
 	for _, p := range o.llmConfig.Providers {
-		client := createClient(logger, p)
+		logger.Debug("init provider", "kind", p.Kind, "base_url", redactURL(p.BaseURL), "api_key", redactSecret(p.APIKey))
+
+		var opts []llm.Option
+		if o.embedCache != nil {
+			opts = append(opts, llm.WithEmbedCache(o.embedCache))
+		}
+
+		client := newBackend(logger, p, o.keepAlive, opts...)
 
 		temperature := cmp.Or(p.Temperature, o.defaultTemperature)
 
@@ -50,8 +94,11 @@ func (o *llmOptions) initProviders(logger *slog.Logger) error {
 		)
 
 		p := &types.Provider{
-			Client:  client,
-			Session: session,
+			BaseURL:        p.BaseURL,
+			Client:         client,
+			Session:        session,
+			Preset:         types.PresetFor(p.Kind),
+			MaxConcurrency: p.MaxConcurrency,
 		}
 
 		o.providers = append(o.providers, p)
@@ -60,12 +107,9 @@ func (o *llmOptions) initProviders(logger *slog.Logger) error {
 	return nil
 }
 
-func (o *llmOptions) dimFor(ctx context.Context, embeddingModel string) (int, error) {
-	provider, err := o.providers.ProviderFor(embeddingModel)
-	if err != nil {
-		return 0, fmt.Errorf("provider for: %w", err)
-	}
-
+// dimFor probes the embedding dimension of embeddingModel served by provider
+// with an empty input.
+func dimFor(ctx context.Context, provider types.Provider, embeddingModel string) (int, error) {
 	req := llm.EmbedRequest{
 		Input: "",
 		Model: embeddingModel,
@@ -79,6 +123,123 @@ func (o *llmOptions) dimFor(ctx context.Context, embeddingModel string) (int, er
 	return len(res.Vector), nil
 }
 
+// embeddingDimensions returns the configured reduced embedding size, if any.
+func (o *llmOptions) embeddingDimensions() *int {
+	if d := o.embeddingConfig.Dimensions; d > 0 {
+		return &d
+	}
+
+	return nil
+}
+
+// configuredModels returns the distinct model IDs referenced by the configuration.
+func (o *llmOptions) configuredModels() []string {
+	models := []string{o.llmConfig.DefaultModel, o.embeddingConfig.Model}
+
+	for _, m := range o.llmConfig.Models {
+		models = append(models, m.ID)
+	}
+
+	models = slices.DeleteFunc(models, func(m string) bool { return m == "" })
+	slices.Sort(models)
+
+	return slices.Compact(models)
+}
+
+// retrieve embeds the query and returns its nearest chunks from the vector database.
+// In hybrid mode, the chunks are ranked by both vector distance and keyword match.
+func (o *llmOptions) retrieve(ctx context.Context, setStatus func(string), query string) ([]vecdb.SearchResult, error) {
+	return o.retrieveTopK(ctx, setStatus, query, o.embeddingConfig.TopK)
+}
+
+// retrieveTopK is like retrieve, but retrieves topK chunks
+// instead of the configured number. A zero topK disables retrieval.
+// With source weights configured, a larger pool of candidates is
+// retrieved and re-ranked by weighted similarity.
+func (o *llmOptions) retrieveTopK(ctx context.Context, setStatus func(string), query string, topK int) ([]vecdb.SearchResult, error) {
+	if topK == 0 {
+		return nil, nil
+	}
+
+	weights, err := ragx.CompileSourceWeights(o.embeddingConfig.SourceWeights)
+	if err != nil {
+		return nil, fmt.Errorf("source weights: %w", err)
+	}
+
+	provider, err := o.providers.ProviderFor(o.embeddingConfig.Model)
+	if err != nil {
+		return nil, fmt.Errorf("provider for: %w", err)
+	}
+
+	s := ragx.Searcher{
+		Client:     provider.Client,
+		DB:         o.vectordb,
+		Model:      o.embeddingConfig.Model,
+		Dimensions: o.embeddingDimensions(),
+		Mode:       o.retrievalConfig.Mode,
+		Weights:    weights,
+		SetStatus:  setStatus,
+	}
+
+	if e := o.queryEmbedding; e != nil && e.query == query {
+		s.QueryVector = e.vector
+	}
+
+	return s.Search(ctx, query, topK)
+}
+
+// embedQuery embeds query ahead of its retrieval, which then reuses
+// the embedding instead of embedding the query again.
+func (o *llmOptions) embedQuery(ctx context.Context, query string) error {
+	provider, err := o.providers.ProviderFor(o.embeddingConfig.Model)
+	if err != nil {
+		return fmt.Errorf("provider for: %w", err)
+	}
+
+	res, err := provider.Client.Embed(ctx, llm.EmbedRequest{
+		Input:      query,
+		Model:      o.embeddingConfig.Model,
+		Dimensions: o.embeddingDimensions(),
+	})
+	if err != nil {
+		return fmt.Errorf("embed query: %w", err)
+	}
+
+	o.queryEmbedding = &queryEmbedding{query: query, vector: res.Vector}
+
+	return nil
+}
+
+// noContextAnswer returns the configured no context message if none of
+// hits is close enough to the query to ground an answer.
+// It reports false if no such message is configured.
+func noContextAnswer(cfg types.OutputConfig, hits []vecdb.SearchResult) (string, bool) {
+	if cfg.NoContextMessage == "" {
+		return "", false
+	}
+
+	relevant := slices.ContainsFunc(hits, func(h vecdb.SearchResult) bool {
+		return cfg.NoContextMaxDistance == 0 || h.Distance <= cfg.NoContextMaxDistance
+	})
+
+	return cfg.NoContextMessage, !relevant
+}
+
+// chatRequest builds a chat request for model, see [ragx.Models.ChatRequest].
+func (o *llmOptions) chatRequest(model, userPrompt string) llm.ChatCompletionRequest {
+	return o.models().ChatRequest(model, userPrompt)
+}
+
+// models returns the chat settings of the configured models.
+func (o *llmOptions) models() ragx.Models {
+	return ragx.Models{
+		Configured:  o.llmConfig.Models,
+		Temperature: o.defaultTemperature,
+		Context:     o.defaultContext,
+		Detected:    o.modelContexts,
+	}
+}
+
 func (o *llmOptions) embed(ctx context.Context, logger *slog.Logger, r io.Reader, matchREs []*regexp.Regexp, args ...string) error {
 	ctx, cancel := context.WithCancel(ctx)
 
@@ -90,22 +251,24 @@ func (o *llmOptions) embed(ctx context.Context, logger *slog.Logger, r io.Reader
 
 	switch {
 	case r != nil:
-		return o.embedInput(ctx, logger, spinner.sendStatusWithEllipsis, r)
+		return o.embedInput(ctx, logger, spinner.sendStatusWithEllipsis, spinner.println, r)
 	case len(args) > 0:
-		return o.discoverAndEmbed(ctx, logger, spinner.display, spinner.setStatus, matchREs, args...)
+		return o.discoverAndEmbed(ctx, logger, spinner.display, spinner.println, spinner.setProgress, matchREs, args...)
 	default:
 	}
 
 	return nil
 }
 
-func (o *llmOptions) embedInput(ctx context.Context, logger *slog.Logger, sendStatus func(string), r io.Reader) error {
+func (o *llmOptions) embedInput(ctx context.Context, logger *slog.Logger, sendStatus, printLine func(string), r io.Reader) error {
+	defer o.timings.track(logger, phaseEmbedding)()
+
 	bs, err := io.ReadAll(r)
 	if err != nil {
 		return fmt.Errorf("read piped input: %w", err)
 	}
 
-	chunks, err := ChunkText(string(bs),
+	chunks, err := ragx.ChunkText(string(bs),
 		o.embeddingConfig.ChunkSize,
 		o.embeddingConfig.Overlap,
 	)
@@ -113,142 +276,488 @@ func (o *llmOptions) embedInput(ctx context.Context, logger *slog.Logger, sendSt
 		return fmt.Errorf("chunk piped input: %w", err)
 	}
 
-	dataChunks := &dataChunks{
+	piped, excluded := excludeChunks([]*dataChunks{{
 		source: "piped-data",
 		chunks: chunks,
+	}}, o.excludeContentREs)
+
+	if excluded > 0 {
+		printLine(fmt.Sprintf("excluded %d chunks matching --exclude-content", excluded))
+		logger.Info("excluded chunks", "chunks", excluded)
+	}
+
+	if len(piped) == 0 {
+		return nil
+	}
+
+	piped = limitChunks(piped, o.maxChunks)
+
+	if o.printChunks {
+		printChunks(printLine, piped, o.maxPrintChunks)
+	}
+
+	// piped data replaces the one stored by a previous run
+	if o.dbPath != "" {
+		if _, err := o.vectordb.DeleteBySource(piped[0].source); err != nil {
+			return fmt.Errorf("delete piped input: %w", err)
+		}
 	}
 
 	sendStatus("embedding piped data")
 
-	if err := o.embedData(ctx, logger, dataChunks); err != nil {
+	var done int
+
+	progress := func(n int) {
+		done += n
+		sendStatus(fmt.Sprintf("embedding piped data [%d chunks]", done))
+	}
+
+	if err := o.embedData(ctx, logger, piped[0], progress); err != nil {
 		return fmt.Errorf("embed piped input: %w", err)
 	}
 
 	return nil
 }
 
-func (o *llmOptions) discoverAndEmbed(ctx context.Context, logger *slog.Logger, display func(text string), status func(string), matchREs []*regexp.Regexp, args ...string) error {
-	defer func(start time.Time) {
-		elapsed := time.Since(start)
-		logger.Debug("embedding total duration", "duration", elapsed)
-	}(time.Now())
+func (o *llmOptions) discoverAndEmbed(ctx context.Context, logger *slog.Logger, display, printLine func(text string), progress progressFunc, matchREs []*regexp.Regexp, args ...string) error {
+	defer o.timings.track(logger, phaseEmbedding)()
 
-	discovered, err := discover(args, matchREs)
+	discovered, err := discover(args, matchREs, o.embeddingConfig.Ignore)
 	if err != nil {
 		return err
 	}
 
-	chunkedFiles, err := chunkFiles(ctx, display, discovered,
-		o.embeddingConfig.ChunkSize,
-		o.embeddingConfig.Overlap,
+	// a persistent database keeps the chunks of the files unchanged since stored
+	var (
+		stored  map[string]vecdb.SourceStamp
+		changes sourceChanges
 	)
+
+	if o.dbPath != "" {
+		stored, err = o.vectordb.SourceStamps()
+		if err != nil {
+			return fmt.Errorf("stored sources: %w", err)
+		}
+
+		if o.prune {
+			changes.pruned, err = o.pruneDeleted(logger, stored, args)
+			if err != nil {
+				return err
+			}
+		}
+
+		discovered, changes.unchanged = skipUnchanged(discovered, stored, o.embeddingConfig)
+	}
+
+	chunkedFiles, skipped, err := chunkFiles(ctx, logger, discovered, o.embeddingConfig)
 	if err != nil {
 		return err
 	}
 
+	if skipped.total() > 0 {
+		display(skipped.String())
+		logger.Warn("skipped files", "too_large", skipped.tooLarge, "binary", skipped.binary, "non_text", skipped.nonText, "other", skipped.other)
+	}
+
 	logger.Debug("discovered files", "files", len(chunkedFiles), "chunks", totalChunks(chunkedFiles))
 
-	return o.embedAll(ctx, logger, status, chunkedFiles)
+	chunkedFiles, excluded := excludeChunks(chunkedFiles, o.excludeContentREs)
+	if excluded > 0 {
+		display(fmt.Sprintf("excluded %d chunks matching --exclude-content", excluded))
+		logger.Info("excluded chunks", "chunks", excluded)
+	}
+
+	if o.embeddingConfig.IndexPaths {
+		for _, cf := range slices.Clone(chunkedFiles) {
+			if !isURL(cf.source) {
+				chunkedFiles = append(chunkedFiles, pathChunks(cf.source))
+			}
+		}
+	}
+
+	// files are discovered in a stable order, so the sample is deterministic
+	if total := totalChunks(chunkedFiles); o.maxChunks > 0 && total > o.maxChunks {
+		chunkedFiles = limitChunks(chunkedFiles, o.maxChunks)
+
+		display(fmt.Sprintf("embedding the first %d of %d chunks (--max-chunks)", o.maxChunks, total))
+		logger.Info("limited embedded chunks", "max_chunks", o.maxChunks, "total", total)
+	}
+
+	if o.printChunks {
+		printChunks(printLine, chunkedFiles, o.maxPrintChunks)
+	}
+
+	if o.dbPath == "" {
+		return o.embedAll(ctx, logger, progress, chunkedFiles, nil)
+	}
+
+	changes.count(chunkedFiles, stored)
+
+	// the chunks of changed files are replaced only once embedded again,
+	// so that a file that fails to chunk or to embed keeps its old chunks
+	if err := o.embedAll(ctx, logger, progress, chunkedFiles, stored); err != nil {
+		return err
+	}
+
+	display(changes.String())
+	logger.Info("embedded sources", "embedded", changes.embedded, "unchanged", changes.unchanged, "reindexed", changes.reindexed, "pruned", changes.pruned)
+
+	return nil
 }
 
-func (o *llmOptions) embedAll(ctx context.Context, logger *slog.Logger, sendStatus func(string), chunkedFiles []*dataChunks) error {
-	g, ctx := errgroup.WithContext(ctx)
-	sem := semaphore.NewWeighted(embedConcurrency)
+// sourceChanges counts the files of an embedding into a persistent database.
+type sourceChanges struct {
+	embedded  int // embedded counts the files not stored before.
+	unchanged int // unchanged counts the files skipped as unchanged since stored.
+	reindexed int // reindexed counts the changed files embedded again.
+	pruned    int // pruned counts the deleted files removed with --prune.
+}
 
-	for i, cf := range chunkedFiles {
-		if err := sem.Acquire(ctx, 1); err != nil {
-			break
-		}
+// String summarizes the changes in a single line,
+// e.g. "embedded=2 unchanged=120 reindexed=1".
+func (c sourceChanges) String() string {
+	s := fmt.Sprintf("embedded=%d unchanged=%d reindexed=%d", c.embedded, c.unchanged, c.reindexed)
+	if c.pruned > 0 {
+		s += fmt.Sprintf(" pruned=%d", c.pruned)
+	}
 
-		g.Go(func() error {
-			defer sem.Release(1)
-			sendStatus(fmt.Sprintf("embedding [%d/%d] %s", i+1, len(chunkedFiles), cf.source))
+	return s
+}
 
-			return o.embedData(ctx, logger, cf)
-		})
+// skipUnchanged returns the paths whose file changed since its chunks were
+// stored, or that were never stored, along with the number of skipped ones.
+// A file is unchanged if its modification time and size match the stored ones,
+// and it was chunked with the same chunking config as cfg. URLs are always kept.
+func skipUnchanged(paths []string, stored map[string]vecdb.SourceStamp, cfg types.EmbeddingConfig) ([]string, int) {
+	var (
+		kept     = make([]string, 0, len(paths))
+		chunking = chunkingFingerprint(cfg)
+	)
+
+	for _, path := range paths {
+		if stamp, ok := stored[path]; ok && !isURL(path) {
+			if fi, err := os.Stat(path); err == nil && fileStamp(fi, chunking) == stamp {
+				continue
+			}
+		}
+
+		kept = append(kept, path)
 	}
 
-	return g.Wait()
+	return kept, len(paths) - len(kept)
 }
 
-func (o *llmOptions) embedData(ctx context.Context, logger *slog.Logger, cf *dataChunks) error {
-	n := len(cf.chunks)
-	embeddingModel := o.embeddingConfig.Model
+// count counts chunkedFiles as reindexed if stored, as embedded otherwise.
+func (c *sourceChanges) count(chunkedFiles []*dataChunks, stored map[string]vecdb.SourceStamp) {
+	for _, cf := range chunkedFiles {
+		if cf.kind == vecdb.KindPath {
+			continue
+		}
 
-	provider, err := o.providers.ProviderFor(embeddingModel)
-	if err != nil {
-		return fmt.Errorf("provider for: %w", err)
+		if _, ok := stored[cf.source]; ok {
+			c.reindexed++
+		} else {
+			c.embedded++
+		}
 	}
+}
 
-	for i := 0; i < n; i += embedBatchSize {
-		end := min(i+embedBatchSize, n)
+// pruneDeleted deletes the stored chunks of the files under roots that
+// no longer exist, and returns the number of pruned files. Pruned files
+// are removed from stored.
+func (o *llmOptions) pruneDeleted(logger *slog.Logger, stored map[string]vecdb.SourceStamp, roots []string) (int, error) {
+	dirs := make([]string, 0, len(roots))
 
-		req := llm.EmbedBatchRequest{
-			Input: cf.chunks[i:end],
-			Model: o.embeddingConfig.Model,
+	for _, root := range roots {
+		if isURL(root) {
+			continue
 		}
 
-		res, err := provider.Client.EmbedBatch(ctx, req)
+		abs, err := filepath.Abs(root)
 		if err != nil {
-			return fmt.Errorf("embed batch [%d:%d]: %w", i, end, err)
+			return 0, fmt.Errorf("abs %q: %w", root, err)
 		}
 
-		if want, got := end-i, len(res.Vectors); want != got {
-			return fmt.Errorf("embed batch [%d:%d]: want %d, got %d vectors",
-				i, end, want, got)
+		dirs = append(dirs, abs)
+	}
+
+	under := func(source string) bool {
+		return slices.ContainsFunc(dirs, func(dir string) bool {
+			return source == dir || strings.HasPrefix(source, dir+string(filepath.Separator))
+		})
+	}
+
+	pruned := 0
+
+	for _, source := range slices.Sorted(maps.Keys(stored)) {
+		if !under(source) {
+			continue
 		}
 
-		embedded := make([]vecdb.Chunk, 0, len(res.Vectors))
+		if _, err := os.Stat(source); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
 
-		for j, vec := range res.Vectors {
-			vecChunk := vecdb.Chunk{
-				Content: cf.chunks[i+j],
-				Vec:     toFloat32Slice(vec),
-				Meta:    vecdb.Meta{Source: cf.source, Index: i + j},
-			}
-			embedded = append(embedded, vecChunk)
+		n, err := o.vectordb.DeleteBySource(source)
+		if err != nil {
+			return pruned, fmt.Errorf("prune %q: %w", source, err)
 		}
 
-		if err := o.vectordb.Insert(embedded); err != nil {
-			return fmt.Errorf("vectordb insert %q [%d:%d]: %w", cf.source, i, end, err)
+		logger.Debug("pruned deleted source", "source", source, "chunks", n)
+
+		delete(stored, source)
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// embedAll embeds chunkedFiles across all providers of the embedding model.
+// Each provider embeds up to its own max concurrency of files at a time,
+// so that faster providers take on more files. The chunks of the sources
+// in stored are replaced once their new chunks are embedded.
+func (o *llmOptions) embedAll(ctx context.Context, logger *slog.Logger, sendProgress progressFunc, chunkedFiles []*dataChunks, stored map[string]vecdb.SourceStamp) error {
+	providers := o.providers.ProvidersFor(o.embeddingConfig.Model)
+	if len(providers) == 0 {
+		return fmt.Errorf("no provider found for: %q", o.embeddingConfig.Model)
+	}
+
+	progress := newEmbedProgress(len(chunkedFiles), totalChunks(chunkedFiles), sendProgress)
+	progress.report()
+
+	g, ctx := errgroup.WithContext(ctx)
+	files := make(chan *dataChunks)
+
+	for _, p := range providers {
+		for range cmp.Or(p.MaxConcurrency, o.embeddingConfig.Concurrency) {
+			g.Go(func() error {
+				for cf := range files {
+					if err := o.embedFileWith(ctx, logger, p.Client, cf, stored, progress.addChunks); err != nil {
+						return err
+					}
+
+					progress.fileDone()
+				}
+
+				return nil
+			})
 		}
+	}
 
-		logger.Debug("embedded batch", "range", fmt.Sprintf("[%d:%d]", i, end), "total", n, "source", cf.source)
+	g.Go(func() error {
+		defer close(files)
 
-		if end == n {
-			break
+		for _, cf := range chunkedFiles {
+			select {
+			case files <- cf:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
+
+		return nil
+	})
+
+	return g.Wait()
+}
+
+// embedData embeds and stores the chunks of cf in batches,
+// reporting the number of chunks of each stored batch to progress, if set.
+func (o *llmOptions) embedData(ctx context.Context, logger *slog.Logger, cf *dataChunks, progress func(n int)) error {
+	provider, err := o.providers.ProviderFor(o.embeddingConfig.Model)
+	if err != nil {
+		return fmt.Errorf("provider for: %w", err)
+	}
+
+	return o.embedDataWith(ctx, logger, provider.Client, cf, progress)
+}
+
+// embedDataWith is like [llmOptions.embedData], using the given client.
+func (o *llmOptions) embedDataWith(ctx context.Context, logger *slog.Logger, client llm.Backend, cf *dataChunks, progress func(n int)) error {
+	return o.indexer(logger, client).Index(ctx, cf.indexSource(), progress)
+}
+
+// embedFileWith embeds and stores the chunks of cf with client, replacing
+// the stored chunks of its source if it is in stored.
+func (o *llmOptions) embedFileWith(ctx context.Context, logger *slog.Logger, client llm.Backend, cf *dataChunks, stored map[string]vecdb.SourceStamp, progress func(n int)) error {
+	if _, ok := stored[cf.source]; !ok {
+		return o.embedDataWith(ctx, logger, client, cf, progress)
 	}
 
+	n, err := o.indexer(logger, client).Replace(ctx, cf.indexSource(), progress)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("replaced changed source", "source", cf.source, "kind", cf.kind, "chunks", n)
+
 	return nil
 }
 
-func createClient(logger *slog.Logger, c types.ProviderConfig) *llm.Client {
-	opts := []llm.Option{
-		llm.WithBaseURL(c.BaseURL),
-		llm.WithLogger(logger),
-		llm.WithTemperature(c.Temperature),
+// replaceData embeds the chunks of cf and replaces the stored chunks of its
+// source and kind with them, returning the number of replaced chunks.
+// The stored chunks are kept if embedding fails.
+func (o *llmOptions) replaceData(ctx context.Context, logger *slog.Logger, cf *dataChunks, progress func(n int)) (int, error) {
+	provider, err := o.providers.ProviderFor(o.embeddingConfig.Model)
+	if err != nil {
+		return 0, fmt.Errorf("provider for: %w", err)
 	}
 
-	return llm.NewClient(opts...)
+	return o.indexer(logger, provider.Client).Replace(ctx, cf.indexSource(), progress)
 }
 
-func createSession(logger *slog.Logger, client *llm.Client, temperature *float64, defaultContext int, systemPrompt string) *llm.ChatSession {
-	sessionOpts := []llm.SessionOpt{
-		llm.WithSessionLogger(logger),
-		llm.WithSessionTemperature(temperature),
-		llm.WithDefaultContextLength(defaultContext),
+// indexer returns an indexer storing chunks embedded by client.
+func (o *llmOptions) indexer(logger *slog.Logger, client llm.Backend) ragx.Indexer {
+	return ragx.Indexer{
+		Client:     client,
+		DB:         o.vectordb,
+		Model:      o.embeddingConfig.Model,
+		Dimensions: o.embeddingDimensions(),
+		BatchSize:  o.embeddingConfig.BatchSize,
+		Logger:     logger,
+	}
+}
+
+// defaultUserAgent identifies ragx requests to providers, e.g. "ragx/1.2.3".
+func defaultUserAgent() string { return "ragx/" + Version }
+
+// newBackend creates the backend of a configured provider.
+// It is a variable so that tests can serve providers in memory.
+var newBackend = func(logger *slog.Logger, c types.ProviderConfig, keepAlive *time.Duration, extra ...llm.Option) llm.Backend {
+	return createClient(logger, c, keepAlive, extra...)
+}
+
+// createClient creates a client for the provider, see [ragx.NewClient],
+// identified by the default user agent unless one is configured.
+// A provider with a CA file or with TLS verification disabled
+// is sent requests with a client of the matching TLS config.
+func createClient(logger *slog.Logger, c types.ProviderConfig, keepAlive *time.Duration, extra ...llm.Option) *llm.Client {
+	c.UserAgent = cmp.Or(c.UserAgent, defaultUserAgent())
+
+	if c.InsecureSkipVerify || c.CAFile != "" {
+		client, err := tlsHTTPClient(c)
+		if err != nil {
+			logger.Error("tls config", "base_url", redactURL(c.BaseURL), "err", err)
+		} else {
+			extra = append([]llm.Option{llm.WithHTTPClient(client)}, extra...)
+		}
+
+		if c.InsecureSkipVerify {
+			logger.Warn("tls certificate verification disabled", "base_url", redactURL(c.BaseURL))
+		}
+	}
+
+	return ragx.NewClient(logger, c, keepAlive, extra...)
+}
+
+// tlsHTTPClient returns an HTTP client trusting the CA file of c in addition
+// to the system CAs, or skipping verification if c says so.
+func tlsHTTPClient(c types.ProviderConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify, //nolint:gosec // opted into by the user
+	}
+
+	if c.CAFile != "" {
+		pool, err := loadCAPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("unexpected default transport")
+	}
+
+	transport = transport.Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// loadCAPool returns the system cert pool with the PEM
+// certificates of the file at path added.
+func loadCAPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, errors.New("no PEM certificates found")
+	}
+
+	return pool, nil
+}
+
+// contextRetryNotice describes a request retried with a smaller context.
+func contextRetryNotice(attempted, limit int) string {
+	return fmt.Sprintf("context length exceeded, retried with %d of %d tokens", limit, attempted)
+}
+
+// newSession creates a chat session for model that is independent of
+// the provider session, for use by concurrent requests.
+func (o *llmOptions) newSession(logger *slog.Logger, model string) (llm.Session, error) {
+	i := slices.IndexFunc(o.providers, func(p *types.Provider) bool { return p.Supports(model) })
+	if i == -1 {
+		return nil, fmt.Errorf("no provider found for: %q", model)
+	}
+
+	temperature := cmp.Or(o.llmConfig.Providers[i].Temperature, o.defaultTemperature)
+
+	return createSession(logger, o.providers[i].Client, temperature, o.defaultContext, o.promptConfig.System), nil
+}
+
+// sendQuery starts generating the answer to query from hits, in a new
+// chat session of model.
+func (o *llmOptions) sendQuery(ctx context.Context, logger *slog.Logger, model, query string, hits []vecdb.SearchResult) (<-chan prompt.Chunk, error) {
+	session, err := o.newSession(logger, model)
+	if err != nil {
+		return nil, err
+	}
+
+	p, dropped, err := o.buildUserPrompt(model, query, hits)
+	if err != nil {
+		return nil, fmt.Errorf("build user prompt: %w", err)
 	}
 
-	return llm.NewChat(client, systemPrompt, sessionOpts...)
+	if dropped > 0 {
+		logger.Warn("dropped chunks exceeding the context", "model", model, "dropped", dropped, "kept", len(hits)-dropped)
+	}
+
+	return prompt.SendStream(ctx, session, o.chatRequest(model, p)), nil
+}
+
+// buildUserPrompt builds the user prompt answering query from hits, dropping
+// the lowest ranked hits that do not fit in the prompt budget of model.
+// It returns the prompt and the number of dropped hits.
+func (o *llmOptions) buildUserPrompt(model, query string, hits []vecdb.SearchResult) (string, int, error) {
+	return prompt.FitUserPrompt(query, hits, prompt.DecodeMeta, llm.ApproxTokenCounter{}, o.promptBudget(model),
+		prompt.WithUserPromptTmpl(o.promptConfig.UserPromptTmpl),
+	)
 }
 
-func toFloat32Slice(src []float64) (f32 []float32) {
-	f32 = make([]float32, len(src))
+// promptBudget returns the tokens the user prompt of model may take: its
+// context length less the configured reserve, or zero if its context length
+// is unknown or does not exceed the reserve.
+func (o *llmOptions) promptBudget(model string) int {
+	return max(o.models().ContextLength(model)-o.promptConfig.ContextReserve, 0)
+}
 
-	for i, v := range src {
-		f32[i] = float32(v)
+func createSession(logger *slog.Logger, client llm.Backend, temperature *float64, defaultContext int, systemPrompt string) llm.Session {
+	sessionOpts := []llm.SessionOpt{
+		llm.WithSessionLogger(logger),
+		llm.WithSessionTemperature(temperature),
+		llm.WithDefaultContextLength(defaultContext),
 	}
 
-	return f32
+	return client.NewChat(systemPrompt, sessionOpts...)
 }
@@ -0,0 +1,177 @@
+package cli_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+func TestCreateClient_KeepAlive(t *testing.T) {
+	keepAlive := 10 * time.Minute
+
+	tests := []struct {
+		name      string
+		kind      string
+		keepAlive *time.Duration
+		want      any
+	}{
+		{
+			name:      "ollama kind sends keep_alive",
+			kind:      types.ProviderKindOllama,
+			keepAlive: &keepAlive,
+			want:      "10m0s",
+		},
+		{
+			name:      "openai kind omits keep_alive",
+			kind:      types.ProviderKindOpenAI,
+			keepAlive: &keepAlive,
+			want:      nil,
+		},
+		{
+			name:      "unset keep-alive is omitted",
+			kind:      types.ProviderKindOllama,
+			keepAlive: nil,
+			want:      nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewDecoder(r.Body).Decode(&body)
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"bar"}}]}`)
+			}))
+			t.Cleanup(srv.Close)
+
+			logger := slog.New(slog.DiscardHandler)
+			provider := types.ProviderConfig{BaseURL: srv.URL + "/v1", Kind: tt.kind}
+
+			client := cli.CreateClient(logger, provider, tt.keepAlive)
+
+			_, err := client.GenerateCompletion(context.Background(), llm.CompletionRequest{Model: "foo", Prompt: "baz"})
+			if err != nil {
+				t.Fatalf("generate completion: %v", err)
+			}
+
+			if got := body["keep_alive"]; got != tt.want {
+				t.Errorf("want keep_alive: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// embedServer serves embeddings slowly and records
+// the peak number of concurrent requests.
+type embedServer struct {
+	*httptest.Server
+
+	mu             sync.Mutex
+	inflight, peak int
+	requests       int
+}
+
+func newEmbedServer(t *testing.T) *embedServer {
+	t.Helper()
+
+	s := &embedServer{}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		s.inflight++
+		s.requests++
+		s.peak = max(s.peak, s.inflight)
+		s.mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		s.mu.Lock()
+		s.inflight--
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"object":"list","model":"bar","data":[{"object":"embedding","index":0,"embedding":[1,0]}]}`)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *embedServer) stats() (peak, requests int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.peak, s.requests
+}
+
+func TestEmbedAll_PerProviderConcurrency(t *testing.T) {
+	const files = 24
+
+	logger := slog.New(slog.DiscardHandler)
+
+	var (
+		small = newEmbedServer(t)
+		large = newEmbedServer(t)
+		caps  = map[*embedServer]int{small: 1, large: 3}
+	)
+
+	providers := make(types.Providers, 0, len(caps))
+	for _, srv := range []*embedServer{small, large} {
+		providers = append(providers, &types.Provider{
+			Client:          llm.NewClient(llm.WithBaseURL(srv.URL+"/v1"), llm.WithLogger(logger)),
+			AvailableModels: []string{"bar"},
+			MaxConcurrency:  caps[srv],
+		})
+	}
+
+	db, err := vecdb.New(2)
+	if err != nil {
+		t.Fatalf("new vecdb: %v", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	sources := make([]string, 0, files)
+	for i := range files {
+		sources = append(sources, fmt.Sprintf("file-%d", i))
+	}
+
+	// the global concurrency applies only to providers without a cap
+	if err := cli.EmbedAll(providers, db, "bar", 8, sources...); err != nil {
+		t.Fatalf("embed all: %v", err)
+	}
+
+	total := 0
+
+	for srv, limit := range caps {
+		peak, requests := srv.stats()
+		if peak > limit {
+			t.Errorf("want at most %d concurrent requests, got: %d", limit, peak)
+		}
+
+		if requests == 0 {
+			t.Errorf("want requests routed to the provider capped at %d", limit)
+		}
+
+		total += requests
+	}
+
+	if total != files {
+		t.Errorf("want %d embedding requests, got: %d", files, total)
+	}
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// frontmatter holds the fields of a markdown YAML frontmatter used for retrieval.
+type frontmatter struct {
+	title string
+	tags  []string
+}
+
+// isMarkdown reports whether path names a markdown file.
+func isMarkdown(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return true
+	default:
+		return false
+	}
+}
+
+// splitFrontmatter splits the leading YAML frontmatter, delimited by "---"
+// lines, from the markdown text. If text has no frontmatter,
+// it is returned as the body and ok is false.
+func splitFrontmatter(text string) (fm frontmatter, body string, ok bool) {
+	lines := strings.SplitAfter(text, "\n")
+	if strings.TrimRight(lines[0], "\r\n") != "---" {
+		return fm, text, false
+	}
+
+	for i := 1; i < len(lines); i++ {
+		switch strings.TrimRight(lines[i], "\r\n") {
+		case "---", "...":
+			return parseFrontmatter(lines[1:i]), strings.Join(lines[i+1:], ""), true
+		}
+	}
+
+	return fm, text, false
+}
+
+// parseFrontmatter extracts the title and tags from the frontmatter lines.
+// Only the subset of YAML used by static site generators is understood:
+// scalar values, and tags given as a flow list, a block list or a single scalar.
+// Other keys are ignored.
+func parseFrontmatter(lines []string) frontmatter {
+	var (
+		fm     frontmatter
+		inTags bool
+	)
+
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r\n")
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok {
+			if inTags {
+				fm.tags = appendTag(fm.tags, item)
+			}
+
+			continue
+		}
+
+		inTags = false
+
+		// nested mappings belong to keys we do not use
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "title":
+			fm.title = unquoteYAML(value)
+		case "tags":
+			switch {
+			case value == "":
+				inTags = true
+			case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+				for tag := range strings.SplitSeq(value[1:len(value)-1], ",") {
+					fm.tags = appendTag(fm.tags, tag)
+				}
+			default:
+				fm.tags = appendTag(fm.tags, value)
+			}
+		}
+	}
+
+	return fm
+}
+
+func appendTag(tags []string, tag string) []string {
+	if tag = unquoteYAML(strings.TrimSpace(tag)); tag != "" {
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// unquoteYAML removes the quotes of a single or double quoted YAML scalar.
+func unquoteYAML(s string) string {
+	if len(s) < 2 {
+		return s
+	}
+
+	switch {
+	case s[0] == '"' && s[len(s)-1] == '"':
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+
+		return s[1 : len(s)-1]
+	case s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	default:
+		return s
+	}
+}
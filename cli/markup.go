@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ladzaretti/ragx-cli/cli/extract"
+	"github.com/ladzaretti/ragx-cli/types"
+)
+
+var (
+	mdFenceRE    = regexp.MustCompile("(?m)^[ \t]*(?:```|~~~).*$\n?")
+	mdHeadingRE  = regexp.MustCompile(`(?m)^[ \t]*#{1,6}[ \t]+`)
+	mdQuoteRE    = regexp.MustCompile(`(?m)^[ \t]*>[ \t]?`)
+	mdListRE     = regexp.MustCompile(`(?m)^([ \t]*)(?:[-*+]|\d+[.)])[ \t]+`)
+	mdRuleRE     = regexp.MustCompile(`(?m)^[ \t]*(?:[-*_][ \t]*){3,}$`)
+	mdImageRE    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLinkRE     = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	mdStrongRE   = regexp.MustCompile(`\*\*([^*\n]+)\*\*|__([^_\n]+)__`)
+	mdEmphasisRE = regexp.MustCompile(`\*([^*\n]+)\*|\b_([^_\n]+)_\b`)
+	mdCodeRE     = regexp.MustCompile("`([^`\n]+)`")
+)
+
+// isHTML reports whether path names an HTML file.
+func isHTML(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".xhtml":
+		return true
+	default:
+		return false
+	}
+}
+
+// normalizeMarkup returns the text of the chunks of an HTML or markdown file
+// to embed: with cfg.StripMarkup, without HTML tags and markdown syntax, and
+// with cfg.DecodeEntities, with HTML entities decoded. It returns nil if no
+// chunk changed, or the file is neither HTML nor markdown.
+func normalizeMarkup(path string, chunks []string, cfg types.EmbeddingConfig) []string {
+	markdown := isMarkdown(path)
+	if (!markdown && !isHTML(path)) || (!cfg.StripMarkup && !cfg.DecodeEntities) {
+		return nil
+	}
+
+	var (
+		normalized = make([]string, len(chunks))
+		changed    bool
+	)
+
+	for i, c := range chunks {
+		text := c
+
+		if cfg.StripMarkup {
+			text = extract.StripHTML(text)
+
+			if markdown {
+				text = stripMarkdown(text)
+			}
+		}
+
+		// decoded last, so that escaped markup is kept as text
+		if cfg.DecodeEntities {
+			text = html.UnescapeString(text)
+		}
+
+		normalized[i] = text
+		changed = changed || text != c
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return normalized
+}
+
+// stripMarkdown reduces the markdown syntax of text to its plain text:
+// link and image texts, emphasized and code spans are kept, while fences,
+// heading, quote and list markers, and rules are removed.
+func stripMarkdown(text string) string {
+	text = mdFenceRE.ReplaceAllString(text, "")
+	text = mdRuleRE.ReplaceAllString(text, "")
+	text = mdHeadingRE.ReplaceAllString(text, "")
+	text = mdQuoteRE.ReplaceAllString(text, "")
+	text = mdListRE.ReplaceAllString(text, "$1")
+	text = mdImageRE.ReplaceAllString(text, "$1")
+	text = mdLinkRE.ReplaceAllString(text, "$1")
+	text = mdStrongRE.ReplaceAllString(text, "$1$2")
+	text = mdEmphasisRE.ReplaceAllString(text, "$1$2")
+
+	return mdCodeRE.ReplaceAllString(text, "$1")
+}
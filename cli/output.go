@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var outputFormats = []string{outputText, outputJSON}
+
+// maxDistancePrecision is the maximum output.distance_precision.
+const maxDistancePrecision = 10
+
+// jsonFieldKeys are the top-level JSON output keys that can be
+// renamed via the output.json_fields config.
+var jsonFieldKeys = []string{"answer", "query", "chunks", "citations"}
+
+// QueryResult is the structured output of a single query.
+type QueryResult struct {
+	Query     string            `json:"query"`
+	Answer    string            `json:"answer"`
+	Chunks    []ResultChunk     `json:"chunks"`
+	Citations []prompt.Citation `json:"citations"`
+}
+
+// ResultChunk is a retrieved chunk as shown in structured output.
+type ResultChunk struct {
+	ID       int     `json:"id"`
+	Source   string  `json:"source"`
+	Distance float64 `json:"distance"`
+	Content  string  `json:"content"`
+}
+
+func newQueryResult(query, answer string, hits []vecdb.SearchResult) QueryResult {
+	chunks := make([]ResultChunk, 0, len(hits))
+
+	for _, h := range hits {
+		source, id := prompt.DecodeMeta(h.Meta)
+
+		chunks = append(chunks, ResultChunk{
+			ID:       id,
+			Source:   source,
+			Distance: h.Distance,
+			Content:  h.Content,
+		})
+	}
+
+	citations, _ := prompt.ParseCitations(answer, hits)
+	if citations == nil {
+		citations = []prompt.Citation{}
+	}
+
+	return QueryResult{
+		Query:     query,
+		Answer:    answer,
+		Chunks:    chunks,
+		Citations: citations,
+	}
+}
+
+// renameJSONFields returns v as a JSON object with its top-level
+// keys renamed according to fields. Keys not in fields are kept as is.
+func renameJSONFields(v any, fields map[string]string) (any, error) {
+	if len(fields) == 0 {
+		return v, nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshal output: %w", err)
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("output is not a JSON object: %w", err)
+	}
+
+	out := make(map[string]json.RawMessage, len(obj))
+
+	for k, val := range obj {
+		if name, ok := fields[k]; ok && slices.Contains(jsonFieldKeys, k) {
+			k = name
+		}
+
+		out[k] = val
+	}
+
+	return out, nil
+}
+
+func validateOutputFormat(format string) error {
+	if !slices.Contains(outputFormats, format) {
+		return fmt.Errorf("invalid output format %q (supported: %v)", format, outputFormats)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package cli_test
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/types"
+)
+
+func TestRenameJSONFields(t *testing.T) {
+	result := cli.QueryResult{
+		Query:  "foo",
+		Answer: "bar",
+		Chunks: []cli.ResultChunk{{ID: 1, Source: "baz", Content: "qux"}},
+	}
+
+	tests := []struct {
+		name          string
+		fields        map[string]string
+		wantKeys      []string
+		wantAnswerKey string
+	}{
+		{
+			name:          "defaults unchanged",
+			fields:        nil,
+			wantKeys:      []string{"answer", "chunks", "citations", "query"},
+			wantAnswerKey: "answer",
+		},
+		{
+			name:          "renamed fields",
+			fields:        map[string]string{"answer": "response", "chunks": "context"},
+			wantKeys:      []string{"citations", "context", "query", "response"},
+			wantAnswerKey: "response",
+		},
+		{
+			name:          "unsupported keys are ignored",
+			fields:        map[string]string{"id": "foo"},
+			wantKeys:      []string{"answer", "chunks", "citations", "query"},
+			wantAnswerKey: "answer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := cli.RenameJSONFields(result, tt.fields)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			raw, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+
+			var got map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+
+			gotKeys := make([]string, 0, len(got))
+			for k := range got {
+				gotKeys = append(gotKeys, k)
+			}
+
+			slices.Sort(gotKeys)
+
+			if !slices.Equal(tt.wantKeys, gotKeys) {
+				t.Errorf("want keys: %v, got: %v", tt.wantKeys, gotKeys)
+			}
+
+			if answer := string(got[tt.wantAnswerKey]); answer != `"bar"` {
+				t.Errorf("want %s: %q, got: %q", tt.wantAnswerKey, `"bar"`, answer)
+			}
+		})
+	}
+}
+
+func TestOutputConfig_FormatDistance(t *testing.T) {
+	precision := func(n int) *int { return &n }
+
+	tests := []struct {
+		name string
+		cfg  types.OutputConfig
+		want string
+	}{
+		{name: "default", want: "0.2500"},
+		{name: "distance precision", cfg: types.OutputConfig{DistancePrecision: precision(2)}, want: "0.25"},
+		{name: "zero precision", cfg: types.OutputConfig{DistancePrecision: precision(0)}, want: "0"},
+		{name: "similarity", cfg: types.OutputConfig{DistanceUnit: types.DistanceUnitSimilarity, DistancePrecision: precision(3)}, want: "0.800"},
+		{name: "percent", cfg: types.OutputConfig{DistanceUnit: types.DistanceUnitPercent, DistancePrecision: precision(1)}, want: "80.0%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.FormatDistance(0.25); got != tt.want {
+				t.Errorf("want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pathsFromStdin is the --paths-from value for reading paths from stdin.
+const pathsFromStdin = "-"
+
+// readPathsFrom reads newline-separated paths to embed from the file at name,
+// or from in when name is "-". Missing paths are skipped, with a warning
+// written to errOut. URLs are kept as is.
+func readPathsFrom(name string, in io.Reader, errOut io.Writer) ([]string, error) {
+	listed, err := readPathList(name, in)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(listed))
+
+	for _, p := range listed {
+		if isURL(p) {
+			paths = append(paths, p)
+			continue
+		}
+
+		if _, err := os.Stat(p); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("stat %q: %w", p, err)
+			}
+
+			fmt.Fprintf(errOut, "warning: skipping missing path %q\n", p)
+
+			continue
+		}
+
+		paths = append(paths, p)
+	}
+
+	return paths, nil
+}
+
+// readPathList reads newline-separated paths from the file at name,
+// or from in when name is "-". Blank lines are skipped.
+func readPathList(name string, in io.Reader) ([]string, error) {
+	if name != pathsFromStdin {
+		f, err := os.Open(filepath.Clean(name))
+		if err != nil {
+			return nil, fmt.Errorf("open paths from: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+
+		in = f
+	}
+
+	var (
+		paths   []string
+		scanner = bufio.NewScanner(in)
+	)
+
+	for scanner.Scan() {
+		if p := strings.TrimSpace(scanner.Text()); p != "" {
+			paths = append(paths, p)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read paths from: %w", err)
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,139 @@
+package prompt
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+// ErrUnverifiedCitation is returned for citations that cannot be
+// traced back to a retrieved chunk.
+var ErrUnverifiedCitation = errors.New("unverified citation")
+
+// Citation is a numbered reference from an answer to a context chunk,
+// as declared in the answer's Sources footer.
+type Citation struct {
+	Number   int    `json:"number"`
+	ChunkID  int    `json:"chunk_id"`
+	Source   string `json:"source"`
+	Verified bool   `json:"verified"`
+}
+
+var (
+	// sourcesHeaderRE matches the Sources footer header,
+	// e.g. "Sources:", "**Sources:**" or "## Sources".
+	sourcesHeaderRE = regexp.MustCompile(`(?i)^\s*(?:#+\s*)?\**sources:?\**:?\s*$`)
+
+	// sourceEntryRE matches a Sources footer entry,
+	// e.g. "[1] (chunk 2) README.md" or "- [1] (chunk 2) README.md".
+	sourceEntryRE = regexp.MustCompile(`^\s*(?:[-*]\s*)?\[(\d+)\]\s*\(chunk\s+(\d+)\)\s*(.*?)\s*$`)
+
+	// citationRE matches an in-text citation, e.g. "[1]".
+	// Markdown links such as "[1](url)" are not citations.
+	citationRE = regexp.MustCompile(`\[(\d+)\]`)
+)
+
+// ParseCitations extracts the citations of answer and verifies them
+// against the retrieved hits, using the same chunk ids and sources
+// the user prompt presented to the model.
+//
+// A citation is unverified if its Sources entry points to a chunk that
+// was not retrieved, or if it is cited in text without a Sources entry.
+// An error wrapping [ErrUnverifiedCitation] is returned for each one.
+func ParseCitations(answer string, hits []vecdb.SearchResult) ([]Citation, []error) {
+	body, footer := splitSources(answer)
+
+	var (
+		citations []Citation
+		errs      []error
+		declared  = map[int]bool{}
+	)
+
+	for _, line := range footer {
+		m := sourceEntryRE.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		n, _ := strconv.Atoi(m[1])
+		id, _ := strconv.Atoi(m[2])
+
+		if declared[n] {
+			continue
+		}
+
+		declared[n] = true
+
+		c := Citation{
+			Number:   n,
+			ChunkID:  id,
+			Source:   m[3],
+			Verified: retrieved(hits, id, m[3]),
+		}
+
+		if !c.Verified {
+			errs = append(errs, fmt.Errorf("%w: [%d] chunk %d (%s) was not retrieved", ErrUnverifiedCitation, n, id, cmp.Or(c.Source, "no source")))
+		}
+
+		citations = append(citations, c)
+	}
+
+	for _, m := range citationRE.FindAllStringSubmatchIndex(body, -1) {
+		if strings.HasPrefix(body[m[1]:], "(") {
+			continue
+		}
+
+		n, _ := strconv.Atoi(body[m[2]:m[3]])
+
+		if declared[n] {
+			continue
+		}
+
+		declared[n] = true
+
+		citations = append(citations, Citation{Number: n})
+		errs = append(errs, fmt.Errorf("%w: [%d] has no Sources entry", ErrUnverifiedCitation, n))
+	}
+
+	slices.SortFunc(citations, func(a, b Citation) int { return cmp.Compare(a.Number, b.Number) })
+
+	return citations, errs
+}
+
+// splitSources splits answer into its body and the lines
+// following the last Sources footer header, if any.
+func splitSources(answer string) (body string, footer []string) {
+	lines := strings.Split(answer, "\n")
+
+	for i := len(lines) - 1; i >= 0; i-- {
+		if sourcesHeaderRE.MatchString(lines[i]) {
+			return strings.Join(lines[:i], "\n"), lines[i+1:]
+		}
+	}
+
+	return answer, nil
+}
+
+// retrieved reports whether a chunk with the given id was retrieved.
+// If source is given, it must match the chunk source as well.
+func retrieved(hits []vecdb.SearchResult, id int, source string) bool {
+	for i, h := range hits {
+		src, hid := DecodeMeta(h.Meta)
+
+		// mirror the fallbacks used when rendering the user prompt
+		src = cmp.Or(src, "unknown")
+		hid = cmp.Or(hid, i)
+
+		if hid == id && (source == "" || source == src) {
+			return true
+		}
+	}
+
+	return false
+}
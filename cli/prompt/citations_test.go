@@ -0,0 +1,87 @@
+package prompt_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+func TestParseCitations(t *testing.T) {
+	hits := []vecdb.SearchResult{
+		{Content: "foo", Meta: meta("README.md", 2)},
+		{Content: "bar", Meta: meta("docs/usage.md", 5)},
+	}
+
+	testCases := []struct {
+		name     string
+		answer   string
+		want     []prompt.Citation
+		wantErrs int
+	}{
+		{
+			name:   "no citations",
+			answer: "I don't know based on the provided context.",
+			want:   nil,
+		},
+		{
+			name: "valid and invalid citations",
+			answer: `- Start the server with "srv start". [1]
+- Logs go to stderr. [2]
+
+Sources:
+[1] (chunk 2) README.md
+[2] (chunk 9) docs/usage.md`,
+			want: []prompt.Citation{
+				{Number: 1, ChunkID: 2, Source: "README.md", Verified: true},
+				{Number: 2, ChunkID: 9, Source: "docs/usage.md", Verified: false},
+			},
+			wantErrs: 1,
+		},
+		{
+			name: "source must match the retrieved chunk",
+			answer: `Foo. [1]
+
+**Sources:**
+- [1] (chunk 5) README.md`,
+			want: []prompt.Citation{
+				{Number: 1, ChunkID: 5, Source: "README.md", Verified: false},
+			},
+			wantErrs: 1,
+		},
+		{
+			name: "citation without a sources entry",
+			answer: `Foo [1] and bar [2], see [docs](https://example.com) and [3](https://example.com).
+
+Sources:
+[1] (chunk 5) docs/usage.md`,
+			want: []prompt.Citation{
+				{Number: 1, ChunkID: 5, Source: "docs/usage.md", Verified: true},
+				{Number: 2},
+			},
+			wantErrs: 1,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := prompt.ParseCitations(tt.answer, hits)
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("citations mismatch (-want +got):\n%s", diff)
+			}
+
+			if len(errs) != tt.wantErrs {
+				t.Fatalf("want %d errors, got %d: %v", tt.wantErrs, len(errs), errs)
+			}
+
+			for _, err := range errs {
+				if !errors.Is(err, prompt.ErrUnverifiedCitation) {
+					t.Errorf("want ErrUnverifiedCitation, got: %v", err)
+				}
+			}
+		})
+	}
+}
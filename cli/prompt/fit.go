@@ -0,0 +1,61 @@
+package prompt
+
+import (
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+
+	openai "github.com/openai/openai-go/v2"
+)
+
+// FitChunks returns the leading chunks whose contents fit in budget tokens,
+// as counted by tc. Chunks are expected ranked, most relevant first, so the
+// lowest ranked ones are dropped; a chunk that does not fit drops all the
+// chunks ranked below it as well.
+func FitChunks(chunks []vecdb.SearchResult, tc llm.TokenCounter, budget int) []vecdb.SearchResult {
+	used := 0
+
+	for i, ch := range chunks {
+		used += countTokens(tc, ch.Content)
+		if used > budget {
+			return chunks[:i]
+		}
+	}
+
+	return chunks
+}
+
+// FitUserPrompt is like [BuildUserPrompt], but drops the lowest ranked chunks
+// until the prompt fits in budget tokens, as counted by tc. A non-positive
+// budget keeps all chunks. It returns the prompt and the number of dropped chunks.
+func FitUserPrompt(query string, chunks []vecdb.SearchResult, metaFn MetaFunc, tc llm.TokenCounter, budget int, opts ...PromptOpt) (string, int, error) {
+	p, err := BuildUserPrompt(query, chunks, metaFn, opts...)
+	if err != nil || budget <= 0 || countTokens(tc, p) <= budget {
+		return p, 0, err
+	}
+
+	// the prompt without chunks underestimates the per chunk template
+	// overhead, which the loop below makes up for
+	empty, err := BuildUserPrompt(query, nil, metaFn, opts...)
+	if err != nil {
+		return "", 0, err
+	}
+
+	kept := FitChunks(chunks, tc, budget-countTokens(tc, empty))
+
+	for {
+		p, err = BuildUserPrompt(query, kept, metaFn, opts...)
+		if err != nil {
+			return "", 0, err
+		}
+
+		if len(kept) == 0 || countTokens(tc, p) <= budget {
+			return p, len(chunks) - len(kept), nil
+		}
+
+		kept = kept[:len(kept)-1]
+	}
+}
+
+func countTokens(tc llm.TokenCounter, s string) int {
+	return tc.Count(openai.UserMessage(s))
+}
@@ -0,0 +1,126 @@
+package prompt_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+
+	openai "github.com/openai/openai-go/v2"
+)
+
+func TestFitChunks(t *testing.T) {
+	// the approximate counter counts a token per four runes
+	chunks := func(contents ...string) []vecdb.SearchResult {
+		res := make([]vecdb.SearchResult, 0, len(contents))
+		for _, c := range contents {
+			res = append(res, vecdb.SearchResult{Content: c})
+		}
+
+		return res
+	}
+
+	testCases := []struct {
+		name   string
+		chunks []vecdb.SearchResult
+		budget int
+		want   []vecdb.SearchResult
+	}{
+		{
+			name:   "all fit",
+			chunks: chunks("aaaa", "bbbb", "cccc"),
+			budget: 3,
+			want:   chunks("aaaa", "bbbb", "cccc"),
+		},
+		{
+			name:   "lowest ranked dropped",
+			chunks: chunks("aaaa", "bbbb", "cccc"),
+			budget: 2,
+			want:   chunks("aaaa", "bbbb"),
+		},
+		{
+			name:   "oversized chunk drops the ones below it",
+			chunks: chunks("aaaa", strings.Repeat("b", 40), "cccc"),
+			budget: 5,
+			want:   chunks("aaaa"),
+		},
+		{
+			name:   "no budget",
+			chunks: chunks("aaaa"),
+			budget: 0,
+			want:   chunks(),
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := prompt.FitChunks(tt.chunks, llm.ApproxTokenCounter{}, tt.budget)
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("chunks mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFitUserPrompt(t *testing.T) {
+	var (
+		tc     = llm.ApproxTokenCounter{}
+		chunks = []vecdb.SearchResult{
+			{Content: strings.Repeat("a", 400), Meta: meta("foo", 1)},
+			{Content: strings.Repeat("b", 400), Meta: meta("bar", 2)},
+			{Content: strings.Repeat("c", 400), Meta: meta("baz", 3)},
+		}
+	)
+
+	t.Run("fits", func(t *testing.T) {
+		want, err := prompt.BuildUserPrompt("query", chunks, prompt.DecodeMeta)
+		if err != nil {
+			t.Fatalf("build user prompt: %v", err)
+		}
+
+		got, dropped, err := prompt.FitUserPrompt("query", chunks, prompt.DecodeMeta, tc, 1000)
+		if err != nil {
+			t.Fatalf("fit user prompt: %v", err)
+		}
+
+		if got != want || dropped != 0 {
+			t.Errorf("want the prompt with all chunks, got %d dropped:\n%s", dropped, got)
+		}
+	})
+
+	t.Run("no budget", func(t *testing.T) {
+		_, dropped, err := prompt.FitUserPrompt("query", chunks, prompt.DecodeMeta, tc, 0)
+		if err != nil {
+			t.Fatalf("fit user prompt: %v", err)
+		}
+
+		if dropped != 0 {
+			t.Errorf("want no chunks dropped without a budget, got: %d", dropped)
+		}
+	})
+
+	t.Run("over budget", func(t *testing.T) {
+		const budget = 250
+
+		got, dropped, err := prompt.FitUserPrompt("query", chunks, prompt.DecodeMeta, tc, budget)
+		if err != nil {
+			t.Fatalf("fit user prompt: %v", err)
+		}
+
+		if dropped != 1 {
+			t.Errorf("want the lowest ranked chunk dropped, got %d dropped", dropped)
+		}
+
+		if n := tc.Count(openai.UserMessage(got)); n > budget {
+			t.Errorf("want the prompt within %d tokens, got: %d", budget, n)
+		}
+
+		if !strings.Contains(got, "source=bar") || strings.Contains(got, "source=baz") {
+			t.Errorf("want the two highest ranked chunks kept, got:\n%s", got)
+		}
+	})
+}
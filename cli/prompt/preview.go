@@ -0,0 +1,51 @@
+package prompt
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+// Preview summarizes a user prompt before it is sent.
+type Preview struct {
+	Tokens  int      // Tokens is the estimated number of tokens of the prompt.
+	Chunks  int      // Chunks is the number of chunks in the prompt.
+	Sources []string // Sources lists the distinct sources of the chunks, most relevant first.
+	Cost    float64  // Cost is the estimated input cost of the prompt, zero if not priced.
+}
+
+// NewPreview previews userPrompt, built from hits, counting its tokens with tc.
+// priceIn is the price per 1K prompt tokens of the model, zero if unknown.
+func NewPreview(tc llm.TokenCounter, userPrompt string, hits []vecdb.SearchResult, priceIn float64) Preview {
+	p := Preview{
+		Tokens: countTokens(tc, userPrompt),
+		Chunks: len(hits),
+	}
+
+	p.Cost = float64(p.Tokens) / 1000 * priceIn
+
+	for _, h := range hits {
+		source, _ := DecodeMeta(h.Meta)
+
+		source = cmp.Or(source, "unknown")
+		if !slices.Contains(p.Sources, source) {
+			p.Sources = append(p.Sources, source)
+		}
+	}
+
+	return p
+}
+
+// String formats the preview on a single line,
+// e.g. "~1200 tokens, 4 chunks from 2 sources, ~$0.0002".
+func (p Preview) String() string {
+	s := fmt.Sprintf("~%d tokens, %d chunks from %d sources", p.Tokens, p.Chunks, len(p.Sources))
+	if p.Cost > 0 {
+		s += fmt.Sprintf(", ~$%.4f", p.Cost)
+	}
+
+	return s
+}
@@ -4,13 +4,21 @@ import (
 	"bytes"
 	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
+	"unicode/utf8"
 
 	"github.com/ladzaretti/ragx-cli/vecdb"
 )
 
+// NoContextAnswer is the answer the default system prompt
+// instructs the model to give when the context does not help.
+const NoContextAnswer = "I don't know based on the provided context."
+
 // DefaultSystemPrompt is the base, terminal-first system prompt for a ragx CLI.
 const DefaultSystemPrompt = `# Identity
 You are a terminal-first RAG assistant. You answer **only** from the provided CONTEXT.
@@ -108,14 +116,67 @@ TEXT: {{.Content}}
 (no relevant chunks)
 {{- end }}`
 
+// SummarizeSystemPrompt instructs the model to condense a single
+// retrieved chunk before the question is answered from the summaries.
+const SummarizeSystemPrompt = `You condense an EXCERPT of source material so that a later step can answer the USER QUERY from it.
+
+- Keep only information relevant to the query; keep names, numbers, commands, flags and code identifiers verbatim.
+- Do not answer the query and do not add anything that is not in the excerpt.
+- If nothing in the excerpt is relevant, reply exactly: "(no relevant content)".
+- Reply with the summary only.`
+
+// BuildSummarizePrompt renders the prompt summarizing text for query.
+func BuildSummarizePrompt(query, text string) string {
+	return "USER QUERY:\n" + strings.TrimSpace(query) + "\n\nEXCERPT:\n" + strings.TrimSpace(text)
+}
+
+// tmplFuncs are the helper functions available to the user prompt template:
+//
+//	truncate n s  the first n runes of s, followed by "..." if s was cut
+//	indent n s    s with every line indented by n spaces
+//	numbered s    s with every line prefixed by its 1-based number
+//	trim s        s without leading and trailing white space
+//	add a b       the sum of a and b, e.g. {{add $i 1}} for 1-based indices
+var tmplFuncs = template.FuncMap{
+	"truncate": truncate,
+	"indent":   indent,
+	"numbered": numbered,
+	"trim":     strings.TrimSpace,
+	"add":      func(a, b int) int { return a + b },
+}
+
+func truncate(n int, s string) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n]) + "..."
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", max(n, 0))
+
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+func numbered(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = fmt.Sprintf("%d: %s", i+1, l)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 type promptConfig struct {
 	userTmpl string
 }
 
 type chunkView struct {
-	ID      int
-	Source  string
-	Content string
+	ID       int
+	Source   string
+	Content  string
+	Distance float64 // Distance of the chunk from the query, lower is more relevant.
 }
 type tmplData struct {
 	Query  string
@@ -134,6 +195,11 @@ func WithUserPromptTmpl(tmpl string) PromptOpt {
 
 // BuildUserPrompt renders the user prompt template.
 // If no template is provided, [DefaultUserPromptTmpl] is used.
+// The template can use the truncate, indent, numbered, trim and add helpers.
+//
+// The query and chunk contents are passed to the template as data and are
+// never parsed as a template, so template-like sequences such as "{{"
+// in retrieved text are rendered literally.
 func BuildUserPrompt(query string, chunks []vecdb.SearchResult, metaFn MetaFunc, opts ...PromptOpt) (string, error) {
 	c := &promptConfig{
 		userTmpl: DefaultUserPromptTmpl,
@@ -158,21 +224,55 @@ func BuildUserPrompt(query string, chunks []vecdb.SearchResult, metaFn MetaFunc,
 		id = cmp.Or(id, i)
 
 		td.Chunks = append(td.Chunks, chunkView{
-			ID:      id,
-			Source:  src,
-			Content: strings.TrimSpace(ch.Content),
+			ID:       id,
+			Source:   src,
+			Content:  strings.TrimSpace(ch.Content),
+			Distance: ch.Distance,
 		})
 	}
 
-	t, err := template.New("user_prompt").Parse(c.userTmpl)
+	t, err := template.New("user_prompt").Funcs(tmplFuncs).Parse(c.userTmpl)
 	if err != nil {
-		return "", fmt.Errorf("template parse error: %v", err)
+		return "", templateError("parse", c.userTmpl, err)
 	}
 
 	var buf bytes.Buffer
 	if err := t.Execute(&buf, td); err != nil {
-		return "", fmt.Errorf("template execution error: %v", err)
+		return "", templateError("execution", c.userTmpl, err)
 	}
 
 	return buf.String(), nil
 }
+
+// ValidateUserPromptTmpl reports whether tmpl can be parsed and rendered
+// against sample data, so that template errors surface before the first query.
+func ValidateUserPromptTmpl(tmpl string) error {
+	sample := []vecdb.SearchResult{{Content: "content"}}
+
+	_, err := BuildUserPrompt("query", sample, nil, WithUserPromptTmpl(tmpl))
+
+	return err
+}
+
+// tmplErrLineRE matches the line number of text/template errors,
+// e.g. "template: user_prompt:3: ..." or "template: user_prompt:3:12: ...".
+var tmplErrLineRE = regexp.MustCompile(`^template: [^:]+:(\d+)(?::\d+)?:`)
+
+// templateError annotates a template error with the offending template line.
+func templateError(stage, tmpl string, err error) error {
+	msg := fmt.Sprintf("template %s error: %v", stage, err)
+
+	m := tmplErrLineRE.FindStringSubmatch(err.Error())
+	if m == nil {
+		return errors.New(msg)
+	}
+
+	n, _ := strconv.Atoi(m[1])
+
+	lines := strings.Split(tmpl, "\n")
+	if n < 1 || n > len(lines) {
+		return errors.New(msg)
+	}
+
+	return fmt.Errorf("%s (line %d: %q)", msg, n, strings.TrimSpace(lines[n-1]))
+}
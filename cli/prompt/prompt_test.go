@@ -76,12 +76,46 @@ TEXT: qux
 N: 2
 First: baz`,
 		},
+		{
+			name:     "chunk distance",
+			userTmpl: "{{range .Chunks}}{{.Source}} {{printf \"%.2f\" .Distance}}{{if lt .Distance 0.4}} relevant{{end}}\n{{end}}",
+			query:    "foo",
+			chunks: []vecdb.SearchResult{
+				{Content: "bar", Distance: 0.25, Meta: meta("baz", 2)},
+				{Content: "qux", Distance: 0.75, Meta: meta("quux", 7)},
+			},
+			metaFn: prompt.DecodeMeta,
+			want:   "baz 0.25 relevant\nquux 0.75\n",
+		},
 		{
 			name:     "template parse error",
 			query:    "foo",
 			userTmpl: "{{",
 			chunks:   nil,
-			wantErr:  "template parse error: template: user_prompt:1: unclosed action",
+			wantErr:  `template parse error: template: user_prompt:1: unclosed action (line 1: "{{")`,
+		},
+		{
+			name:     "template execution error points at the offending line",
+			query:    "foo",
+			userTmpl: "Q: {{.Query}}\nX: {{.Querry}}",
+			chunks:   nil,
+			wantErr:  `template execution error: template: user_prompt:2:5: executing "user_prompt" at <.Querry>: can't evaluate field Querry in type prompt.tmplData (line 2: "X: {{.Querry}}")`,
+		},
+		{
+			name:  "template delimiters in chunk content are injected literally",
+			query: "{{.Query}}",
+			chunks: []vecdb.SearchResult{
+				{Content: "use {{ .Values.image }} and {{/* comment */}} here }}", Meta: meta("chart.yaml", 1)},
+			},
+			metaFn: prompt.DecodeMeta,
+			want: `USER QUERY:
+{{.Query}}
+
+CONTEXT:
+----
+CHUNK id=1 source=chart.yaml
+TEXT: use {{ .Values.image }} and {{/* comment */}} here }}
+----`,
 		},
 	}
 
@@ -111,6 +145,85 @@ First: baz`,
 	}
 }
 
+func TestPrompt_TemplateFuncs(t *testing.T) {
+	chunks := []vecdb.SearchResult{
+		{Content: "foo bar baz"},
+		{Content: "qux\nquux"},
+	}
+
+	testCases := []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{
+			name: "truncate",
+			tmpl: "{{range .Chunks}}{{truncate 3 .Content}}|{{end}}",
+			want: "foo...|qux...|",
+		},
+		{
+			name: "truncate shorter than n",
+			tmpl: "{{truncate 50 .Query}}",
+			want: "foo",
+		},
+		{
+			name: "indent",
+			tmpl: "{{indent 2 (index .Chunks 1).Content}}",
+			want: "  qux\n  quux",
+		},
+		{
+			name: "numbered",
+			tmpl: "{{numbered (index .Chunks 1).Content}}",
+			want: "1: qux\n2: quux",
+		},
+		{
+			name: "trim",
+			tmpl: "[{{trim \"  foo  \"}}]",
+			want: "[foo]",
+		},
+		{
+			name: "add",
+			tmpl: "{{range $i, $c := .Chunks}}CHUNK [{{add $i 1}}] {{end}}",
+			want: "CHUNK [1] CHUNK [2] ",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := prompt.BuildUserPrompt("foo", chunks, nil, prompt.WithUserPromptTmpl(tt.tmpl))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("template output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPrompt_ValidateUserPromptTmpl(t *testing.T) {
+	testCases := []struct {
+		name    string
+		tmpl    string
+		wantErr bool
+	}{
+		{name: "default template", tmpl: prompt.DefaultUserPromptTmpl},
+		{name: "indexing the first chunk", tmpl: "{{(index .Chunks 0).Content}}"},
+		{name: "unknown field", tmpl: "{{.Foo}}", wantErr: true},
+		{name: "unclosed action", tmpl: "{{.Query", wantErr: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := prompt.ValidateUserPromptTmpl(tt.tmpl)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("want error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
 func meta(source string, index int) json.RawMessage {
 	b, _ := json.Marshal(struct { //nolint:errchkjson
 		Source string `json:"path,omitempty"`
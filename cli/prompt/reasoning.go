@@ -0,0 +1,115 @@
+package prompt
+
+import "strings"
+
+// The tags models inline their reasoning between.
+const (
+	ReasoningStartTag = "<think>"
+	ReasoningEndTag   = "</think>"
+)
+
+// ReasoningEventKind is the kind of a [ReasoningEvent].
+type ReasoningEventKind int
+
+const (
+	EventContent        ReasoningEventKind = iota // answer text
+	EventReasoning                                // text between the reasoning tags
+	EventReasoningStart                           // a reasoning start tag
+	EventReasoningEnd                             // a reasoning end tag
+)
+
+// ReasoningEvent is a piece of streamed text classified by a [ReasoningScanner].
+type ReasoningEvent struct {
+	Kind ReasoningEventKind
+	Text string // Text is set on content and reasoning events.
+}
+
+// ReasoningScanner splits streamed text into reasoning tags, reasoning
+// and answer content. Unlike comparing each chunk to the tags, it finds
+// tags glued to other text or split across chunks, by holding back a
+// chunk suffix that may start a tag until the next chunk.
+// The zero value is ready to use, for a single stream.
+type ReasoningScanner struct {
+	pending   string
+	reasoning bool
+}
+
+// Scan returns the events of the next chunk of the stream.
+func (s *ReasoningScanner) Scan(chunk string) []ReasoningEvent {
+	var (
+		text   = s.pending + chunk
+		events []ReasoningEvent
+	)
+
+	s.pending = ""
+
+	for {
+		tag := s.nextTag()
+
+		i := strings.Index(text, tag)
+		if i == -1 {
+			break
+		}
+
+		events = s.appendText(events, text[:i])
+
+		if s.reasoning {
+			events = append(events, ReasoningEvent{Kind: EventReasoningEnd})
+		} else {
+			events = append(events, ReasoningEvent{Kind: EventReasoningStart})
+		}
+
+		s.reasoning = !s.reasoning
+		text = text[i+len(tag):]
+	}
+
+	n := partialTagLen(text, s.nextTag())
+	s.pending = text[len(text)-n:]
+
+	return s.appendText(events, text[:len(text)-n])
+}
+
+// Flush returns the text held back at the end of the stream.
+func (s *ReasoningScanner) Flush() []ReasoningEvent {
+	text := s.pending
+	s.pending = ""
+
+	return s.appendText(nil, text)
+}
+
+// nextTag returns the tag that changes the state of the scanner.
+func (s *ReasoningScanner) nextTag() string {
+	if s.reasoning {
+		return ReasoningEndTag
+	}
+
+	return ReasoningStartTag
+}
+
+func (s *ReasoningScanner) appendText(events []ReasoningEvent, text string) []ReasoningEvent {
+	if text == "" {
+		return events
+	}
+
+	kind := EventContent
+	if s.reasoning {
+		kind = EventReasoning
+	}
+
+	return append(events, ReasoningEvent{Kind: kind, Text: text})
+}
+
+// partialTagLen returns the length of the suffix of text
+// that is a proper prefix of tag, if any.
+func partialTagLen(text, tag string) int {
+	i := strings.LastIndexByte(text, '<')
+	if i == -1 {
+		return 0
+	}
+
+	if suffix := text[i:]; len(suffix) < len(tag) && strings.HasPrefix(tag, suffix) {
+		return len(suffix)
+	}
+
+	return 0
+}
@@ -0,0 +1,104 @@
+package prompt_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+)
+
+func TestReasoningScanner(t *testing.T) {
+	type event = prompt.ReasoningEvent
+
+	var (
+		content = func(s string) event { return event{Kind: prompt.EventContent, Text: s} }
+		reason  = func(s string) event { return event{Kind: prompt.EventReasoning, Text: s} }
+		start   = event{Kind: prompt.EventReasoningStart}
+		end     = event{Kind: prompt.EventReasoningEnd}
+	)
+
+	testCases := []struct {
+		name   string
+		stream string
+		want   []event
+	}{
+		{
+			name:   "no reasoning",
+			stream: "foo bar",
+			want:   []event{content("foo bar")},
+		},
+		{
+			name:   "glued tags",
+			stream: "<think>foo</think>\n\nbar",
+			want:   []event{start, reason("foo"), end, content("\n\nbar")},
+		},
+		{
+			name:   "content around reasoning",
+			stream: "foo <think>bar</think> baz",
+			want:   []event{content("foo "), start, reason("bar"), end, content(" baz")},
+		},
+		{
+			name:   "angle brackets that are not tags",
+			stream: "a < b <th c</think> <thin",
+			want:   []event{content("a < b <th c</think> <thin")},
+		},
+		{
+			name:   "unterminated reasoning",
+			stream: "<think>foo </thi",
+			want:   []event{start, reason("foo </thi")},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			// split the stream at every pair of boundaries, including none
+			for i := 0; i <= len(tt.stream); i++ {
+				for j := i; j <= len(tt.stream); j++ {
+					chunks := []string{tt.stream[:i], tt.stream[i:j], tt.stream[j:]}
+
+					if diff := cmp.Diff(tt.want, scanAll(chunks...)); diff != "" {
+						t.Fatalf("split %q (-want +got):\n%s", chunks, diff)
+					}
+				}
+			}
+
+			// and at every byte
+			chunks := make([]string, 0, len(tt.stream))
+			for i := range len(tt.stream) {
+				chunks = append(chunks, tt.stream[i:i+1])
+			}
+
+			if diff := cmp.Diff(tt.want, scanAll(chunks...)); diff != "" {
+				t.Errorf("split at every byte (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// scanAll scans chunks as a stream and returns its events,
+// merging consecutive text events of the same kind.
+func scanAll(chunks ...string) []prompt.ReasoningEvent {
+	var (
+		s      prompt.ReasoningScanner
+		events []prompt.ReasoningEvent
+	)
+
+	for _, c := range chunks {
+		events = append(events, s.Scan(c)...)
+	}
+
+	events = append(events, s.Flush()...)
+
+	var merged []prompt.ReasoningEvent
+
+	for _, e := range events {
+		if n := len(merged); n > 0 && e.Text != "" && merged[n-1].Kind == e.Kind {
+			merged[n-1].Text += e.Text
+			continue
+		}
+
+		merged = append(merged, e)
+	}
+
+	return merged
+}
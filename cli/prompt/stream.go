@@ -8,15 +8,26 @@ import (
 
 	"github.com/ladzaretti/ragx-cli/llm"
 	"github.com/ladzaretti/ragx-cli/vecdb"
+
+	openai "github.com/openai/openai-go/v2"
 )
 
 type Chunk struct {
-	Err     error
-	Content string
+	Err       error
+	Content   string
+	Reasoning string // Reasoning is set on chunks of reasoning sent apart from the content.
+	Usage     *Usage // Usage is set on the final chunk of a turn, with no content.
+}
+
+// Usage is the token usage of a single chat turn.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool // Estimated reports whether the provider did not report the usage.
 }
 
 // SendStream starts a streaming request and wires chunks back to [model.Update].
-func SendStream(ctx context.Context, s *llm.ChatSession, req llm.ChatCompletionRequest) <-chan Chunk {
+func SendStream(ctx context.Context, s llm.Session, req llm.ChatCompletionRequest) <-chan Chunk {
 	ch := make(chan Chunk)
 
 	go func() {
@@ -34,7 +45,17 @@ func SendStream(ctx context.Context, s *llm.ChatSession, req llm.ChatCompletionR
 				return
 			}
 
-			ch <- Chunk{Content: res.Content}
+			if u, ok := res.Usage.(openai.CompletionUsage); ok {
+				ch <- Chunk{Usage: &Usage{
+					PromptTokens:     int(u.PromptTokens),
+					CompletionTokens: int(u.CompletionTokens),
+					Estimated:        res.UsageEstimated,
+				}}
+
+				continue
+			}
+
+			ch <- Chunk{Content: res.Content, Reasoning: res.Reasoning}
 		}
 
 		ch <- Chunk{Err: io.EOF}
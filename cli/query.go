@@ -1,32 +1,78 @@
 package cli
 
 import (
+	"bufio"
 	"cmp"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"slices"
 	"strings"
 	"syscall"
+	"unicode"
 
 	"github.com/ladzaretti/ragx-cli/cli/prompt"
 	"github.com/ladzaretti/ragx-cli/clierror"
 	"github.com/ladzaretti/ragx-cli/genericclioptions"
 	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/ragx"
 	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
 )
 
+// batchStdin is the --batch value for reading queries from stdin.
+const batchStdin = "-"
+
+// defaultMaxPrintChunks is the default number of chunks printed by --print-chunks.
+const defaultMaxPrintChunks = 20
+
+var (
+	ErrBatchStdinNeedsPaths = errors.New("--batch - reads queries from stdin; provide paths to embed")
+	ErrRawContextWithInput  = errors.New("--raw-context cannot be used with paths, --paths-from or piped input to embed")
+)
+
+// rawContextStdin is the --raw-context value for reading the context from stdin.
+const rawContextStdin = "-"
+
 type QueryOptions struct {
 	*genericclioptions.StdioOptions
 	llmOptions *llmOptions
 
-	query  string
-	dryRun bool
+	query        string
+	output       string
+	batch        string
+	dryRun       bool
+	showMessages bool
+	raw          bool
+	hybrid       bool
+
+	summarize          bool
+	summarizeThreshold int
+
+	printChunks bool
+	maxPrint    int
+	minScore    float64
+
+	sessionPath string
+	pathsFrom   string
+	noStream    bool
+	noDaemon    bool
+	showTimings bool
+	rawContext  []string
+}
+
+// Message is a chat message as it would be sent to the LLM.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
 }
 
 var _ genericclioptions.CmdOptions = &QueryOptions{}
@@ -39,28 +85,89 @@ func NewQueryOptions(stdio *genericclioptions.StdioOptions, llmOptions *llmOptio
 	}
 }
 
-func (*QueryOptions) Complete() error { return nil }
+func (o *QueryOptions) Complete() error {
+	if o.hybrid {
+		o.llmOptions.retrievalConfig.Mode = ragx.RetrievalHybrid
+	}
+
+	if o.minScore > 0 {
+		o.llmOptions.retrievalConfig.MinScore = o.minScore
+	}
 
-func (*QueryOptions) Validate() error { return nil }
+	o.llmOptions.printChunks, o.llmOptions.maxPrintChunks = o.printChunks, o.maxPrint
 
-func (o *QueryOptions) Run(ctx context.Context, args ...string) error {
-	if !o.Piped && len(args) == 0 {
-		return ErrNoEmbedInput
+	if o.showTimings {
+		o.llmOptions.timings = &timings{}
 	}
 
-	if o.Piped && len(args) > 0 {
-		return ErrConflictingEmbedInputs
+	return nil
+}
+
+func (o *QueryOptions) Validate() error {
+	if o.batch != "" && o.raw {
+		return errf("--raw cannot be used with --batch")
 	}
 
-	var in io.Reader
+	if o.batch != "" && o.dryRun {
+		return errf("--dry-run cannot be used with --batch")
+	}
 
-	if o.Piped {
-		in = o.In
+	if o.showMessages && (o.batch != "" || o.dryRun || o.raw) {
+		return errf("--show-messages cannot be used with --batch, --dry-run or --raw")
 	}
 
-	err := o.llmOptions.embed(ctx, o.Logger, in, o.llmOptions.embeddingREs, args...)
-	if err != nil {
-		return errf("embed: %w", err)
+	if o.summarize && (o.dryRun || o.showMessages) {
+		return errf("--summarize cannot be used with --dry-run or --show-messages")
+	}
+
+	if o.summarizeThreshold < 0 {
+		return errf("--summarize-threshold must be zero or positive")
+	}
+
+	if len(o.rawContext) > 0 && o.batch != "" {
+		return errf("--raw-context cannot be used with --batch")
+	}
+
+	if o.batch == batchStdin && o.pathsFrom == pathsFromStdin {
+		return errf("--batch - and --paths-from - cannot both read from stdin")
+	}
+
+	if o.sessionPath != "" && (o.batch != "" || o.dryRun || o.showMessages) {
+		return errf("--session cannot be used with --batch, --dry-run or --show-messages")
+	}
+
+	if o.minScore < 0 || o.minScore > 1 {
+		return errf("--min-score must be between 0 and 1")
+	}
+
+	if o.maxPrint < 0 {
+		return errf("--max-print must be zero or positive")
+	}
+
+	if o.raw && o.output != outputText {
+		return errf("--raw cannot be used with --output %s", o.output)
+	}
+
+	return validateOutputFormat(o.output)
+}
+
+func (o *QueryOptions) Run(ctx context.Context, args ...string) error {
+	if o.llmOptions.daemonSocket != "" {
+		return o.forward(ctx, args)
+	}
+
+	defer o.llmOptions.timings.print(o.ErrOut)
+
+	if len(o.rawContext) > 0 {
+		if len(args) > 0 || o.pathsFrom != "" || (o.Piped && !slices.Contains(o.rawContext, rawContextStdin)) {
+			return ErrRawContextWithInput
+		}
+	} else if err := o.embedArgsAndQuery(ctx, args); err != nil {
+		return err
+	}
+
+	if o.batch != "" {
+		return o.runBatch(ctx)
 	}
 
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
@@ -73,81 +180,634 @@ func (o *QueryOptions) Run(ctx context.Context, args ...string) error {
 	defer spinner.stop()
 
 	var (
-		selectedModel  = o.llmOptions.llmConfig.DefaultModel
-		embeddingModel = o.llmOptions.embeddingConfig.Model
-		topK           = o.llmOptions.embeddingConfig.TopK
+		selectedModel = o.llmOptions.llmConfig.DefaultModel
+		setStatus     = spinner.sendStatusWithEllipsis
 	)
 
-	provider, err := o.llmOptions.providers.ProviderFor(embeddingModel)
+	provider, err := o.llmOptions.providers.ProviderFor(selectedModel)
 	if err != nil {
 		return fmt.Errorf("provider for: %w", err)
 	}
 
-	setStatus := spinner.sendStatusWithEllipsis
-
-	setStatus("embedding query")
-
-	q, err := provider.Client.Embed(ctx, llm.EmbedRequest{
-		Input: o.query,
-		Model: embeddingModel,
-	})
+	hits, err := o.contextHits(ctx, setStatus)
 	if err != nil {
 		return err
 	}
 
-	setStatus(fmt.Sprintf("search knn (topK=%d)", topK))
-
-	hits, err := o.llmOptions.vectordb.SearchKNN(toFloat32Slice(q.Vector), topK)
+	promptHits, err := o.promptHits(ctx, setStatus, provider, selectedModel, o.query, hits)
 	if err != nil {
 		return err
 	}
 
 	setStatus("sending to " + selectedModel)
 
-	opts := []prompt.PromptOpt{
-		prompt.WithUserPromptTmpl(o.llmOptions.promptConfig.UserPromptTmpl),
+	p, promptHits, err := o.buildPrompt(selectedModel, o.query, promptHits)
+	if err != nil {
+		return err
 	}
 
-	p, err := prompt.BuildUserPrompt(o.query, hits, prompt.DecodeMeta, opts...)
-	if err != nil {
-		return errf("build user prompt: %w", err)
+	if o.showMessages {
+		spinner.stop()
+		return o.printMessages(p)
 	}
 
 	if o.dryRun {
 		spinner.stop()
-		o.Print(p + "\n")
+		o.printRetrieval(hits)
+		o.Print(p)
+
+		if !o.raw {
+			o.Print("\n")
+		}
+
+		o.printPreview(selectedModel, p, promptHits)
 
 		return nil
 	}
 
+	// with retrieval disabled, there is no context to miss
+	if msg, ok := noContextAnswer(o.llmOptions.outputConfig, hits); ok && o.llmOptions.embeddingConfig.TopK > 0 {
+		spinner.stop()
+		o.Logger.Info("no relevant context retrieved, skipping llm call", "hits", len(hits))
+
+		return o.printAnswer(msg, hits)
+	}
+
+	req := o.llmOptions.chatRequest(selectedModel, p)
+
+	session := provider.Session.NewChat(llm.WithContextRetryNotify(o.warnContextRetry))
+
+	if o.sessionPath != "" {
+		if err := loadSession(o.sessionPath, session); err != nil {
+			return err
+		}
+	}
+
 	var (
-		temperature   *float64
-		contextLength int
+		stopGeneration = o.llmOptions.timings.track(o.Logger, phaseGeneration)
+		firstToken     = o.llmOptions.timings.trackFirst(o.Logger, phaseFirstToken)
 	)
 
-	i := slices.IndexFunc(
-		o.llmOptions.llmConfig.Models,
-		func(m types.ModelConfig) bool { return m.ID == selectedModel },
+	if o.noStream {
+		answer, err := o.send(ctx, setStatus, session, req)
+
+		spinner.stop()
+		stopGeneration()
+
+		if err != nil {
+			return err
+		}
+
+		if err := o.saveSession(session); err != nil {
+			return err
+		}
+
+		if o.output != outputJSON {
+			o.warnCitations(answer, hits)
+		}
+
+		return o.printAnswer(answer, hits)
+	}
+
+	ch := prompt.SendStream(ctx, session, req)
+
+	if o.output == outputJSON {
+		var answer strings.Builder
+
+		onToken := func(s string) {
+			firstToken()
+			answer.WriteString(s)
+		}
+
+		if err := drainStream(ctx, ch, onToken, setStatus, spinner.stop); err != nil {
+			return fmt.Errorf("response stream: %w", err)
+		}
+
+		stopGeneration()
+
+		if err := o.saveSession(session); err != nil {
+			return err
+		}
+
+		return o.printJSON(newQueryResult(o.query, strings.TrimSpace(answer.String()), hits))
+	}
+
+	var answer strings.Builder
+
+	printFunc := func(s string) {
+		firstToken()
+		answer.WriteString(s)
+		o.Print(s)
+	}
+
+	if err := o.printStream(ctx, ch, printFunc, setStatus, spinner.stop); err != nil {
+		return err
+	}
+
+	stopGeneration()
+
+	o.warnCitations(answer.String(), hits)
+
+	return o.saveSession(session)
+}
+
+// forward answers the query by the daemon, which embeds the paths
+// given as arguments, or reuses their index if it is still warm.
+func (o *QueryOptions) forward(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return ErrNoEmbedInput
+	}
+
+	req := DaemonRequest{
+		Query: o.query,
+		Model: o.llmOptions.llmConfig.DefaultModel,
+		TopK:  o.llmOptions.embeddingConfig.TopK,
+	}
+
+	for _, arg := range args {
+		if isURL(arg) {
+			req.Paths = append(req.Paths, arg)
+			continue
+		}
+
+		p, err := filepath.Abs(arg)
+		if err != nil {
+			return fmt.Errorf("abs %q: %w", arg, err)
+		}
+
+		req.Paths = append(req.Paths, p)
+	}
+
+	for _, re := range o.llmOptions.embeddingREs {
+		req.Match = append(req.Match, re.String())
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	spinner := newSpinner(cancel, "")
+
+	go spinner.run()
+
+	defer spinner.stop()
+
+	spinner.sendStatusWithEllipsis("waiting for the daemon")
+
+	onToken := func(s string) {
+		if o.output == outputJSON {
+			return
+		}
+
+		spinner.stop()
+		o.Print(s)
+	}
+
+	res, warnings, err := queryDaemon(ctx, o.llmOptions.daemonSocket, req, onToken)
+
+	spinner.stop()
+
+	if err != nil {
+		return errf("forward to daemon: %w", err)
+	}
+
+	if o.output == outputJSON {
+		return o.printJSON(res)
+	}
+
+	if !o.raw {
+		o.Print("\n")
+	}
+
+	for _, w := range warnings {
+		fmt.Fprintf(o.ErrOut, "warning: %s\n", w)
+	}
+
+	return nil
+}
+
+// saveSession saves the chat history for the next query, if --session is set.
+func (o *QueryOptions) saveSession(session llm.Session) error {
+	if o.sessionPath == "" {
+		return nil
+	}
+
+	return saveSession(o.sessionPath, session)
+}
+
+// embedArgs embeds the data of the paths given as arguments,
+// or with --paths-from, or of the piped input.
+func (o *QueryOptions) embedArgs(ctx context.Context, args []string) error {
+	if o.pathsFrom != "" {
+		paths, err := readPathsFrom(o.pathsFrom, o.In, o.ErrOut)
+		if err != nil {
+			return err
+		}
+
+		args = append(args, paths...)
+	}
+
+	in, err := o.embedInput(args)
+	if err != nil {
+		return err
+	}
+
+	if err := o.llmOptions.embed(ctx, o.Logger, in, o.llmOptions.embeddingREs, args...); err != nil {
+		return errf("embed: %w", err)
+	}
+
+	return nil
+}
+
+// embedArgsAndQuery embeds the args and, concurrently, the query to
+// retrieve for, as the two are independent. Either failing cancels the other.
+func (o *QueryOptions) embedArgsAndQuery(ctx context.Context, args []string) error {
+	if o.batch != "" || o.query == "" || o.llmOptions.embeddingConfig.TopK == 0 {
+		return o.embedArgs(ctx, args)
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error { return o.embedArgs(gctx, args) })
+	g.Go(func() error { return o.llmOptions.embedQuery(gctx, o.query) })
+
+	return g.Wait()
+}
+
+// contextHits returns the chunks to answer from: the --raw-context
+// files as is or, by default, the chunks retrieved for the query.
+func (o *QueryOptions) contextHits(ctx context.Context, setStatus func(string)) ([]vecdb.SearchResult, error) {
+	if len(o.rawContext) == 0 {
+		return o.retrieve(ctx, setStatus, o.query)
+	}
+
+	hits := make([]vecdb.SearchResult, 0, len(o.rawContext))
+
+	for _, path := range o.rawContext {
+		var (
+			b      []byte
+			err    error
+			source = path
+		)
+
+		if path == rawContextStdin {
+			b, err = io.ReadAll(o.In)
+			source = "stdin"
+		} else {
+			b, err = os.ReadFile(filepath.Clean(path))
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("read raw context: %w", err)
+		}
+
+		meta, err := json.Marshal(vecdb.Meta{Source: source})
+		if err != nil {
+			return nil, fmt.Errorf("raw context meta: %w", err)
+		}
+
+		hits = append(hits, vecdb.SearchResult{Content: string(b), Meta: meta})
+	}
+
+	return hits, nil
+}
+
+// retrieve retrieves the chunks for query, dropping the ones
+// scoring below the configured minimum.
+func (o *QueryOptions) retrieve(ctx context.Context, setStatus func(string), query string) ([]vecdb.SearchResult, error) {
+	defer o.llmOptions.timings.track(o.Logger, phaseRetrieval)()
+
+	hits, err := o.llmOptions.retrieve(ctx, setStatus, query)
+	if err != nil {
+		return nil, err
+	}
+
+	minScore := o.llmOptions.retrievalConfig.MinScore
+
+	relevant := vecdb.FilterMinScore(hits, minScore)
+	if dropped := len(hits) - len(relevant); dropped > 0 {
+		o.Logger.Info("dropped chunks below min score", "dropped", dropped, "kept", len(relevant), "min_score", minScore)
+	}
+
+	return relevant, nil
+}
+
+// buildPrompt builds the user prompt answering query from hits,
+// warning about the hits dropped to fit the context of model.
+// It returns the prompt and the hits it includes.
+func (o *QueryOptions) buildPrompt(model, query string, hits []vecdb.SearchResult) (string, []vecdb.SearchResult, error) {
+	defer o.llmOptions.timings.track(o.Logger, phasePromptBuild)()
+
+	p, dropped, err := o.llmOptions.buildUserPrompt(model, query, hits)
+	if err != nil {
+		return "", nil, errf("build user prompt: %w", err)
+	}
+
+	if dropped > 0 {
+		o.Logger.Warn("dropped chunks exceeding the context", "model", model, "dropped", dropped, "kept", len(hits)-dropped)
+		fmt.Fprintf(o.ErrOut, "warning: prompt exceeds the context of %s, dropped the %d lowest ranked of %d chunks\n", model, dropped, len(hits))
+	}
+
+	return p, hits[:len(hits)-dropped], nil
+}
+
+// send sends req as a single non-streaming request and
+// returns the complete answer, without its reasoning.
+func (o *QueryOptions) send(ctx context.Context, setStatus func(string), session llm.Session, req llm.ChatCompletionRequest) (string, error) {
+	setStatus("waiting for " + req.Model)
+
+	res, err := session.Send(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("send: %w", err)
+	}
+
+	return llm.StripThinking(res.Content), nil
+}
+
+// printAnswer prints a complete answer, one that was not streamed.
+func (o *QueryOptions) printAnswer(answer string, hits []vecdb.SearchResult) error {
+	if o.output == outputJSON {
+		return o.printJSON(newQueryResult(o.query, answer, hits))
+	}
+
+	o.Print(answer)
+
+	if !o.raw {
+		o.Print("\n")
+	}
+
+	return nil
+}
+
+// printPreview prints the estimated size of userPrompt, the sources of its
+// hits and, if model is priced, its estimated input cost to stderr.
+func (o *QueryOptions) printPreview(model, userPrompt string, hits []vecdb.SearchResult) {
+	mc, _ := o.llmOptions.models().Config(model)
+	p := prompt.NewPreview(llm.ApproxTokenCounter{}, userPrompt, hits, mc.PriceIn)
+
+	fmt.Fprintf(o.ErrOut, "dry run: %s\n", p)
+
+	if len(p.Sources) > 0 {
+		fmt.Fprintf(o.ErrOut, "sources: %s\n", strings.Join(p.Sources, ", "))
+	}
+}
+
+// printRetrieval prints the retrieved chunks and their distances to stderr.
+func (o *QueryOptions) printRetrieval(hits []vecdb.SearchResult) {
+	for i, h := range hits {
+		source, index := prompt.DecodeMeta(h.Meta)
+		fmt.Fprintf(o.ErrOut, "%2d. %s:%d (%s)\n", i+1, source, index, o.llmOptions.outputConfig.FormatDistance(h.Distance))
+	}
+}
+
+// warnCitations reports citations of answer that cannot be
+// traced back to the retrieved chunks.
+func (o *QueryOptions) warnCitations(answer string, hits []vecdb.SearchResult) {
+	_, errs := prompt.ParseCitations(answer, hits)
+
+	for _, err := range errs {
+		fmt.Fprintf(o.ErrOut, "warning: %v\n", err)
+	}
+}
+
+// promptHits returns the chunks to answer from: the retrieved hits or,
+// with --summarize, their summaries.
+func (o *QueryOptions) promptHits(ctx context.Context, setStatus func(string), provider types.Provider, model, query string, hits []vecdb.SearchResult) ([]vecdb.SearchResult, error) {
+	if !o.summarize {
+		return hits, nil
+	}
+
+	return summarizeHits(ctx, setStatus, o.llmOptions.summarizer(provider, model), query, hits, o.summarizeThreshold)
+}
+
+// warnContextRetry reports a request retried with a smaller context.
+func (o *QueryOptions) warnContextRetry(attempted, limit int) {
+	fmt.Fprintf(o.ErrOut, "warning: %s\n", contextRetryNotice(attempted, limit))
+}
+
+// embedInput returns the reader to embed from, if any.
+// When queries are read from stdin, only paths can be embedded.
+func (o *QueryOptions) embedInput(args []string) (io.Reader, error) {
+	if o.batch == batchStdin {
+		if len(args) == 0 {
+			return nil, ErrBatchStdinNeedsPaths
+		}
+
+		return nil, nil
+	}
+
+	// with --paths-from -, stdin holds the paths rather than the data
+	piped := o.Piped && o.pathsFrom != pathsFromStdin
+
+	if !piped && len(args) == 0 {
+		return nil, ErrNoEmbedInput
+	}
+
+	if piped && len(args) > 0 {
+		return nil, ErrConflictingEmbedInputs
+	}
+
+	if piped {
+		return o.In, nil
+	}
+
+	return nil, nil
+}
+
+// runBatch answers every query of the batch input and prints
+// each result as a single line of JSON (JSONL).
+func (o *QueryOptions) runBatch(ctx context.Context) error {
+	queries, err := o.readBatch()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	spinner := newSpinner(cancel, "")
+
+	go spinner.run()
+
+	defer spinner.stop()
+
+	for i, q := range queries {
+		setStatus := func(s string) {
+			spinner.sendStatusWithEllipsis(fmt.Sprintf("[%d/%d] %s", i+1, len(queries), s))
+		}
+
+		res, err := o.answer(ctx, setStatus, q)
+		if err != nil {
+			return fmt.Errorf("query %d: %w", i+1, err)
+		}
+
+		out, err := renameJSONFields(res, o.llmOptions.outputConfig.JSONFields)
+		if err != nil {
+			return err
+		}
+
+		o.Print(stringify(out))
+	}
+
+	return nil
+}
+
+// answer runs a single query through retrieval and generation.
+// Each query is answered independently of the previous ones.
+func (o *QueryOptions) answer(ctx context.Context, setStatus func(string), query string) (QueryResult, error) {
+	model := o.llmOptions.llmConfig.DefaultModel
+
+	provider, err := o.llmOptions.providers.ProviderFor(model)
+	if err != nil {
+		return QueryResult{}, fmt.Errorf("provider for: %w", err)
+	}
+
+	hits, err := o.retrieve(ctx, setStatus, query)
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	// with retrieval disabled, there is no context to miss
+	if msg, ok := noContextAnswer(o.llmOptions.outputConfig, hits); ok && o.llmOptions.embeddingConfig.TopK > 0 {
+		o.Logger.Info("no relevant context retrieved, skipping llm call", "hits", len(hits))
+		return newQueryResult(query, msg, hits), nil
+	}
+
+	promptHits, err := o.promptHits(ctx, setStatus, provider, model, query, hits)
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	p, _, err := o.buildPrompt(model, query, promptHits)
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	setStatus("sending to " + model)
+
+	var (
+		session        = provider.Session.NewChat(llm.WithContextRetryNotify(o.warnContextRetry))
+		req            = o.llmOptions.chatRequest(model, p)
+		stopGeneration = o.llmOptions.timings.track(o.Logger, phaseGeneration)
+		firstToken     = o.llmOptions.timings.trackFirst(o.Logger, phaseFirstToken)
 	)
-	if i != -1 {
-		temperature = cmp.Or(o.llmOptions.llmConfig.Models[i].Temperature, o.llmOptions.defaultTemperature)
-		contextLength = cmp.Or(o.llmOptions.llmConfig.Models[i].Context, o.llmOptions.defaultContext)
+
+	if o.noStream {
+		answer, err := o.send(ctx, setStatus, session, req)
+		if err != nil {
+			return QueryResult{}, err
+		}
+
+		stopGeneration()
+
+		return newQueryResult(query, answer, hits), nil
 	}
 
-	req := llm.ChatCompletionRequest{
-		Model:         selectedModel,
-		ContextLength: contextLength,
-		Temperature:   temperature,
-		Prompt:        p,
+	var (
+		answer strings.Builder
+		ch     = prompt.SendStream(ctx, session, req)
+	)
+
+	onToken := func(s string) {
+		firstToken()
+		answer.WriteString(s)
+	}
+
+	if err := drainStream(ctx, ch, onToken, setStatus, func() {}); err != nil {
+		return QueryResult{}, fmt.Errorf("response stream: %w", err)
 	}
 
-	ch := prompt.SendStream(ctx, provider.Session, req)
+	stopGeneration()
+
+	return newQueryResult(query, strings.TrimSpace(answer.String()), hits), nil
+}
+
+// readBatch reads the batch queries, one per line, from stdin or a file.
+func (o *QueryOptions) readBatch() ([]string, error) {
+	if o.batch == batchStdin {
+		return readQueries(o.In)
+	}
+
+	f, err := os.Open(filepath.Clean(o.batch))
+	if err != nil {
+		return nil, fmt.Errorf("open batch: %w", err)
+	}
+	defer func() { _ = f.Close() }()
 
-	if err := drainStream(ctx, ch, o.Print, setStatus, spinner.stop); err != nil {
+	return readQueries(f)
+}
+
+func readQueries(r io.Reader) ([]string, error) {
+	var (
+		queries []string
+		scanner = bufio.NewScanner(r)
+	)
+
+	for scanner.Scan() {
+		if q := strings.TrimSpace(scanner.Text()); q != "" {
+			queries = append(queries, q)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read queries: %w", err)
+	}
+
+	if len(queries) == 0 {
+		return nil, errf("no queries found in batch input")
+	}
+
+	return queries, nil
+}
+
+// printStream prints the streamed answer as it arrives using printFunc.
+// Unless in raw mode, the output is terminated with a newline.
+func (o *QueryOptions) printStream(ctx context.Context, ch <-chan prompt.Chunk, printFunc func(string), setStatus func(string), stopSpinner func()) error {
+	if err := drainStream(ctx, ch, printFunc, setStatus, stopSpinner); err != nil {
 		return fmt.Errorf("response stream: %w", err)
 	}
 
-	o.Print("\n")
+	if !o.raw {
+		o.Print("\n")
+	}
+
+	return nil
+}
+
+// printMessages prints the system and user messages of the request,
+// in the order they would be sent to the LLM.
+func (o *QueryOptions) printMessages(userPrompt string) error {
+	messages := make([]Message, 0, 2)
+
+	if system := o.llmOptions.promptConfig.System; system != "" {
+		messages = append(messages, Message{Role: "system", Content: system})
+	}
+
+	messages = append(messages, Message{Role: "user", Content: userPrompt})
+
+	if o.output == outputJSON {
+		o.Print(stringifyPretty(messages))
+		return nil
+	}
+
+	for i, m := range messages {
+		if i > 0 {
+			o.Print("\n")
+		}
+
+		o.Printf("=== %s ===\n%s\n", m.Role, strings.TrimRight(m.Content, "\n"))
+	}
+
+	return nil
+}
+
+// printJSON writes v as JSON, applying the configured field renames.
+func (o *QueryOptions) printJSON(v any) error {
+	out, err := renameJSONFields(v, o.llmOptions.outputConfig.JSONFields)
+	if err != nil {
+		return err
+	}
+
+	o.Print(stringifyPretty(out))
 
 	return nil
 }
@@ -155,18 +815,50 @@ func (o *QueryOptions) Run(ctx context.Context, args ...string) error {
 func drainStream(ctx context.Context, ch <-chan prompt.Chunk, printFunc func(string), setStatus func(string), stopSpinner func()) error {
 	var (
 		chunk         prompt.Chunk
-		reasoning     = false
+		scanner       prompt.ReasoningScanner
 		reasoningDone = false
 	)
 
+	// handle prints the content of events, skipping the reasoning
+	// and the white space between the reasoning and the answer.
+	handle := func(events []prompt.ReasoningEvent) {
+		for _, e := range events {
+			switch e.Kind {
+			case prompt.EventReasoningStart:
+				setStatus("thinking")
+			case prompt.EventReasoningEnd:
+				reasoningDone = true
+			case prompt.EventReasoning:
+				// not printed
+			case prompt.EventContent:
+				text := e.Text
+				if reasoningDone {
+					if text = strings.TrimLeftFunc(text, unicode.IsSpace); text == "" {
+						continue
+					}
+
+					reasoningDone = false
+				}
+
+				stopSpinner()
+				printFunc(text)
+			}
+		}
+	}
+
 	setStatus("processing")
 
 	for {
 		select {
 		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil
+			}
+
 			return ctx.Err()
 		case c, ok := <-ch:
 			if !ok {
+				handle(scanner.Flush())
 				return nil
 			}
 
@@ -174,41 +866,30 @@ func drainStream(ctx context.Context, ch <-chan prompt.Chunk, printFunc func(str
 		}
 
 		if chunk.Err != nil {
-			if errors.Is(chunk.Err, io.EOF) {
+			// a canceled stream, e.g. by ctrl+c, ends quietly
+			if errors.Is(chunk.Err, io.EOF) || errors.Is(chunk.Err, llm.ErrStreamCanceled) {
+				handle(scanner.Flush())
 				return nil
 			}
 
 			return chunk.Err
 		}
 
-		switch strings.TrimSpace(chunk.Content) {
-		case reasoningStartTag:
-			setStatus("thinking")
-
-			reasoning = true
-		case reasoningEndTag:
-			reasoning = false
-			reasoningDone = true
-
-			continue
-		default:
-		}
-
-		if reasoning {
+		if chunk.Usage != nil {
 			continue
 		}
 
-		stopSpinner()
+		// reasoning sent apart from the content is not printed, like
+		// inline reasoning, and precedes the answer content
+		if chunk.Reasoning != "" {
+			setStatus("thinking")
 
-		if reasoningDone {
-			reasoningDone = false
+			reasoningDone = true
 
-			if strings.TrimSpace(chunk.Content) == "" {
-				continue
-			}
+			continue
 		}
 
-		printFunc(chunk.Content)
+		handle(scanner.Scan(chunk.Content))
 	}
 }
 
@@ -224,7 +905,7 @@ func NewCmdQuery(defaults *DefaultRAGOptions) *cobra.Command {
 		Aliases: []string{"q"},
 		Short:   "Embed data from paths or stdin and query the LLM",
 		Long: `Embeds content from one or more paths (files or directories) or from stdin.
-Directories are walked recursively.
+Directories are walked recursively. http(s) URLs are fetched, and HTML pages reduced to their text.
 
 Query is required and can be provided in the following precedence:
   1) with --query/-q
@@ -232,7 +913,20 @@ Query is required and can be provided in the following precedence:
   3) as the last positional argument
 
 When paths are provided, files are included if they match any -M/--match regex (full path).
-If no -M filter is given, all files under the provided paths are embedded.`,
+If no -M filter is given, all files under the provided paths are embedded.
+When walking a directory, files ignored by its .gitignore or by embedding.ignore are skipped.
+With --paths-from, paths are also read one per line from a file, or from stdin when given "-".
+
+With --raw-context, the given files are sent as the context as is, skipping embedding
+and retrieval, for quick questions about a single snippet.
+
+With --batch, queries are read one per line from a file, or from stdin when given "-"
+(in which case the data to embed must be given as paths). Each query is answered
+independently and its result is written as a single line of JSON (JSONL).
+
+With --summarize, when the retrieved chunks exceed --summarize-threshold characters,
+each chunk is first summarized by the LLM and the query is answered from the summaries,
+trading extra LLM calls for more source material in the context.`,
 		Example: `  # embed all .go files in current dir and query via --query/-q
   ragx query . -M '\.go$' -q "<query>"
 
@@ -243,7 +937,19 @@ If no -M filter is given, all files under the provided paths are embedded.`,
   cat readme.md | ragx query "<query>"
 
   # embed multiple paths with filter
-  ragx query docs src -M '(?i)\.(md|txt)$' -q "<query>"`,
+  ragx query docs src -M '(?i)\.(md|txt)$' -q "<query>"
+
+  # embed a web page, fetched and reduced to its text
+  ragx query https://example.com/guide.html -q "<query>"
+
+  # embed the files changed since main
+  git diff --name-only main | ragx query --paths-from - -q "<query>"
+
+  # ask about a snippet without embedding it
+  ragx query --raw-context main.go -q "<query>"
+
+  # answer several queries read from stdin as JSONL
+  printf '%s\n' "<query 1>" "<query 2>" | ragx query docs --batch -`,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return cmp.Or(
@@ -254,12 +960,42 @@ If no -M filter is given, all files under the provided paths are embedded.`,
 	}
 
 	cmd.Flags().StringVarP(&o.query, "query", "q", "", "set query text (can also be given positionally)")
-	cmd.Flags().BoolVarP(&o.dryRun, "dry-run", "", false, "print retrieval plan and the final prompt without calling the LLM")
+	cmd.Flags().BoolVarP(&o.dryRun, "dry-run", "", false, "print retrieval plan, the final prompt and its estimated size and cost without calling the LLM")
+	cmd.Flags().BoolVarP(&o.showMessages, "show-messages", "", false, "print the system and user messages that would be sent, without calling the LLM")
+	cmd.Flags().StringVarP(&o.output, "output", "o", outputText, "output format (text, json)")
+	cmd.Flags().StringVarP(&o.batch, "batch", "", "", "read queries one per line from a file (use - for stdin) and print JSONL results")
+	cmd.Flags().BoolVarP(&o.hybrid, "hybrid", "", false, "combine vector search with keyword search (overrides retrieval.mode)")
+	cmd.Flags().Float64VarP(&o.minScore, "min-score", "", 0, "drop retrieved chunks scoring below this similarity, between 0 and 1 (overrides retrieval.min_score)")
+	cmd.Flags().BoolVarP(&o.summarize, "summarize", "", false, "summarize each retrieved chunk with the LLM first and answer from the summaries")
+	cmd.Flags().IntVarP(&o.summarizeThreshold, "summarize-threshold", "", defaultSummarizeThreshold, "retrieved context size in characters above which --summarize applies")
+	cmd.Flags().BoolVarP(&o.noStream, "no-stream", "", false, "wait for the complete answer and print it at once instead of streaming it")
+	cmd.Flags().BoolVarP(&o.raw, "raw", "", false, "print the model output exactly as received, without a trailing newline")
+	cmd.Flags().BoolVarP(&o.printChunks, "print-chunks", "", false, "print each chunk with its source and index to stderr before embedding")
+	cmd.Flags().IntVarP(&o.maxPrint, "max-print", "", defaultMaxPrintChunks, "maximum number of chunks printed by --print-chunks (0 for all)")
+	cmd.Flags().IntVarP(&o.llmOptions.maxChunks, "max-chunks", "", 0, "embed at most this many chunks, taken in file order, to sample a large corpus (0 for all)")
+	cmd.Flags().StringArrayVarP(&o.llmOptions.excludeContent, "exclude-content", "", nil, "drop chunks whose content matches this regex before embedding (repeatable)")
+	cmd.Flags().BoolVarP(&o.llmOptions.sanitizeUTF8, "sanitize-utf8", "", false, "replace invalid UTF-8 sequences instead of skipping the file (overrides embedding.sanitize_utf8)")
+	cmd.Flags().StringArrayVarP(&o.rawContext, "raw-context", "", nil, "answer from the content of this file as is, without embedding or retrieval (use - for stdin; repeatable)")
+	cmd.Flags().StringVarP(&o.llmOptions.dbPath, "db-path", "", "", "keep the embeddings in this vector database file, re-embedding only the files changed since the last run")
+	cmd.Flags().BoolVarP(&o.llmOptions.prune, "prune", "", false, "remove the stored chunks of files under the given paths that no longer exist (requires --db-path)")
+	cmd.Flags().StringVarP(&o.pathsFrom, "paths-from", "", "", "read newline-separated paths to embed from a file (use - for stdin)")
+	cmd.Flags().BoolVarP(&o.noDaemon, "no-daemon", "", false, "answer locally even if a ragx daemon is running")
+	cmd.Flags().BoolVarP(&o.showTimings, "timings", "", false, "print how long embedding, retrieval, prompt build and generation took to stderr")
+	cmd.Flags().StringVarP(&o.sessionPath, "session", "", "", "load the chat history from a file and save it back after answering, to continue across queries")
 
 	return cmd
 }
 
 func (o *QueryOptions) normalizeArgs(args *[]string, argsBeforeDash int) error {
+	// in batch mode, all positional arguments are paths
+	if o.batch != "" {
+		if o.query != "" || argsBeforeDash != -1 {
+			return errf("a query cannot be given with --batch")
+		}
+
+		return nil
+	}
+
 	norm, err := normalizeArgs(*args, argsBeforeDash, o.query)
 	if err != nil {
 		return err
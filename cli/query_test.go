@@ -0,0 +1,1526 @@
+package cli_test
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/llm/fake"
+	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+func TestQueryOptions_RawOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  bool
+		want string
+	}{
+		{
+			name: "trailing newline by default",
+			raw:  false,
+			want: "foo bar\n",
+		},
+		{
+			name: "raw output as received",
+			raw:  true,
+			want: "foo bar",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iostreams, _, out, _ := genericclioptions.NewTestIOStreams(nil)
+			stdio := &genericclioptions.StdioOptions{IOStreams: iostreams}
+
+			o := cli.NewQueryOptions(stdio, nil)
+			o.SetRaw(tt.raw)
+
+			ch := streamOf("foo", " bar")
+
+			if err := o.PrintStream(context.Background(), ch); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := out.String(); got != tt.want {
+				t.Errorf("want output: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// streamOf returns a closed stream of the given chunks terminated by [io.EOF].
+func streamOf(chunks ...string) <-chan prompt.Chunk {
+	ch := make(chan prompt.Chunk, len(chunks)+1)
+
+	for _, c := range chunks {
+		ch <- prompt.Chunk{Content: c}
+	}
+
+	ch <- prompt.Chunk{Err: io.EOF}
+	close(ch)
+
+	return ch
+}
+
+const chatCompletionStream = `data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{"role":"assistant","content":"bar"},"finish_reason":null}]}
+
+data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`
+
+const chatCompletion = `{"id":"1","object":"chat.completion","created":0,"model":"foo","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"<think>hmm</think>\n\nbar"}}]}`
+
+// fakeLLMServer is a minimal OpenAI API compatible server
+// serving the chat model "foo" and the embedding model "bar".
+type fakeLLMServer struct {
+	*httptest.Server
+
+	// probes counts the empty input embedding requests
+	// used to detect the embedding dimension.
+	probes atomic.Int64
+
+	// chats counts the chat completion requests.
+	chats atomic.Int64
+
+	// messages holds the number of messages of the last chat completion request.
+	messages atomic.Int64
+
+	// userAgent holds the User-Agent header of the last chat completion request.
+	userAgent atomic.Value
+
+	// temperature holds the temperature of the last chat completion request, if set.
+	temperature atomic.Pointer[float64]
+
+	// queryEmbeds counts the embedding requests of a single non-empty input.
+	queryEmbeds atomic.Int64
+
+	// embedDelay holds the delay of embedding responses, in nanoseconds.
+	embedDelay atomic.Int64
+
+	// failEmbeds fails all embedding requests but the dimension probes.
+	failEmbeds atomic.Bool
+}
+
+func newFakeLLMServer(t testing.TB) *fakeLLMServer {
+	t.Helper()
+
+	var (
+		s   = &fakeLLMServer{}
+		mux = http.NewServeMux()
+	)
+
+	mux.HandleFunc("/v1/models", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"object":"list","data":[{"id":"foo","object":"model"},{"id":"bar","object":"model"}]}`)
+	})
+
+	mux.HandleFunc("/v1/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input json.RawMessage `json:"input"`
+		}
+
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		inputs := []string{}
+		if err := json.Unmarshal(req.Input, &inputs); err != nil {
+			inputs = []string{""}
+		}
+
+		switch {
+		case string(req.Input) == `""`:
+			s.probes.Add(1)
+		case bytes.HasPrefix(req.Input, []byte(`"`)):
+			s.queryEmbeds.Add(1)
+		}
+
+		time.Sleep(time.Duration(s.embedDelay.Load()))
+
+		if s.failEmbeds.Load() && string(req.Input) != `""` {
+			http.Error(w, `{"error":{"message":"embedding failed"}}`, http.StatusBadRequest)
+			return
+		}
+
+		data := make([]map[string]any, 0, len(inputs))
+		for i := range inputs {
+			data = append(data, map[string]any{"object": "embedding", "index": i, "embedding": []float64{1, float64(i)}})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"object": "list", "model": "bar", "data": data})
+	})
+
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		s.chats.Add(1)
+		s.userAgent.Store(r.UserAgent())
+
+		var req struct {
+			Messages    []json.RawMessage `json:"messages"`
+			Stream      bool              `json:"stream"`
+			Temperature *float64          `json:"temperature"`
+		}
+
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		s.messages.Store(int64(len(req.Messages)))
+		s.temperature.Store(req.Temperature)
+
+		if !req.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, chatCompletion)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, chatCompletionStream)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// writeTestConfig writes a config file pointing at the given server.
+// State, such as the embedding dim cache, is kept in a temporary directory.
+func writeTestConfig(t testing.TB, baseURL string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+
+	path := filepath.Join(dir, "config.toml")
+
+	config := fmt.Sprintf(`[llm]
+default_model = 'foo'
+
+[[llm.providers]]
+base_url = '%s/v1'
+
+[embedding]
+embedding_model = 'bar'
+
+[logging]
+log_dir = '%s'
+`, baseURL, dir)
+
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	return path
+}
+
+func TestQuery_EmbedsQueryOnce(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, data, "--query", "qux"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if got := srv.queryEmbeds.Load(); got != 1 {
+		t.Errorf("want the query embedded once, got: %d", got)
+	}
+
+	if n := srv.chats.Load(); n != 1 {
+		t.Errorf("want 1 chat completion, got: %d", n)
+	}
+}
+
+func TestQuery_IncrementalEmbedding(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		dbPath = filepath.Join(t.TempDir(), "foo.db")
+		dir    = t.TempDir()
+		a      = filepath.Join(dir, "a.md")
+		b      = filepath.Join(dir, "b.md")
+		c      = filepath.Join(dir, "c.md")
+	)
+
+	writeFile := func(path, content string) {
+		t.Helper()
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	query := func(extra ...string) {
+		t.Helper()
+
+		iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		args := append([]string{"query", "--config", config, "--db-path", dbPath, dir, "--query", "qux"}, extra...)
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, args)
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+
+	contents := func() []string {
+		t.Helper()
+
+		db, err := vecdb.Open(dbPath)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+
+		defer func() { _ = db.Close() }()
+
+		hits, err := db.SearchKNN(vecdb.Vector{1, 0}, 10)
+		if err != nil {
+			t.Fatalf("search knn: %v", err)
+		}
+
+		out := make([]string, 0, len(hits))
+		for _, h := range hits {
+			out = append(out, h.Content)
+		}
+
+		slices.Sort(out)
+
+		return out
+	}
+
+	writeFile(a, "foo")
+	writeFile(b, "bar")
+
+	query()
+
+	if got, want := contents(), []string{"bar", "foo"}; !slices.Equal(want, got) {
+		t.Fatalf("want chunks: %q, got: %q", want, got)
+	}
+
+	// an edit keeping the size and modification time goes unnoticed
+	fi, err := os.Stat(a)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	writeFile(a, "baz")
+
+	if err := os.Chtimes(a, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	query()
+
+	if got, want := contents(), []string{"bar", "foo"}; !slices.Equal(want, got) {
+		t.Fatalf("unchanged: want chunks: %q, got: %q", want, got)
+	}
+
+	// a change of the chunking config embeds the files again
+	query("--set", "embedding.chunk_size=1000")
+
+	if got, want := contents(), []string{"bar", "baz"}; !slices.Equal(want, got) {
+		t.Fatalf("chunking changed: want chunks: %q, got: %q", want, got)
+	}
+
+	writeFile(a, "foo bar")
+	writeFile(c, "qux")
+
+	if err := os.Remove(b); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	query()
+
+	if got, want := contents(), []string{"bar", "foo bar", "qux"}; !slices.Equal(want, got) {
+		t.Fatalf("changed: want chunks: %q, got: %q", want, got)
+	}
+
+	query("--prune")
+
+	if got, want := contents(), []string{"foo bar", "qux"}; !slices.Equal(want, got) {
+		t.Fatalf("pruned: want chunks: %q, got: %q", want, got)
+	}
+
+	// a changed file that fails to embed keeps its old chunks
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	writeFile(a, "foo bar baz")
+	srv.failEmbeds.Store(true)
+
+	iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, "--db-path", dbPath, dir, "--query", "qux"})
+	cmd.SilenceErrors = true
+
+	if err := cmd.ExecuteContext(context.Background()); err == nil {
+		t.Fatal("want an error when embedding fails")
+	}
+
+	if got, want := contents(), []string{"foo bar", "qux"}; !slices.Equal(want, got) {
+		t.Fatalf("failed embedding: want chunks: %q, got: %q", want, got)
+	}
+}
+
+func TestQuery_PruneWithoutDBPath(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+	)
+
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, t.TempDir(), "--query", "qux", "--prune"})
+	cmd.SilenceErrors = true
+
+	if err := cmd.ExecuteContext(context.Background()); !errors.Is(err, cli.ErrPruneWithoutDBPath) {
+		t.Errorf("want error: %v, got: %v", cli.ErrPruneWithoutDBPath, err)
+	}
+}
+
+// BenchmarkQuery measures a query over a small corpus served with
+// embedding latency, which embedding the query concurrently with the
+// corpus hides.
+func BenchmarkQuery(b *testing.B) {
+	srv := newFakeLLMServer(b)
+	srv.embedDelay.Store(int64(20 * time.Millisecond))
+
+	var (
+		config = writeTestConfig(b, srv.URL)
+		data   = filepath.Join(b.TempDir(), "data.md")
+	)
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		b.Fatalf("write data: %v", err)
+	}
+
+	for b.Loop() {
+		iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, data, "--query", "qux"})
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			b.Fatalf("execute: %v", err)
+		}
+	}
+}
+
+func pipedStdin(s string) *genericclioptions.TestFdReader {
+	fi := genericclioptions.NewMockFileInfo("stdin", int64(len(s)), 0, false, time.Time{})
+	return genericclioptions.NewTestFdReader(bytes.NewBufferString(s), 0, fi)
+}
+
+func ttyStdin() *genericclioptions.TestFdReader {
+	fi := genericclioptions.NewMockFileInfo("stdin", 0, os.ModeCharDevice, false, time.Time{})
+	return genericclioptions.NewTestFdReader(&bytes.Buffer{}, 0, fi)
+}
+
+func TestQuery_BatchFromStdin(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	iostreams, _, out, _ := genericclioptions.NewTestIOStreams(pipedStdin("first query\n\nsecond query\nthird query\n"))
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, data, "--batch", "-"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+	want := []string{"first query", "second query", "third query"}
+	if len(lines) != len(want) {
+		t.Fatalf("want %d result lines, got %d: %q", len(want), len(lines), out.String())
+	}
+
+	for i, line := range lines {
+		var res cli.QueryResult
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatalf("line %d: unmarshal: %v", i+1, err)
+		}
+
+		if res.Query != want[i] {
+			t.Errorf("line %d: want query: %q, got: %q", i+1, want[i], res.Query)
+		}
+
+		if res.Answer != "bar" {
+			t.Errorf("line %d: want answer: %q, got: %q", i+1, "bar", res.Answer)
+		}
+
+		if len(res.Chunks) == 0 {
+			t.Errorf("line %d: want retrieved chunks, got none", i+1)
+		}
+	}
+}
+
+func TestQuery_BatchFromStdinRequiresPaths(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+	)
+
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	iostreams, _, _, _ := genericclioptions.NewTestIOStreams(pipedStdin("foo\n"))
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, "--batch", "-"})
+	cmd.SilenceErrors = true
+
+	err := cmd.ExecuteContext(context.Background())
+	if !errors.Is(err, cli.ErrBatchStdinNeedsPaths) {
+		t.Errorf("want error: %v, got: %v", cli.ErrBatchStdinNeedsPaths, err)
+	}
+}
+
+func TestQuery_ShowMessages(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	run := func(t *testing.T, args ...string) string {
+		t.Helper()
+
+		iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		args = append([]string{"query", "--config", config, data, "--show-messages", "-q", "qux"}, args...)
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, args)
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		return out.String()
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var messages []cli.Message
+		if err := json.Unmarshal([]byte(run(t, "-o", "json")), &messages); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+
+		if len(messages) != 2 {
+			t.Fatalf("want 2 messages, got: %+v", messages)
+		}
+
+		if messages[0].Role != "system" || messages[0].Content != prompt.DefaultSystemPrompt {
+			t.Errorf("want the default system prompt first, got: %+v", messages[0])
+		}
+
+		if messages[1].Role != "user" || !strings.HasPrefix(messages[1].Content, "USER QUERY:\nqux") {
+			t.Errorf("want the user prompt second, got: %+v", messages[1])
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		out := run(t)
+
+		system, user := strings.Index(out, "=== system ==="), strings.Index(out, "=== user ===")
+		if system != 0 || user <= system {
+			t.Errorf("want the system message before the user message, got:\n%s", out)
+		}
+
+		if !strings.Contains(out, "TEXT: foo bar baz") {
+			t.Errorf("want the retrieved context in the user message, got:\n%s", out)
+		}
+	})
+
+	// an empty --system keeps the default system prompt
+	for _, system := range []string{"answer in one sentence", ""} {
+		t.Run("system "+system, func(t *testing.T) {
+			var messages []cli.Message
+			if err := json.Unmarshal([]byte(run(t, "-o", "json", "--system", system)), &messages); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+
+			want := cmp.Or(system, prompt.DefaultSystemPrompt)
+
+			if len(messages) != 2 || messages[0].Role != "system" || messages[0].Content != want {
+				t.Errorf("want the system prompt %q first, got: %+v", want, messages)
+			}
+		})
+	}
+}
+
+func TestQuery_NoContextMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  *genericclioptions.TestFdReader
+		output func(out string) (answer string)
+	}{
+		{
+			name:   "text",
+			args:   []string{"-q", "what is foo?"},
+			stdin:  ttyStdin(),
+			output: func(out string) string { return strings.TrimSuffix(out, "\n") },
+		},
+		{
+			name:  "batch",
+			args:  []string{"--batch", "-"},
+			stdin: pipedStdin("what is foo?\n"),
+			output: func(out string) string {
+				var res cli.QueryResult
+				_ = json.Unmarshal([]byte(out), &res)
+
+				return res.Answer
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				srv    = newFakeLLMServer(t)
+				config = writeTestConfig(t, srv.URL)
+				data   = filepath.Join(t.TempDir(), "empty.md")
+			)
+
+			f, err := os.OpenFile(config, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatalf("open config: %v", err)
+			}
+
+			_, err = f.WriteString("\n[output]\nno_context_message = 'Nothing about that in your notes.'\n")
+			_ = f.Close()
+
+			if err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+
+			// an empty file retrieves no chunks
+			if err := os.WriteFile(data, nil, 0o600); err != nil {
+				t.Fatalf("write data: %v", err)
+			}
+
+			iostreams, _, out, _ := genericclioptions.NewTestIOStreams(tt.stdin)
+
+			args := append([]string{"query", "--config", config, data}, tt.args...)
+
+			cmd := cli.NewDefaultRAGCommand(iostreams, args)
+			if err := cmd.ExecuteContext(context.Background()); err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+
+			if got, want := tt.output(out.String()), "Nothing about that in your notes."; got != want {
+				t.Errorf("want answer: %q, got: %q", want, got)
+			}
+
+			if n := srv.chats.Load(); n != 0 {
+				t.Errorf("want no chat requests, got: %d", n)
+			}
+		})
+	}
+}
+
+func TestNoContextAnswer(t *testing.T) {
+	hits := []vecdb.SearchResult{{Distance: 0.8}, {Distance: 1.2}}
+
+	tests := []struct {
+		name   string
+		cfg    types.OutputConfig
+		hits   []vecdb.SearchResult
+		wantOK bool
+	}{
+		{name: "no message configured", hits: nil, wantOK: false},
+		{name: "no hits", cfg: types.OutputConfig{NoContextMessage: "n/a"}, hits: nil, wantOK: true},
+		{name: "any hit is relevant without a max distance", cfg: types.OutputConfig{NoContextMessage: "n/a"}, hits: hits, wantOK: false},
+		{name: "a hit within the max distance", cfg: types.OutputConfig{NoContextMessage: "n/a", NoContextMaxDistance: 1}, hits: hits, wantOK: false},
+		{name: "all hits beyond the max distance", cfg: types.OutputConfig{NoContextMessage: "n/a", NoContextMaxDistance: 0.5}, hits: hits, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, ok := cli.NoContextAnswer(tt.cfg, tt.hits)
+			if ok != tt.wantOK {
+				t.Fatalf("want ok: %v, got: %v", tt.wantOK, ok)
+			}
+
+			if ok && msg != tt.cfg.NoContextMessage {
+				t.Errorf("want message: %q, got: %q", tt.cfg.NoContextMessage, msg)
+			}
+		})
+	}
+}
+
+func TestQueryOptions_WhitespaceAfterReasoning(t *testing.T) {
+	iostreams, _, out, _ := genericclioptions.NewTestIOStreams(nil)
+	stdio := &genericclioptions.StdioOptions{IOStreams: iostreams}
+
+	o := cli.NewQueryOptions(stdio, nil)
+	o.SetRaw(true)
+
+	ch := streamOf("<think>", "hmm", "</think>", "\n", "\n\n", " ", "foo", "\n", "bar")
+
+	if err := o.PrintStream(context.Background(), ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := "foo\nbar", out.String(); got != want {
+		t.Errorf("want output: %q, got: %q", want, got)
+	}
+}
+
+func TestQueryOptions_SplitReasoningTags(t *testing.T) {
+	iostreams, _, out, _ := genericclioptions.NewTestIOStreams(nil)
+	stdio := &genericclioptions.StdioOptions{IOStreams: iostreams}
+
+	o := cli.NewQueryOptions(stdio, nil)
+	o.SetRaw(true)
+
+	ch := streamOf("<th", "ink>hm", "m</th", "ink>\n", "\nfoo <", "b>")
+
+	if err := o.PrintStream(context.Background(), ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := "foo <b>", out.String(); got != want {
+		t.Errorf("want output: %q, got: %q", want, got)
+	}
+}
+
+func TestQueryOptions_SeparateReasoning(t *testing.T) {
+	iostreams, _, out, _ := genericclioptions.NewTestIOStreams(nil)
+	stdio := &genericclioptions.StdioOptions{IOStreams: iostreams}
+
+	o := cli.NewQueryOptions(stdio, nil)
+	o.SetRaw(true)
+
+	ch := make(chan prompt.Chunk, 5)
+	for _, c := range []prompt.Chunk{{Reasoning: "hmm"}, {Reasoning: " ok"}, {Content: "\n\n"}, {Content: "foo"}, {Err: io.EOF}} {
+		ch <- c
+	}
+
+	close(ch)
+
+	if err := o.PrintStream(context.Background(), ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := "foo", out.String(); got != want {
+		t.Errorf("want output: %q, got: %q", want, got)
+	}
+}
+
+func TestQuery_IndexPaths(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	enableIndexPaths(t, config)
+
+	if err := os.WriteFile(data, []byte("foo"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, data, "--show-messages", "-q", "where is data.md?"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	for _, want := range []string{"TEXT: foo", "TEXT: file: data.md"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("want %q in the retrieved context, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestQuery_Session(t *testing.T) {
+	var (
+		srv     = newFakeLLMServer(t)
+		config  = writeTestConfig(t, srv.URL)
+		dir     = t.TempDir()
+		data    = filepath.Join(dir, "data.md")
+		session = filepath.Join(dir, "session.json")
+	)
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	run := func(t *testing.T, query string) {
+		t.Helper()
+
+		iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, data, "--session", session, "-q", query})
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+
+	run(t, "first query")
+
+	// system and user messages
+	if got := srv.messages.Load(); got != 2 {
+		t.Fatalf("want 2 messages in the first request, got: %d", got)
+	}
+
+	run(t, "second query")
+
+	// system, the prior user and assistant turn, and the new user message
+	if got := srv.messages.Load(); got != 4 {
+		t.Errorf("want 4 messages in the second request, got: %d", got)
+	}
+
+	b, err := os.ReadFile(session)
+	if err != nil {
+		t.Fatalf("read session: %v", err)
+	}
+
+	var history []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+
+	if err := json.Unmarshal(b, &history); err != nil {
+		t.Fatalf("unmarshal session: %v", err)
+	}
+
+	if len(history) != 4 {
+		t.Fatalf("want 4 messages in the session, got: %+v", history)
+	}
+
+	if history[0].Role != "user" || !strings.Contains(history[0].Content, "first query") {
+		t.Errorf("want the first query in the history, got: %+v", history[0])
+	}
+
+	if history[1].Role != "assistant" || history[1].Content != "bar" {
+		t.Errorf("want the first answer in the history, got: %+v", history[1])
+	}
+}
+
+func TestQuery_PathsFrom(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		dir    = t.TempDir()
+		list   = filepath.Join(dir, "paths.txt")
+	)
+
+	for name, content := range map[string]string{"foo.md": "foo content", "bar.md": "bar content", "baz.md": "baz content"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	paths := strings.Join([]string{
+		filepath.Join(dir, "foo.md"),
+		"",
+		filepath.Join(dir, "bar.md"),
+		filepath.Join(dir, "missing.md"),
+	}, "\n")
+
+	if err := os.WriteFile(list, []byte(paths), 0o600); err != nil {
+		t.Fatalf("write paths: %v", err)
+	}
+
+	iostreams, _, out, errOut := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, "--paths-from", list, "--dry-run", "-q", "qux"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	for _, want := range []string{"TEXT: foo content", "TEXT: bar content"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("want %q in the prompt, got:\n%s", want, out.String())
+		}
+	}
+
+	if strings.Contains(out.String(), "baz content") {
+		t.Errorf("want only the listed files embedded, got:\n%s", out.String())
+	}
+
+	if !strings.Contains(errOut.String(), "missing.md") {
+		t.Errorf("want a warning about the missing path, got: %q", errOut.String())
+	}
+}
+
+func TestQuery_DryRunPreview(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	f, err := os.OpenFile(config, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("open config: %v", err)
+	}
+
+	if _, err := io.WriteString(f, "\n[[llm.models]]\nid = 'foo'\nprice_in = 1.0\n"); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("close config: %v", err)
+	}
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	iostreams, _, out, errOut := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, "--dry-run", "-q", "qux", data})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if strings.Contains(out.String(), "dry run:") {
+		t.Errorf("want the prompt only on stdout, got:\n%s", out.String())
+	}
+
+	for _, want := range []string{"dry run: ~", "1 chunks from 1 sources, ~$", "sources: " + data} {
+		if !strings.Contains(errOut.String(), want) {
+			t.Errorf("want %q in the preview, got:\n%s", want, errOut.String())
+		}
+	}
+}
+
+func TestQuery_NoStream(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	run := func(t *testing.T, args ...string) string {
+		t.Helper()
+
+		iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		args = append([]string{"query", "--config", config, data, "--no-stream", "-q", "qux"}, args...)
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, args)
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		return out.String()
+	}
+
+	t.Run("text", func(t *testing.T) {
+		if got := run(t); got != "bar\n" {
+			t.Errorf("want answer: %q, got: %q", "bar\n", got)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var res cli.QueryResult
+		if err := json.Unmarshal([]byte(run(t, "-o", "json")), &res); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+
+		if res.Answer != "bar" {
+			t.Errorf("want answer: %q, got: %q", "bar", res.Answer)
+		}
+	})
+}
+
+func TestQuery_Timings(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	run := func(t *testing.T, args ...string) (string, string) {
+		t.Helper()
+
+		iostreams, _, out, errOut := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, append([]string{"query", "--config", config, data, "-q", "qux"}, args...))
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		return out.String(), errOut.String()
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		out, errOut := run(t, "--timings")
+
+		if strings.Contains(out, "timing:") {
+			t.Errorf("want timings on stderr only, got stdout: %q", out)
+		}
+
+		var got []string
+
+		for line := range strings.Lines(errOut) {
+			if rest, ok := strings.CutPrefix(line, "timing: "); ok {
+				fields := strings.Fields(rest) // the phase, then its duration
+				got = append(got, strings.Join(fields[:len(fields)-1], " "))
+			}
+		}
+
+		if want := []string{"embedding", "retrieval", "prompt build", "first token", "generation"}; !slices.Equal(want, got) {
+			t.Errorf("want timed phases: %q, got: %q\n%s", want, got, errOut)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		if _, errOut := run(t); strings.Contains(errOut, "timing:") {
+			t.Errorf("want no timings without --timings, got: %q", errOut)
+		}
+	})
+}
+
+func TestQuery_UserAgent(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, data, "-q", "qux"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if got, want := srv.userAgent.Load(), "ragx/"+cli.Version; got != want {
+		t.Errorf("want user agent: %q, got: %q", want, got)
+	}
+}
+
+func TestQuery_TLS(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		tlsSrv = httptest.NewTLSServer(srv.Config.Handler)
+		dir    = t.TempDir()
+		data   = filepath.Join(dir, "data.md")
+	)
+
+	t.Cleanup(tlsSrv.Close)
+	t.Setenv("XDG_STATE_HOME", dir)
+
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsSrv.Certificate().Raw})
+	if err := os.WriteFile(filepath.Join(dir, "ca.pem"), ca, 0o600); err != nil {
+		t.Fatalf("write ca: %v", err)
+	}
+
+	if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		provider    string
+		wantErr     bool
+		wantWarning bool
+	}{
+		{name: "untrusted", wantErr: true},
+		{name: "ca file", provider: "ca_file = 'ca.pem'"},
+		{name: "insecure skip verify", provider: "insecure_skip_verify = true", wantWarning: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := filepath.Join(dir, "config.toml")
+
+			content := fmt.Sprintf(`[llm]
+default_model = 'foo'
+
+[[llm.providers]]
+base_url = '%s/v1'
+%s
+
+[embedding]
+embedding_model = 'bar'
+
+[logging]
+log_dir = '%s'
+`, tlsSrv.URL, tt.provider, dir)
+
+			if err := os.WriteFile(config, []byte(content), 0o600); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+
+			iostreams, _, _, errOut := genericclioptions.NewTestIOStreams(ttyStdin())
+
+			cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, data, "-q", "qux"})
+			cmd.SilenceErrors = true
+
+			if err := cmd.ExecuteContext(context.Background()); (err != nil) != tt.wantErr {
+				t.Fatalf("want error: %t, got: %v", tt.wantErr, err)
+			}
+
+			if got := strings.Contains(errOut.String(), "warning: TLS certificate verification is disabled"); got != tt.wantWarning {
+				t.Errorf("want warning: %t, got stderr:\n%s", tt.wantWarning, errOut.String())
+			}
+		})
+	}
+}
+
+func TestQuery_RawContext(t *testing.T) {
+	var (
+		srv     = newFakeLLMServer(t)
+		config  = writeTestConfig(t, srv.URL)
+		snippet = filepath.Join(t.TempDir(), "snippet.go")
+	)
+
+	if err := os.WriteFile(snippet, []byte("func foo() {}"), 0o600); err != nil {
+		t.Fatalf("write snippet: %v", err)
+	}
+
+	t.Run("sent as context without embedding", func(t *testing.T) {
+		iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, "--raw-context", snippet, "--dry-run", "-q", "qux"})
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		want := "CHUNK id=0 source=" + snippet + "\nTEXT: func foo() {}"
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("want %q in the prompt, got:\n%s", want, out.String())
+		}
+
+		if n := srv.probes.Load(); n != 0 {
+			t.Errorf("want no embedding dimension probes, got: %d", n)
+		}
+	})
+
+	t.Run("conflicts with paths", func(t *testing.T) {
+		clierror.SetErrorHandler(clierror.PrintErrHandler)
+		clierror.SetErrWriter(io.Discard)
+
+		t.Cleanup(func() {
+			clierror.ResetErrorHandler()
+			clierror.ResetErrWriter()
+		})
+
+		iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, "--raw-context", snippet, snippet, "-q", "qux"})
+		cmd.SilenceErrors = true
+
+		if err := cmd.ExecuteContext(context.Background()); !errors.Is(err, cli.ErrRawContextWithInput) {
+			t.Errorf("want error: %v, got: %v", cli.ErrRawContextWithInput, err)
+		}
+	})
+}
+
+func TestQuery_TopK(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		doc    = filepath.Join(t.TempDir(), "doc.md")
+	)
+
+	if err := os.WriteFile(doc, []byte("foo bar baz"), 0o600); err != nil {
+		t.Fatalf("write doc: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		topK       string
+		wantChunks bool
+	}{
+		{name: "retrieves chunks", topK: "1", wantChunks: true},
+		{name: "zero disables retrieval", topK: "0", wantChunks: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+			cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, "--top-k", tt.topK, "--dry-run", "-q", "qux", doc})
+			if err := cmd.ExecuteContext(context.Background()); err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+
+			if got := strings.Contains(out.String(), "CHUNK id="); got != tt.wantChunks {
+				t.Errorf("want chunks in the prompt: %t, got:\n%s", tt.wantChunks, out.String())
+			}
+		})
+	}
+
+	t.Run("negative", func(t *testing.T) {
+		clierror.SetErrorHandler(clierror.PrintErrHandler)
+		clierror.SetErrWriter(io.Discard)
+
+		t.Cleanup(func() {
+			clierror.ResetErrorHandler()
+			clierror.ResetErrWriter()
+		})
+
+		iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, "--top-k", "-1", "--dry-run", "-q", "qux", doc})
+		cmd.SilenceErrors = true
+
+		if err := cmd.ExecuteContext(context.Background()); err == nil {
+			t.Error("want error for a negative top-k")
+		}
+	})
+}
+
+func TestQuery_MaxChunks(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		dir    = t.TempDir()
+	)
+
+	for _, name := range []string{"a.md", "b.md", "c.md"} {
+		content := strings.Repeat("foo bar qu", 3) // 3 chunks of 10 characters
+
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{
+		"query", "--config", config,
+		"--set", "embedding.chunk_size=10", "--set", "embedding.overlap=0",
+		"--max-chunks", "4", "--top-k", "100", "--dry-run", "-q", "qux", dir,
+	})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	// every stored chunk is retrieved, so the prompt lists the database content
+	counts := map[string]int{}
+
+	for line := range strings.Lines(out.String()) {
+		if _, source, ok := strings.Cut(line, "CHUNK id="); ok {
+			_, source, _ = strings.Cut(source, "source=")
+			counts[filepath.Base(strings.TrimSpace(source))]++
+		}
+	}
+
+	want := map[string]int{"a.md": 3, "b.md": 1}
+	if !maps.Equal(want, counts) {
+		t.Errorf("want chunks per source: %v, got: %v", want, counts)
+	}
+}
+
+func TestQuery_ExcludeContent(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		data   = filepath.Join(t.TempDir(), "data.md")
+	)
+
+	// 4 chunks of 10 characters, two of them holding a generated blob
+	if err := os.WriteFile(data, []byte("foo bar quAAAA/BBB/=keep this.BASE64/==="), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{
+		"query", "--config", config,
+		"--set", "embedding.chunk_size=10", "--set", "embedding.overlap=0",
+		"--exclude-content", `[A-Z]{4}`, "--exclude-content", `={2,}`,
+		"--top-k", "100", "--dry-run", "-q", "qux", data,
+	})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	// every stored chunk is retrieved, so the prompt lists the database content
+	var got []string
+
+	for line := range strings.Lines(out.String()) {
+		if text, ok := strings.CutPrefix(line, "TEXT: "); ok {
+			got = append(got, strings.TrimSpace(text))
+		}
+	}
+
+	slices.Sort(got)
+
+	if want := []string{"foo bar qu", "keep this."}; !slices.Equal(want, got) {
+		t.Errorf("want embedded chunks: %q, got: %q", want, got)
+	}
+}
+
+func TestQuery_NormalizeMarkup(t *testing.T) {
+	var (
+		backend = &fake.Backend{Models: []string{"foo", "bar"}}
+		config  = writeTestConfig(t, "http://127.0.0.1:0")
+		dir     = writeTree(t, map[string]string{
+			"doc.md":    "# Foo &amp; bar\n\nSee <b>the</b> [docs](http://foo).\n",
+			"page.html": "<p>Tom &amp; Jerry</p>",
+			"notes.txt": "a &amp; <b>b</b>",
+		})
+	)
+
+	cli.UseBackend(t, backend)
+
+	iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{
+		"query", "--config", config,
+		"--set", "embedding.chunk_size=1000", "--set", "embedding.decode_entities=true", "--set", "embedding.strip_markup=true",
+		"--top-k", "100", "--dry-run", "-q", "qux", dir,
+	})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	embedded := backend.Embedded()
+
+	// only HTML and markdown files are normalized
+	for _, want := range []string{"Foo & bar\n\nSee the docs.\n", "Tom & Jerry", "a &amp; <b>b</b>"} {
+		if !slices.Contains(embedded, want) {
+			t.Errorf("want %q embedded, got: %q", want, embedded)
+		}
+	}
+
+	// the chunks are shown as is
+	for _, want := range []string{"TEXT: # Foo &amp; bar", "TEXT: <p>Tom &amp; Jerry</p>"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("want %q in the prompt, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestQuery_SanitizeUTF8(t *testing.T) {
+	var (
+		config = writeTestConfig(t, "http://127.0.0.1:0")
+		dir    = writeTree(t, map[string]string{
+			"app.log": "foo \xff\xfe bar",
+			"bin.dat": "foo \x00 bar",
+			"ok.txt":  "baz",
+		})
+	)
+
+	run := func(t *testing.T, args ...string) []string {
+		t.Helper()
+
+		backend := &fake.Backend{Models: []string{"foo", "bar"}}
+		cli.UseBackend(t, backend)
+
+		iostreams := genericclioptions.NewTestIOStreamsDiscard(ttyStdin())
+
+		args = append([]string{"query", "--config", config, "--top-k", "100", "--dry-run", "-q", "qux", dir}, args...)
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, args)
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		return backend.Embedded()
+	}
+
+	t.Run("sanitized", func(t *testing.T) {
+		embedded := run(t, "--sanitize-utf8")
+
+		if want := "foo \uFFFD bar"; !slices.Contains(embedded, want) {
+			t.Errorf("want %q embedded, got: %q", want, embedded)
+		}
+
+		if slices.ContainsFunc(embedded, func(s string) bool { return strings.Contains(s, "\x00") }) {
+			t.Errorf("want the binary file skipped, got: %q", embedded)
+		}
+	})
+
+	t.Run("strict by default", func(t *testing.T) {
+		if embedded := run(t); slices.ContainsFunc(embedded, func(s string) bool { return strings.Contains(s, "foo") }) {
+			t.Errorf("want the invalid file skipped, got: %q", embedded)
+		}
+	})
+}
+
+func TestQuery_Temperature(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want *float64
+	}{
+		{name: "zero", args: []string{"--temp", "0"}, want: ptr(0.0)},
+		{name: "set", args: []string{"--temp", "0.5"}, want: ptr(0.5)},
+		{name: "unset", args: nil, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				srv    = newFakeLLMServer(t)
+				config = writeTestConfig(t, srv.URL)
+				data   = filepath.Join(t.TempDir(), "data.md")
+			)
+
+			if err := os.WriteFile(data, []byte("foo bar baz"), 0o600); err != nil {
+				t.Fatalf("write data: %v", err)
+			}
+
+			iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+			args := append([]string{"query", "--config", config, data, "-q", "qux"}, tt.args...)
+
+			cmd := cli.NewDefaultRAGCommand(iostreams, args)
+			if err := cmd.ExecuteContext(context.Background()); err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+
+			got := srv.temperature.Load()
+
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("want no temperature sent, got: %v", *got)
+			case tt.want != nil && (got == nil || *got != *tt.want):
+				t.Errorf("want temperature: %v, got: %v", *tt.want, got)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// TestQuery_Golden drives the query pipeline against an in-memory backend
+// and compares the user prompt sent to the model with a golden file.
+func TestQuery_Golden(t *testing.T) {
+	const reply = "Set it in foo.toml [0]."
+
+	var (
+		backend = &fake.Backend{
+			Models: []string{"foo", "bar"},
+			Reply:  func(string) string { return reply },
+		}
+		config = writeTestConfig(t, "http://127.0.0.1:0")
+		dir    = t.TempDir()
+		golden = filepath.Join("testdata", "query_prompt.golden")
+	)
+
+	cli.UseBackend(t, backend)
+
+	for name, content := range map[string]string{
+		"a.md": "foo is configured in foo.toml",
+		"b.md": "bar handles unrelated requests",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"query", "--config", config, dir, "-q", "how do I configure foo?"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if got, want := out.String(), reply+"\n"; got != want {
+		t.Errorf("want streamed output: %q, got: %q", want, got)
+	}
+
+	requests := backend.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("want 1 chat request, got: %d", len(requests))
+	}
+
+	if got, want := requests[0].Model, "foo"; got != want {
+		t.Errorf("want model %q, got %q", want, got)
+	}
+
+	got := strings.ReplaceAll(requests[0].Prompt, dir, "$DIR") + "\n"
+
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o600); err != nil {
+			t.Fatalf("update golden: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+
+	if got != string(want) {
+		t.Errorf("user prompt mismatch (-want +got):\n-%s\n+%s", want, got)
+	}
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+
+	"github.com/spf13/cobra"
+)
+
+type ReindexOptions struct {
+	*genericclioptions.StdioOptions
+	llmOptions *llmOptions
+
+	pathsFrom string
+}
+
+var _ genericclioptions.CmdOptions = &ReindexOptions{}
+
+// NewReindexOptions initializes the options struct.
+func NewReindexOptions(stdio *genericclioptions.StdioOptions, llmOptions *llmOptions) *ReindexOptions {
+	return &ReindexOptions{
+		StdioOptions: stdio,
+		llmOptions:   llmOptions,
+	}
+}
+
+func (*ReindexOptions) Complete() error { return nil }
+
+func (*ReindexOptions) Validate() error { return nil }
+
+func (o *ReindexOptions) Run(ctx context.Context, args ...string) error {
+	// listed files that no longer exist are kept, so that their chunks are removed
+	if o.pathsFrom != "" {
+		paths, err := readPathList(o.pathsFrom, o.In)
+		if err != nil {
+			return err
+		}
+
+		args = append(args, paths...)
+	}
+
+	for _, path := range args {
+		if err := o.reindex(ctx, path); err != nil {
+			return errf("reindex %q: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// reindex replaces the stored chunks of the file at path with freshly
+// embedded ones. If the file no longer exists, its chunks are only removed.
+func (o *ReindexOptions) reindex(ctx context.Context, path string) error {
+	source, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("abs: %w", err)
+	}
+
+	fi, err := os.Stat(source)
+	if errors.Is(err, fs.ErrNotExist) {
+		n, err := o.llmOptions.vectordb.DeleteBySource(source)
+		if err != nil {
+			return err
+		}
+
+		o.Printf("%s: removed %d chunks (file no longer exists)\n", source, n)
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		return errors.New("is a directory; reindex expects files")
+	}
+
+	// the old chunks are replaced only once the new ones are embedded,
+	// so that an unreadable file or a failed embedding keeps them
+	cf, err := chunkFile(source, o.llmOptions.embeddingConfig)
+	if err != nil {
+		return err
+	}
+
+	n, err := o.llmOptions.replaceData(ctx, o.Logger, cf, nil)
+	if err != nil {
+		return fmt.Errorf("embed: %w", err)
+	}
+
+	added := len(cf.chunks)
+
+	if o.llmOptions.embeddingConfig.IndexPaths {
+		m, err := o.llmOptions.replaceData(ctx, o.Logger, pathChunks(source), nil)
+		if err != nil {
+			return fmt.Errorf("embed path: %w", err)
+		}
+
+		n += m
+		added++
+	}
+
+	o.Printf("%s: removed %d, added %d chunks\n", source, n, added)
+
+	return nil
+}
+
+// NewCmdReindex creates the reindex cobra command.
+func NewCmdReindex(defaults *DefaultRAGOptions) *cobra.Command {
+	o := NewReindexOptions(
+		defaults.StdioOptions,
+		defaults.llmOptions,
+	)
+
+	cmd := &cobra.Command{
+		Use:   "reindex [file]... --db-path <file>",
+		Short: "Re-embed files in a vector database",
+		Long: `Replaces the stored chunks of one or more files in a persistent vector database
+with freshly embedded ones, without rebuilding the whole database.
+
+Files that no longer exist have their chunks removed.
+
+With --paths-from, files are also read one per line from a file, or from stdin
+when given "-", e.g. the files changed by a commit.`,
+		Example: `  # re-embed a single edited file
+  ragx reindex docs/usage.md --db-path foo.db
+
+  # re-embed the files changed by the last commit
+  git diff --name-only HEAD~1 | ragx reindex --paths-from - --db-path foo.db`,
+		Args: func(_ *cobra.Command, args []string) error {
+			if len(args) == 0 && o.pathsFrom == "" {
+				return errors.New("requires at least 1 file or --paths-from")
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return clierror.Check(genericclioptions.ExecuteCommand(cmd.Context(), o, args...))
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.llmOptions.dbPath, "db-path", "", "", "path to the vector database file")
+	cmd.Flags().StringVarP(&o.pathsFrom, "paths-from", "", "", "read newline-separated files to re-embed from a file (use - for stdin)")
+
+	_ = cmd.MarkFlagRequired("db-path")
+
+	hiddenFlags := []string{
+		"dim",
+		"topk",
+		"match",
+		"model",
+		"temp",
+		"context",
+		"system",
+		"keep-alive",
+	}
+
+	genericclioptions.MarkFlagsHidden(cmd, hiddenFlags...)
+
+	return cmd
+}
@@ -0,0 +1,375 @@
+package cli_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+func TestReindex(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		dir    = t.TempDir()
+		dbPath = filepath.Join(dir, "foo.db")
+		a      = filepath.Join(dir, "a.md")
+		b      = filepath.Join(dir, "b.md")
+	)
+
+	writeFile := func(path, content string) {
+		t.Helper()
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	reindex := func(paths ...string) {
+		t.Helper()
+
+		iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		args := append([]string{"reindex", "--config", config, "--db-path", dbPath}, paths...)
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, args)
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+
+	contents := func() []string {
+		t.Helper()
+
+		db, err := vecdb.Open(dbPath)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+
+		defer func() { _ = db.Close() }()
+
+		hits, err := db.SearchKNN(vecdb.Vector{1, 0}, 10)
+		if err != nil {
+			t.Fatalf("search knn: %v", err)
+		}
+
+		out := make([]string, 0, len(hits))
+		for _, h := range hits {
+			out = append(out, h.Content)
+		}
+
+		slices.Sort(out)
+
+		return out
+	}
+
+	writeFile(a, "foo")
+	writeFile(b, "bar")
+
+	reindex(a, b)
+
+	if got, want := contents(), []string{"bar", "foo"}; !slices.Equal(want, got) {
+		t.Fatalf("want chunks: %q, got: %q", want, got)
+	}
+
+	writeFile(a, "baz")
+	reindex(a)
+
+	if got, want := contents(), []string{"bar", "baz"}; !slices.Equal(want, got) {
+		t.Fatalf("after edit: want chunks: %q, got: %q", want, got)
+	}
+
+	if err := os.Remove(a); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	reindex(a)
+
+	if got, want := contents(), []string{"bar"}; !slices.Equal(want, got) {
+		t.Fatalf("after remove: want chunks: %q, got: %q", want, got)
+	}
+}
+
+func TestReindex_EmbedFailureKeepsChunks(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		dir    = t.TempDir()
+		dbPath = filepath.Join(dir, "foo.db")
+		a      = filepath.Join(dir, "a.md")
+	)
+
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	reindex := func() error {
+		t.Helper()
+
+		iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"reindex", "--config", config, "--db-path", dbPath, a})
+		cmd.SilenceErrors = true
+
+		return cmd.ExecuteContext(context.Background())
+	}
+
+	if err := os.WriteFile(a, []byte("foo"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if err := reindex(); err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+
+	if err := os.WriteFile(a, []byte("bar"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	srv.failEmbeds.Store(true)
+
+	if err := reindex(); err == nil {
+		t.Fatal("want an error when embedding fails")
+	}
+
+	db, err := vecdb.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	defer func() { _ = db.Close() }()
+
+	hits, err := db.SearchKNN(vecdb.Vector{1, 0}, 10)
+	if err != nil {
+		t.Fatalf("search knn: %v", err)
+	}
+
+	if len(hits) != 1 || hits[0].Content != "foo" {
+		t.Errorf("want the old chunk kept, got: %+v", hits)
+	}
+}
+
+func TestReindex_EmbeddingMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		dim   int
+		model string
+	}{
+		// the fake server embeds with model "bar" at dim 2
+		{name: "dim", dim: 384, model: "bar"},
+		{name: "model", dim: 2, model: "baz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				srv    = newFakeLLMServer(t)
+				config = writeTestConfig(t, srv.URL)
+				dbPath = filepath.Join(t.TempDir(), "foo.db")
+			)
+
+			db, err := vecdb.New(tt.dim, vecdb.WithPath(dbPath), vecdb.WithModel(tt.model))
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+
+			if err := db.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+
+			clierror.SetErrorHandler(clierror.PrintErrHandler)
+			clierror.SetErrWriter(io.Discard)
+
+			t.Cleanup(func() {
+				clierror.ResetErrorHandler()
+				clierror.ResetErrWriter()
+			})
+
+			iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+			cmd := cli.NewDefaultRAGCommand(iostreams, []string{"reindex", "--config", config, "--db-path", dbPath})
+			cmd.SilenceErrors = true
+
+			err = cmd.ExecuteContext(context.Background())
+			if !errors.Is(err, cli.ErrEmbeddingMismatch) {
+				t.Fatalf("want ErrEmbeddingMismatch, got: %v", err)
+			}
+
+			for _, want := range []string{dbPath, "--db-path", "ragx reindex"} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("want error to mention %q, got: %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestReindex_PathsFrom(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		dir    = t.TempDir()
+		dbPath = filepath.Join(dir, "foo.db")
+		list   = filepath.Join(dir, "changed.txt")
+		a      = filepath.Join(dir, "a.md")
+		b      = filepath.Join(dir, "b.md")
+		c      = filepath.Join(dir, "c.md")
+	)
+
+	writeFile := func(path, content string) {
+		t.Helper()
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	reindex := func(args ...string) {
+		t.Helper()
+
+		iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		args = append([]string{"reindex", "--config", config, "--db-path", dbPath}, args...)
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, args)
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+
+	contents := func() []string {
+		t.Helper()
+
+		db, err := vecdb.Open(dbPath)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+
+		defer func() { _ = db.Close() }()
+
+		hits, err := db.SearchKNN(vecdb.Vector{1, 0}, 10)
+		if err != nil {
+			t.Fatalf("search knn: %v", err)
+		}
+
+		out := make([]string, 0, len(hits))
+		for _, h := range hits {
+			out = append(out, h.Content)
+		}
+
+		slices.Sort(out)
+
+		return out
+	}
+
+	writeFile(a, "foo")
+	writeFile(b, "bar")
+	writeFile(c, "baz")
+
+	reindex(a, b, c)
+
+	// edit all files, but list only the changed ones: a edited, c removed
+	writeFile(a, "qux")
+	writeFile(b, "quux")
+
+	if err := os.Remove(c); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	writeFile(list, a+"\n\n"+c+"\n")
+
+	reindex("--paths-from", list)
+
+	if got, want := contents(), []string{"bar", "qux"}; !slices.Equal(want, got) {
+		t.Errorf("want chunks: %q, got: %q", want, got)
+	}
+}
+
+// enableIndexPaths turns on embedding.index_paths in the test config.
+func enableIndexPaths(t *testing.T, config string) {
+	t.Helper()
+
+	b, err := os.ReadFile(config)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+
+	b = []byte(strings.Replace(string(b), "[embedding]\n", "[embedding]\nindex_paths = true\n", 1))
+
+	if err := os.WriteFile(config, b, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+}
+
+func TestReindex_IndexPaths(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+		dir    = t.TempDir()
+		dbPath = filepath.Join(dir, "foo.db")
+		data   = filepath.Join(dir, "settings", "proxy.toml")
+	)
+
+	enableIndexPaths(t, config)
+
+	if err := os.MkdirAll(filepath.Dir(data), 0o750); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	if err := os.WriteFile(data, []byte("foo"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"reindex", "--config", config, "--db-path", dbPath, data})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if !strings.Contains(out.String(), "added 2 chunks") {
+		t.Errorf("want the content and path chunks added, got: %q", out.String())
+	}
+
+	db, err := vecdb.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	defer func() { _ = db.Close() }()
+
+	hits, err := db.SearchHybrid(vecdb.Vector{1, 0}, "proxy", 1, 0)
+	if err != nil {
+		t.Fatalf("search hybrid: %v", err)
+	}
+
+	if len(hits) != 1 {
+		t.Fatalf("want a single hit, got: %+v", hits)
+	}
+
+	meta, err := vecdb.DecodeMeta(hits[0].Meta)
+	if err != nil {
+		t.Fatalf("decode meta: %v", err)
+	}
+
+	if meta.Kind != vecdb.KindPath || meta.Source != data {
+		t.Errorf("want a path chunk of %q, got: %+v", data, meta)
+	}
+
+	if !strings.Contains(hits[0].Content, "file: proxy.toml") {
+		t.Errorf("want the file name in the path chunk, got: %q", hits[0].Content)
+	}
+}
@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+
+	"github.com/spf13/cobra"
+)
+
+var ErrSelftestFailed = errors.New("selftest: some checks failed")
+
+// The selftest corpus: a made-up fact the model cannot know without
+// retrieving it, and a distractor that must not be cited for it.
+const (
+	selftestFactSource = "ragx-selftest/launch-code.md"
+	selftestFact       = "The launch code of the ragx self-test is QUOKKA-7319. It is rotated every spring."
+	selftestAnswer     = "QUOKKA-7319"
+	selftestQuery      = "What is the launch code of the ragx self-test?"
+
+	selftestDistractorSource = "ragx-selftest/weather.md"
+	selftestDistractor       = "The weather report for the harbor predicts light rain and a westerly wind."
+)
+
+type SelftestOptions struct {
+	*genericclioptions.StdioOptions
+	llmOptions *llmOptions
+}
+
+var _ genericclioptions.CmdOptions = &SelftestOptions{}
+
+// NewSelftestOptions initializes the options struct.
+func NewSelftestOptions(stdio *genericclioptions.StdioOptions, llmOptions *llmOptions) *SelftestOptions {
+	return &SelftestOptions{
+		StdioOptions: stdio,
+		llmOptions:   llmOptions,
+	}
+}
+
+func (*SelftestOptions) Complete() error { return nil }
+
+func (*SelftestOptions) Validate() error { return nil }
+
+// Run embeds the selftest corpus into an in-memory database, asks the
+// selftest query and checks that the answer is grounded in the fact.
+// A persistent database is never touched.
+func (o *SelftestOptions) Run(ctx context.Context, _ ...string) error {
+	failed := 0
+
+	report := func(ok bool, name, detail string) {
+		status := "OK"
+		if !ok {
+			status = "FAIL"
+			failed++
+		}
+
+		o.Printf("%-4s  %s: %s\n", status, name, detail)
+	}
+
+	db, err := vecdb.New(o.llmOptions.dim)
+	if err != nil {
+		return errf("create vector database: %v", err)
+	}
+
+	defer func() { _ = db.Close() }()
+
+	o.llmOptions.vectordb = db
+
+	var (
+		embedName  = "embed " + o.llmOptions.embeddingConfig.Model
+		answerName = "answer " + o.llmOptions.llmConfig.DefaultModel
+		start      = time.Now()
+	)
+
+	for _, cf := range []*dataChunks{
+		{source: selftestFactSource, chunks: []string{selftestFact}},
+		{source: selftestDistractorSource, chunks: []string{selftestDistractor}},
+	} {
+		if err := o.llmOptions.embedData(ctx, o.Logger, cf, nil); err != nil {
+			report(false, embedName, err.Error())
+			return o.summary(failed)
+		}
+	}
+
+	report(true, embedName, fmt.Sprintf("2 chunks (%s)", time.Since(start).Round(time.Millisecond)))
+
+	hits, err := o.llmOptions.retrieve(ctx, func(string) {}, selftestQuery)
+	if err != nil {
+		report(false, "retrieval", err.Error())
+		return o.summary(failed)
+	}
+
+	rank := slices.IndexFunc(hits, func(h vecdb.SearchResult) bool {
+		src, _ := prompt.DecodeMeta(h.Meta)
+		return src == selftestFactSource
+	})
+
+	if rank == -1 {
+		report(false, "retrieval", fmt.Sprintf("%s not among the %d retrieved chunks", selftestFactSource, len(hits)))
+	} else {
+		report(true, "retrieval", fmt.Sprintf("%s ranked %d of %d", selftestFactSource, rank+1, len(hits)))
+	}
+
+	answer, err := o.answer(ctx, hits)
+	if err != nil {
+		report(false, answerName, err.Error())
+		return o.summary(failed)
+	}
+
+	if strings.Contains(answer, selftestAnswer) {
+		report(true, answerName, fmt.Sprintf("contains %q", selftestAnswer))
+	} else {
+		report(false, answerName, fmt.Sprintf("missing %q: %q", selftestAnswer, answer))
+	}
+
+	citations, _ := prompt.ParseCitations(answer, hits)
+
+	i := slices.IndexFunc(citations, func(c prompt.Citation) bool { return c.Verified && c.Source == selftestFactSource })
+	if i == -1 {
+		report(false, "citation", "no verified citation of "+selftestFactSource)
+	} else {
+		c := citations[i]
+		report(true, "citation", fmt.Sprintf("[%d] (chunk %d) %s", c.Number, c.ChunkID, c.Source))
+	}
+
+	return o.summary(failed)
+}
+
+// answer asks the default model the selftest query over hits.
+func (o *SelftestOptions) answer(ctx context.Context, hits []vecdb.SearchResult) (string, error) {
+	model := o.llmOptions.llmConfig.DefaultModel
+
+	provider, err := o.llmOptions.providers.ProviderFor(model)
+	if err != nil {
+		return "", fmt.Errorf("provider for: %w", err)
+	}
+
+	p, err := prompt.BuildUserPrompt(selftestQuery, hits, prompt.DecodeMeta,
+		prompt.WithUserPromptTmpl(o.llmOptions.promptConfig.UserPromptTmpl),
+	)
+	if err != nil {
+		return "", fmt.Errorf("build user prompt: %w", err)
+	}
+
+	res, err := provider.Session.NewChat().Send(ctx, o.llmOptions.chatRequest(model, p))
+	if err != nil {
+		return "", err
+	}
+
+	return res.Content, nil
+}
+
+func (o *SelftestOptions) summary(failed int) error {
+	if failed > 0 {
+		o.Printf("\n%d checks failed\n", failed)
+		return ErrSelftestFailed
+	}
+
+	o.Printf("\nall checks passed\n")
+
+	return nil
+}
+
+// NewCmdSelftest creates the selftest cobra command.
+func NewCmdSelftest(defaults *DefaultRAGOptions) *cobra.Command {
+	o := NewSelftestOptions(
+		defaults.StdioOptions,
+		defaults.llmOptions,
+	)
+
+	cmd := &cobra.Command{
+		Use:   "selftest",
+		Short: "Check a full retrieval and answer round-trip",
+		Long: `Embeds a tiny known document into an in-memory database, asks a question
+only that document answers, and checks that the relevant chunk is retrieved
+and that the answer contains the expected content with a verified citation.
+
+Unlike doctor, which checks connectivity, selftest exercises the configured
+embedding and chat models end to end. The vector database is not touched.
+
+Exits with a non-zero status if any check fails.`,
+		Example: `  # check the active configuration after changing models
+  ragx selftest
+
+  # check another chat model
+  ragx selftest --model llama3.1:8b`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return clierror.Check(genericclioptions.ExecuteCommand(cmd.Context(), o))
+		},
+	}
+
+	hiddenFlags := []string{
+		"dim",
+		"embed-cache",
+		"embed-batch-size",
+		"embed-concurrency",
+		"topk",
+		"match",
+	}
+
+	genericclioptions.MarkFlagsHidden(cmd, hiddenFlags...)
+
+	return cmd
+}
@@ -0,0 +1,101 @@
+package cli_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/llm/fake"
+)
+
+func TestSelftest(t *testing.T) {
+	clierror.SetErrorHandler(clierror.PrintErrHandler)
+	clierror.SetErrWriter(io.Discard)
+
+	t.Cleanup(func() {
+		clierror.ResetErrorHandler()
+		clierror.ResetErrWriter()
+	})
+
+	factRE := regexp.MustCompile(`CHUNK id=(\d+) source=(ragx-selftest/launch-code\.md)\nTEXT: .*is (QUOKKA-\d+)`)
+
+	// grounded answers the launch code from the prompt context, citing its chunk
+	grounded := func(p string) string {
+		m := factRE.FindStringSubmatch(p)
+		if m == nil {
+			return "I don't know."
+		}
+
+		return "The launch code is " + m[3] + " [1].\n\nSources:\n[1] (chunk " + m[1] + ") " + m[2]
+	}
+
+	tests := []struct {
+		name    string
+		reply   func(string) string
+		args    []string
+		wantErr bool
+		want    []string
+	}{
+		{
+			name:  "passes",
+			reply: grounded,
+			want: []string{
+				"OK    retrieval: ragx-selftest/launch-code.md ranked 1 of 2",
+				`OK    answer foo: contains "QUOKKA-7319"`,
+				"OK    citation: [1] (chunk 0) ragx-selftest/launch-code.md",
+				"all checks passed",
+			},
+		},
+		{
+			name:    "uncited answer",
+			reply:   func(string) string { return "The launch code is QUOKKA-7319." },
+			wantErr: true,
+			want: []string{
+				`OK    answer foo: contains "QUOKKA-7319"`,
+				"FAIL  citation: no verified citation of ragx-selftest/launch-code.md",
+				"1 checks failed",
+			},
+		},
+		{
+			name:    "no retrieval",
+			reply:   grounded,
+			args:    []string{"--top-k", "0"},
+			wantErr: true,
+			want: []string{
+				"FAIL  retrieval: ragx-selftest/launch-code.md not among the 0 retrieved chunks",
+				"FAIL  answer foo: missing",
+				"3 checks failed",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli.UseBackend(t, &fake.Backend{Models: []string{"foo", "bar"}, Reply: tt.reply})
+
+			iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+			args := append([]string{"selftest", "--config", writeTestConfig(t, "http://127.0.0.1:0")}, tt.args...)
+
+			cmd := cli.NewDefaultRAGCommand(iostreams, args)
+			cmd.SilenceErrors = true
+
+			err := cmd.ExecuteContext(context.Background())
+			if tt.wantErr != errors.Is(err, cli.ErrSelftestFailed) {
+				t.Fatalf("want failed: %v, got: %v\n%s", tt.wantErr, err, out.String())
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("want %q in the output, got:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultServeAddr       = "127.0.0.1:8080"
+	serveShutdownTimeout   = 5 * time.Second
+	serveReadHeaderTimeout = 10 * time.Second
+	maxServeRequestBytes   = 1 << 20
+)
+
+type ServeOptions struct {
+	*genericclioptions.StdioOptions
+	llmOptions *llmOptions
+
+	addr string
+}
+
+var _ genericclioptions.CmdOptions = &ServeOptions{}
+
+// ServeQueryRequest is the body of a POST /v1/query request.
+type ServeQueryRequest struct {
+	Query  string `json:"query"`
+	TopK   int    `json:"top_k,omitempty"`
+	Stream bool   `json:"stream,omitempty"`
+}
+
+// ServeModel is a model listed by GET /v1/models.
+type ServeModel struct {
+	ID            string `json:"id"`
+	Object        string `json:"object"`
+	ContextLength int    `json:"context_length,omitempty"`
+}
+
+// NewServeOptions initializes the options struct.
+func NewServeOptions(stdio *genericclioptions.StdioOptions, llmOptions *llmOptions) *ServeOptions {
+	return &ServeOptions{
+		StdioOptions: stdio,
+		llmOptions:   llmOptions,
+	}
+}
+
+func (*ServeOptions) Complete() error { return nil }
+
+func (o *ServeOptions) Validate() error {
+	if o.addr == "" {
+		return errf("--addr must not be empty")
+	}
+
+	if got, want := o.llmOptions.vectordb.Dim(), o.llmOptions.dim; got != want {
+		return errf("database dimension %d does not match the embedding model dimension %d", got, want)
+	}
+
+	return nil
+}
+
+func (o *ServeOptions) Run(ctx context.Context, _ ...string) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	ln, err := net.Listen("tcp", o.addr)
+	if err != nil {
+		return errf("listen: %w", err)
+	}
+
+	srv := &http.Server{
+		Handler:           o.handler(),
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+
+	go func() { serveErr <- srv.Serve(ln) }()
+
+	o.Logger.Info("serving", "addr", ln.Addr().String(), "db", o.llmOptions.dbPath)
+	o.Printf("listening on http://%s\n", ln.Addr())
+
+	select {
+	case err := <-serveErr:
+		return errf("serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	o.Logger.Info("shutting down")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.WithoutCancel(ctx), serveShutdownTimeout)
+	defer cancelShutdown()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		_ = srv.Close()
+		return errf("shutdown: %w", err)
+	}
+
+	return nil
+}
+
+func (o *ServeOptions) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /v1/query", o.handleQuery)
+	mux.HandleFunc("GET /v1/models", o.handleModels)
+
+	return mux
+}
+
+// handleQuery answers a query from the retrieved chunks. The answer
+// is returned as a single JSON result or, if requested, streamed as
+// server-sent events.
+func (o *ServeOptions) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var req ServeQueryRequest
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxServeRequestBytes)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		writeJSONError(w, http.StatusBadRequest, errors.New("missing query"))
+		return
+	}
+
+	if req.TopK < 0 {
+		writeJSONError(w, http.StatusBadRequest, errors.New("top_k must not be negative"))
+		return
+	}
+
+	var (
+		ctx   = r.Context()
+		model = o.llmOptions.llmConfig.DefaultModel
+		topK  = cmp.Or(req.TopK, o.llmOptions.embeddingConfig.TopK)
+	)
+
+	o.Logger.Info("serve query", "top_k", topK, "stream", req.Stream)
+
+	hits, err := o.retrieve(ctx, req.Query, topK)
+	if err != nil {
+		o.Logger.Error("retrieve", "err", err)
+		writeJSONError(w, http.StatusBadGateway, fmt.Errorf("retrieve: %w", err))
+
+		return
+	}
+
+	ch, err := o.answerStream(ctx, model, req.Query, hits)
+	if err != nil {
+		o.Logger.Error("answer", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	if req.Stream {
+		o.streamAnswer(ctx, w, req.Query, hits, ch)
+		return
+	}
+
+	var answer strings.Builder
+
+	if err := drainStream(ctx, ch, func(s string) { answer.WriteString(s) }, func(string) {}, func() {}); err != nil {
+		o.Logger.Error("response stream", "err", err)
+		writeJSONError(w, http.StatusBadGateway, fmt.Errorf("response stream: %w", err))
+
+		return
+	}
+
+	res, err := renameJSONFields(newQueryResult(req.Query, strings.TrimSpace(answer.String()), hits), o.llmOptions.outputConfig.JSONFields)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (o *ServeOptions) retrieve(ctx context.Context, query string, topK int) ([]vecdb.SearchResult, error) {
+	return o.llmOptions.retrieveTopK(ctx, func(string) {}, query, topK)
+}
+
+// answerStream starts generating the answer to query. Each request uses its
+// own chat session, so that concurrent requests do not share history.
+func (o *ServeOptions) answerStream(ctx context.Context, model, query string, hits []vecdb.SearchResult) (<-chan prompt.Chunk, error) {
+	if msg, ok := noContextAnswer(o.llmOptions.outputConfig, hits); ok {
+		o.Logger.Info("no relevant context retrieved, skipping llm call", "hits", len(hits))
+
+		ch := make(chan prompt.Chunk, 2)
+		ch <- prompt.Chunk{Content: msg}
+		ch <- prompt.Chunk{Err: io.EOF}
+		close(ch)
+
+		return ch, nil
+	}
+
+	return o.llmOptions.sendQuery(ctx, o.Logger, model, query, hits)
+}
+
+// streamAnswer writes the answer as server-sent events: a "chunks" event
+// with the retrieved chunks, a "token" event per answer token and a final
+// "result" event with the full query result. Failures after the response
+// has started are reported as an "error" event.
+func (o *ServeOptions) streamAnswer(ctx context.Context, w http.ResponseWriter, query string, hits []vecdb.SearchResult, ch <-chan prompt.Chunk) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event string, v any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			o.Logger.Error("marshal event", "event", event, "err", err)
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+
+		flusher.Flush()
+	}
+
+	send("chunks", newQueryResult(query, "", hits).Chunks)
+
+	var answer strings.Builder
+
+	printFunc := func(s string) {
+		answer.WriteString(s)
+		send("token", map[string]string{"content": s})
+	}
+
+	if err := drainStream(ctx, ch, printFunc, func(string) {}, func() {}); err != nil {
+		o.Logger.Error("response stream", "err", err)
+		send("error", errorBody(err))
+
+		return
+	}
+
+	res, err := renameJSONFields(newQueryResult(query, strings.TrimSpace(answer.String()), hits), o.llmOptions.outputConfig.JSONFields)
+	if err != nil {
+		send("error", errorBody(err))
+		return
+	}
+
+	send("result", res)
+}
+
+// handleModels lists the models of all providers, in the
+// OpenAI list models format.
+func (o *ServeOptions) handleModels(w http.ResponseWriter, r *http.Request) {
+	data := []ServeModel{}
+
+	for _, p := range o.llmOptions.providers {
+		// servers that cannot list their models are assumed to serve the configured ones
+		if !p.Preset.ListModels {
+			for _, id := range o.llmOptions.configuredModels() {
+				data = append(data, ServeModel{ID: id, Object: "model"})
+			}
+
+			continue
+		}
+
+		models, err := p.Client.ListModels(r.Context())
+		if err != nil {
+			o.Logger.Error("list models", "err", err)
+			writeJSONError(w, http.StatusBadGateway, fmt.Errorf("list models: %w", err))
+
+			return
+		}
+
+		for _, m := range models {
+			data = append(data, ServeModel{ID: m.ID, Object: "model", ContextLength: m.ContextLength})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": data})
+}
+
+func errorBody(err error) map[string]any {
+	return map[string]any{"error": map[string]string{"message": err.Error()}}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorBody(err))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// NewCmdServe creates the serve cobra command.
+func NewCmdServe(defaults *DefaultRAGOptions) *cobra.Command {
+	o := NewServeOptions(
+		defaults.StdioOptions,
+		defaults.llmOptions,
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve --db-path <file> [--addr <host:port>]",
+		Short: "Serve retrieval and chat over a local HTTP API",
+		Long: `Serves queries against a persistent vector database over HTTP, so that other
+tools can query an embedded corpus without re-embedding it.
+
+Endpoints:
+  POST /v1/query   answer a query; body: {"query": "...", "top_k": 4, "stream": false}
+                   with "stream": true, the answer is sent as server-sent events:
+                   "chunks", one "token" per answer token, then "result" (or "error")
+  GET  /v1/models  list the models of the configured providers
+
+The database is opened read-only; build it with "ragx reindex".`,
+		Example: `  # serve an existing database on the default address
+  ragx serve --db-path foo.db
+
+  # query it
+  curl -s localhost:8080/v1/query -d '{"query": "<query>"}'`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return clierror.Check(genericclioptions.ExecuteCommand(cmd.Context(), o, args...))
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.llmOptions.dbPath, "db-path", "", "", "path to the vector database file")
+	cmd.Flags().StringVarP(&o.addr, "addr", "", defaultServeAddr, "address to listen on")
+
+	_ = cmd.MarkFlagRequired("db-path")
+
+	hiddenFlags := []string{
+		"dim",
+		"match",
+	}
+
+	genericclioptions.MarkFlagsHidden(cmd, hiddenFlags...)
+
+	return cmd
+}
@@ -0,0 +1,287 @@
+package cli_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+)
+
+// startServe builds a database from a single file and serves it,
+// returning the server base URL. The server is shut down on cleanup.
+func startServe(t *testing.T) string {
+	t.Helper()
+
+	srv := newFakeLLMServer(t)
+
+	return startServeConfig(t, writeTestConfig(t, srv.URL))
+}
+
+// startServeConfig is like startServe, using the config file at config.
+func startServeConfig(t *testing.T, config string) string {
+	t.Helper()
+
+	var (
+		dir    = t.TempDir()
+		dbPath = filepath.Join(dir, "foo.db")
+		data   = filepath.Join(dir, "data.md")
+	)
+
+	if err := os.WriteFile(data, []byte("foo"), 0o600); err != nil {
+		t.Fatalf("write data: %v", err)
+	}
+
+	iostreams, _, _, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd := cli.NewDefaultRAGCommand(iostreams, []string{"reindex", "--config", config, "--db-path", dbPath, data})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	iostreams, _, _, _ = genericclioptions.NewTestIOStreams(ttyStdin())
+
+	cmd = cli.NewDefaultRAGCommand(iostreams, []string{"serve", "--config", config, "--db-path", dbPath, "--addr", addr})
+
+	go func() { done <- cmd.ExecuteContext(ctx) }()
+
+	t.Cleanup(func() {
+		cancel()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("serve: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("serve: no graceful shutdown")
+		}
+	})
+
+	baseURL := "http://" + addr
+
+	for range 250 {
+		res, err := http.Get(baseURL + "/v1/models")
+		if err == nil {
+			_ = res.Body.Close()
+			return baseURL
+		}
+
+		select {
+		case err := <-done:
+			t.Fatalf("serve exited early: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	t.Fatalf("server at %s not ready", addr)
+
+	return ""
+}
+
+func postQuery(t *testing.T, baseURL, body string) *http.Response {
+	t.Helper()
+
+	res, err := http.Post(baseURL+"/v1/query", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("post query: %v", err)
+	}
+
+	t.Cleanup(func() { _ = res.Body.Close() })
+
+	return res
+}
+
+func TestServe(t *testing.T) {
+	baseURL := startServe(t)
+
+	t.Run("query", func(t *testing.T) {
+		res := postQuery(t, baseURL, `{"query":"what is foo?","top_k":1}`)
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("want status 200, got: %d", res.StatusCode)
+		}
+
+		var got cli.QueryResult
+		if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+
+		if got.Answer != "bar" {
+			t.Errorf("want answer: %q, got: %q", "bar", got.Answer)
+		}
+
+		if len(got.Chunks) != 1 || got.Chunks[0].Content != "foo" {
+			t.Errorf("want the single chunk %q, got: %+v", "foo", got.Chunks)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		res := postQuery(t, baseURL, `{"query":"what is foo?","stream":true}`)
+
+		if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("want content type text/event-stream, got: %q", ct)
+		}
+
+		var (
+			events  []string
+			tokens  strings.Builder
+			result  cli.QueryResult
+			scanner = bufio.NewScanner(res.Body)
+			event   string
+		)
+
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			if e, ok := strings.CutPrefix(line, "event: "); ok {
+				event = e
+				events = append(events, e)
+
+				continue
+			}
+
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+
+			switch event {
+			case "token":
+				var tok struct{ Content string }
+				if err := json.Unmarshal([]byte(data), &tok); err != nil {
+					t.Fatalf("decode token: %v", err)
+				}
+
+				tokens.WriteString(tok.Content)
+			case "result":
+				if err := json.Unmarshal([]byte(data), &result); err != nil {
+					t.Fatalf("decode result: %v", err)
+				}
+			}
+		}
+
+		if got, want := strings.Join(events, ","), "chunks,token,result"; got != want {
+			t.Errorf("want events: %q, got: %q", want, got)
+		}
+
+		if tokens.String() != "bar" || result.Answer != "bar" {
+			t.Errorf("want streamed answer %q, got tokens: %q, result: %q", "bar", tokens.String(), result.Answer)
+		}
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		for _, body := range []string{`{`, `{"query":" "}`, `{"query":"foo","top_k":-1}`} {
+			if res := postQuery(t, baseURL, body); res.StatusCode != http.StatusBadRequest {
+				t.Errorf("%s: want status 400, got: %d", body, res.StatusCode)
+			}
+		}
+	})
+
+	t.Run("models", func(t *testing.T) {
+		res, err := http.Get(baseURL + "/v1/models")
+		if err != nil {
+			t.Fatalf("get models: %v", err)
+		}
+
+		defer func() { _ = res.Body.Close() }()
+
+		var got struct {
+			Data []cli.ServeModel `json:"data"`
+		}
+
+		if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+
+		ids := make([]string, 0, len(got.Data))
+		for _, m := range got.Data {
+			ids = append(ids, m.ID)
+		}
+
+		if want := "foo,bar"; strings.Join(ids, ",") != want {
+			t.Errorf("want models: %q, got: %q", want, fmt.Sprint(ids))
+		}
+	})
+}
+
+func TestServe_ModelsKeepConfiguredModels(t *testing.T) {
+	var (
+		srv    = newFakeLLMServer(t)
+		config = writeTestConfig(t, srv.URL)
+	)
+
+	// a provider reporting the context length of a model not configured
+	listing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"object":"list","data":[{"id":"baz","object":"model","context_length":4096}]}`)
+	}))
+	t.Cleanup(listing.Close)
+
+	f, err := os.OpenFile(config, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open config: %v", err)
+	}
+
+	// a llama.cpp provider cannot list its models, so it lists the configured ones
+	_, err = fmt.Fprintf(f, `
+[[llm.providers]]
+base_url = '%s/v1'
+
+[[llm.providers]]
+kind = 'llamacpp'
+base_url = '%s/v1'
+`, listing.URL, srv.URL)
+	if err := errors.Join(err, f.Close()); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	baseURL := startServeConfig(t, config)
+
+	res, err := http.Get(baseURL + "/v1/models")
+	if err != nil {
+		t.Fatalf("get models: %v", err)
+	}
+
+	defer func() { _ = res.Body.Close() }()
+
+	var got struct {
+		Data []cli.ServeModel `json:"data"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	ids := make([]string, 0, len(got.Data))
+	for _, m := range got.Data {
+		ids = append(ids, m.ID)
+	}
+
+	if want := "foo,bar,baz,bar,foo"; strings.Join(ids, ",") != want {
+		t.Errorf("want models: %q, got: %q", want, fmt.Sprint(ids))
+	}
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ladzaretti/ragx-cli/llm"
+)
+
+// loadSession restores the chat history saved at path into session.
+// A missing file starts a new session.
+func loadSession(path string, session llm.Session) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("read session: %w", err)
+	}
+
+	var history []llm.HistoryMessage
+	if err := json.Unmarshal(b, &history); err != nil {
+		return fmt.Errorf("decode session %q: %w", path, err)
+	}
+
+	if err := session.SetHistory(history); err != nil {
+		return fmt.Errorf("session %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// saveSession writes the chat history of session to path.
+func saveSession(path string, session llm.Session) error {
+	b, err := json.MarshalIndent(session.History(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode session: %w", err)
+	}
+
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+
+	return nil
+}
+
+// chatSessionVersion is the version of the chat session file format.
+const chatSessionVersion = 1
+
+// chatSession is a chat session saved by ragx chat --session.
+type chatSession struct {
+	Version  int                  `json:"version"`
+	Model    string               `json:"model,omitempty"` // Model is the model selected when the session was saved.
+	Messages []llm.HistoryMessage `json:"messages"`
+}
+
+// chatSessionPath returns the file of the named chat session
+// in the sessions directory under the state dir.
+func chatSessionPath(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid session name %q: must not be a path", name)
+	}
+
+	dir, err := defaultStateDir()
+	if err != nil {
+		return "", fmt.Errorf("state dir: %w", err)
+	}
+
+	return filepath.Join(dir, "sessions", name+".json"), nil
+}
+
+// readChatSession reads the chat session saved at path. Messages that
+// cannot be restored, e.g. with a role from another file version, are
+// skipped and counted. A missing file returns an empty session.
+func readChatSession(path string) (s chatSession, skipped int, err error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return chatSession{Version: chatSessionVersion}, 0, nil
+	}
+
+	if err != nil {
+		return chatSession{}, 0, fmt.Errorf("read session: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &s); err != nil {
+		return chatSession{}, 0, fmt.Errorf("decode session %q: %w", path, err)
+	}
+
+	msgs := make([]llm.HistoryMessage, 0, len(s.Messages))
+
+	for _, m := range s.Messages {
+		if (m.Role != "user" && m.Role != "assistant") || m.Content == "" {
+			skipped++
+			continue
+		}
+
+		msgs = append(msgs, m)
+	}
+
+	s.Messages = msgs
+
+	return s, skipped, nil
+}
+
+// writeChatSession writes the chat history of session
+// and the selected model to path.
+func writeChatSession(path, model string, session llm.Session) error {
+	s := chatSession{
+		Version:  chatSessionVersion,
+		Model:    model,
+		Messages: session.History(),
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode session: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+
+	return nil
+}
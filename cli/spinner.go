@@ -1,9 +1,12 @@
 package cli
 
 import (
+	"fmt"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
@@ -49,6 +52,13 @@ type updateStatusMsg struct {
 	showEllipsis bool
 }
 
+// updateProgressMsg changes the status of a task with known progress.
+type updateProgressMsg struct {
+	status      string
+	done, total int
+	at          time.Time
+}
+
 type displayTextMsg struct{ text string }
 
 // spinnerModel is the Bubble Tea model that renders the spinner and status suffix.
@@ -57,7 +67,9 @@ type spinnerModel struct {
 	cancel   func()
 	text     []string
 	status   string
+	eta      string
 	ellipsis *ellipsis
+	etas     *etaEstimator
 }
 
 var _ tea.Model = &spinnerModel{}
@@ -67,6 +79,9 @@ func (m spinnerModel) Init() tea.Cmd { return m.spinner.Tick }
 func (m spinnerModel) View() string {
 	lines := make([]string, 0, len(m.text)+1)
 	spin := m.spinner.View() + m.status + m.ellipsis.String()
+	if m.eta != "" {
+		spin += ", " + m.eta
+	}
 
 	if len(m.text) > 0 {
 		lines = append(lines, m.text...)
@@ -94,8 +109,20 @@ func (m spinnerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case updateStatusMsg:
 		m.status = msg.status
+		m.eta = ""
 		m.ellipsis.show(msg.showEllipsis)
 
+		return m, nil
+
+	case updateProgressMsg:
+		m.status = msg.status
+		m.eta = ""
+		m.ellipsis.show(false)
+
+		if eta, ok := m.etas.add(msg.at, msg.done, msg.total); ok {
+			m.eta = formatETA(eta)
+		}
+
 		return m, nil
 	}
 
@@ -123,6 +150,7 @@ func newSpinner(cancel func(), initialText string) *spinnerProg {
 		cancel:   cancel,
 		status:   initialText,
 		ellipsis: newEllipsis(defaultEllipsisMod),
+		etas:     &etaEstimator{},
 	}
 
 	prog := tea.NewProgram(model, tea.WithOutput(os.Stderr))
@@ -148,8 +176,119 @@ func (s *spinnerProg) display(text string) {
 	s.prog.Send(displayTextMsg{text})
 }
 
+// println prints text above the spinner.
+func (s *spinnerProg) println(text string) { s.prog.Println(text) }
+
 func (s *spinnerProg) setStatus(text string) { s.prog.Send(updateStatusMsg{status: text}) }
 
+func (s *spinnerProg) setProgress(text string, done, total int) {
+	s.prog.Send(updateProgressMsg{status: text, done: done, total: total, at: time.Now()})
+}
+
 func (s *spinnerProg) sendStatusWithEllipsis(text string) {
 	s.prog.Send(updateStatusMsg{status: text, showEllipsis: true})
 }
+
+// progressFunc reports a status along with the number of done and total
+// units of work, from which the spinner estimates the remaining time.
+type progressFunc func(status string, done, total int)
+
+// embedProgress tracks the files and chunks embedded by concurrent
+// workers and reports the overall progress of an ingest to send.
+type embedProgress struct {
+	totalFiles  int
+	totalChunks int
+	files       atomic.Int64
+	chunks      atomic.Int64
+
+	// sendMu orders the reports, so that the
+	// reported counts never go backwards.
+	sendMu sync.Mutex
+	send   progressFunc
+}
+
+func newEmbedProgress(totalFiles, totalChunks int, send progressFunc) *embedProgress {
+	return &embedProgress{
+		totalFiles:  totalFiles,
+		totalChunks: totalChunks,
+		send:        send,
+	}
+}
+
+// addChunks records n embedded chunks.
+func (p *embedProgress) addChunks(n int) {
+	p.chunks.Add(int64(n))
+	p.report()
+}
+
+// fileDone records a fully embedded file.
+func (p *embedProgress) fileDone() {
+	p.files.Add(1)
+	p.report()
+}
+
+// report sends the current progress. The counters are read under the lock,
+// so that a report never carries lower counts than the one sent before it.
+func (p *embedProgress) report() {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+
+	chunks := int(p.chunks.Load())
+
+	p.send(progressStatus(int(p.files.Load()), p.totalFiles, chunks, p.totalChunks), chunks, p.totalChunks)
+}
+
+// progressStatus formats the embedding progress.
+func progressStatus(filesDone, totalFiles, chunksDone, totalChunks int) string {
+	if totalChunks == 0 {
+		return fmt.Sprintf("embedding [%d/%d files]", filesDone, totalFiles)
+	}
+
+	return fmt.Sprintf("embedding [%d/%d files, %d/%d chunks] %d%%",
+		filesDone, totalFiles, chunksDone, totalChunks, chunksDone*100/totalChunks)
+}
+
+// etaWindow is the span of recent progress the throughput is computed over.
+const etaWindow = 10 * time.Second
+
+type progressSample struct {
+	at   time.Time
+	done int
+}
+
+// etaEstimator estimates the remaining time of a task
+// from its rolling throughput.
+type etaEstimator struct {
+	samples []progressSample
+}
+
+// add records the progress at the given time and returns the estimated time
+// remaining, if known. Completing the task resets the estimator.
+func (e *etaEstimator) add(at time.Time, done, total int) (time.Duration, bool) {
+	if done >= total {
+		e.samples = nil
+		return 0, false
+	}
+
+	e.samples = append(e.samples, progressSample{at: at, done: done})
+
+	// keep the samples within the window, plus the one just before it
+	for len(e.samples) > 2 && at.Sub(e.samples[1].at) >= etaWindow {
+		e.samples = e.samples[1:]
+	}
+
+	first := e.samples[0]
+
+	elapsed, progressed := at.Sub(first.at), done-first.done
+	if elapsed <= 0 || progressed <= 0 {
+		return 0, false
+	}
+
+	perUnit := elapsed / time.Duration(progressed)
+
+	return perUnit * time.Duration(total-done), true
+}
+
+func formatETA(d time.Duration) string {
+	return "ETA ~" + d.Round(time.Second).String()
+}
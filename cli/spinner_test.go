@@ -0,0 +1,148 @@
+package cli_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+)
+
+func TestProgressStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		filesDone  int
+		files      int
+		chunksDone int
+		chunks     int
+		want       string
+	}{
+		{
+			name:   "not started",
+			files:  4,
+			chunks: 100,
+			want:   "embedding [0/4 files, 0/100 chunks] 0%",
+		},
+		{
+			name:       "in progress",
+			filesDone:  1,
+			files:      4,
+			chunksDone: 25,
+			chunks:     100,
+			want:       "embedding [1/4 files, 25/100 chunks] 25%",
+		},
+		{
+			name:       "done",
+			filesDone:  4,
+			files:      4,
+			chunksDone: 100,
+			chunks:     100,
+			want:       "embedding [4/4 files, 100/100 chunks] 100%",
+		},
+		{
+			name:  "no chunks",
+			files: 2,
+			want:  "embedding [0/2 files]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cli.ProgressStatus(tt.filesDone, tt.files, tt.chunksDone, tt.chunks); got != tt.want {
+				t.Errorf("want status: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestETAEstimator(t *testing.T) {
+	var (
+		e     cli.ETAEstimator
+		start = time.Now()
+	)
+
+	if _, ok := e.Add(start, 0, 100); ok {
+		t.Fatal("want no eta without throughput")
+	}
+
+	// a steady 2 chunks per second
+	var (
+		eta time.Duration
+		ok  bool
+	)
+
+	for i := 1; i <= 20; i++ {
+		eta, ok = e.Add(start.Add(time.Duration(i)*time.Second), 2*i, 100)
+	}
+
+	if !ok {
+		t.Fatal("want an eta")
+	}
+
+	if want := 30 * time.Second; eta != want {
+		t.Errorf("want eta: %v, got: %v", want, eta)
+	}
+
+	if got, want := cli.FormatETA(eta+400*time.Millisecond), "ETA ~30s"; got != want {
+		t.Errorf("want formatted eta: %q, got: %q", want, got)
+	}
+
+	if _, ok := e.Add(start.Add(time.Minute), 100, 100); ok {
+		t.Error("want no eta on completion")
+	}
+
+	// completion resets the throughput
+	if _, ok := e.Add(start.Add(2*time.Minute), 10, 100); ok {
+		t.Error("want no eta after a reset")
+	}
+}
+
+func TestEmbedProgress_Monotonic(t *testing.T) {
+	const (
+		workers = 8
+		batches = 50
+	)
+
+	var statuses []string
+
+	// send is serialized by the progress
+	addChunks, fileDone := cli.NewEmbedProgress(workers, workers*batches, func(s string) { statuses = append(statuses, s) })
+
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range batches {
+				addChunks(1)
+			}
+
+			fileDone()
+		}()
+	}
+
+	wg.Wait()
+
+	prevFiles, prevChunks := 0, 0
+
+	for _, s := range statuses {
+		var files, chunks int
+		if _, err := fmt.Sscanf(s, "embedding [%d/%d files, %d/", &files, new(int), &chunks); err != nil {
+			t.Fatalf("parse status %q: %v", s, err)
+		}
+
+		if files < prevFiles || chunks < prevChunks {
+			t.Fatalf("want monotonic counts, got %q after %d files, %d chunks", s, prevFiles, prevChunks)
+		}
+
+		prevFiles, prevChunks = files, chunks
+	}
+
+	if prevFiles != workers || prevChunks != workers*batches {
+		t.Errorf("want final counts %d files, %d chunks, got: %d, %d", workers, workers*batches, prevFiles, prevChunks)
+	}
+}
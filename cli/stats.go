@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/ladzaretti/ragx-cli/clierror"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+
+	"github.com/spf13/cobra"
+)
+
+type StatsOptions struct {
+	*genericclioptions.StdioOptions
+	llmOptions *llmOptions
+
+	output string
+}
+
+var _ genericclioptions.CmdOptions = &StatsOptions{}
+
+// DBStats summarizes the contents of a vector database.
+type DBStats struct {
+	Path      string             `json:"path"`
+	Chunks    int                `json:"chunks"`
+	Sources   int                `json:"sources"`
+	Dimension int                `json:"dimension"`
+	Metric    string             `json:"metric"`
+	PerSource []vecdb.SourceStat `json:"per_source"`
+}
+
+// NewStatsOptions initializes the options struct.
+func NewStatsOptions(stdio *genericclioptions.StdioOptions, llmOptions *llmOptions) *StatsOptions {
+	return &StatsOptions{
+		StdioOptions: stdio,
+		llmOptions:   llmOptions,
+	}
+}
+
+func (*StatsOptions) Complete() error { return nil }
+
+func (o *StatsOptions) Validate() error { return validateOutputFormat(o.output) }
+
+func (o *StatsOptions) Run(_ context.Context, _ ...string) error {
+	db := o.llmOptions.vectordb
+
+	n, err := db.Count()
+	if err != nil {
+		return errf("stats: %w", err)
+	}
+
+	sources, err := db.Sources()
+	if err != nil {
+		return errf("stats: %w", err)
+	}
+
+	stats := DBStats{
+		Path:      o.llmOptions.dbPath,
+		Chunks:    n,
+		Sources:   len(sources),
+		Dimension: db.Dim(),
+		Metric:    db.Metric(),
+		PerSource: sources,
+	}
+
+	if stats.PerSource == nil {
+		stats.PerSource = []vecdb.SourceStat{}
+	}
+
+	if o.output == outputJSON {
+		o.Print(stringifyPretty(stats))
+		return nil
+	}
+
+	o.printStats(stats)
+
+	return nil
+}
+
+func (o *StatsOptions) printStats(s DBStats) {
+	o.Printf("path:      %s\n", s.Path)
+	o.Printf("chunks:    %d\n", s.Chunks)
+	o.Printf("sources:   %d\n", s.Sources)
+	o.Printf("dimension: %d\n", s.Dimension)
+	o.Printf("metric:    %s\n", s.Metric)
+
+	if len(s.PerSource) == 0 {
+		return
+	}
+
+	o.Print("\n")
+
+	w := tabwriter.NewWriter(o.Out, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(w, "SOURCE\tCHUNKS")
+
+	for _, src := range s.PerSource {
+		_, _ = fmt.Fprintf(w, "%s\t%d\n", cmp.Or(src.Source, "(unknown)"), src.Chunks)
+	}
+
+	_ = w.Flush()
+}
+
+// NewCmdStats creates the stats cobra command.
+func NewCmdStats(defaults *DefaultRAGOptions) *cobra.Command {
+	o := NewStatsOptions(
+		defaults.StdioOptions,
+		defaults.llmOptions,
+	)
+
+	cmd := &cobra.Command{
+		Use:   "stats --db-path <file>",
+		Short: "Show the contents of a vector database",
+		Long: `Opens a persistent vector database read-only and prints the total number of chunks,
+the number of distinct sources, the embedding dimension, the distance metric
+and the number of chunks per source.
+
+No LLM provider is contacted.`,
+		Example: `  # show what is stored in a database
+  ragx stats --db-path foo.db
+
+  # as JSON
+  ragx stats --db-path foo.db --output json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return clierror.Check(genericclioptions.ExecuteCommand(cmd.Context(), o))
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.llmOptions.dbPath, "db-path", "", "", "path to the vector database file")
+	cmd.Flags().StringVarP(&o.output, "output", "o", outputText, "output format (text, json)")
+
+	_ = cmd.MarkFlagRequired("db-path")
+
+	hiddenFlags := []string{
+		"dim",
+		"embedding-model",
+		"embed-cache",
+		"embed-batch-size",
+		"embed-concurrency",
+		"topk",
+		"match",
+		"model",
+		"temp",
+		"context",
+		"system",
+		"keep-alive",
+		"refresh-dim",
+	}
+
+	genericclioptions.MarkFlagsHidden(cmd, hiddenFlags...)
+
+	return cmd
+}
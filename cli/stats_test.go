@@ -0,0 +1,96 @@
+package cli_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/genericclioptions"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+func writeTestDB(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "foo.db")
+
+	db, err := vecdb.New(2, vecdb.WithPath(path))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	err = db.Insert([]vecdb.Chunk{
+		{Content: "foo", Vec: vecdb.Vector{1, 0}, Meta: vecdb.Meta{Source: "a.md", Index: 0}},
+		{Content: "bar", Vec: vecdb.Vector{0, 1}, Meta: vecdb.Meta{Source: "a.md", Index: 1}},
+		{Content: "baz", Vec: vecdb.Vector{1, 1}, Meta: vecdb.Meta{Source: "b.md", Index: 0}},
+	})
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	return path
+}
+
+func TestStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected provider request: %s", r.URL.Path)
+	}))
+	t.Cleanup(srv.Close)
+
+	var (
+		config = writeTestConfig(t, srv.URL)
+		dbPath = writeTestDB(t)
+	)
+
+	t.Run("json", func(t *testing.T) {
+		iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"stats", "--config", config, "--db-path", dbPath, "-o", "json"})
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		var got cli.DBStats
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+
+		want := cli.DBStats{
+			Path:      dbPath,
+			Chunks:    3,
+			Sources:   2,
+			Dimension: 2,
+			Metric:    vecdb.MetricL2,
+			PerSource: []vecdb.SourceStat{{Source: "a.md", Chunks: 2}, {Source: "b.md", Chunks: 1}},
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("stats mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		iostreams, _, out, _ := genericclioptions.NewTestIOStreams(ttyStdin())
+
+		cmd := cli.NewDefaultRAGCommand(iostreams, []string{"stats", "--config", config, "--db-path", dbPath})
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		for _, want := range []string{"chunks:    3", "sources:   2", "dimension: 2", "a.md    2"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("want output to contain %q, got:\n%s", want, out.String())
+			}
+		}
+	})
+}
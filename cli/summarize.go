@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+// defaultSummarizeThreshold is the size of the retrieved context, in
+// characters, above which --summarize condenses the retrieved chunks.
+const defaultSummarizeThreshold = 8000
+
+// summarizeFunc condenses text, keeping what is relevant to query.
+type summarizeFunc func(ctx context.Context, query, text string) (string, error)
+
+// summarizeHits returns a copy of hits with the content of each chunk replaced
+// by its summary, so that more source material fits into the context. Hits
+// whose total content is within threshold characters are returned as is.
+func summarizeHits(ctx context.Context, setStatus func(string), summarize summarizeFunc, query string, hits []vecdb.SearchResult, threshold int) ([]vecdb.SearchResult, error) {
+	size := 0
+	for _, h := range hits {
+		size += len(h.Content)
+	}
+
+	if size <= threshold {
+		return hits, nil
+	}
+
+	summarized := slices.Clone(hits)
+
+	for i, h := range hits {
+		setStatus(fmt.Sprintf("summarizing [%d/%d]", i+1, len(hits)))
+
+		s, err := summarize(ctx, query, h.Content)
+		if err != nil {
+			return nil, fmt.Errorf("summarize chunk %d: %w", i+1, err)
+		}
+
+		summarized[i].Content = s
+	}
+
+	return summarized, nil
+}
+
+// summarizer summarizes with single-turn completions of model,
+// using the generation settings configured for it.
+func (o *llmOptions) summarizer(provider types.Provider, model string) summarizeFunc {
+	return func(ctx context.Context, query, text string) (string, error) {
+		chat := o.chatRequest(model, "")
+
+		return provider.Client.GenerateCompletion(ctx, llm.CompletionRequest{
+			GenerationParams: chat.GenerationParams,
+			Model:            model,
+			SystemPrompt:     prompt.SummarizeSystemPrompt,
+			Prompt:           prompt.BuildSummarizePrompt(query, text),
+			ContextLength:    chat.ContextLength,
+			Temperature:      chat.Temperature,
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package cli_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/cli"
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+func TestSummarizeHits(t *testing.T) {
+	hits := []vecdb.SearchResult{
+		{Content: "foo foo foo", Meta: []byte(`{"path":"a.md","index":1}`)},
+		{Content: "bar bar bar", Meta: []byte(`{"path":"b.md","index":2}`)},
+	}
+
+	var calls int
+
+	stub := func(_ context.Context, query, text string) (string, error) {
+		calls++
+		return "summary of " + strings.Fields(text)[0] + " for " + query, nil
+	}
+
+	t.Run("above threshold", func(t *testing.T) {
+		calls = 0
+
+		summarized, err := cli.SummarizeHits(stub, "qux", hits, 10)
+		if err != nil {
+			t.Fatalf("summarize: %v", err)
+		}
+
+		p, err := prompt.BuildUserPrompt("qux", summarized, prompt.DecodeMeta)
+		if err != nil {
+			t.Fatalf("build user prompt: %v", err)
+		}
+
+		for _, want := range []string{
+			"CHUNK id=1 source=a.md\nTEXT: summary of foo for qux",
+			"CHUNK id=2 source=b.md\nTEXT: summary of bar for qux",
+		} {
+			if !strings.Contains(p, want) {
+				t.Errorf("want %q in the prompt, got:\n%s", want, p)
+			}
+		}
+
+		if strings.Contains(p, "foo foo foo") || strings.Contains(p, "bar bar bar") {
+			t.Errorf("want no raw chunks in the prompt, got:\n%s", p)
+		}
+
+		if calls != 2 {
+			t.Errorf("want a summary per chunk, got %d calls", calls)
+		}
+
+		if hits[0].Content != "foo foo foo" {
+			t.Errorf("want the retrieved hits untouched, got: %q", hits[0].Content)
+		}
+	})
+
+	t.Run("within threshold", func(t *testing.T) {
+		calls = 0
+
+		summarized, err := cli.SummarizeHits(stub, "qux", hits, 22)
+		if err != nil {
+			t.Fatalf("summarize: %v", err)
+		}
+
+		if calls != 0 || summarized[0].Content != "foo foo foo" {
+			t.Errorf("want the raw chunks without summarizing, got %d calls and: %+v", calls, summarized)
+		}
+	})
+}
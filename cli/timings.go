@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// The phases reported by --timings.
+const (
+	phaseEmbedding   = "embedding"
+	phaseRetrieval   = "retrieval"
+	phasePromptBuild = "prompt build"
+	phaseFirstToken  = "first token"
+	phaseGeneration  = "generation"
+)
+
+// timings accumulates the durations of the phases of a command.
+// A nil *timings only logs them, at debug level.
+type timings struct {
+	mu     sync.Mutex
+	phases []phaseTiming
+}
+
+type phaseTiming struct {
+	name  string
+	total time.Duration
+	runs  int
+}
+
+// track starts timing phase and returns the func that stops it.
+func (t *timings) track(logger *slog.Logger, phase string) (stop func()) {
+	start := time.Now()
+
+	return func() {
+		elapsed := time.Since(start)
+		logger.Debug(phase+" duration", "duration", elapsed)
+		t.add(phase, elapsed)
+	}
+}
+
+// trackFirst is like track, for a phase that ends at the first of
+// several events: only the first call of the returned func counts.
+func (t *timings) trackFirst(logger *slog.Logger, phase string) (stop func()) {
+	var once sync.Once
+
+	stopOnce := t.track(logger, phase)
+
+	return func() { once.Do(stopOnce) }
+}
+
+// add adds a run of phase that took d.
+func (t *timings) add(phase string, d time.Duration) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := slices.IndexFunc(t.phases, func(p phaseTiming) bool { return p.name == phase })
+	if i == -1 {
+		t.phases = append(t.phases, phaseTiming{name: phase})
+		i = len(t.phases) - 1
+	}
+
+	t.phases[i].total += d
+	t.phases[i].runs++
+}
+
+// print writes a line per phase to w, in the order the phases first ran.
+// Phases that ran more than once, e.g. in batch mode, report their total.
+func (t *timings) print(w io.Writer) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, p := range t.phases {
+		line := fmt.Sprintf("timing: %-12s %s", p.name, p.total.Round(time.Microsecond))
+		if p.runs > 1 {
+			line += fmt.Sprintf(" (%d runs)", p.runs)
+		}
+
+		fmt.Fprintln(w, line)
+	}
+}
@@ -1,6 +1,7 @@
 package clierror
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +13,14 @@ const (
 	DefaultErrorExitCode = 1
 )
 
+// Error output formats.
+const (
+	FormatText = "text" // FormatText prints the error message as is.
+	FormatJSON = "json" // FormatJSON prints the error message and exit code as a JSON object.
+)
+
+var ErrUnknownFormat = errors.New("unknown error format")
+
 var (
 	// errHandler is the function used to handle cli errors.
 	errHandler = FatalErrHandler
@@ -24,6 +33,9 @@ var (
 
 	// name is the name of the root cli command in use.
 	name string
+
+	// format is the error output format.
+	format = FormatText
 )
 
 // SetErrorHandler overrides the default [FatalErrHandler] error handler.
@@ -51,6 +63,22 @@ func SetDefaultFprintf(f func(w io.Writer, format string, a ...any) (n int, err
 	fprintf = f
 }
 
+// SetFormat sets the error output format, [FormatText] or [FormatJSON].
+func SetFormat(f string) error {
+	switch f {
+	case FormatText, FormatJSON:
+		format = f
+		return nil
+	default:
+		return fmt.Errorf("%w: %q (want %q or %q)", ErrUnknownFormat, f, FormatText, FormatJSON)
+	}
+}
+
+// ResetFormat restores the default error output format [FormatText].
+func ResetFormat() {
+	format = FormatText
+}
+
 // SetName for the cli in use.
 func SetName(s string) {
 	name = s
@@ -58,21 +86,32 @@ func SetName(s string) {
 
 // FatalErrHandler prints the message provided and then exits with the given code.
 func FatalErrHandler(msg string, code int) {
-	printError(msg)
+	printError(msg, code)
 
 	//nolint:revive // Intentional exit after fatal error.
 	os.Exit(code)
 }
 
-func PrintErrHandler(msg string, _ int) {
-	printError(msg)
+func PrintErrHandler(msg string, code int) {
+	printError(msg, code)
 }
 
-func printError(msg string) {
+func printError(msg string, code int) {
 	if len(msg) == 0 {
 		return
 	}
 
+	if format == FormatJSON {
+		b, err := json.Marshal(jsonError{Error: strings.TrimSuffix(msg, "\n"), Code: code})
+		if err != nil {
+			return
+		}
+
+		fprintf(errWriter, "%s\n", b) //nolint:errcheck
+
+		return
+	}
+
 	// add newline if needed
 	if !strings.HasSuffix(msg, "\n") {
 		msg += "\n"
@@ -81,6 +120,12 @@ func printError(msg string) {
 	fprintf(errWriter, msg) //nolint:errcheck
 }
 
+// jsonError is an error printed in the [FormatJSON] format.
+type jsonError struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
 // ErrExit may be passed to CheckError to instruct it to output nothing but exit with
 // status code 1.
 var ErrExit = errors.New("exit")
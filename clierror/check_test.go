@@ -0,0 +1,60 @@
+package clierror_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/clierror"
+)
+
+func TestCheck_Format(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		err    error
+		want   string
+	}{
+		{name: "text", format: clierror.FormatText, err: errors.New("foo"), want: "ragx: foo\n"},
+		{name: "text already prefixed", format: clierror.FormatText, err: errors.New("ragx: foo"), want: "ragx: foo\n"},
+		{name: "json", format: clierror.FormatJSON, err: errors.New(`foo "bar"`), want: `{"error":"ragx: foo \"bar\"","code":1}` + "\n"},
+		{name: "json exit", format: clierror.FormatJSON, err: clierror.ErrExit, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			clierror.SetName("ragx")
+			clierror.SetErrorHandler(clierror.PrintErrHandler)
+			clierror.SetErrWriter(&buf)
+
+			t.Cleanup(func() {
+				clierror.SetName("")
+				clierror.ResetErrorHandler()
+				clierror.ResetErrWriter()
+				clierror.ResetFormat()
+			})
+
+			if err := clierror.SetFormat(tt.format); err != nil {
+				t.Fatalf("set format: %v", err)
+			}
+
+			if err := clierror.Check(tt.err); !errors.Is(err, tt.err) {
+				t.Errorf("want error: %v, got: %v", tt.err, err)
+			}
+
+			if got := buf.String(); got != tt.want {
+				t.Errorf("want output: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSetFormat_Unknown(t *testing.T) {
+	t.Cleanup(clierror.ResetFormat)
+
+	if err := clierror.SetFormat("yaml"); !errors.Is(err, clierror.ErrUnknownFormat) {
+		t.Errorf("want error: %v, got: %v", clierror.ErrUnknownFormat, err)
+	}
+}
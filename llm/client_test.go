@@ -0,0 +1,1063 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/openai/openai-go/v2"
+)
+
+const chatCompletionResponse = `{
+  "id": "chatcmpl-1",
+  "object": "chat.completion",
+  "created": 0,
+  "model": "foo",
+  "choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "bar"}}],
+  "usage": {"prompt_tokens": 3, "completion_tokens": 1, "total_tokens": 4}
+}`
+
+const embeddingResponse = `{
+  "object": "list",
+  "model": "foo",
+  "data": [{"object": "embedding", "index": 0, "embedding": [0.1, 0.2]}],
+  "usage": {"prompt_tokens": 1, "total_tokens": 1}
+}`
+
+// fakeServer is a minimal OpenAI API compatible server recording
+// the requests it receives.
+type fakeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	bodies   []map[string]any
+	headers  []http.Header
+	handlers map[string]http.HandlerFunc
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	s := &fakeServer{
+		handlers: map[string]http.HandlerFunc{
+			"/v1/chat/completions": func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, chatCompletionResponse)
+			},
+			"/v1/embeddings": func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, embeddingResponse)
+			},
+		},
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+
+		body := map[string]any{}
+		_ = json.Unmarshal(raw, &body)
+
+		s.mu.Lock()
+		s.bodies = append(s.bodies, body)
+		s.headers = append(s.headers, r.Header.Clone())
+		h, ok := s.handlers[r.URL.Path]
+		s.mu.Unlock()
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		h(w, r)
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *fakeServer) handle(path string, h http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[path] = h
+}
+
+func (s *fakeServer) lastBody() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.bodies) == 0 {
+		return nil
+	}
+
+	return s.bodies[len(s.bodies)-1]
+}
+
+func (s *fakeServer) lastHeader() http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.headers) == 0 {
+		return nil
+	}
+
+	return s.headers[len(s.headers)-1]
+}
+
+func (s *fakeServer) client(opts ...llm.Option) *llm.Client {
+	opts = append([]llm.Option{
+		llm.WithBaseURL(s.URL + "/v1"),
+		llm.WithLogger(slog.New(slog.DiscardHandler)),
+	}, opts...)
+
+	return llm.NewClient(opts...)
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestGenerationParams(t *testing.T) {
+	keys := []string{"max_tokens", "top_p", "stop", "frequency_penalty", "presence_penalty"}
+
+	tests := []struct {
+		name   string
+		params llm.GenerationParams
+		want   map[string]any
+	}{
+		{
+			name:   "unset params are omitted",
+			params: llm.GenerationParams{},
+			want:   map[string]any{},
+		},
+		{
+			name: "all params set",
+			params: llm.GenerationParams{
+				MaxTokens:        ptr(128),
+				TopP:             ptr(0.9),
+				Stop:             []string{"foo", "bar"},
+				FrequencyPenalty: ptr(0.5),
+				PresencePenalty:  ptr(-0.5),
+			},
+			want: map[string]any{
+				"max_tokens":        float64(128),
+				"top_p":             0.9,
+				"stop":              []any{"foo", "bar"},
+				"frequency_penalty": 0.5,
+				"presence_penalty":  -0.5,
+			},
+		},
+		{
+			name:   "zero values are sent when set",
+			params: llm.GenerationParams{TopP: ptr(0.0)},
+			want:   map[string]any{"top_p": float64(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			client := srv.client()
+
+			pick := func(body map[string]any) map[string]any {
+				got := map[string]any{}
+
+				for _, k := range keys {
+					if v, ok := body[k]; ok {
+						got[k] = v
+					}
+				}
+
+				return got
+			}
+
+			_, err := client.GenerateCompletion(context.Background(), llm.CompletionRequest{
+				GenerationParams: tt.params,
+				Model:            "foo",
+				Prompt:           "baz",
+			})
+			if err != nil {
+				t.Fatalf("generate completion: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, pick(srv.lastBody())); diff != "" {
+				t.Errorf("completion params mismatch (-want +got):\n%s", diff)
+			}
+
+			session := llm.NewChat(client, "", llm.WithSessionLogger(slog.New(slog.DiscardHandler)))
+
+			_, err = session.Send(context.Background(), llm.ChatCompletionRequest{
+				GenerationParams: tt.params,
+				Model:            "foo",
+				Prompt:           "baz",
+			})
+			if err != nil {
+				t.Fatalf("send: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, pick(srv.lastBody())); diff != "" {
+				t.Errorf("chat params mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEmbedDimensions(t *testing.T) {
+	tests := []struct {
+		name       string
+		dimensions *int
+		want       any
+	}{
+		{
+			name:       "unset dimensions are omitted",
+			dimensions: nil,
+			want:       nil,
+		},
+		{
+			name:       "dimensions are sent when set",
+			dimensions: ptr(256),
+			want:       float64(256),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			client := srv.client()
+
+			_, err := client.Embed(context.Background(), llm.EmbedRequest{
+				Model:      "foo",
+				Input:      "bar",
+				Dimensions: tt.dimensions,
+			})
+			if err != nil {
+				t.Fatalf("embed: %v", err)
+			}
+
+			if got := srv.lastBody()["dimensions"]; got != tt.want {
+				t.Errorf("want dimensions: %v, got: %v", tt.want, got)
+			}
+
+			_, err = client.EmbedBatch(context.Background(), llm.EmbedBatchRequest{
+				Model:      "foo",
+				Input:      []string{"bar"},
+				Dimensions: tt.dimensions,
+			})
+			if err != nil {
+				t.Fatalf("embed batch: %v", err)
+			}
+
+			if got := srv.lastBody()["dimensions"]; got != tt.want {
+				t.Errorf("batch: want dimensions: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExtraBody(t *testing.T) {
+	srv := newFakeServer(t)
+	client := srv.client(llm.WithExtraBody(map[string]any{
+		"min_p":    0.05,
+		"top_k":    40,
+		"grammar":  "root ::= \"yes\"",
+		"mirostat": map[string]any{"tau": 5.0},
+	}))
+
+	want := map[string]any{
+		"min_p":    0.05,
+		"top_k":    float64(40),
+		"grammar":  "root ::= \"yes\"",
+		"mirostat": map[string]any{"tau": 5.0},
+	}
+
+	pick := func(body map[string]any) map[string]any {
+		got := map[string]any{}
+
+		for k := range want {
+			if v, ok := body[k]; ok {
+				got[k] = v
+			}
+		}
+
+		return got
+	}
+
+	_, err := client.GenerateCompletion(context.Background(), llm.CompletionRequest{Model: "foo", Prompt: "baz"})
+	if err != nil {
+		t.Fatalf("generate completion: %v", err)
+	}
+
+	if diff := cmp.Diff(want, pick(srv.lastBody())); diff != "" {
+		t.Errorf("completion extra body mismatch (-want +got):\n%s", diff)
+	}
+
+	session := llm.NewChat(client, "", llm.WithSessionLogger(slog.New(slog.DiscardHandler)))
+
+	if _, err := session.Send(context.Background(), llm.ChatCompletionRequest{Model: "foo", Prompt: "baz"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if diff := cmp.Diff(want, pick(srv.lastBody())); diff != "" {
+		t.Errorf("chat extra body mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := client.Embed(context.Background(), llm.EmbedRequest{Model: "foo", Input: "bar"}); err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+
+	if got := pick(srv.lastBody()); len(got) != 0 {
+		t.Errorf("embed: want no extra body fields, got: %v", got)
+	}
+}
+
+func TestHTTPClientAndHeaders(t *testing.T) {
+	var (
+		srv  = newFakeServer(t)
+		sent atomic.Int64
+	)
+
+	httpClient := &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			sent.Add(1)
+			return http.DefaultTransport.RoundTrip(r)
+		}),
+	}
+
+	client := srv.client(
+		llm.WithUserAgent("ragx/1.0.0"),
+		llm.WithHTTPClient(httpClient),
+		llm.WithHeader("OpenAI-Organization", "org-1"),
+		llm.WithHeader("User-Agent", "foo"),
+	)
+
+	if _, err := client.Embed(context.Background(), llm.EmbedRequest{Model: "foo", Input: "bar"}); err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+
+	if n := sent.Load(); n != 1 {
+		t.Errorf("want 1 request sent with the custom client, got: %d", n)
+	}
+
+	h := srv.lastHeader()
+
+	if got := h.Get("OpenAI-Organization"); got != "org-1" {
+		t.Errorf("want header: %q, got: %q", "org-1", got)
+	}
+
+	if got := h.Get("User-Agent"); got != "foo" {
+		t.Errorf("want the user agent overridden: %q, got: %q", "foo", got)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestListModels_ContextLength(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.handle("/v1/models", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"object":"list","data":[
+  {"id":"foo","object":"model","context_length":3},
+  {"id":"bar","object":"model","meta":{"n_ctx_train":8192}},
+  {"id":"baz","object":"model"}
+]}`)
+	})
+
+	client := srv.client()
+
+	models, err := client.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("list models: %v", err)
+	}
+
+	want := []llm.ModelInfo{
+		{ID: "foo", ContextLength: 3},
+		{ID: "bar", ContextLength: 8192},
+		{ID: "baz"},
+	}
+
+	if diff := cmp.Diff(want, models); diff != "" {
+		t.Fatalf("models mismatch (-want +got):\n%s", diff)
+	}
+
+	// the reported context length of foo only fits the system prompt and one turn
+	session := llm.NewChat(client, "sys",
+		llm.WithSessionLogger(slog.New(slog.DiscardHandler)),
+		llm.WithTokenCounter(countMsgs{}),
+	)
+
+	for _, p := range []string{"first", "second"} {
+		_, err := session.Send(context.Background(), llm.ChatCompletionRequest{
+			Model:         "foo",
+			Prompt:        p,
+			ContextLength: models[0].ContextLength,
+		})
+		if err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	raw, err := json.Marshal(srv.lastBody()["messages"])
+	if err != nil {
+		t.Fatalf("marshal messages: %v", err)
+	}
+
+	if strings.Contains(string(raw), "first") {
+		t.Errorf("want the first turn truncated, got messages: %s", raw)
+	}
+
+	if !strings.Contains(string(raw), "second") {
+		t.Errorf("want the last turn kept, got messages: %s", raw)
+	}
+
+	if got := session.ContextUsed().Max; got != 3 {
+		t.Errorf("want context max: 3, got: %d", got)
+	}
+}
+
+func TestModelContextWindow(t *testing.T) {
+	testCases := []struct {
+		name   string
+		path   string
+		body   string
+		want   int
+		wantOK bool
+	}{
+		{
+			name:   "llama.cpp",
+			path:   "/props",
+			body:   `{"default_generation_settings":{"n_ctx":4096}}`,
+			want:   4096,
+			wantOK: true,
+		},
+		{
+			name:   "ollama",
+			path:   "/api/show",
+			body:   `{"parameters":"stop                           \"<|im_end|>\"\nnum_ctx                        8192"}`,
+			want:   8192,
+			wantOK: true,
+		},
+		{
+			name: "ollama server default",
+			path: "/api/show",
+			body: `{"parameters":"temperature                    0.7"}`,
+		},
+		{
+			name: "unsupported",
+			path: "/unknown",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			srv.handle(tt.path, func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, tt.body)
+			})
+
+			got, ok := srv.client().ModelContextWindow(context.Background(), "foo")
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("want: (%d, %t), got: (%d, %t)", tt.want, tt.wantOK, got, ok)
+			}
+
+			if tt.path == "/api/show" {
+				if got := srv.lastBody()["model"]; got != "foo" {
+					t.Errorf("want show request for model: foo, got: %v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestSendStreaming_Usage(t *testing.T) {
+	const stream = `data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{"role":"assistant","content":"bar"},"finish_reason":null}]}
+
+data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[],"usage":{"prompt_tokens":40,"completion_tokens":2,"total_tokens":42}}
+
+data: [DONE]
+
+`
+
+	srv := newFakeServer(t)
+	srv.handle("/v1/chat/completions", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, stream)
+	})
+
+	session := llm.NewChat(srv.client(llm.WithStreamUsage(true)), "", llm.WithSessionLogger(slog.New(slog.DiscardHandler)))
+
+	it, err := session.SendStreaming(context.Background(), llm.ChatCompletionRequest{Model: "foo", Prompt: "baz"})
+	if err != nil {
+		t.Fatalf("send streaming: %v", err)
+	}
+
+	var (
+		content strings.Builder
+		usage   any
+	)
+
+	for res, err := range it {
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+
+		content.WriteString(res.Content)
+
+		if res.Usage != nil {
+			usage = res.Usage
+		}
+	}
+
+	if got := content.String(); got != "bar" {
+		t.Errorf("want content: %q, got: %q", "bar", got)
+	}
+
+	u, ok := usage.(openai.CompletionUsage)
+	if !ok {
+		t.Fatalf("want openai.CompletionUsage, got: %T", usage)
+	}
+
+	if u.PromptTokens != 40 || u.CompletionTokens != 2 || u.TotalTokens != 42 {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+
+	if got := session.ContextUsed().Used; got != 42 {
+		t.Errorf("want context used: 42, got: %d", got)
+	}
+
+	opts, ok := srv.lastBody()["stream_options"].(map[string]any)
+	if !ok || opts["include_usage"] != true {
+		t.Errorf("want stream_options.include_usage set, got: %v", srv.lastBody()["stream_options"])
+	}
+}
+
+func TestSendStreaming_EstimatedUsage(t *testing.T) {
+	const stream = `data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{"role":"assistant","content":"barbazqux"},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`
+
+	srv := newFakeServer(t)
+	srv.handle("/v1/chat/completions", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, stream)
+	})
+
+	session := llm.NewChat(srv.client(), "", llm.WithSessionLogger(slog.New(slog.DiscardHandler)))
+
+	it, err := session.SendStreaming(context.Background(), llm.ChatCompletionRequest{Model: "foo", Prompt: "12345678"})
+	if err != nil {
+		t.Fatalf("send streaming: %v", err)
+	}
+
+	var last llm.ChatResponse
+
+	for res, err := range it {
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+
+		last = res
+	}
+
+	u, ok := last.Usage.(openai.CompletionUsage)
+	if !ok {
+		t.Fatalf("want openai.CompletionUsage, got: %T", last.Usage)
+	}
+
+	if !last.UsageEstimated {
+		t.Error("want usage marked as estimated")
+	}
+
+	// approximately one token per four runes
+	if u.PromptTokens != 2 || u.CompletionTokens != 3 || u.TotalTokens != 5 {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+}
+
+func TestSendStreaming_Reasoning(t *testing.T) {
+	const stream = `data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{"role":"assistant","content":"","reasoning_content":"hmm"},"finish_reason":null}]}
+
+data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{"reasoning":" ok"},"finish_reason":null}]}
+
+data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{"content":"bar","reasoning_content":null},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`
+
+	srv := newFakeServer(t)
+	srv.handle("/v1/chat/completions", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, stream)
+	})
+
+	session := llm.NewChat(srv.client(), "", llm.WithSessionLogger(slog.New(slog.DiscardHandler)))
+
+	it, err := session.SendStreaming(context.Background(), llm.ChatCompletionRequest{Model: "foo", Prompt: "baz"})
+	if err != nil {
+		t.Fatalf("send streaming: %v", err)
+	}
+
+	var content, reasoning strings.Builder
+
+	for res, err := range it {
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+
+		content.WriteString(res.Content)
+		reasoning.WriteString(res.Reasoning)
+	}
+
+	if got := reasoning.String(); got != "hmm ok" {
+		t.Errorf("want reasoning: %q, got: %q", "hmm ok", got)
+	}
+
+	if got := content.String(); got != "bar" {
+		t.Errorf("want content: %q, got: %q", "bar", got)
+	}
+
+	h := session.History()
+	if len(h) != 2 || h[1].Content != "bar" {
+		t.Errorf("want only the content in history, got: %+v", h)
+	}
+}
+
+func TestSendStreaming_Canceled(t *testing.T) {
+	const chunk = `data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{"role":"assistant","content":"bar"},"finish_reason":null}]}
+
+`
+
+	srv := newFakeServer(t)
+	srv.handle("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, chunk)
+		w.(http.Flusher).Flush()
+
+		<-r.Context().Done() // stream until the client goes away
+	})
+
+	session := llm.NewChat(srv.client(), "", llm.WithSessionLogger(slog.New(slog.DiscardHandler)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	it, err := session.SendStreaming(ctx, llm.ChatCompletionRequest{Model: "foo", Prompt: "foo"})
+	if err != nil {
+		t.Fatalf("send streaming: %v", err)
+	}
+
+	var last error
+
+	for res, err := range it {
+		if err != nil {
+			last = err
+			break
+		}
+
+		if res.Content == "bar" {
+			cancel() // cancel mid-stream
+		}
+	}
+
+	if !errors.Is(last, llm.ErrStreamCanceled) {
+		t.Errorf("want error: %v, got: %v", llm.ErrStreamCanceled, last)
+	}
+
+	if h := session.History(); len(h) != 0 {
+		t.Errorf("want the canceled turn removed from history, got: %+v", h)
+	}
+}
+
+func TestSend_RetriesWithSmallerContextOnOverflow(t *testing.T) {
+	const overflow = `{"error":{"message":"This model's maximum context length is 3 tokens. However, your messages resulted in 4 tokens.","type":"invalid_request_error","code":"context_length_exceeded"}}`
+
+	const stream = `data: {"id":"1","object":"chat.completion.chunk","created":0,"model":"foo","choices":[{"index":0,"delta":{"role":"assistant","content":"bar"},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`
+
+	senders := map[string]func(*llm.ChatSession, string) (string, error){
+		"send": func(s *llm.ChatSession, p string) (string, error) {
+			res, err := s.Send(context.Background(), llm.ChatCompletionRequest{Model: "foo", Prompt: p})
+			if err != nil {
+				return "", err
+			}
+
+			return res.Content, nil
+		},
+		"streaming": func(s *llm.ChatSession, p string) (string, error) {
+			it, err := s.SendStreaming(context.Background(), llm.ChatCompletionRequest{Model: "foo", Prompt: p})
+			if err != nil {
+				return "", err
+			}
+
+			var b strings.Builder
+
+			for res, err := range it {
+				if err != nil {
+					return "", err
+				}
+
+				b.WriteString(res.Content)
+			}
+
+			return b.String(), nil
+		},
+	}
+
+	for name, send := range senders {
+		t.Run(name, func(t *testing.T) {
+			var (
+				srv      = newFakeServer(t)
+				fail     atomic.Bool
+				requests atomic.Int64
+			)
+
+			srv.handle("/v1/chat/completions", func(w http.ResponseWriter, _ *http.Request) {
+				requests.Add(1)
+
+				if fail.CompareAndSwap(true, false) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = io.WriteString(w, overflow)
+
+					return
+				}
+
+				if name == "streaming" {
+					w.Header().Set("Content-Type", "text/event-stream")
+					_, _ = io.WriteString(w, stream)
+
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, chatCompletionResponse)
+			})
+
+			newSession := func(notify func(attempted, limit int)) *llm.ChatSession {
+				return llm.NewChat(srv.client(), "sys",
+					llm.WithSessionLogger(slog.New(slog.DiscardHandler)),
+					llm.WithTokenCounter(countMsgs{}),
+					llm.WithContextRetryNotify(notify),
+				)
+			}
+
+			// a single turn cannot be truncated any further
+			fail.Store(true)
+
+			if _, err := send(newSession(nil), "first"); !llm.IsContextOverflowError(err) {
+				t.Fatalf("want context overflow error, got: %v", err)
+			}
+
+			if n := requests.Load(); n != 1 {
+				t.Fatalf("want no retry for a single turn, got %d requests", n)
+			}
+
+			var notified [2]int
+
+			session := newSession(func(attempted, limit int) { notified = [2]int{attempted, limit} })
+
+			if _, err := send(session, "first"); err != nil {
+				t.Fatalf("send first: %v", err)
+			}
+
+			fail.Store(true)
+			requests.Store(0)
+
+			answer, err := send(session, "second")
+			if err != nil {
+				t.Fatalf("send second: %v", err)
+			}
+
+			if answer != "bar" {
+				t.Errorf("want answer: %q, got: %q", "bar", answer)
+			}
+
+			if n := requests.Load(); n != 2 {
+				t.Errorf("want 2 requests, got: %d", n)
+			}
+
+			// sys, first, bar, second (4) retried with 80% of it (3)
+			if want := [2]int{4, 3}; notified != want {
+				t.Errorf("want notified (attempted, limit): %v, got: %v", want, notified)
+			}
+
+			raw, err := json.Marshal(srv.lastBody()["messages"])
+			if err != nil {
+				t.Fatalf("marshal messages: %v", err)
+			}
+
+			if strings.Contains(string(raw), "first") || !strings.Contains(string(raw), "second") {
+				t.Errorf("want the first turn dropped on retry, got messages: %s", raw)
+			}
+		})
+	}
+}
+
+func TestEmbedBatch_Cache(t *testing.T) {
+	srv := newFakeServer(t)
+
+	var inputs [][]string
+
+	// each input is embedded as [len(input), 1]
+	srv.handle("/v1/embeddings", func(w http.ResponseWriter, _ *http.Request) {
+		body := srv.lastBody()
+
+		var (
+			batch []string
+			data  []map[string]any
+		)
+
+		for i, in := range body["input"].([]any) {
+			s := in.(string)
+			batch = append(batch, s)
+			data = append(data, map[string]any{"object": "embedding", "index": i, "embedding": []float64{float64(len(s)), 1}})
+		}
+
+		inputs = append(inputs, batch)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"object": "list", "model": body["model"], "data": data})
+	})
+
+	cache, err := llm.OpenEmbedCache(filepath.Join(t.TempDir(), "cache", "embeddings.db"))
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+
+	t.Cleanup(func() { _ = cache.Close() })
+
+	client := srv.client(llm.WithEmbedCache(cache))
+
+	embed := func(model string, in ...string) [][]float64 {
+		t.Helper()
+
+		res, err := client.EmbedBatch(context.Background(), llm.EmbedBatchRequest{Model: model, Input: in})
+		if err != nil {
+			t.Fatalf("embed batch: %v", err)
+		}
+
+		return res.Vectors
+	}
+
+	want := [][]float64{{1, 1}, {2, 1}}
+
+	if got := embed("foo", "a", "bb"); !cmp.Equal(want, got) {
+		t.Errorf("first batch: want vectors: %v, got: %v", want, got)
+	}
+
+	if got := embed("foo", "a", "bb"); !cmp.Equal(want, got) {
+		t.Errorf("cached batch: want vectors: %v, got: %v", want, got)
+	}
+
+	want = [][]float64{{3, 1}, {1, 1}, {2, 1}}
+
+	if got := embed("foo", "ccc", "a", "bb"); !cmp.Equal(want, got) {
+		t.Errorf("partial batch: want vectors: %v, got: %v", want, got)
+	}
+
+	embed("bar", "a")
+
+	wantInputs := [][]string{{"a", "bb"}, {"ccc"}, {"a"}}
+	if diff := cmp.Diff(wantInputs, inputs); diff != "" {
+		t.Errorf("provider inputs mismatch (-want +got):\n%s", diff)
+	}
+
+	// another provider may serve a different model under the same name
+	var (
+		other    = newFakeServer(t)
+		requests atomic.Int64
+	)
+
+	other.handle("/v1/embeddings", func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"object":"list","model":"foo","data":[{"object":"embedding","index":0,"embedding":[7,7]}]}`)
+	})
+
+	res, err := other.client(llm.WithEmbedCache(cache)).EmbedBatch(context.Background(), llm.EmbedBatchRequest{Model: "foo", Input: []string{"a"}})
+	if err != nil {
+		t.Fatalf("embed batch: %v", err)
+	}
+
+	if n := requests.Load(); n != 1 || !cmp.Equal([][]float64{{7, 7}}, res.Vectors) {
+		t.Errorf("want the other provider embedding uncached, got %d requests, vectors: %v", n, res.Vectors)
+	}
+}
+
+func TestSendStreaming_NonStreamingProvider(t *testing.T) {
+	collect := func(t *testing.T, session *llm.ChatSession) string {
+		t.Helper()
+
+		it, err := session.SendStreaming(context.Background(), llm.ChatCompletionRequest{Model: "foo", Prompt: "baz"})
+		if err != nil {
+			t.Fatalf("send streaming: %v", err)
+		}
+
+		var b strings.Builder
+
+		for res, err := range it {
+			if err != nil {
+				t.Fatalf("stream: %v", err)
+			}
+
+			b.WriteString(res.Content)
+		}
+
+		return b.String()
+	}
+
+	t.Run("configured", func(t *testing.T) {
+		srv := newFakeServer(t)
+		session := llm.NewChat(srv.client(llm.WithStreaming(false)), "", llm.WithSessionLogger(slog.New(slog.DiscardHandler)))
+
+		if got := collect(t, session); got != "bar" {
+			t.Errorf("want answer: %q, got: %q", "bar", got)
+		}
+
+		if stream, _ := srv.lastBody()["stream"].(bool); stream {
+			t.Error("want a non-streaming request")
+		}
+	})
+
+	t.Run("detected", func(t *testing.T) {
+		var (
+			srv      = newFakeServer(t)
+			requests atomic.Int64
+		)
+
+		// the default handler ignores the stream field and replies with a JSON body
+		srv.handle("/v1/chat/completions", func(w http.ResponseWriter, _ *http.Request) {
+			requests.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, chatCompletionResponse)
+		})
+
+		client := srv.client()
+		session := llm.NewChat(client, "", llm.WithSessionLogger(slog.New(slog.DiscardHandler)))
+
+		if got := collect(t, session); got != "bar" {
+			t.Errorf("want answer: %q, got: %q", "bar", got)
+		}
+
+		if client.Streaming() {
+			t.Error("want streaming disabled after detection")
+		}
+
+		if h := session.History(); len(h) != 2 {
+			t.Errorf("want a single turn in history, got: %+v", h)
+		}
+
+		requests.Store(0)
+
+		if got := collect(t, session); got != "bar" {
+			t.Errorf("want answer: %q, got: %q", "bar", got)
+		}
+
+		if n := requests.Load(); n != 1 {
+			t.Errorf("want later turns sent without streaming first, got %d requests", n)
+		}
+
+		if stream, _ := srv.lastBody()["stream"].(bool); stream {
+			t.Error("want a non-streaming request")
+		}
+	})
+}
+
+func TestEmbedBatch_SingleInputFallback(t *testing.T) {
+	embedAll := func(t *testing.T, client *llm.Client, in ...string) [][]float64 {
+		t.Helper()
+
+		res, err := client.EmbedBatch(context.Background(), llm.EmbedBatchRequest{Model: "foo", Input: in})
+		if err != nil {
+			t.Fatalf("embed batch: %v", err)
+		}
+
+		return res.Vectors
+	}
+
+	newSingleInputServer := func(t *testing.T) (*fakeServer, *atomic.Int64) {
+		t.Helper()
+
+		var (
+			srv    = newFakeServer(t)
+			arrays atomic.Int64
+		)
+
+		// a single string input is embedded as [len(input), 1], arrays are rejected
+		srv.handle("/v1/embeddings", func(w http.ResponseWriter, _ *http.Request) {
+			in, ok := srv.lastBody()["input"].(string)
+			if !ok {
+				arrays.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = io.WriteString(w, `{"error": {"message": "input must be a string", "type": "invalid_request_error"}}`)
+
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"object": "list",
+				"model":  "foo",
+				"data":   []map[string]any{{"object": "embedding", "index": 0, "embedding": []float64{float64(len(in)), 1}}},
+			})
+		})
+
+		return srv, &arrays
+	}
+
+	want := [][]float64{{1, 1}, {2, 1}, {3, 1}}
+
+	t.Run("configured", func(t *testing.T) {
+		srv, arrays := newSingleInputServer(t)
+
+		if got := embedAll(t, srv.client(llm.WithEmbedBatch(false)), "a", "bb", "ccc"); !cmp.Equal(want, got) {
+			t.Errorf("want vectors: %v, got: %v", want, got)
+		}
+
+		if n := arrays.Load(); n != 0 {
+			t.Errorf("want no batched requests, got %d", n)
+		}
+	})
+
+	t.Run("detected", func(t *testing.T) {
+		srv, arrays := newSingleInputServer(t)
+		client := srv.client()
+
+		if got := embedAll(t, client, "a", "bb", "ccc"); !cmp.Equal(want, got) {
+			t.Errorf("want vectors: %v, got: %v", want, got)
+		}
+
+		if client.EmbedBatching() {
+			t.Error("want batching disabled after detection")
+		}
+
+		if got := embedAll(t, client, "ccc", "a"); !cmp.Equal([][]float64{{3, 1}, {1, 1}}, got) {
+			t.Errorf("want vectors in input order, got: %v", got)
+		}
+
+		if n := arrays.Load(); n != 1 {
+			t.Errorf("want a single batched request before detection, got %d", n)
+		}
+	})
+}
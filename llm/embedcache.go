@@ -0,0 +1,182 @@
+package llm
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/ncruces" //nolint:revive //common alias
+	"github.com/ncruces/go-sqlite3"
+)
+
+const embedCacheSchema = `
+CREATE TABLE IF NOT EXISTS
+	embeddings (
+		key BLOB PRIMARY KEY,
+		vec BLOB NOT NULL
+	) WITHOUT ROWID;
+`
+
+// EmbedCache is an on-disk cache of embedding vectors, keyed by the
+// hash of the provider base URL, the embedding model and the input. Vectors are stored as float32.
+// It is safe for concurrent use.
+type EmbedCache struct {
+	mu sync.Mutex
+	db *sqlite3.Conn
+}
+
+// OpenEmbedCache opens the cache at path, creating it if needed.
+func OpenEmbedCache(path string) (*EmbedCache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+
+	db, err := sqlite3.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3 open: %w", err)
+	}
+
+	// the cache may be shared by concurrent ragx runs
+	err = db.Exec("PRAGMA journal_mode=WAL; PRAGMA busy_timeout=5000;" + embedCacheSchema)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create schema: %w", err)
+	}
+
+	return &EmbedCache{db: db}, nil
+}
+
+// Close closes the cache.
+func (c *EmbedCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.db.Close()
+}
+
+// get returns the cached vectors of inputs; misses are nil.
+func (c *EmbedCache) get(model string, inputs []string) (_ [][]float64, retErr error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stmt, _, err := c.db.Prepare("SELECT vec FROM embeddings WHERE key = ?")
+	if err != nil {
+		return nil, fmt.Errorf("prepare select: %w", err)
+	}
+
+	defer func() {
+		if err := stmt.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("close stmt: %w", err))
+		}
+	}()
+
+	vectors := make([][]float64, len(inputs))
+
+	for i, in := range inputs {
+		stmt.BindBlob(1, embedCacheKey(model, in))
+
+		if stmt.Step() {
+			vectors[i] = decodeFloat32(stmt.ColumnRawBlob(0))
+		}
+
+		if err := stmt.Reset(); err != nil {
+			return nil, fmt.Errorf("select: %w", err)
+		}
+	}
+
+	return vectors, nil
+}
+
+// put stores the vectors of inputs.
+func (c *EmbedCache) put(model string, inputs []string, vectors [][]float64) (retErr error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.db.Exec("BEGIN"); err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+
+	defer func() {
+		if retErr != nil {
+			_ = c.db.Exec("ROLLBACK")
+		}
+	}()
+
+	stmt, _, err := c.db.Prepare("INSERT OR REPLACE INTO embeddings (key, vec) VALUES (?, ?)")
+	if err != nil {
+		return fmt.Errorf("prepare insert: %w", err)
+	}
+
+	defer func() {
+		if err := stmt.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("close stmt: %w", err))
+		}
+	}()
+
+	for i, in := range inputs {
+		blob, err := sqlite_vec.SerializeFloat32(toFloat32(vectors[i]))
+		if err != nil {
+			return err
+		}
+
+		stmt.BindBlob(1, embedCacheKey(model, in))
+		stmt.BindBlob(2, blob)
+
+		if err := stmt.Exec(); err != nil {
+			return fmt.Errorf("insert: %w", err)
+		}
+
+		stmt.Reset()
+	}
+
+	if err := c.db.Exec("COMMIT"); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	return nil
+}
+
+// embedCacheModel identifies the embedding space of a request, as
+// reduced dimensions yield different vectors for the same model, and
+// providers may serve different models under the same name.
+func embedCacheModel(baseURL, model string, dims *int) string {
+	space := strings.TrimSuffix(baseURL, "/") + "\n" + model
+	if dims == nil {
+		return space
+	}
+
+	return space + "@" + strconv.Itoa(*dims)
+}
+
+func embedCacheKey(model, input string) []byte {
+	sum := sha256.Sum256([]byte(model + "\n" + input))
+	return sum[:]
+}
+
+func toFloat32(src []float64) []float32 {
+	dst := make([]float32, len(src))
+
+	for i, v := range src {
+		dst[i] = float32(v)
+	}
+
+	return dst
+}
+
+// decodeFloat32 decodes a little endian float32 blob.
+func decodeFloat32(b []byte) []float64 {
+	vec := make([]float64, len(b)/4)
+
+	for i := range vec {
+		vec[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:])))
+	}
+
+	return vec
+}
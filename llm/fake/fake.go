@@ -0,0 +1,246 @@
+// Package fake provides a deterministic in-memory [llm.Backend],
+// so that the query and chat pipelines can be tested without a provider.
+package fake
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/ladzaretti/ragx-cli/llm"
+
+	openai "github.com/openai/openai-go/v2"
+)
+
+// DefaultDim is the embedding dimension used when [Backend.Dim] is zero.
+const DefaultDim = 16
+
+// DefaultReply is the chat reply used when [Backend.Reply] is nil.
+const DefaultReply = "ok"
+
+// Backend is an in-memory [llm.Backend].
+//
+// Embeddings are normalized byte histograms of the input, so that texts
+// sharing words are close to each other. Chat replies are produced by Reply
+// and streamed word by word. Backend is safe for concurrent use.
+type Backend struct {
+	// Models are the models listed by the backend.
+	Models []string
+
+	// Dim is the embedding dimension, [DefaultDim] if zero.
+	Dim int
+
+	// Reply returns the assistant reply to a prompt, [DefaultReply] if nil.
+	Reply func(prompt string) string
+
+	mu       sync.Mutex
+	requests []llm.ChatCompletionRequest
+	embedded []string
+}
+
+var _ llm.Backend = (*Backend)(nil)
+
+// Requests returns the chat and completion requests received so far, in order.
+// Completion requests are recorded with their prompt and model.
+func (b *Backend) Requests() []llm.ChatCompletionRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make([]llm.ChatCompletionRequest, len(b.requests))
+	copy(out, b.requests)
+
+	return out
+}
+
+// Embedded returns the texts embedded so far, in order.
+func (b *Backend) Embedded() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make([]string, len(b.embedded))
+	copy(out, b.embedded)
+
+	return out
+}
+
+func (b *Backend) recordEmbedded(inputs ...string) {
+	b.mu.Lock()
+	b.embedded = append(b.embedded, inputs...)
+	b.mu.Unlock()
+}
+
+func (b *Backend) record(req llm.ChatCompletionRequest) string {
+	b.mu.Lock()
+	b.requests = append(b.requests, req)
+	b.mu.Unlock()
+
+	if b.Reply == nil {
+		return DefaultReply
+	}
+
+	return b.Reply(req.Prompt)
+}
+
+func (b *Backend) dim(override *int) int {
+	if override != nil && *override > 0 {
+		return *override
+	}
+
+	if b.Dim > 0 {
+		return b.Dim
+	}
+
+	return DefaultDim
+}
+
+// Embed returns the embedding of the request input.
+func (b *Backend) Embed(_ context.Context, req llm.EmbedRequest) (*llm.EmbedResponse, error) {
+	b.recordEmbedded(req.Input)
+
+	return &llm.EmbedResponse{Vector: Embedding(req.Input, b.dim(req.Dimensions))}, nil
+}
+
+// EmbedBatch returns the embeddings of the request inputs.
+func (b *Backend) EmbedBatch(_ context.Context, req llm.EmbedBatchRequest) (*llm.EmbedBatchResponse, error) {
+	b.recordEmbedded(req.Input...)
+
+	vectors := make([][]float64, 0, len(req.Input))
+	for _, in := range req.Input {
+		vectors = append(vectors, Embedding(in, b.dim(req.Dimensions)))
+	}
+
+	return &llm.EmbedBatchResponse{Vectors: vectors}, nil
+}
+
+// ListModels lists [Backend.Models] without context lengths.
+func (b *Backend) ListModels(context.Context) ([]llm.ModelInfo, error) {
+	models := make([]llm.ModelInfo, 0, len(b.Models))
+	for _, id := range b.Models {
+		models = append(models, llm.ModelInfo{ID: id})
+	}
+
+	return models, nil
+}
+
+// GenerateCompletion returns the reply to the request prompt.
+func (b *Backend) GenerateCompletion(_ context.Context, req llm.CompletionRequest) (string, error) {
+	if req.Model == "" {
+		return "", llm.ErrNoModelSelected
+	}
+
+	return b.record(llm.ChatCompletionRequest{Model: req.Model, Prompt: req.Prompt}), nil
+}
+
+// NewChat creates a chat session. Session options configure
+// [llm.ChatSession] internals and are ignored.
+func (b *Backend) NewChat(systemPrompt string, _ ...llm.SessionOpt) llm.Session {
+	return &Session{backend: b, systemPrompt: systemPrompt}
+}
+
+// Embedding returns the normalized byte histogram of s folded into dim buckets.
+func Embedding(s string, dim int) []float64 {
+	v := make([]float64, dim)
+	for _, c := range []byte(strings.ToLower(s)) {
+		v[int(c)%dim]++
+	}
+
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+
+	if norm == 0 {
+		return v
+	}
+
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+
+	return v
+}
+
+// Session is an in-memory [llm.Session] of a [Backend].
+type Session struct {
+	backend      *Backend
+	systemPrompt string
+	history      []llm.HistoryMessage
+}
+
+var _ llm.Session = (*Session)(nil)
+
+// NewChat clears the session history.
+func (s *Session) NewChat(...llm.SessionOpt) llm.Session {
+	s.history = nil
+	return s
+}
+
+// Send records req and returns the backend reply.
+func (s *Session) Send(_ context.Context, req llm.ChatCompletionRequest) (*llm.ChatResponse, error) {
+	if req.Model == "" {
+		return nil, llm.ErrNoModelSelected
+	}
+
+	reply := s.backend.record(req)
+
+	s.history = append(s.history,
+		llm.HistoryMessage{Role: "user", Content: req.Prompt},
+		llm.HistoryMessage{Role: "assistant", Content: reply},
+	)
+
+	return &llm.ChatResponse{Content: reply, Usage: usage(req.Prompt, reply)}, nil
+}
+
+// SendStreaming is like Send, but yields the reply word by word,
+// followed by the usage.
+func (s *Session) SendStreaming(ctx context.Context, req llm.ChatCompletionRequest) (llm.ChatResponseIterator, error) {
+	res, err := s.Send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(yield func(llm.ChatResponse, error) bool) {
+		for _, word := range strings.SplitAfter(res.Content, " ") {
+			if err := ctx.Err(); err != nil {
+				yield(llm.ChatResponse{}, llm.ErrStreamCanceled)
+				return
+			}
+
+			if !yield(llm.ChatResponse{Content: word}, nil) {
+				return
+			}
+		}
+
+		yield(llm.ChatResponse{Usage: res.Usage}, nil)
+	}, nil
+}
+
+// SystemPrompt returns the system prompt the session was created with.
+func (s *Session) SystemPrompt() string { return s.systemPrompt }
+
+// ContextUsed returns no usage, as the session has no context limit.
+func (*Session) ContextUsed() llm.ContextUsage { return llm.ContextUsage{} }
+
+// History returns the user and assistant messages of the session.
+func (s *Session) History() []llm.HistoryMessage {
+	out := make([]llm.HistoryMessage, len(s.history))
+	copy(out, s.history)
+
+	return out
+}
+
+// SetHistory replaces the user and assistant messages of the session.
+func (s *Session) SetHistory(msgs []llm.HistoryMessage) error {
+	s.history = append([]llm.HistoryMessage(nil), msgs...)
+	return nil
+}
+
+// usage counts the words of the prompt and the reply as tokens.
+func usage(prompt, reply string) openai.CompletionUsage {
+	return openai.CompletionUsage{
+		PromptTokens:     int64(len(strings.Fields(prompt))),
+		CompletionTokens: int64(len(strings.Fields(reply))),
+	}
+}
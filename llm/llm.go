@@ -5,14 +5,20 @@ package llm
 import (
 	"cmp"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"iter"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 	"unicode/utf8"
 
 	openai "github.com/openai/openai-go/v2"
@@ -23,20 +29,72 @@ var (
 	ErrNoModelSelected         = errors.New("no model specified")
 	ErrNoEmbeddingReturned     = errors.New("no embedding returned")
 	ErrEmptyCompletionResponse = errors.New("empty completion response")
+
+	// ErrStreamCanceled is yielded by [ChatSession.SendStreaming]
+	// when the stream is stopped by canceling its context.
+	ErrStreamCanceled = errors.New("stream canceled")
+)
+
+// Backend is the provider API used to embed text, list models and chat.
+// It is implemented by [Client]; package fake provides a deterministic
+// in-memory implementation for tests.
+type Backend interface {
+	Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error)
+	EmbedBatch(ctx context.Context, req EmbedBatchRequest) (*EmbedBatchResponse, error)
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+	GenerateCompletion(ctx context.Context, req CompletionRequest) (string, error)
+
+	// NewChat creates a chat session with an optional system prompt.
+	NewChat(systemPrompt string, opts ...SessionOpt) Session
+}
+
+// Session is a chat conversation that keeps its history between requests.
+// It is implemented by [ChatSession].
+type Session interface {
+	// NewChat clears the history, keeping the system prompt,
+	// and applies opts. It returns the session itself.
+	NewChat(opts ...SessionOpt) Session
+	Send(ctx context.Context, req ChatCompletionRequest) (*ChatResponse, error)
+	SendStreaming(ctx context.Context, req ChatCompletionRequest) (ChatResponseIterator, error)
+	ContextUsed() ContextUsage
+	History() []HistoryMessage
+	SetHistory(msgs []HistoryMessage) error
+}
+
+var (
+	_ Backend = (*Client)(nil)
+	_ Session = (*ChatSession)(nil)
 )
 
 // Client implements an open ai api compatible client.
 type Client struct {
 	config
 	openaiClient openai.Client
+
+	// noStreaming reports whether chat requests are sent without streaming,
+	// either as configured or after detecting that the provider cannot stream.
+	noStreaming atomic.Bool
+
+	// noEmbedBatch reports whether embedding inputs are sent one per request,
+	// either as configured or after detecting that the provider rejects arrays.
+	noEmbedBatch atomic.Bool
 }
 
 type config struct {
-	logger      *slog.Logger
-	baseURL     string
-	apiKey      string
-	model       string
-	temperature *float64
+	logger       *slog.Logger
+	baseURL      string
+	apiKey       string
+	model        string
+	temperature  *float64
+	keepAlive    *time.Duration
+	extraBody    map[string]any
+	streamUsage  bool
+	embedCache   *EmbedCache
+	userAgent    string
+	httpClient   *http.Client
+	headers      map[string]string
+	noStreaming  bool
+	noEmbedBatch bool
 }
 
 // Option configures the OpenAI client.
@@ -77,6 +135,87 @@ func WithTemperature(t *float64) Option {
 	}
 }
 
+// WithKeepAlive sets how long the server should keep the model loaded
+// after a request, sent as the non-standard keep_alive request field
+// (e.g. Ollama). A negative duration keeps the model loaded indefinitely.
+func WithKeepAlive(d time.Duration) Option {
+	return func(o *config) {
+		o.keepAlive = &d
+	}
+}
+
+// WithExtraBody sets additional fields merged into the JSON body of
+// completion and chat requests, for provider specific parameters not
+// covered by the typed request params (e.g. min_p). Fields are sent as is.
+func WithExtraBody(fields map[string]any) Option {
+	return func(o *config) {
+		o.extraBody = fields
+	}
+}
+
+// WithStreamUsage requests token usage for streaming chat requests
+// (stream_options.include_usage). Providers that support it send the
+// usage in a final chunk with no choices.
+func WithStreamUsage(enabled bool) Option {
+	return func(o *config) {
+		o.streamUsage = enabled
+	}
+}
+
+// WithEmbedCache sets a cache consulted by embedding requests
+// before calling the provider.
+func WithEmbedCache(cache *EmbedCache) Option {
+	return func(o *config) {
+		o.embedCache = cache
+	}
+}
+
+// WithUserAgent sets the User-Agent header of all requests.
+func WithUserAgent(ua string) Option {
+	return func(o *config) {
+		o.userAgent = ua
+	}
+}
+
+// WithHTTPClient sets the HTTP client requests are sent with, e.g. to route
+// them through a custom transport. The default client honors the HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY environment variables.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *config) {
+		o.httpClient = client
+	}
+}
+
+// WithHeader sets the header key to val on all requests.
+// It takes precedence over the User-Agent set by [WithUserAgent].
+func WithHeader(key, val string) Option {
+	return func(o *config) {
+		if o.headers == nil {
+			o.headers = map[string]string{}
+		}
+
+		o.headers[key] = val
+	}
+}
+
+// WithStreaming sets whether the provider supports streaming chat responses.
+// When disabled, [ChatSession.SendStreaming] sends a non-streaming request
+// and yields the complete answer at once. Streaming is enabled by default.
+func WithStreaming(enabled bool) Option {
+	return func(o *config) {
+		o.noStreaming = !enabled
+	}
+}
+
+// WithEmbedBatch sets whether the provider accepts several inputs per
+// embedding request. When disabled, [Client.EmbedBatch] embeds its inputs
+// one request at a time. Batching is enabled by default.
+func WithEmbedBatch(enabled bool) Option {
+	return func(o *config) {
+		o.noEmbedBatch = !enabled
+	}
+}
+
 // NewClient creates a new OpenAI client.
 func NewClient(opts ...Option) *Client {
 	c := &config{}
@@ -90,10 +229,60 @@ func NewClient(opts ...Option) *Client {
 		option.WithAPIKey(c.apiKey),
 	}
 
-	return &Client{
+	if c.userAgent != "" {
+		options = append(options, option.WithHeader("User-Agent", c.userAgent))
+	}
+
+	if c.httpClient != nil {
+		options = append(options, option.WithHTTPClient(c.httpClient))
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(c.headers)) {
+		options = append(options, option.WithHeader(k, c.headers[k]))
+	}
+
+	client := &Client{
 		openaiClient: openai.NewClient(options...),
 		config:       *c,
 	}
+
+	client.noStreaming.Store(c.noStreaming)
+	client.noEmbedBatch.Store(c.noEmbedBatch)
+
+	return client
+}
+
+// Streaming reports whether chat responses are streamed.
+// It turns false once the provider is detected not to support streaming.
+func (c *Client) Streaming() bool { return !c.noStreaming.Load() }
+
+// EmbedBatching reports whether embedding inputs are sent in batches.
+// It turns false once the provider is detected to reject batched inputs.
+func (c *Client) EmbedBatching() bool { return !c.noEmbedBatch.Load() }
+
+// requestOptions returns the per-request options for generation
+// and embedding requests.
+func (c *Client) requestOptions() []option.RequestOption {
+	if c.keepAlive == nil {
+		return nil
+	}
+
+	return []option.RequestOption{
+		option.WithJSONSet("keep_alive", c.keepAlive.String()),
+	}
+}
+
+// generationOptions returns the per-request options for completion
+// and chat requests, including the extra body fields.
+func (c *Client) generationOptions() []option.RequestOption {
+	opts := c.requestOptions()
+
+	keys := slices.Sorted(maps.Keys(c.extraBody))
+	for _, k := range keys {
+		opts = append(opts, option.WithJSONSet(k, c.extraBody[k]))
+	}
+
+	return opts
 }
 
 // Close releases any resources (no-op for OpenAI).
@@ -103,7 +292,41 @@ func (*Client) Close() error {
 
 type ChatMessage = openai.ChatCompletionMessageParamUnion
 
+// GenerationParams holds optional generation controls shared by
+// completion and chat requests. Nil or empty fields are not sent.
+type GenerationParams struct {
+	MaxTokens        *int
+	TopP             *float64
+	Stop             []string
+	FrequencyPenalty *float64
+	PresencePenalty  *float64
+}
+
+func (g GenerationParams) apply(params *openai.ChatCompletionNewParams) {
+	if g.MaxTokens != nil {
+		params.MaxTokens = openai.Int(int64(*g.MaxTokens))
+	}
+
+	if g.TopP != nil {
+		params.TopP = openai.Float(*g.TopP)
+	}
+
+	if len(g.Stop) > 0 {
+		params.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: g.Stop}
+	}
+
+	if g.FrequencyPenalty != nil {
+		params.FrequencyPenalty = openai.Float(*g.FrequencyPenalty)
+	}
+
+	if g.PresencePenalty != nil {
+		params.PresencePenalty = openai.Float(*g.PresencePenalty)
+	}
+}
+
 type CompletionRequest struct {
+	GenerationParams
+
 	Model         string
 	SystemPrompt  string
 	Prompt        string
@@ -140,7 +363,9 @@ func (c *Client) GenerateCompletion(ctx context.Context, req CompletionRequest)
 		params.Temperature = openai.Float(*t)
 	}
 
-	completion, err := c.openaiClient.Chat.Completions.New(ctx, params)
+	req.apply(&params)
+
+	completion, err := c.openaiClient.Chat.Completions.New(ctx, params, c.generationOptions()...)
 	if err != nil {
 		return "", err
 	}
@@ -160,25 +385,126 @@ func (c *Client) selectModel(override string) (string, error) {
 	return "", ErrNoModelSelected
 }
 
-// ListModels returns available model IDs.
-func (c *Client) ListModels(ctx context.Context) ([]string, error) {
+// ModelInfo describes a model served by the provider.
+type ModelInfo struct {
+	ID string
+
+	// ContextLength is the model context length in tokens,
+	// or zero if the provider does not report it.
+	ContextLength int
+}
+
+// modelMetadata holds the non-standard context length fields
+// reported by some OpenAI API-compatible servers.
+type modelMetadata struct {
+	ContextLength    int `json:"context_length"`     // e.g. OpenRouter
+	MaxContextLength int `json:"max_context_length"` // e.g. LM Studio
+	MaxModelLen      int `json:"max_model_len"`      // e.g. vLLM
+	Meta             struct {
+		NCtxTrain int `json:"n_ctx_train"` // e.g. llama.cpp
+	} `json:"meta"`
+}
+
+func (m modelMetadata) contextLength() int {
+	return cmp.Or(m.ContextLength, m.MaxContextLength, m.MaxModelLen, m.Meta.NCtxTrain)
+}
+
+// ListModels returns the available models, including their
+// context length when the provider reports it.
+func (c *Client) ListModels(ctx context.Context) ([]ModelInfo, error) {
 	res, err := c.openaiClient.Models.List(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list models: %w", err)
 	}
 
-	modelIDs := make([]string, 0, len(res.Data))
+	models := make([]ModelInfo, 0, len(res.Data))
+
 	for _, model := range res.Data {
-		modelIDs = append(modelIDs, model.ID)
+		var meta modelMetadata
+		if raw := model.RawJSON(); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &meta); err != nil {
+				c.logger.Debug("decode model metadata", "model", model.ID, "err", err)
+			}
+		}
+
+		models = append(models, ModelInfo{
+			ID:            model.ID,
+			ContextLength: meta.contextLength(),
+		})
+	}
+
+	return models, nil
+}
+
+// contextWindowTimeout bounds each request of [Client.ModelContextWindow].
+const contextWindowTimeout = 5 * time.Second
+
+// llamaCPPProps holds the context size of the llama.cpp /props response.
+type llamaCPPProps struct {
+	DefaultGenerationSettings struct {
+		NCtx int `json:"n_ctx"`
+	} `json:"default_generation_settings"`
+}
+
+// ollamaShow holds the model parameters of the Ollama /api/show response.
+type ollamaShow struct {
+	Parameters string `json:"parameters"`
+}
+
+// ModelContextWindow returns the context window model is served with, when
+// the server reports it outside of the models list: the context size of a
+// llama.cpp server, or the num_ctx parameter of an Ollama model.
+// It is best effort and reports false if the server reports neither.
+func (c *Client) ModelContextWindow(ctx context.Context, model string) (int, bool) {
+	// the native endpoints are served next to the OpenAI compatible API
+	root := strings.TrimSuffix(strings.TrimSuffix(c.baseURL, "/"), "/v1") + "/"
+
+	opts := []option.RequestOption{
+		option.WithBaseURL(root),
+		option.WithMaxRetries(0),
+		option.WithRequestTimeout(contextWindowTimeout),
+	}
+
+	var props llamaCPPProps
+	if err := c.openaiClient.Get(ctx, "props", nil, &props, opts...); err == nil && props.DefaultGenerationSettings.NCtx > 0 {
+		return props.DefaultGenerationSettings.NCtx, true
+	}
+
+	var show ollamaShow
+	if err := c.openaiClient.Post(ctx, "api/show", map[string]string{"model": model}, &show, opts...); err != nil {
+		c.logger.Debug("model context window", "model", model, "err", err)
+		return 0, false
+	}
+
+	return ollamaNumCtx(show.Parameters)
+}
+
+// ollamaNumCtx returns the num_ctx of Ollama model parameters,
+// listed one per line as "name value". Models without one are
+// served with the server default, which is not reported.
+func ollamaNumCtx(params string) (int, bool) {
+	for line := range strings.Lines(params) {
+		f := strings.Fields(line)
+		if len(f) != 2 || f[0] != "num_ctx" {
+			continue
+		}
+
+		n, err := strconv.Atoi(f[1])
+
+		return n, err == nil && n > 0
 	}
 
-	return modelIDs, nil
+	return 0, false
 }
 
 // EmbedRequest specifies a model and input string for embedding.
 type EmbedRequest struct {
 	Model string
 	Input string
+
+	// Dimensions optionally requests a reduced embedding size,
+	// for models that support it.
+	Dimensions *int
 }
 
 type EmbedResponse struct {
@@ -187,15 +513,46 @@ type EmbedResponse struct {
 }
 
 // Embed returns the embedding for a single input.
+// Cached embeddings are returned without usage.
 func (c *Client) Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error) {
+	if c.embedCache == nil {
+		return c.embed(ctx, req)
+	}
+
+	model := embedCacheModel(c.config.baseURL, req.Model, req.Dimensions)
+
+	cached, err := c.embedCache.get(model, []string{req.Input})
+	if err != nil {
+		c.logger.Warn("embed cache get", "err", err)
+	} else if cached[0] != nil {
+		return &EmbedResponse{Vector: cached[0]}, nil
+	}
+
+	res, err := c.embed(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.embedCache.put(model, []string{req.Input}, [][]float64{res.Vector}); err != nil {
+		c.logger.Warn("embed cache put", "err", err)
+	}
+
+	return res, nil
+}
+
+func (c *Client) embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error) {
 	params := openai.EmbeddingNewParams{
 		Input: openai.EmbeddingNewParamsInputUnion{OfString: openai.String(req.Input)},
 		Model: req.Model,
 	}
 
+	if req.Dimensions != nil {
+		params.Dimensions = openai.Int(int64(*req.Dimensions))
+	}
+
 	c.logger.Info("embed request", "model", req.Model, "input_len", len(req.Input))
 
-	res, err := c.openaiClient.Embeddings.New(ctx, params)
+	res, err := c.openaiClient.Embeddings.New(ctx, params, c.requestOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("embedding request failed: %w", err)
 	}
@@ -214,6 +571,10 @@ func (c *Client) Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, e
 type EmbedBatchRequest struct {
 	Model string
 	Input []string
+
+	// Dimensions optionally requests a reduced embedding size,
+	// for models that support it.
+	Dimensions *int
 }
 
 type EmbedBatchResponse struct {
@@ -222,21 +583,97 @@ type EmbedBatchResponse struct {
 }
 
 // EmbedBatch returns embeddings for multiple inputs.
+// With a cache, only the uncached inputs are sent to the provider.
 func (c *Client) EmbedBatch(ctx context.Context, req EmbedBatchRequest) (*EmbedBatchResponse, error) {
+	if c.embedCache == nil {
+		return c.embedBatch(ctx, req)
+	}
+
+	model := embedCacheModel(c.config.baseURL, req.Model, req.Dimensions)
+
+	vectors, err := c.embedCache.get(model, req.Input)
+	if err != nil {
+		c.logger.Warn("embed cache get", "err", err)
+		vectors = make([][]float64, len(req.Input))
+	}
+
+	var (
+		misses   []int
+		uncached []string
+	)
+
+	for i, v := range vectors {
+		if v == nil {
+			misses = append(misses, i)
+			uncached = append(uncached, req.Input[i])
+		}
+	}
+
+	c.logger.Debug("embed cache", "model", req.Model, "hits", len(req.Input)-len(misses), "misses", len(misses))
+
+	if len(misses) == 0 {
+		return &EmbedBatchResponse{Vectors: vectors}, nil
+	}
+
+	missReq := req
+	missReq.Input = uncached
+
+	res, err := c.embedBatch(ctx, missReq)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, i := range misses {
+		vectors[i] = res.Vectors[j]
+	}
+
+	if err := c.embedCache.put(model, uncached, res.Vectors); err != nil {
+		c.logger.Warn("embed cache put", "err", err)
+	}
+
+	return &EmbedBatchResponse{
+		Vectors: vectors,
+		Usage:   res.Usage,
+	}, nil
+}
+
+// embedBatch embeds the inputs of req in a single request, or one request
+// at a time if the provider does not accept batched inputs.
+func (c *Client) embedBatch(ctx context.Context, req EmbedBatchRequest) (*EmbedBatchResponse, error) {
+	if !c.EmbedBatching() {
+		return c.embedEach(ctx, req)
+	}
+
+	res, err := c.embedArray(ctx, req)
+	if err != nil && isEmbedBatchUnsupportedError(err) {
+		c.logger.Warn("provider does not support batched embeddings, falling back to single input requests", "err", err)
+		c.noEmbedBatch.Store(true)
+
+		return c.embedEach(ctx, req)
+	}
+
+	return res, err
+}
+
+func (c *Client) embedArray(ctx context.Context, req EmbedBatchRequest) (*EmbedBatchResponse, error) {
 	params := openai.EmbeddingNewParams{
 		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: req.Input},
 		Model: req.Model,
 	}
 
+	if req.Dimensions != nil {
+		params.Dimensions = openai.Int(int64(*req.Dimensions))
+	}
+
 	c.logger.Info("embed batch request", "model", req.Model, "input_count", len(req.Input))
 
-	res, err := c.openaiClient.Embeddings.New(ctx, params)
+	res, err := c.openaiClient.Embeddings.New(ctx, params, c.requestOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("embedding batch request failed: %w", err)
 	}
 
 	if len(res.Data) != len(req.Input) {
-		return nil, fmt.Errorf("expected %d embeddings, got %d", len(req.Input), len(res.Data))
+		return nil, fmt.Errorf("%w: expected %d, got %d", errEmbeddingCountMismatch, len(req.Input), len(res.Data))
 	}
 
 	vectors := make([][]float64, len(res.Data))
@@ -250,6 +687,35 @@ func (c *Client) EmbedBatch(ctx context.Context, req EmbedBatchRequest) (*EmbedB
 	}, nil
 }
 
+// embedEach embeds the inputs of req one request at a time, returning
+// the same response as a batched request. Callers bound the concurrency
+// of [Client.EmbedBatch], so the inputs are embedded sequentially.
+func (c *Client) embedEach(ctx context.Context, req EmbedBatchRequest) (*EmbedBatchResponse, error) {
+	var (
+		vectors = make([][]float64, 0, len(req.Input))
+		usage   openai.CreateEmbeddingResponseUsage
+	)
+
+	for _, in := range req.Input {
+		res, err := c.embed(ctx, EmbedRequest{Model: req.Model, Input: in, Dimensions: req.Dimensions})
+		if err != nil {
+			return nil, err
+		}
+
+		vectors = append(vectors, res.Vector)
+
+		if res.Usage != nil {
+			usage.PromptTokens += res.Usage.PromptTokens
+			usage.TotalTokens += res.Usage.TotalTokens
+		}
+	}
+
+	return &EmbedBatchResponse{
+		Vectors: vectors,
+		Usage:   &usage,
+	}, nil
+}
+
 // TokenCounter reports the number of tokens in a set of messages.
 type TokenCounter interface {
 	Count(msgs ...openai.ChatCompletionMessageParamUnion) int
@@ -258,23 +724,31 @@ type TokenCounter interface {
 func (ApproxTokenCounter) Count(msgs ...openai.ChatCompletionMessageParamUnion) int {
 	n := 0
 	for _, m := range msgs {
-		u := m.GetContent().AsAny()
+		n += utf8.RuneCountInString(messageText(m))
+	}
+
+	return (n + 3) / 4 // applying the standard idiom for positive integer rounding up.
+}
+
+// messageText returns the text content of a chat message.
+func messageText(m ChatMessage) string {
+	switch v := m.GetContent().AsAny().(type) {
+	case *string:
+		return *v
 
-		switch v := u.(type) {
-		case *string:
-			n += utf8.RuneCountInString(*v)
+	case *[]openai.ChatCompletionContentPartUnionParam:
+		var sb strings.Builder
 
-		case *[]openai.ChatCompletionContentPartUnionParam:
-			for _, p := range *v {
-				if text := p.GetText(); text != nil {
-					n += utf8.RuneCountInString(*text)
-				}
+		for _, p := range *v {
+			if text := p.GetText(); text != nil {
+				sb.WriteString(*text)
 			}
-		default:
 		}
-	}
 
-	return (n + 3) / 4 // applying the standard idiom for positive integer rounding up.
+		return sb.String()
+	default:
+		return ""
+	}
 }
 
 // ApproxTokenCounter estimates token usage by assuming roughly
@@ -291,9 +765,11 @@ type ChatSession struct {
 	history        []ChatMessage
 	temperature    *float64
 	defaultContext int
+	contextLimit   int
 	contextUsed    int
 
-	tokenCounter TokenCounter
+	tokenCounter   TokenCounter
+	onContextRetry func(attempted, limit int)
 }
 
 type SessionOpt func(*ChatSession)
@@ -326,6 +802,14 @@ func WithDefaultContextLength(l int) SessionOpt {
 	}
 }
 
+// WithContextRetryNotify sets a function called when a request that
+// exceeded the model context is retried with a smaller one.
+func WithContextRetryNotify(f func(attempted, limit int)) SessionOpt {
+	return func(o *ChatSession) {
+		o.onContextRetry = f
+	}
+}
+
 // NewChat creates a new chat session with optional system prompt.
 func NewChat(c *Client, systemPrompt string, opts ...SessionOpt) *ChatSession {
 	session := &ChatSession{
@@ -335,10 +819,23 @@ func NewChat(c *Client, systemPrompt string, opts ...SessionOpt) *ChatSession {
 		tokenCounter: ApproxTokenCounter{},
 	}
 
-	return session.NewChat(opts...)
+	session.reset(opts...)
+
+	return session
+}
+
+// NewChat creates a new chat session using c with optional system prompt.
+func (c *Client) NewChat(systemPrompt string, opts ...SessionOpt) Session {
+	return NewChat(c, systemPrompt, opts...)
+}
+
+func (s *ChatSession) NewChat(opts ...SessionOpt) Session {
+	s.reset(opts...)
+	return s
 }
 
-func (s *ChatSession) NewChat(opts ...SessionOpt) *ChatSession {
+// reset applies opts and clears the history, keeping the system prompt.
+func (s *ChatSession) reset(opts ...SessionOpt) {
 	for _, o := range opts {
 		o(s)
 	}
@@ -349,8 +846,6 @@ func (s *ChatSession) NewChat(opts ...SessionOpt) *ChatSession {
 	}
 
 	s.history = history
-
-	return s
 }
 
 // ChatResponseIterator is a streaming sequence of chat responses.
@@ -358,20 +853,30 @@ type ChatResponseIterator iter.Seq2[ChatResponse, error]
 
 // ChatResponse is a non-streaming chat response.
 type ChatResponse struct {
-	Content string // assistant text
-	Usage   any
+	Content   string // assistant text
+	Reasoning string // reasoning sent apart from the content, if any
+	Usage     any
+
+	// UsageEstimated reports whether Usage was approximated by the
+	// session token counter, as the provider did not report it.
+	UsageEstimated bool
 }
 
 type ContextUsage struct{ Used, Max int }
 
 // ContextUsed returns the number of tokens currently used in the session context.
 func (s *ChatSession) ContextUsed() ContextUsage {
-	return ContextUsage{Used: s.contextUsed, Max: s.defaultContext}
+	return ContextUsage{Used: s.contextUsed, Max: cmp.Or(s.contextLimit, s.defaultContext)}
 }
 
 type ChatCompletionRequest struct {
-	Model         string
-	Prompt        string
+	GenerationParams
+
+	Model  string
+	Prompt string
+
+	// ContextLength is the context length used for truncating the
+	// history of this request; if zero, the session default is used.
 	ContextLength int
 	Temperature   *float64
 }
@@ -389,7 +894,7 @@ func (s *ChatSession) Send(ctx context.Context, req ChatCompletionRequest) (*Cha
 
 	params := openai.ChatCompletionNewParams{
 		Model:    req.Model,
-		Messages: TruncateHistory(s.tokenCounter, s.history, s.defaultContext),
+		Messages: TruncateHistory(s.tokenCounter, s.history, s.contextLimitFor(req)),
 	}
 
 	t := cmp.Or(req.Temperature, s.temperature, s.client.temperature)
@@ -397,9 +902,16 @@ func (s *ChatSession) Send(ctx context.Context, req ChatCompletionRequest) (*Cha
 		params.Temperature = openai.Float(*t)
 	}
 
+	req.apply(&params)
+
 	s.logger.Debug("chat request", "model", req.Model, "message_count", len(params.Messages))
 
-	completion, err := s.client.openaiClient.Chat.Completions.New(ctx, params)
+	completion, err := s.client.openaiClient.Chat.Completions.New(ctx, params, s.client.generationOptions()...)
+	if msgs, ok := s.contextRetryMessages(err, params.Messages); ok {
+		params.Messages = msgs
+		completion, err = s.client.openaiClient.Chat.Completions.New(ctx, params, s.client.generationOptions()...)
+	}
+
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			s.removeLastUserMessage()
@@ -427,8 +939,9 @@ func (s *ChatSession) Send(ctx context.Context, req ChatCompletionRequest) (*Cha
 	s.logger.Info("saved assistant message", "content_present", msg.Content != "")
 
 	return &ChatResponse{
-		Content: msg.Content,
-		Usage:   completion.Usage,
+		Content:   msg.Content,
+		Reasoning: reasoningOf(msg.RawJSON()),
+		Usage:     completion.Usage,
 	}, nil
 }
 
@@ -439,13 +952,17 @@ func (s *ChatSession) SendStreaming(ctx context.Context, req ChatCompletionReque
 		return nil, ErrNoModelSelected
 	}
 
+	if !s.client.Streaming() {
+		return s.sendUnstreamed(ctx, req), nil
+	}
+
 	s.logger.Info("start streaming request", "model", req.Model)
 
 	s.appendUserMessages(req.Prompt)
 
 	params := openai.ChatCompletionNewParams{
 		Model:    req.Model,
-		Messages: TruncateHistory(s.tokenCounter, s.history, s.defaultContext),
+		Messages: TruncateHistory(s.tokenCounter, s.history, s.contextLimitFor(req)),
 	}
 
 	t := cmp.Or(req.Temperature, s.temperature, s.client.temperature)
@@ -453,42 +970,45 @@ func (s *ChatSession) SendStreaming(ctx context.Context, req ChatCompletionReque
 		params.Temperature = openai.Float(*t)
 	}
 
-	stream := s.client.openaiClient.Chat.Completions.NewStreaming(ctx, params)
-
-	acc := openai.ChatCompletionAccumulator{}
+	req.apply(&params)
 
-	var buf strings.Builder
+	if s.client.streamUsage {
+		params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+	}
 
 	return func(yield func(ChatResponse, error) bool) {
-		defer func() {
-			_ = stream.Close()
-		}()
+		var buf strings.Builder
 
-		for stream.Next() {
-			chunk := stream.Current()
-			acc.AddChunk(chunk)
+		usage, ok, err := s.streamCompletion(ctx, params, &buf, yield)
 
-			if refusal, ok := acc.JustFinishedRefusal(); ok {
-				yield(ChatResponse{}, fmt.Errorf("model refused: %v", refusal))
-				return
+		// nothing was streamed yet, so the request can still be retried
+		if buf.Len() == 0 {
+			if msgs, retry := s.contextRetryMessages(err, params.Messages); retry {
+				params.Messages = msgs
+				usage, ok, err = s.streamCompletion(ctx, params, &buf, yield)
 			}
+		}
 
-			if len(chunk.Choices) == 0 {
-				continue
-			}
+		if !ok {
+			return
+		}
 
-			if delta := chunk.Choices[0].Delta.Content; delta != "" {
-				buf.WriteString(delta)
+		// nothing was streamed, so the request can still be sent without streaming
+		if buf.Len() == 0 && isStreamingUnsupportedError(err) {
+			s.logger.Warn("provider does not support streaming, falling back to non-streaming requests", "err", err)
+			s.client.noStreaming.Store(true)
+			s.removeLastUserMessage()
+			s.sendUnstreamed(ctx, req)(yield)
 
-				if !yield(ChatResponse{Content: delta}, nil) {
-					return
-				}
-			}
+			return
 		}
 
-		if err := stream.Err(); err != nil {
+		if err != nil {
 			if errors.Is(err, context.Canceled) {
 				s.removeLastUserMessage()
+				yield(ChatResponse{}, ErrStreamCanceled)
+
+				return
 			}
 
 			yield(ChatResponse{}, fmt.Errorf("stream error: %w", err))
@@ -502,9 +1022,241 @@ func (s *ChatSession) SendStreaming(ctx context.Context, req ChatCompletionReque
 			s.history = append(s.history, param)
 			s.contextUsed = s.tokenCounter.Count(s.history...)
 		}
+
+		// the usage, if requested, arrives in the final chunk
+		estimated := usage.TotalTokens == 0
+		if estimated {
+			usage = s.estimateUsage(params.Messages, buf.String())
+		} else {
+			s.contextUsed = int(usage.TotalTokens)
+		}
+
+		yield(ChatResponse{Usage: usage, UsageEstimated: estimated}, nil)
 	}, nil
 }
 
+// sendUnstreamed sends req with [ChatSession.Send] and yields the complete
+// answer as a single chunk, followed by its usage, like a streamed response.
+func (s *ChatSession) sendUnstreamed(ctx context.Context, req ChatCompletionRequest) ChatResponseIterator {
+	return func(yield func(ChatResponse, error) bool) {
+		s.logger.Info("send non-streaming request", "model", req.Model)
+
+		res, err := s.Send(ctx, req)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				yield(ChatResponse{}, ErrStreamCanceled)
+				return
+			}
+
+			yield(ChatResponse{}, err)
+
+			return
+		}
+
+		if res.Reasoning != "" && !yield(ChatResponse{Reasoning: res.Reasoning}, nil) {
+			return
+		}
+
+		if res.Content != "" && !yield(ChatResponse{Content: res.Content}, nil) {
+			return
+		}
+
+		usage, _ := res.Usage.(openai.CompletionUsage)
+
+		estimated := usage.TotalTokens == 0
+		if estimated {
+			// the history holds the sent messages followed by the reply
+			usage = s.estimateUsage(s.history[:len(s.history)-1], res.Content)
+		} else {
+			s.contextUsed = int(usage.TotalTokens)
+		}
+
+		yield(ChatResponse{Usage: usage, UsageEstimated: estimated}, nil)
+	}
+}
+
+// estimateUsage approximates the usage of a turn that sent
+// the given messages and got reply, using the session token counter.
+func (s *ChatSession) estimateUsage(sent []ChatMessage, reply string) openai.CompletionUsage {
+	var (
+		promptTokens     = s.tokenCounter.Count(sent...)
+		completionTokens = s.tokenCounter.Count(openai.AssistantMessage(reply))
+	)
+
+	return openai.CompletionUsage{
+		PromptTokens:     int64(promptTokens),
+		CompletionTokens: int64(completionTokens),
+		TotalTokens:      int64(promptTokens + completionTokens),
+	}
+}
+
+// streamCompletion streams a single chat completion, yielding its content
+// deltas and writing them to buf. It reports false if the iteration was
+// stopped, either by the consumer or by a model refusal.
+func (s *ChatSession) streamCompletion(
+	ctx context.Context,
+	params openai.ChatCompletionNewParams,
+	buf *strings.Builder,
+	yield func(ChatResponse, error) bool,
+) (openai.CompletionUsage, bool, error) {
+	stream := s.client.openaiClient.Chat.Completions.NewStreaming(ctx, params, s.client.generationOptions()...)
+
+	defer func() {
+		_ = stream.Close()
+	}()
+
+	var (
+		acc      = openai.ChatCompletionAccumulator{}
+		received bool
+	)
+
+	for stream.Next() {
+		chunk := stream.Current()
+		acc.AddChunk(chunk)
+
+		received = true
+
+		if refusal, ok := acc.JustFinishedRefusal(); ok {
+			yield(ChatResponse{}, fmt.Errorf("model refused: %v", refusal))
+			return acc.Usage, false, nil
+		}
+
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		// yielded apart from the content, which alone is kept in the history
+		if reasoning := reasoningOf(chunk.Choices[0].Delta.RawJSON()); reasoning != "" {
+			if !yield(ChatResponse{Reasoning: reasoning}, nil) {
+				return acc.Usage, false, nil
+			}
+		}
+
+		if delta := chunk.Choices[0].Delta.Content; delta != "" {
+			buf.WriteString(delta)
+
+			if !yield(ChatResponse{Content: delta}, nil) {
+				return acc.Usage, false, nil
+			}
+		}
+	}
+
+	if err := stream.Err(); err != nil || received {
+		return acc.Usage, true, err
+	}
+
+	// a provider that ignores the stream request field replies with a
+	// single JSON body, which carries no server-sent events.
+	return acc.Usage, true, errNoStreamEvents
+}
+
+// reasoningFields holds the reasoning of a message or a streamed delta
+// that is sent apart from its content, e.g. as reasoning_content by
+// llama.cpp, vLLM and DeepSeek, or as reasoning by Ollama and OpenRouter.
+type reasoningFields struct {
+	ReasoningContent string `json:"reasoning_content"`
+	Reasoning        string `json:"reasoning"`
+}
+
+// reasoningOf returns the reasoning of the raw JSON of a message
+// or a streamed delta, if any.
+func reasoningOf(raw string) string {
+	if !strings.Contains(raw, `"reasoning`) {
+		return ""
+	}
+
+	var f reasoningFields
+	if err := json.Unmarshal([]byte(raw), &f); err != nil {
+		return ""
+	}
+
+	return cmp.Or(f.ReasoningContent, f.Reasoning)
+}
+
+// contextRetryMessages returns the history truncated to a smaller context
+// if err reports that the sent messages exceeded the model context.
+// It reports false if the smaller context cannot keep the last user message.
+func (s *ChatSession) contextRetryMessages(err error, sent []ChatMessage) ([]ChatMessage, bool) {
+	if !IsContextOverflowError(err) {
+		return nil, false
+	}
+
+	var (
+		attempted = s.tokenCounter.Count(sent...)
+		limit     = int(float64(attempted) * contextRetryRatio)
+		msgs      = TruncateHistory(s.tokenCounter, s.history, limit)
+	)
+
+	if len(msgs) == 0 || len(msgs) >= len(sent) || msgs[len(msgs)-1].OfUser == nil {
+		s.logger.Warn("context length exceeded, cannot retry with a smaller context", "attempted", attempted)
+		return nil, false
+	}
+
+	s.logger.Warn("context length exceeded, retrying with a smaller context", "attempted", attempted, "limit", limit)
+
+	if s.onContextRetry != nil {
+		s.onContextRetry(attempted, limit)
+	}
+
+	return msgs, true
+}
+
+// contextLimitFor returns the context length for req and
+// records it as the current session limit.
+func (s *ChatSession) contextLimitFor(req ChatCompletionRequest) int {
+	s.contextLimit = cmp.Or(req.ContextLength, s.defaultContext)
+
+	return s.contextLimit
+}
+
+// HistoryMessage is a chat history message in its serialized form.
+type HistoryMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// History returns the user and assistant messages of the session,
+// without the system prompt.
+func (s *ChatSession) History() []HistoryMessage {
+	msgs := make([]HistoryMessage, 0, len(s.history))
+
+	for _, m := range s.history {
+		switch {
+		case m.OfUser != nil:
+			msgs = append(msgs, HistoryMessage{Role: "user", Content: messageText(m)})
+		case m.OfAssistant != nil:
+			msgs = append(msgs, HistoryMessage{Role: "assistant", Content: messageText(m)})
+		}
+	}
+
+	return msgs
+}
+
+// SetHistory replaces the user and assistant messages of the session,
+// keeping its system prompt.
+func (s *ChatSession) SetHistory(msgs []HistoryMessage) error {
+	history := make([]ChatMessage, 0, len(msgs)+1)
+	if s.systemPrompt != "" {
+		history = append(history, openai.SystemMessage(s.systemPrompt))
+	}
+
+	for i, m := range msgs {
+		switch m.Role {
+		case "user":
+			history = append(history, openai.UserMessage(m.Content))
+		case "assistant":
+			history = append(history, openai.AssistantMessage(m.Content))
+		default:
+			return fmt.Errorf("history message %d: unsupported role %q", i, m.Role)
+		}
+	}
+
+	s.history = history
+	s.contextUsed = s.tokenCounter.Count(s.history...)
+
+	return nil
+}
+
 // appendUserMessages appends a user message to the chat history.
 func (s *ChatSession) appendUserMessages(msg string) {
 	s.history = append(s.history, openai.UserMessage(msg))
@@ -584,6 +1336,121 @@ func TruncateHistory(tc TokenCounter, msgs []ChatMessage, limit int) []ChatMessa
 	return append(head, tail...)
 }
 
+// contextRetryRatio is the share of the attempted context tokens kept
+// when retrying a request that exceeded the model context.
+const contextRetryRatio = 0.8
+
+// contextOverflowPatterns match the error bodies of providers
+// rejecting requests that exceed the model context.
+var contextOverflowPatterns = []string{
+	"context_length_exceeded",       // openai
+	"maximum context length",        // openai, vllm
+	"exceed_context_size",           // llama.cpp
+	"exceeds the available context", // llama.cpp
+	"context length",                // lm studio and others
+	"context window",
+}
+
+// IsContextOverflowError returns true if the error reports that
+// the request exceeded the model context length.
+func IsContextOverflowError(err error) bool {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	if apiErr.StatusCode != http.StatusBadRequest && apiErr.StatusCode != http.StatusRequestEntityTooLarge {
+		return false
+	}
+
+	body := strings.ToLower(apiErr.RawJSON() + " " + apiErr.Message)
+
+	return slices.ContainsFunc(contextOverflowPatterns, func(p string) bool {
+		return strings.Contains(body, p)
+	})
+}
+
+// errNoStreamEvents is returned by [ChatSession.streamCompletion]
+// for a response with no server-sent events.
+var errNoStreamEvents = errors.New("no stream events received")
+
+// streamingUnsupportedPatterns match the error bodies of providers
+// rejecting streaming requests.
+var streamingUnsupportedPatterns = []string{
+	"streaming is not supported",
+	"streaming not supported",
+	"stream is not supported",
+	"stream not supported",
+	"does not support streaming",
+}
+
+// isStreamingUnsupportedError returns true if err reports that
+// the provider cannot stream chat responses.
+func isStreamingUnsupportedError(err error) bool {
+	if errors.Is(err, errNoStreamEvents) {
+		return true
+	}
+
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	if apiErr.StatusCode != http.StatusBadRequest && apiErr.StatusCode != http.StatusNotImplemented {
+		return false
+	}
+
+	body := strings.ToLower(apiErr.RawJSON() + " " + apiErr.Message)
+
+	return slices.ContainsFunc(streamingUnsupportedPatterns, func(p string) bool {
+		return strings.Contains(body, p)
+	})
+}
+
+// errEmbeddingCountMismatch is returned by [Client.embedArray] for a response
+// with a different number of embeddings than inputs.
+var errEmbeddingCountMismatch = errors.New("embedding count mismatch")
+
+// embedBatchUnsupportedPatterns match the error bodies of providers
+// rejecting an array of embedding inputs.
+var embedBatchUnsupportedPatterns = []string{
+	"array",
+	"expected string",
+	"expected a string",
+	"must be a string",
+	"should be a string",
+	"invalid type",
+	"single input",
+}
+
+// isEmbedBatchUnsupportedError returns true if err reports that
+// the provider accepts a single embedding input per request.
+func isEmbedBatchUnsupportedError(err error) bool {
+	// some providers embed only the first input of an array
+	if errors.Is(err, errEmbeddingCountMismatch) {
+		return true
+	}
+
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	if apiErr.StatusCode != http.StatusBadRequest && apiErr.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+
+	if IsContextOverflowError(err) {
+		return false
+	}
+
+	body := strings.ToLower(apiErr.RawJSON() + " " + apiErr.Message)
+
+	return slices.ContainsFunc(embedBatchUnsupportedPatterns, func(p string) bool {
+		return strings.Contains(body, p)
+	})
+}
+
 // IsRetryableError returns true if the error is retryable.
 // It handles common HTTP codes and network timeouts.
 func IsRetryableError(err error) bool {
@@ -0,0 +1,36 @@
+package ragx
+
+import "errors"
+
+var (
+	ErrInvalidChunkSize    = errors.New("size must be > 0")
+	ErrInvalidChunkOverlap = errors.New("overlap must satisfy 0 <= overlap < size")
+)
+
+// ChunkText splits text into fixed size chunks with overlap.
+func ChunkText(text string, size, overlap int) ([]string, error) {
+	if size <= 0 {
+		return nil, ErrInvalidChunkSize
+	}
+
+	if overlap < 0 || overlap >= size {
+		return nil, ErrInvalidChunkOverlap
+	}
+
+	step := size - overlap
+	r := []rune(text)
+	n := len(r)
+
+	var out []string
+	for i := 0; i < n; i += step {
+		end := min(i+size, n)
+
+		out = append(out, string(r[i:end]))
+
+		if end == n {
+			break
+		}
+	}
+
+	return out, nil
+}
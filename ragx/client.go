@@ -0,0 +1,44 @@
+package ragx
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/types"
+)
+
+// NewClient creates a client for the provider, applying the extra options last.
+// keepAlive is only sent to providers whose kind supports it.
+func NewClient(logger *slog.Logger, c types.ProviderConfig, keepAlive *time.Duration, extra ...llm.Option) *llm.Client {
+	opts := []llm.Option{
+		llm.WithBaseURL(c.BaseURL),
+		llm.WithAPIKey(c.APIKey),
+		llm.WithLogger(logger),
+		llm.WithTemperature(c.Temperature),
+		llm.WithExtraBody(c.ExtraBody),
+		llm.WithStreamUsage(c.StreamUsage),
+	}
+
+	if c.UserAgent != "" {
+		opts = append(opts, llm.WithUserAgent(c.UserAgent))
+	}
+
+	for k, v := range c.Headers {
+		opts = append(opts, llm.WithHeader(k, v))
+	}
+
+	if c.Capabilities.StreamingDisabled() {
+		opts = append(opts, llm.WithStreaming(false))
+	}
+
+	if c.Capabilities.EmbedBatchDisabled() {
+		opts = append(opts, llm.WithEmbedBatch(false))
+	}
+
+	if keepAlive != nil && types.PresetFor(c.Kind).KeepAlive {
+		opts = append(opts, llm.WithKeepAlive(*keepAlive))
+	}
+
+	return llm.NewClient(append(opts, extra...)...)
+}
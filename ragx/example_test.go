@@ -0,0 +1,72 @@
+package ragx_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ladzaretti/ragx-cli/llm/fake"
+	"github.com/ladzaretti/ragx-cli/ragx"
+	"github.com/ladzaretti/ragx-cli/types"
+)
+
+func ExampleEngine() {
+	cfg := ragx.Config{
+		LLM: types.LLMConfig{
+			DefaultModel: "chat",
+			Providers:    []types.ProviderConfig{{BaseURL: "http://localhost:11434/v1", Kind: types.ProviderKindOllama}},
+		},
+		Embedding: types.EmbeddingConfig{
+			Model:     "embed",
+			ChunkSize: 64,
+			TopK:      1,
+		},
+	}
+
+	// an in-memory backend stands in for the configured provider
+	backend := &fake.Backend{Reply: func(string) string { return "apples are red" }}
+
+	engine, err := ragx.NewEngine(cfg, ragx.WithBackend(backend))
+	if err != nil {
+		panic(err)
+	}
+	defer engine.Close()
+
+	ctx := context.Background()
+
+	err = engine.Embed(ctx, []ragx.Document{
+		{Source: "fruit.txt", Content: "apples are red"},
+		{Source: "sky.txt", Content: "the sky is blue"},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	hits, err := engine.Query(ctx, "what color are apples?")
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(hits[0].Content)
+
+	answer, err := engine.Ask(ctx, "what color are apples?")
+	if err != nil {
+		panic(err)
+	}
+
+	var b strings.Builder
+
+	for text, err := range answer {
+		if err != nil {
+			panic(err)
+		}
+
+		b.WriteString(text)
+	}
+
+	fmt.Println(b.String())
+
+	// Output:
+	// apples are red
+	// apples are red
+}
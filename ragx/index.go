@@ -0,0 +1,137 @@
+package ragx
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+// Source holds the chunks of a source to embed into a vector database.
+type Source struct {
+	Meta   vecdb.Meta // Meta describes the source. The index of each chunk is set when stored.
+	Chunks []string   // Chunks are the contents of the chunks, as stored and shown.
+	Inputs []string   // Inputs optionally holds the text to embed of each chunk, if it differs from Chunks.
+}
+
+// Indexer embeds the chunks of sources and stores them in a vector database.
+type Indexer struct {
+	Client     llm.Backend     // Client embeds the chunks.
+	DB         *vecdb.VectorDB // DB stores the embedded chunks.
+	Model      string          // Model is the embedding model.
+	Dimensions *int            // Dimensions optionally requests a reduced embedding size, which the returned embeddings must match.
+	BatchSize  int             // BatchSize bounds the chunks per embedding request. All chunks are sent at once if not positive.
+	Logger     *slog.Logger    // Logger, if set, logs every stored batch at debug level.
+}
+
+// Index embeds and stores the chunks of src in batches,
+// reporting the number of chunks of each stored batch to progress, if set.
+func (ix Indexer) Index(ctx context.Context, src Source, progress func(n int)) error {
+	return ix.embed(ctx, src, progress, func(batch []vecdb.Chunk, i, end int) error {
+		if err := ix.DB.Insert(batch); err != nil {
+			return fmt.Errorf("vectordb insert %q [%d:%d]: %w", src.Meta.Source, i, end, err)
+		}
+
+		return nil
+	})
+}
+
+// Replace embeds all chunks of src and only then replaces the stored chunks
+// of its source and kind with them, so that a failed embedding keeps the old
+// chunks. It returns the number of replaced chunks, and reports the number
+// of chunks of each embedded batch to progress, if set.
+func (ix Indexer) Replace(ctx context.Context, src Source, progress func(n int)) (int, error) {
+	embedded := make([]vecdb.Chunk, 0, len(src.Chunks))
+
+	err := ix.embed(ctx, src, progress, func(batch []vecdb.Chunk, _, _ int) error {
+		embedded = append(embedded, batch...)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := ix.DB.ReplaceSource(src.Meta.Source, src.Meta.Kind, embedded)
+	if err != nil {
+		return 0, fmt.Errorf("vectordb replace %q: %w", src.Meta.Source, err)
+	}
+
+	return n, nil
+}
+
+// embed embeds the chunks of src in batches and passes each batch,
+// along with its range, to store.
+func (ix Indexer) embed(ctx context.Context, src Source, progress func(n int), store func(batch []vecdb.Chunk, i, end int) error) error {
+	var (
+		n         = len(src.Chunks)
+		batchSize = n
+		logger    = cmp.Or(ix.Logger, slog.New(slog.DiscardHandler))
+		inputs    = src.Chunks
+	)
+
+	if ix.BatchSize > 0 {
+		batchSize = ix.BatchSize
+	}
+
+	if src.Inputs != nil {
+		inputs = src.Inputs
+	}
+
+	for i := 0; i < n; i += batchSize {
+		end := min(i+batchSize, n)
+
+		req := llm.EmbedBatchRequest{
+			Input:      inputs[i:end],
+			Model:      ix.Model,
+			Dimensions: ix.Dimensions,
+		}
+
+		res, err := ix.Client.EmbedBatch(ctx, req)
+		if err != nil {
+			return fmt.Errorf("embed batch [%d:%d]: %w", i, end, err)
+		}
+
+		if want, got := end-i, len(res.Vectors); want != got {
+			return fmt.Errorf("embed batch [%d:%d]: want %d, got %d vectors",
+				i, end, want, got)
+		}
+
+		embedded := make([]vecdb.Chunk, 0, len(res.Vectors))
+
+		for j, vec := range res.Vectors {
+			if want := ix.Dimensions; want != nil && *want != len(vec) {
+				return fmt.Errorf("%w: requested %d dimensions, %q returned %d",
+					vecdb.ErrDimMismatch, *want, ix.Model, len(vec))
+			}
+
+			meta := src.Meta
+			meta.Index = i + j
+
+			vecChunk := vecdb.Chunk{
+				Content: src.Chunks[i+j],
+				Vec:     toFloat32Slice(vec),
+				Meta:    meta,
+			}
+			embedded = append(embedded, vecChunk)
+		}
+
+		if err := store(embedded, i, end); err != nil {
+			return err
+		}
+
+		logger.Debug("embedded batch", "range", fmt.Sprintf("[%d:%d]", i, end), "total", n, "source", src.Meta.Source)
+
+		if progress != nil {
+			progress(end - i)
+		}
+
+		if end == n {
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package ragx
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/types"
+)
+
+// Models resolves the chat settings of models from their configured
+// overrides, falling back to the defaults.
+type Models struct {
+	Configured  []types.ModelConfig // Configured lists the per model overrides.
+	Temperature *float64            // Temperature is the default sampling temperature, if set.
+	Context     int                 // Context is the default context length in tokens, if positive.
+	Detected    map[string]int      // Detected holds the provider reported context lengths of models not configuring one.
+}
+
+// Config returns the configuration of model, if any.
+func (m Models) Config(model string) (types.ModelConfig, bool) {
+	i := slices.IndexFunc(m.Configured, func(mc types.ModelConfig) bool { return mc.ID == model })
+	if i == -1 {
+		return types.ModelConfig{}, false
+	}
+
+	return m.Configured[i], true
+}
+
+// ContextLength returns the context length of model: the configured one,
+// else the one reported by its provider, else the default.
+func (m Models) ContextLength(model string) int {
+	mc, _ := m.Config(model)
+
+	return cmp.Or(mc.Context, m.Detected[model], m.Context)
+}
+
+// ChatRequest builds a chat request for model,
+// applying its configured overrides, if any.
+func (m Models) ChatRequest(model, userPrompt string) llm.ChatCompletionRequest {
+	req := llm.ChatCompletionRequest{
+		Model:         model,
+		Prompt:        userPrompt,
+		ContextLength: m.ContextLength(model),
+	}
+
+	if mc, ok := m.Config(model); ok {
+		req.Temperature = cmp.Or(mc.Temperature, m.Temperature)
+		req.GenerationParams = llm.GenerationParams{
+			MaxTokens: mc.MaxTokens,
+			TopP:      mc.TopP,
+			Stop:      mc.Stop,
+		}
+	}
+
+	return req
+}
@@ -0,0 +1,53 @@
+package ragx_test
+
+import (
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/ragx"
+	"github.com/ladzaretti/ragx-cli/types"
+)
+
+func TestModels_ChatRequest(t *testing.T) {
+	var (
+		low, high = 0.1, 0.9
+		maxTokens = 64
+		models    = ragx.Models{
+			Configured:  []types.ModelConfig{{ID: "foo", Context: 1024, Temperature: &low, MaxTokens: &maxTokens}, {ID: "bar"}},
+			Temperature: &high,
+			Context:     512,
+			Detected:    map[string]int{"foo": 8192, "bar": 4096, "baz": 2048},
+		}
+	)
+
+	tests := []struct {
+		model       string
+		wantContext int
+		wantTemp    *float64
+		wantMax     *int
+	}{
+		{model: "foo", wantContext: 1024, wantTemp: &low, wantMax: &maxTokens},
+		{model: "bar", wantContext: 4096, wantTemp: &high},
+		{model: "baz", wantContext: 2048},
+		{model: "qux", wantContext: 512},
+	}
+
+	for _, tt := range tests {
+		req := models.ChatRequest(tt.model, "hi")
+
+		if req.Model != tt.model || req.Prompt != "hi" {
+			t.Errorf("%s: want model and prompt set, got: %+v", tt.model, req)
+		}
+
+		if req.ContextLength != tt.wantContext {
+			t.Errorf("%s: want context length %d, got: %d", tt.model, tt.wantContext, req.ContextLength)
+		}
+
+		if req.Temperature != tt.wantTemp {
+			t.Errorf("%s: want temperature %v, got: %v", tt.model, tt.wantTemp, req.Temperature)
+		}
+
+		if req.MaxTokens != tt.wantMax {
+			t.Errorf("%s: want max tokens %v, got: %v", tt.model, tt.wantMax, req.MaxTokens)
+		}
+	}
+}
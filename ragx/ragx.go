@@ -0,0 +1,336 @@
+// Package ragx exposes the retrieval pipeline of the ragx CLI as a library.
+//
+// An [Engine] chunks and embeds documents into an in-memory vector database,
+// retrieves the chunks nearest to a query, and answers queries grounded in
+// the retrieved chunks. The building blocks it is made of, [ChunkText],
+// [Indexer], [Searcher], [SourceWeights] and [Models], can also be used on
+// their own.
+package ragx
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/ladzaretti/ragx-cli/cli/prompt"
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+var (
+	ErrNoProvider       = errors.New("no provider configured")
+	ErrNoEmbeddingModel = errors.New("no embedding model configured")
+)
+
+// Config configures an [Engine]. Unlike the ragx config file, it is used
+// as is: environment variables are not expanded and no defaults are applied.
+type Config struct {
+	LLM       types.LLMConfig
+	Embedding types.EmbeddingConfig
+	Retrieval types.RetrievalConfig
+	Prompt    types.PromptConfig
+}
+
+// Option configures an [Engine].
+type Option func(*Engine)
+
+// WithLogger sets a custom slog.Logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+// WithBackend serves all models from b instead of the configured providers.
+func WithBackend(b llm.Backend) Option {
+	return func(e *Engine) {
+		e.backends = []llm.Backend{b}
+	}
+}
+
+// Document is a text to embed, identified by its source.
+type Document struct {
+	Source  string
+	Content string
+}
+
+// Engine embeds documents and answers queries from them.
+// It is safe for concurrent use.
+type Engine struct {
+	config   Config
+	logger   *slog.Logger
+	backends []llm.Backend
+	weights  SourceWeights
+
+	mu     sync.Mutex
+	served [][]string // served holds the models listed by each backend, once listed.
+	db     *vecdb.VectorDB
+}
+
+// NewEngine creates an [Engine] from cfg.
+// The vector database is created by the first call to [Engine.Embed].
+func NewEngine(cfg Config, opts ...Option) (*Engine, error) {
+	e := &Engine{
+		config: cfg,
+		logger: slog.New(slog.DiscardHandler),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	if cfg.Embedding.Model == "" {
+		return nil, ErrNoEmbeddingModel
+	}
+
+	if cfg.Embedding.ChunkSize <= 0 {
+		return nil, fmt.Errorf("chunk size: %w", ErrInvalidChunkSize)
+	}
+
+	if cfg.Embedding.Overlap < 0 || cfg.Embedding.Overlap >= cfg.Embedding.ChunkSize {
+		return nil, fmt.Errorf("chunk overlap: %w", ErrInvalidChunkOverlap)
+	}
+
+	weights, err := CompileSourceWeights(cfg.Embedding.SourceWeights)
+	if err != nil {
+		return nil, fmt.Errorf("source weights: %w", err)
+	}
+
+	e.weights = weights
+
+	if e.backends == nil {
+		for _, p := range cfg.LLM.Providers {
+			e.backends = append(e.backends, NewClient(e.logger, p, nil))
+		}
+	}
+
+	if len(e.backends) == 0 {
+		return nil, ErrNoProvider
+	}
+
+	return e, nil
+}
+
+// Close closes the vector database of the engine, if created.
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.db == nil {
+		return nil
+	}
+
+	return e.db.Close()
+}
+
+// Embed chunks docs and embeds their chunks into the vector database.
+func (e *Engine) Embed(ctx context.Context, docs []Document) error {
+	client, err := e.backendFor(ctx, e.config.Embedding.Model)
+	if err != nil {
+		return err
+	}
+
+	db, err := e.vectorDB(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	ix := Indexer{
+		Client:     client,
+		DB:         db,
+		Model:      e.config.Embedding.Model,
+		Dimensions: e.dimensions(),
+		BatchSize:  e.config.Embedding.BatchSize,
+		Logger:     e.logger,
+	}
+
+	for _, d := range docs {
+		chunks, err := ChunkText(d.Content, e.config.Embedding.ChunkSize, e.config.Embedding.Overlap)
+		if err != nil {
+			return fmt.Errorf("chunk %q: %w", d.Source, err)
+		}
+
+		if err := ix.Index(ctx, Source{Meta: vecdb.Meta{Source: d.Source}, Chunks: chunks}, nil); err != nil {
+			return fmt.Errorf("embed %q: %w", d.Source, err)
+		}
+	}
+
+	return nil
+}
+
+// Query returns the embedded chunks nearest to q, up to the configured top k,
+// without those scoring below the configured minimum score.
+// It returns no chunks before any document is embedded.
+func (e *Engine) Query(ctx context.Context, q string) ([]vecdb.SearchResult, error) {
+	e.mu.Lock()
+	db := e.db
+	e.mu.Unlock()
+
+	if db == nil {
+		return nil, nil
+	}
+
+	client, err := e.backendFor(ctx, e.config.Embedding.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Searcher{
+		Client:     client,
+		DB:         db,
+		Model:      e.config.Embedding.Model,
+		Dimensions: e.dimensions(),
+		Mode:       e.config.Retrieval.Mode,
+		Weights:    e.weights,
+	}
+
+	hits, err := s.Search(ctx, q, e.config.Embedding.TopK)
+	if err != nil {
+		return nil, err
+	}
+
+	return vecdb.FilterMinScore(hits, e.config.Retrieval.MinScore), nil
+}
+
+// Ask answers q with the default model, from the chunks retrieved for it,
+// and returns the answer text as it is streamed. Reasoning sent apart from
+// the answer is not yielded.
+func (e *Engine) Ask(ctx context.Context, q string) (iter.Seq2[string, error], error) {
+	model := e.config.LLM.DefaultModel
+	if model == "" {
+		return nil, llm.ErrNoModelSelected
+	}
+
+	hits, err := e.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var promptOpts []prompt.PromptOpt
+	if tmpl := e.config.Prompt.UserPromptTmpl; tmpl != "" {
+		promptOpts = append(promptOpts, prompt.WithUserPromptTmpl(tmpl))
+	}
+
+	p, err := prompt.BuildUserPrompt(q, hits, prompt.DecodeMeta, promptOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("build user prompt: %w", err)
+	}
+
+	client, err := e.backendFor(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+
+	session := client.NewChat(cmp.Or(e.config.Prompt.System, prompt.DefaultSystemPrompt),
+		llm.WithSessionLogger(e.logger),
+	)
+
+	stream, err := session.SendStreaming(ctx, e.models().ChatRequest(model, p))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(yield func(string, error) bool) {
+		for res, err := range stream {
+			if err != nil {
+				yield("", err)
+				return
+			}
+
+			if res.Content == "" {
+				continue
+			}
+
+			if !yield(res.Content, nil) {
+				return
+			}
+		}
+	}, nil
+}
+
+// models returns the chat settings of the configured models.
+func (e *Engine) models() Models {
+	return Models{Configured: e.config.LLM.Models}
+}
+
+// backendFor returns the backend serving model: the only one,
+// or the first to list it among its models.
+func (e *Engine) backendFor(ctx context.Context, model string) (llm.Backend, error) {
+	if len(e.backends) == 1 {
+		return e.backends[0], nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.served == nil {
+		served := make([][]string, len(e.backends))
+
+		for i, b := range e.backends {
+			models, err := b.ListModels(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("list models: %w", err)
+			}
+
+			for _, m := range models {
+				served[i] = append(served[i], m.ID)
+			}
+		}
+
+		e.served = served
+	}
+
+	i := slices.IndexFunc(e.served, func(models []string) bool { return slices.Contains(models, model) })
+	if i == -1 {
+		return nil, fmt.Errorf("no provider found for: %q", model)
+	}
+
+	return e.backends[i], nil
+}
+
+// vectorDB returns the vector database of the engine, creating it on first
+// use with the configured embedding dimensions, if any, or else with the
+// embedding dimension of client.
+func (e *Engine) vectorDB(ctx context.Context, client llm.Backend) (*vecdb.VectorDB, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.db != nil {
+		return e.db, nil
+	}
+
+	dim := e.config.Embedding.Dimensions
+
+	if dim <= 0 {
+		res, err := client.Embed(ctx, llm.EmbedRequest{Model: e.config.Embedding.Model})
+		if err != nil {
+			return nil, fmt.Errorf("dim: %w", err)
+		}
+
+		dim = len(res.Vector)
+	}
+
+	db, err := vecdb.New(dim, vecdb.WithModel(e.config.Embedding.Model))
+	if err != nil {
+		return nil, fmt.Errorf("vectordb: %w", err)
+	}
+
+	e.db = db
+
+	return db, nil
+}
+
+// dimensions returns the configured reduced embedding size, if any.
+func (e *Engine) dimensions() *int {
+	if d := e.config.Embedding.Dimensions; d > 0 {
+		return &d
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package ragx_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/llm/fake"
+	"github.com/ladzaretti/ragx-cli/ragx"
+	"github.com/ladzaretti/ragx-cli/types"
+)
+
+func TestNewEngine_InvalidConfig(t *testing.T) {
+	valid := types.EmbeddingConfig{Model: "foo", ChunkSize: 10}
+
+	tests := []struct {
+		name      string
+		embedding func(c *types.EmbeddingConfig)
+		backend   bool
+		wantErr   error
+	}{
+		{
+			name:      "no embedding model",
+			embedding: func(c *types.EmbeddingConfig) { c.Model = "" },
+			backend:   true,
+			wantErr:   ragx.ErrNoEmbeddingModel,
+		},
+		{
+			name:      "invalid chunk size",
+			embedding: func(c *types.EmbeddingConfig) { c.ChunkSize = 0 },
+			backend:   true,
+			wantErr:   ragx.ErrInvalidChunkSize,
+		},
+		{
+			name:      "invalid overlap",
+			embedding: func(c *types.EmbeddingConfig) { c.Overlap = 10 },
+			backend:   true,
+			wantErr:   ragx.ErrInvalidChunkOverlap,
+		},
+		{
+			name:      "no provider",
+			embedding: func(*types.EmbeddingConfig) {},
+			wantErr:   ragx.ErrNoProvider,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ragx.Config{Embedding: valid}
+			tt.embedding(&cfg.Embedding)
+
+			var opts []ragx.Option
+			if tt.backend {
+				opts = append(opts, ragx.WithBackend(&fake.Backend{}))
+			}
+
+			if _, err := ragx.NewEngine(cfg, opts...); !errors.Is(err, tt.wantErr) {
+				t.Errorf("want error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestEngine_QueryBeforeEmbed(t *testing.T) {
+	backend := &fake.Backend{}
+
+	engine, err := ragx.NewEngine(ragx.Config{
+		Embedding: types.EmbeddingConfig{Model: "foo", ChunkSize: 10, TopK: 3},
+	}, ragx.WithBackend(backend))
+	if err != nil {
+		t.Fatalf("new engine: %v", err)
+	}
+
+	t.Cleanup(func() { _ = engine.Close() })
+
+	hits, err := engine.Query(context.Background(), "bar")
+	if err != nil || len(hits) != 0 {
+		t.Errorf("want no hits, got: %+v, err: %v", hits, err)
+	}
+
+	if embedded := backend.Embedded(); len(embedded) != 0 {
+		t.Errorf("want nothing embedded, got: %q", embedded)
+	}
+}
+
+func TestEngine_ConfiguredDimensions(t *testing.T) {
+	backend := &fake.Backend{}
+
+	engine, err := ragx.NewEngine(ragx.Config{
+		Embedding: types.EmbeddingConfig{Model: "foo", ChunkSize: 10, TopK: 3, Dimensions: 8},
+	}, ragx.WithBackend(backend))
+	if err != nil {
+		t.Fatalf("new engine: %v", err)
+	}
+
+	t.Cleanup(func() { _ = engine.Close() })
+
+	if err := engine.Embed(context.Background(), []ragx.Document{{Source: "a.md", Content: "bar"}}); err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+
+	// the configured dimensions are used without probing the model
+	if embedded := backend.Embedded(); !slices.Equal(embedded, []string{"bar"}) {
+		t.Errorf("want only the document embedded, got: %q", embedded)
+	}
+
+	hits, err := engine.Query(context.Background(), "bar")
+	if err != nil || len(hits) != 1 {
+		t.Errorf("want 1 hit, got: %+v, err: %v", hits, err)
+	}
+}
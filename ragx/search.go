@@ -0,0 +1,101 @@
+package ragx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ladzaretti/ragx-cli/llm"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+// The retrieval modes of a [Searcher].
+const (
+	RetrievalVector = "vector"
+	RetrievalHybrid = "hybrid"
+)
+
+// hybridAlpha weights the vector ranking against the keyword ranking in hybrid mode.
+const hybridAlpha = 0.5
+
+// Searcher retrieves the chunks of a vector database closest to a query.
+type Searcher struct {
+	Client     llm.Backend     // Client embeds the query.
+	DB         *vecdb.VectorDB // DB holds the embedded chunks.
+	Model      string          // Model is the embedding model of the chunks.
+	Dimensions *int            // Dimensions optionally requests a reduced embedding size.
+	Mode       string          // Mode is the retrieval mode, [RetrievalVector] if empty.
+	Weights    SourceWeights   // Weights optionally re-rank the chunks by source.
+	SetStatus  func(string)    // SetStatus, if set, reports the search progress.
+
+	// QueryVector, if set, is the embedding of the query,
+	// which is then not embedded again.
+	QueryVector []float64
+}
+
+// Search embeds query and returns its topK nearest chunks. In hybrid mode,
+// the chunks are ranked by both vector distance and keyword match. With
+// source weights, a larger pool of candidates is retrieved and re-ranked
+// by weighted similarity. A zero topK disables retrieval.
+func (s Searcher) Search(ctx context.Context, query string, topK int) ([]vecdb.SearchResult, error) {
+	if topK == 0 {
+		return nil, nil
+	}
+
+	if len(s.Weights) == 0 {
+		return s.search(ctx, query, topK)
+	}
+
+	hits, err := s.search(ctx, query, topK*sourceWeightPoolFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Weights.Rerank(hits, topK)
+}
+
+// search embeds query and retrieves the topK closest chunks
+// using the retrieval mode.
+func (s Searcher) search(ctx context.Context, query string, topK int) ([]vecdb.SearchResult, error) {
+	vec := s.QueryVector
+
+	if vec == nil {
+		s.status("embedding query")
+
+		q, err := s.Client.Embed(ctx, llm.EmbedRequest{
+			Input:      query,
+			Model:      s.Model,
+			Dimensions: s.Dimensions,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		vec = q.Vector
+	}
+
+	if s.Mode == RetrievalHybrid {
+		s.status(fmt.Sprintf("search hybrid (topK=%d)", topK))
+
+		return s.DB.SearchHybrid(toFloat32Slice(vec), query, topK, hybridAlpha)
+	}
+
+	s.status(fmt.Sprintf("search knn (topK=%d)", topK))
+
+	return s.DB.SearchKNN(toFloat32Slice(vec), topK)
+}
+
+func (s Searcher) status(text string) {
+	if s.SetStatus != nil {
+		s.SetStatus(text)
+	}
+}
+
+func toFloat32Slice(src []float64) (f32 []float32) {
+	f32 = make([]float32, len(src))
+
+	for i, v := range src {
+		f32[i] = float32(v)
+	}
+
+	return f32
+}
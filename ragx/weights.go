@@ -0,0 +1,110 @@
+package ragx
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+// sourceWeightPoolFactor scales top-k to the number of candidates
+// retrieved for re-ranking by source weight.
+const sourceWeightPoolFactor = 4
+
+// sourceWeight is a compiled [types.SourceWeight].
+type sourceWeight struct {
+	match  *regexp.Regexp
+	tag    string
+	weight float64
+}
+
+// SourceWeights re-rank retrieved chunks by the weight of their source.
+type SourceWeights []sourceWeight
+
+// CompileSourceWeights validates and compiles the configured source weights.
+func CompileSourceWeights(weights []types.SourceWeight) (SourceWeights, error) {
+	compiled := make(SourceWeights, 0, len(weights))
+
+	for i, w := range weights {
+		if w.Match == "" && w.Tag == "" {
+			return nil, fmt.Errorf("weight %d: one of match or tag is required", i)
+		}
+
+		if w.Weight <= 0 {
+			return nil, fmt.Errorf("weight %d: weight must be positive", i)
+		}
+
+		sw := sourceWeight{tag: w.Tag, weight: w.Weight}
+
+		if w.Match != "" {
+			re, err := regexp.Compile(w.Match)
+			if err != nil {
+				return nil, fmt.Errorf("weight %d: invalid match regex %q: %w", i, w.Match, err)
+			}
+
+			sw.match = re
+		}
+
+		compiled = append(compiled, sw)
+	}
+
+	return compiled, nil
+}
+
+// matches reports whether the chunk described by meta is weighted by w.
+// Both the match regex and the tag must match, if set.
+func (w sourceWeight) matches(meta vecdb.Meta) bool {
+	if w.match != nil && !w.match.MatchString(filepath.ToSlash(meta.Source)) {
+		return false
+	}
+
+	return w.tag == "" || slices.Contains(meta.Tags, w.tag)
+}
+
+// weightOf returns the product of the weights matching meta, or 1 if none does.
+func (ws SourceWeights) weightOf(meta vecdb.Meta) float64 {
+	weight := 1.0
+
+	for _, w := range ws {
+		if w.matches(meta) {
+			weight *= w.weight
+		}
+	}
+
+	return weight
+}
+
+// Rerank orders hits by their similarity score multiplied by the
+// weight of their source, and returns the top k. Ties keep the search order.
+func (ws SourceWeights) Rerank(hits []vecdb.SearchResult, k int) ([]vecdb.SearchResult, error) {
+	type scored struct {
+		hit   vecdb.SearchResult
+		score float64
+	}
+
+	ranked := make([]scored, 0, len(hits))
+
+	for _, h := range hits {
+		meta, err := vecdb.DecodeMeta(h.Meta)
+		if err != nil {
+			return nil, fmt.Errorf("decode meta: %w", err)
+		}
+
+		ranked = append(ranked, scored{hit: h, score: vecdb.Score(h.Distance) * ws.weightOf(meta)})
+	}
+
+	slices.SortStableFunc(ranked, func(a, b scored) int {
+		return cmp.Compare(b.score, a.score)
+	})
+
+	out := make([]vecdb.SearchResult, 0, min(k, len(ranked)))
+	for _, r := range ranked[:min(k, len(ranked))] {
+		out = append(out, r.hit)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,88 @@
+package ragx_test
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/ragx"
+	"github.com/ladzaretti/ragx-cli/types"
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+func TestSourceWeights_Rerank(t *testing.T) {
+	hit := func(source string, distance float64, tags ...string) vecdb.SearchResult {
+		meta, err := json.Marshal(vecdb.Meta{Source: source, Tags: tags})
+		if err != nil {
+			t.Fatalf("marshal meta: %v", err)
+		}
+
+		return vecdb.SearchResult{Content: source, Distance: distance, Meta: meta}
+	}
+
+	hits := []vecdb.SearchResult{
+		hit("docs/old.md", 0.5, "deprecated"),
+		hit("docs/other.md", 0.8),
+		hit("CHANGELOG.md", 1.0),
+	}
+
+	tests := []struct {
+		name    string
+		weights []types.SourceWeight
+		k       int
+		want    []string
+	}{
+		{
+			name: "no weights keeps the search order",
+			k:    3,
+			want: []string{"docs/old.md", "docs/other.md", "CHANGELOG.md"},
+		},
+		{
+			name:    "weighted path outranks closer chunks",
+			weights: []types.SourceWeight{{Match: `^CHANGELOG`, Weight: 2}},
+			k:       3,
+			want:    []string{"CHANGELOG.md", "docs/old.md", "docs/other.md"},
+		},
+		{
+			name:    "downweighted tag ranks below farther chunks",
+			weights: []types.SourceWeight{{Tag: "deprecated", Weight: 0.5}},
+			k:       2,
+			want:    []string{"docs/other.md", "CHANGELOG.md"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weights, err := ragx.CompileSourceWeights(tt.weights)
+			if err != nil {
+				t.Fatalf("compile weights: %v", err)
+			}
+
+			ranked, err := weights.Rerank(slices.Clone(hits), tt.k)
+			if err != nil {
+				t.Fatalf("rerank: %v", err)
+			}
+
+			got := make([]string, 0, len(ranked))
+			for _, r := range ranked {
+				got = append(got, r.Content)
+			}
+
+			if !slices.Equal(tt.want, got) {
+				t.Errorf("want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCompileSourceWeights_Invalid(t *testing.T) {
+	for _, w := range []types.SourceWeight{
+		{Weight: 2},
+		{Match: "foo", Weight: 0},
+		{Match: "(", Weight: 2},
+	} {
+		if _, err := ragx.CompileSourceWeights([]types.SourceWeight{w}); err == nil {
+			t.Errorf("want an error for %+v", w)
+		}
+	}
+}
@@ -1,36 +1,226 @@
 package types
 
+import (
+	"strconv"
+
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
 type LLMConfig struct {
 	DefaultModel string           `json:"default_model,omitempty" toml:"default_model"       comment:"Default model to use"`
-	Providers    []ProviderConfig `json:"providers,omitempty"     toml:"providers,commented" comment:"LLM providers (uncomment and duplicate as needed)\n[[llm.providers]]\nbase_url = 'http://localhost:11434'\napi_key = '<KEY>'\t\t# optional\ntemperature = 0.7\t\t# optional (provider default)"`
-	Models       []ModelConfig    `json:"models,omitempty"        toml:"models,commented"    comment:"Optional model definitions for context length control (uncomment and duplicate as needed)\n[[llm.models]]\nid = 'qwen:8b'\t\t# Model identifier\ncontext = 4096\t\t# Maximum context length in tokens\ntemperature = 0.7\t\t# optional (model override)"`
+	Providers    []ProviderConfig `json:"providers,omitempty"     toml:"providers,commented" comment:"LLM providers (uncomment and duplicate as needed)\n[[llm.providers]]\nbase_url = 'http://localhost:11434/v1'\napi_key = '${OPENAI_API_KEY}'\t\t# optional; ${VAR} and ${VAR:-default} are expanded from the environment\nkind = 'ollama'\t\t# optional (openai, ollama, llamacpp, lmstudio; default: openai)\ntemperature = 0.7\t\t# optional (provider default)\nextra_body = { min_p = 0.05, repeat_penalty = 1.1 }\t\t# optional, provider specific fields sent as is (not validated)\nstream_usage = true\t\t# optional, request token usage when streaming\nmax_concurrency = 4\t\t# optional, files embedded concurrently by this provider (default: embedding.concurrency)\nuser_agent = 'ragx'\t\t# optional (default: ragx/<version>)\nheaders = { 'OpenAI-Organization' = 'org-123' }\t\t# optional, sent with every request; ${VAR} and ${VAR:-default} are expanded from the environment\nca_file = 'internal-ca.pem'\t\t# optional, CA certificates trusted in addition to the system ones, relative to the config file directory\ninsecure_skip_verify = true\t\t# optional, skip TLS certificate verification (insecure)\ncapabilities = { streaming = false, embed_batch = false }	\t# optional, features the provider supports (default: detected)"`
+	Models       []ModelConfig    `json:"models,omitempty"        toml:"models,commented"    comment:"Optional model definitions for context length control (uncomment and duplicate as needed)\n[[llm.models]]\nid = 'qwen:8b'\t\t# Model identifier\ncontext = 4096\t\t# Maximum context length in tokens (default: as reported by the provider)\ntemperature = 0.7\t\t# optional (model override)\nmax_tokens = 1024\t\t# optional\ntop_p = 0.9\t\t# optional\nstop = ['</answer>']\t\t# optional\nprice_in = 0.00015\t\t# optional, price per 1K prompt tokens (chat cost estimate)\nprice_out = 0.0006\t\t# optional, price per 1K completion tokens"`
 }
 
 type ModelConfig struct {
 	ID          string   `json:"id,omitempty"          toml:"id,commented"          comment:"Model identifier"`
-	Context     int      `json:"context,omitempty"     toml:"context,commented"     comment:"Maximum context length in tokens"`
+	Context     int      `json:"context,omitempty"     toml:"context,commented"     comment:"Maximum context length in tokens (default: as reported by the provider, if any)"`
 	Temperature *float64 `json:"temperature,omitempty" toml:"temperature,commented" comment:"Optional model-level temperature override"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"  toml:"max_tokens,commented"  comment:"Optional maximum number of tokens to generate"`
+	TopP        *float64 `json:"top_p,omitempty"       toml:"top_p,commented"       comment:"Optional nucleus sampling probability mass (0.0-1.0)"`
+	Stop        []string `json:"stop,omitempty"        toml:"stop,commented"        comment:"Optional stop sequences"`
+	PriceIn     float64  `json:"price_in,omitempty"    toml:"price_in,commented"    comment:"Optional price per 1K prompt tokens, for the chat cost estimate"`
+	PriceOut    float64  `json:"price_out,omitempty"   toml:"price_out,commented"   comment:"Optional price per 1K completion tokens, for the chat cost estimate"`
+}
+
+// Provider kinds. The generic OpenAI-compatible kind is the default.
+const (
+	ProviderKindOpenAI   = "openai"
+	ProviderKindOllama   = "ollama"
+	ProviderKindLlamaCPP = "llamacpp"
+	ProviderKindLMStudio = "lmstudio"
+)
+
+var ProviderKinds = []string{ProviderKindOpenAI, ProviderKindOllama, ProviderKindLlamaCPP, ProviderKindLMStudio}
+
+// ProviderPreset holds the defaults and capabilities of a provider kind.
+type ProviderPreset struct {
+	BaseURL       string // BaseURL is used when the provider has no base URL configured.
+	KeepAlive     bool   // KeepAlive reports whether the server accepts the keep_alive request field.
+	ListModels    bool   // ListModels reports whether the server can list its models.
+	ContextWindow bool   // ContextWindow reports whether the server reports the context window models are served with.
+}
+
+var providerPresets = map[string]ProviderPreset{
+	ProviderKindOpenAI:   {BaseURL: "https://api.openai.com/v1", ListModels: true},
+	ProviderKindOllama:   {BaseURL: "http://localhost:11434/v1", KeepAlive: true, ListModels: true, ContextWindow: true},
+	ProviderKindLlamaCPP: {BaseURL: "http://localhost:8080/v1", ContextWindow: true},
+	ProviderKindLMStudio: {BaseURL: "http://localhost:1234/v1", ListModels: true},
+}
+
+// PresetFor returns the preset of the given provider kind.
+// An empty or unknown kind falls back to the generic OpenAI preset.
+func PresetFor(kind string) ProviderPreset {
+	if p, ok := providerPresets[kind]; ok {
+		return p
+	}
+
+	return providerPresets[ProviderKindOpenAI]
 }
+
 type ProviderConfig struct {
-	BaseURL     string   `json:"base_url"              toml:"base_url"              comment:"Base URL for the LLM server (e.g., Ollama, OpenAI API-compatible)"`
-	APIKey      string   `json:"api_key,omitempty"     toml:"api_key,commented"     comment:"Optional API key if required"`
-	Temperature *float64 `json:"temperature,omitempty" toml:"temperature,commented" comment:"Default temperature for this provider (optional)"`
+	BaseURL            string            `json:"base_url"                       toml:"base_url"                       comment:"Base URL for the LLM server (e.g., Ollama, OpenAI API-compatible); defaults to the preset of kind, if set"`
+	APIKey             string            `json:"api_key,omitempty"              toml:"api_key,commented"              comment:"Optional API key if required (supports ${ENV_VAR} references)"`
+	APIKeyFile         string            `json:"api_key_file,omitempty"         toml:"api_key_file,commented"         comment:"Optional file holding the API key, relative to the config file directory; used if api_key is unset"`
+	APIKeyCmd          string            `json:"api_key_cmd,omitempty"          toml:"api_key_cmd,commented"          comment:"Optional shell command printing the API key (e.g. 'pass show openai'); used if api_key and api_key_file are unset"`
+	Kind               string            `json:"kind,omitempty"                 toml:"kind,commented"                 comment:"Optional provider kind (openai, ollama, llamacpp, lmstudio; default: openai)"`
+	Temperature        *float64          `json:"temperature,omitempty"          toml:"temperature,commented"          comment:"Default temperature for this provider (optional)"`
+	ExtraBody          map[string]any    `json:"extra_body,omitempty"           toml:"extra_body,commented"           comment:"Optional provider specific fields merged into chat requests as is (not validated)"`
+	StreamUsage        bool              `json:"stream_usage,omitempty"         toml:"stream_usage,commented"         comment:"Request token usage in streaming responses (stream_options.include_usage), if the provider supports it"`
+	MaxConcurrency     int               `json:"max_concurrency,omitempty"      toml:"max_concurrency,commented"      comment:"Maximum number of files embedded concurrently by this provider (default: embedding.concurrency)"`
+	UserAgent          string            `json:"user_agent,omitempty"           toml:"user_agent,commented"           comment:"User-Agent header sent with every request (default: ragx/<version>)"`
+	Headers            map[string]string `json:"headers,omitempty"              toml:"headers,commented"              comment:"Optional HTTP headers sent with every request, overriding user_agent (supports ${ENV_VAR} references)"`
+	CAFile             string            `json:"ca_file,omitempty"              toml:"ca_file,commented"              comment:"Optional PEM file of CA certificates trusted in addition to the system ones, relative to the config file directory"`
+	InsecureSkipVerify bool              `json:"insecure_skip_verify,omitempty" toml:"insecure_skip_verify,commented" comment:"Skip TLS certificate verification (insecure; for self-signed test endpoints only)"`
+	Capabilities       *Capabilities     `json:"capabilities,omitempty"         toml:"capabilities,commented"         comment:"Optional features supported by the provider; unset features are assumed supported and detected at runtime"`
+}
+
+// Capabilities declares the features supported by a provider.
+type Capabilities struct {
+	Streaming  *bool `json:"streaming,omitempty"   toml:"streaming,commented"   comment:"Stream chat responses; when false, answers are received at once (default: true, disabled on detection)"`
+	EmbedBatch *bool `json:"embed_batch,omitempty" toml:"embed_batch,commented" comment:"Send several inputs per embedding request; when false, inputs are embedded one request at a time (default: true, disabled on detection)"`
+}
+
+// StreamingDisabled reports whether streaming is declared unsupported.
+func (c *Capabilities) StreamingDisabled() bool {
+	return c != nil && c.Streaming != nil && !*c.Streaming
+}
+
+// EmbedBatchDisabled reports whether batched embedding requests are declared unsupported.
+func (c *Capabilities) EmbedBatchDisabled() bool {
+	return c != nil && c.EmbedBatch != nil && !*c.EmbedBatch
 }
 
 type PromptConfig struct {
-	System         string `json:"system_prompt,omitempty"    toml:"system_prompt,commented"    comment:"System prompt to override the default assistant behavior"`
-	UserPromptTmpl string `json:"user_prompt_tmpl,omitempty" toml:"user_prompt_tmpl,commented" comment:"Go text/template for building the USER QUERY + CONTEXT block.\nSupported template vars:\n  .Query   — the user's raw query string\n  .Chunks  — slice of retrieved chunks (may be empty). Each chunk has:\n      .ID       — numeric identifier of the chunk\n      .Source   — source file/path of the chunk\n      .Content  — text content of the chunk"`
+	System             string `json:"system_prompt,omitempty"         toml:"system_prompt,commented"         comment:"System prompt to override the default assistant behavior"`
+	SystemFile         string `json:"system_prompt_file,omitempty"    toml:"system_prompt_file,commented"    comment:"Optional file holding the system prompt, relative to the config file directory; takes precedence over system_prompt"`
+	UserPromptTmpl     string `json:"user_prompt_tmpl,omitempty"      toml:"user_prompt_tmpl,commented"      comment:"Go text/template for building the USER QUERY + CONTEXT block.\nSupported template vars:\n  .Query   — the user's raw query string\n  .Chunks  — slice of retrieved chunks (may be empty). Each chunk has:\n      .ID       — numeric identifier of the chunk\n      .Source   — source file/path of the chunk\n      .Content  — text content of the chunk\n      .Distance — distance of the chunk from the query (lower is more relevant)\nSupported template functions:\n  truncate n s  — the first n runes of s, followed by \"...\" if cut\n  indent n s    — s with every line indented by n spaces\n  numbered s    — s with every line prefixed by its number\n  trim s        — s without surrounding white space\n  add a b       — a + b, e.g. {{add $i 1}}"`
+	UserPromptTmplFile string `json:"user_prompt_tmpl_file,omitempty" toml:"user_prompt_tmpl_file,commented" comment:"Optional file holding the user prompt template, relative to the config file directory; takes precedence over user_prompt_tmpl"`
+	ContextReserve     int    `json:"context_reserve,omitempty"       toml:"context_reserve,commented"       comment:"Tokens of the model context kept for the system prompt, history and answer; the lowest ranked chunks are dropped from prompts exceeding the rest"`
 }
 
 type EmbeddingConfig struct {
-	Model     string `json:"embedding_model,omitempty" toml:"embedding_model"      comment:"Model used for embeddings"`
-	ChunkSize int    `json:"chunk_size,omitempty"      toml:"chunk_size,commented" comment:"Number of characters per chunk"`
-	Overlap   int    `json:"overlap,omitempty"         toml:"overlap,commented"    comment:"Number of characters overlapped between chunks (must be less than chunk_size)"`
-	TopK      int    `json:"top_k,omitempty"           toml:"top_k,commented"      comment:"Number of chunks to retrieve during RAG"`
+	Model            string         `json:"embedding_model,omitempty"   toml:"embedding_model"             comment:"Model used for embeddings"`
+	ChunkSize        int            `json:"chunk_size,omitempty"        toml:"chunk_size,commented"        comment:"Number of characters per chunk"`
+	Overlap          int            `json:"overlap,omitempty"           toml:"overlap,commented"           comment:"Number of characters overlapped between chunks (must be less than chunk_size)"`
+	TopK             int            `json:"top_k,omitempty"             toml:"top_k,commented"             comment:"Number of chunks to retrieve during RAG"`
+	Dimensions       int            `json:"dimensions,omitempty"        toml:"dimensions,commented"        comment:"Optional reduced embedding size for models that support it (e.g. text-embedding-3-*)"`
+	MaxFileBytes     int64          `json:"max_file_bytes,omitempty"    toml:"max_file_bytes,commented"    comment:"Files larger than this many bytes are skipped when embedding (0 uses the default)"`
+	BatchSize        int            `json:"batch_size,omitempty"        toml:"batch_size,commented"        comment:"Number of chunks sent per embedding request (lower it for local servers, e.g. 16 for ollama)"`
+	Concurrency      int            `json:"concurrency,omitempty"       toml:"concurrency,commented"       comment:"Number of files embedded concurrently per provider, unless overridden by llm.providers.max_concurrency"`
+	CachePath        string         `json:"cache_path,omitempty"        toml:"cache_path,commented"        comment:"Optional path of an on-disk cache of embeddings, keyed by provider, model and input (e.g. '/var/cache/ragx/embeddings.db')"`
+	IndexPaths       bool           `json:"index_paths,omitempty"       toml:"index_paths,commented"       comment:"Also embed the path of each file as a dedicated chunk (tagged kind=path), so that questions about file locations retrieve the file"`
+	Frontmatter      bool           `json:"frontmatter,omitempty"       toml:"frontmatter,commented"       comment:"Parse the YAML frontmatter of markdown files into the chunk metadata (title, tags) instead of embedding it as text"`
+	FrontmatterTitle bool           `json:"frontmatter_title,omitempty" toml:"frontmatter_title,commented" comment:"With frontmatter, prepend the title of a markdown file to its first chunk"`
+	DecodeEntities   bool           `json:"decode_entities,omitempty"   toml:"decode_entities,commented"   comment:"Decode HTML entities (e.g. &amp;) in the embedded text of HTML and markdown files; chunks are shown as is"`
+	StripMarkup      bool           `json:"strip_markup,omitempty"      toml:"strip_markup,commented"      comment:"Strip HTML tags and markdown syntax from the embedded text of HTML and markdown files; chunks are shown as is"`
+	SanitizeUTF8     bool           `json:"sanitize_utf8,omitempty"     toml:"sanitize_utf8,commented"     comment:"Replace invalid UTF-8 sequences with U+FFFD instead of skipping the file; binary files are still skipped"`
+	Ignore           []string       `json:"ignore,omitempty"            toml:"ignore,commented"            comment:"Gitignore style patterns skipped when walking directories, in addition to the root .gitignore\ne.g. ignore = ['vendor/', '*.min.js']"`
+	SourceWeights    []SourceWeight `json:"source_weights,omitempty"    toml:"source_weights,commented"    comment:"Multiply the similarity score of retrieved chunks by weight when re-ranking, for sources whose path matches the match regex or whose frontmatter tags include tag\ne.g. source_weights = [{ match = 'CHANGELOG', weight = 1.5 }, { tag = 'deprecated', weight = 0.5 }]"`
+	Extractors       []string       `json:"extractors,omitempty"        toml:"extractors,commented"        comment:"Extract and embed the text of documents of these formats instead of skipping them as binary (supported: docx, epub, pdf)\ne.g. extractors = ['pdf', 'docx']"`
+}
+
+// SourceWeight scales the similarity score of retrieved chunks whose source
+// path matches the Match regex, or whose frontmatter tags include Tag.
+type SourceWeight struct {
+	Match  string  `json:"match,omitempty" toml:"match,omitempty"`
+	Tag    string  `json:"tag,omitempty"   toml:"tag,omitempty"`
+	Weight float64 `json:"weight"          toml:"weight"`
+}
+
+type RetrievalConfig struct {
+	Mode     string  `json:"mode,omitempty"      toml:"mode,commented"      comment:"Retrieval mode: 'vector' (semantic search) or 'hybrid' (vector + keyword search)"`
+	MinScore float64 `json:"min_score,omitempty" toml:"min_score,commented" comment:"Drop retrieved chunks scoring below this similarity, between 0 and 1;\nthe score of an L2 distance d is 1/(1+d), e.g. 0.5 drops chunks farther than 1.0 (default: 0, keep all)"`
+}
+
+type OutputConfig struct {
+	JSONFields           map[string]string `json:"json_fields,omitempty"             toml:"json_fields,commented"             comment:"Rename the top-level keys of JSON output (keys: answer, query, chunks, citations)\ne.g. json_fields = { answer = 'response', chunks = 'context' }"`
+	NoContextMessage     string            `json:"no_context_message,omitempty"      toml:"no_context_message,commented"      comment:"Answer printed without calling the LLM when no relevant chunks are retrieved;\nalso replaces the fallback answer of the default system prompt"`
+	NoContextMaxDistance float64           `json:"no_context_max_distance,omitempty" toml:"no_context_max_distance,commented" comment:"Chunks farther than this distance from the query are not relevant for no_context_message (default: 0, any retrieved chunk is relevant)"`
+	DistancePrecision    *int              `json:"distance_precision,omitempty"      toml:"distance_precision,commented"      comment:"Number of decimal places of the retrieval distances shown in the chat sources and --dry-run (default: 4)"`
+	DistanceUnit         string            `json:"distance_unit,omitempty"           toml:"distance_unit,commented"           comment:"How retrieval distances are shown: 'distance' (raw L2 distance), 'similarity' (0-1, higher is closer) or 'percent' (default: distance)"`
+}
+
+// Distance units of [OutputConfig.DistanceUnit].
+const (
+	DistanceUnitDistance   = "distance"
+	DistanceUnitSimilarity = "similarity"
+	DistanceUnitPercent    = "percent"
+)
+
+var DistanceUnits = []string{DistanceUnitDistance, DistanceUnitSimilarity, DistanceUnitPercent}
+
+// DefaultDistancePrecision is the default number of decimal places of formatted distances.
+const DefaultDistancePrecision = 4
+
+// FormatDistance formats an L2 retrieval distance in the configured unit and precision.
+// Similarity is the [vecdb.Score] of the distance.
+func (c OutputConfig) FormatDistance(d float64) string {
+	precision := DefaultDistancePrecision
+	if c.DistancePrecision != nil {
+		precision = *c.DistancePrecision
+	}
+
+	switch c.DistanceUnit {
+	case DistanceUnitSimilarity:
+		return strconv.FormatFloat(vecdb.Score(d), 'f', precision, 64)
+	case DistanceUnitPercent:
+		return strconv.FormatFloat(100*vecdb.Score(d), 'f', precision, 64) + "%"
+	default:
+		return strconv.FormatFloat(d, 'f', precision, 64)
+	}
+}
+
+// Chat key binding actions of [KeysConfig].
+const (
+	KeySubmit  = "submit"
+	KeyCancel  = "cancel"
+	KeyPrefix  = "prefix"
+	KeyNewChat = "new_chat"
+	KeyHistory = "history"
+	KeyModels  = "models"
+	KeyClear   = "clear"
+)
+
+// DefaultKeys are the default chat key bindings, by action.
+var DefaultKeys = map[string]string{
+	KeySubmit:  "ctrl+s",
+	KeyCancel:  "esc",
+	KeyPrefix:  "ctrl+a",
+	KeyNewChat: "ctrl+n",
+	KeyHistory: "h",
+	KeyModels:  "m",
+	KeyClear:   "l",
+}
+
+// KeyActions lists the chat key binding actions, in display order.
+var KeyActions = []string{KeySubmit, KeyCancel, KeyPrefix, KeyNewChat, KeyHistory, KeyModels, KeyClear}
+
+// KeysConfig maps chat actions to keys, in bubbletea key notation (e.g. "ctrl+s").
+// The history, models and clear actions are pressed after the prefix key.
+type KeysConfig map[string]string
+
+// Key returns the key bound to action, falling back to its default.
+func (k KeysConfig) Key(action string) string {
+	if key, ok := k[action]; ok && key != "" {
+		return key
+	}
+
+	return DefaultKeys[action]
 }
 
 type LoggingConfig struct {
-	Dir      string `json:"log_dir,omitempty"   toml:"log_dir,commented"      comment:"Directory where log file will be stored (default: XDG_STATE_HOME or ~/.local/state/ragx)"`
-	Filename string `json:"log_file,omitempty"  toml:"log_filename,commented" comment:"Filename for the log file"`
-	Level    string `json:"log_level,omitempty" toml:"log_level,commented"`
+	Dir       string `json:"log_dir,omitempty"    toml:"log_dir,commented"      comment:"Directory where log file will be stored (default: XDG_STATE_HOME or ~/.local/state/ragx)"`
+	Filename  string `json:"log_file,omitempty"   toml:"log_filename,commented" comment:"Filename for the log file"`
+	Level     string `json:"log_level,omitempty"  toml:"log_level,commented"`
+	Format    string `json:"format,omitempty"     toml:"format,commented"       comment:"Log record format (text, json; default: text)"`
+	AddSource bool   `json:"add_source,omitempty" toml:"add_source,commented"   comment:"Include the source file and line of each log record"`
 }
+
+// Log formats of [LoggingConfig.Format].
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+var LogFormats = []string{LogFormatText, LogFormatJSON}
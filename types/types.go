@@ -8,9 +8,12 @@ import (
 )
 
 type Provider struct {
-	Client          *llm.Client
-	Session         *llm.ChatSession
+	BaseURL         string // BaseURL identifies the provider, e.g. in caches.
+	Client          llm.Backend
+	Session         llm.Session
+	Preset          ProviderPreset
 	AvailableModels []string
+	MaxConcurrency  int // MaxConcurrency caps the files embedded concurrently, if positive.
 }
 
 func (p *Provider) Supports(model string) bool { return slices.Contains(p.AvailableModels, model) }
@@ -26,3 +29,16 @@ func (o *Providers) ProviderFor(model string) (Provider, error) {
 
 	return Provider{}, fmt.Errorf("no provider found for: %q", model)
 }
+
+// ProvidersFor returns all providers that support the given model.
+func (o *Providers) ProvidersFor(model string) []*Provider {
+	var ps []*Provider
+
+	for _, p := range *o {
+		if p.Supports(model) {
+			ps = append(ps, p)
+		}
+	}
+
+	return ps
+}
@@ -2,9 +2,23 @@ package vecdb
 
 import "encoding/json"
 
+// KindPath marks chunks that hold the path of their source rather than its content.
+const KindPath = "path"
+
 type Meta struct {
-	Source string `json:"path,omitempty"`
-	Index  int    `json:"index,omitempty"`
+	Source string   `json:"path,omitempty"`
+	Index  int      `json:"index,omitempty"`
+	Kind   string   `json:"kind,omitempty"`
+	Title  string   `json:"title,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+
+	// ModTime, in Unix nanoseconds, and Size are the stat of the source
+	// file when its chunks were stored, if it is a file.
+	ModTime int64 `json:"mtime,omitempty"`
+	Size    int64 `json:"size,omitempty"`
+
+	// Chunking is a fingerprint of the config the source file was chunked with.
+	Chunking string `json:"chunking,omitempty"`
 }
 
 func DecodeMeta(raw json.RawMessage) (Meta, error) {
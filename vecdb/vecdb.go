@@ -1,19 +1,39 @@
 package vecdb
 
 import (
+	"cmp"
 	_ "embed" // required for embedding sqlite_vec
 	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 
 	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/ncruces" //nolint:revive //common alias
 	"github.com/ncruces/go-sqlite3"
 )
 
+// VectorDB is a sqlite backed vector store. It is safe for concurrent use.
+//
+// Writes go through a single read-write connection. A file-backed database
+// also opens a read-only connection for searches, so that with WAL journaling
+// reads see the last committed state instead of waiting on a running write.
 type VectorDB struct {
-	db   *sqlite3.Conn
-	dim  int
-	path string
+	mu sync.Mutex // guards db
+	db *sqlite3.Conn
+
+	// ro is the connection used for reads, guarded by roMu.
+	// An in-memory or read-only database has a single connection,
+	// in which case ro is db and roMu is &mu.
+	roMu *sync.Mutex
+	ro   *sqlite3.Conn
+
+	dim   int
+	model string
+	path  string
 }
 
 type Opt func(*VectorDB)
@@ -24,11 +44,26 @@ func WithPath(p string) Opt {
 	}
 }
 
+// WithModel sets the embedding model the database is built with.
+// It is recorded on first use, and opening a database built with
+// a different model fails with [ErrModelMismatch].
+func WithModel(name string) Opt {
+	return func(v *VectorDB) {
+		v.model = name
+	}
+}
+
 var (
-	ErrInvalidDim  = errors.New("invalid dim: must be > 0")
-	ErrDimMismatch = errors.New("vector dim mismatch")
+	ErrInvalidDim    = errors.New("invalid dim: must be > 0")
+	ErrDimMismatch   = errors.New("vector dim mismatch")
+	ErrModelMismatch = errors.New("embedding model mismatch")
+	ErrInvalidAlpha  = errors.New("invalid alpha: must be between 0 and 1")
+	ErrNotVectorDB   = errors.New("not a vector database")
 )
 
+// MetricL2 is the distance metric used for vector search.
+const MetricL2 = "l2"
+
 const schema = `
 CREATE TABLE IF NOT EXISTS
 	chunks (
@@ -38,8 +73,20 @@ CREATE TABLE IF NOT EXISTS
 	);
 
 CREATE VIRTUAL TABLE IF NOT EXISTS vec_items USING vec0(embedding float[%d]);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS
+	chunks_fts USING fts5(content, content = 'chunks', content_rowid = 'rowid');
+
+CREATE TABLE IF NOT EXISTS
+	db_meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
 `
 
+// metaModel is the db_meta key holding the embedding model name.
+const metaModel = "model"
+
 func New(dim int, opts ...Opt) (*VectorDB, error) {
 	v := &VectorDB{
 		path: ":memory:",
@@ -60,24 +107,237 @@ func New(dim int, opts ...Opt) (*VectorDB, error) {
 	}
 
 	err = db.Exec(
-		"PRAGMA journal_mode=WAL;" +
+		"PRAGMA journal_mode=WAL; PRAGMA busy_timeout=5000;" +
 			fmt.Sprintf(schema, v.dim))
 	if err != nil {
-		_ = v.db.Close()
+		_ = db.Close()
 		return nil, fmt.Errorf("create schema: %w", err)
 	}
 
 	v.db = db
 
+	// an existing database keeps its schema, so its dim must match
+	if stored, err := v.storedDim(); err != nil || stored != v.dim {
+		_ = db.Close()
+		return nil, cmp.Or(err, fmt.Errorf("%w: database has %d, want %d", ErrDimMismatch, stored, v.dim))
+	}
+
+	if err := v.syncModel(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	if err := v.openReader(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
 	return v, nil
 }
 
+// openReader opens the read-only connection used for searches.
+// An in-memory database is private to its connection, so reads share it.
+func (v *VectorDB) openReader() error {
+	v.ro, v.roMu = v.db, &v.mu
+
+	if v.path == ":memory:" {
+		return nil
+	}
+
+	ro, err := sqlite3.OpenFlags(v.path, sqlite3.OPEN_READONLY)
+	if err != nil {
+		return fmt.Errorf("sqlite3 open reader: %w", err)
+	}
+
+	if err := ro.Exec("PRAGMA busy_timeout=5000;"); err != nil {
+		_ = ro.Close()
+		return fmt.Errorf("configure reader: %w", err)
+	}
+
+	v.ro, v.roMu = ro, new(sync.Mutex)
+
+	return nil
+}
+
+// read calls f with the read connection held.
+func (v *VectorDB) read(f func(conn *sqlite3.Conn) error) error {
+	v.roMu.Lock()
+	defer v.roMu.Unlock()
+
+	return f(v.ro)
+}
+
+// vecDimRE matches the embedding dimension of the vec_items table definition.
+var vecDimRE = regexp.MustCompile(`float\[(\d+)\]`)
+
+// Open opens an existing vector database at path in read-only mode.
+// The embedding dimension is read from the stored schema.
+func Open(path string) (*VectorDB, error) {
+	db, err := sqlite3.OpenFlags(path, sqlite3.OPEN_READONLY)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3 open: %w", err)
+	}
+
+	v := &VectorDB{db: db, path: path}
+	v.ro, v.roMu = db, &v.mu
+
+	if v.dim, err = v.storedDim(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	if v.model, err = v.storedModel(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// syncModel records the configured embedding model in a database that has
+// none, and rejects a database built with a different one.
+// Without a configured model, the stored one is kept.
+func (v *VectorDB) syncModel() error {
+	stored, err := v.storedModel()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case v.model == "":
+		v.model = stored
+	case stored == "":
+		if err := v.storeModel(); err != nil {
+			return err
+		}
+	case stored != v.model:
+		return fmt.Errorf("%w: database has %q, want %q", ErrModelMismatch, stored, v.model)
+	}
+
+	return nil
+}
+
+// storeModel records the embedding model in db_meta.
+func (v *VectorDB) storeModel() error {
+	stmt, _, err := v.db.Prepare(`INSERT INTO db_meta(key, value) VALUES (?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare model insert: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	if err := stmt.BindText(1, metaModel); err != nil {
+		return fmt.Errorf("bind model key: %w", err)
+	}
+
+	if err := stmt.BindText(2, v.model); err != nil {
+		return fmt.Errorf("bind model: %w", err)
+	}
+
+	if err := stmt.Exec(); err != nil {
+		return fmt.Errorf("store embedding model: %w", err)
+	}
+
+	return nil
+}
+
+// storedModel returns the recorded embedding model, or "" if there is none.
+// Databases created before the model was recorded have no db_meta table.
+func (v *VectorDB) storedModel() (string, error) {
+	stmt, _, err := v.db.Prepare(`SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'db_meta'`)
+	if err != nil {
+		return "", fmt.Errorf("prepare meta lookup: %w", err)
+	}
+
+	exists := stmt.Step()
+	err = cmp.Or(stmt.Err(), stmt.Close())
+
+	if err != nil {
+		return "", fmt.Errorf("meta lookup: %w", err)
+	}
+
+	if !exists {
+		return "", nil
+	}
+
+	stmt, _, err = v.db.Prepare(`SELECT value FROM db_meta WHERE key = ?`)
+	if err != nil {
+		return "", fmt.Errorf("prepare model lookup: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	if err := stmt.BindText(1, metaModel); err != nil {
+		return "", fmt.Errorf("bind model key: %w", err)
+	}
+
+	if !stmt.Step() {
+		if err := stmt.Err(); err != nil {
+			return "", fmt.Errorf("model lookup: %w", err)
+		}
+
+		return "", nil
+	}
+
+	return stmt.ColumnText(0), nil
+}
+
+func (v *VectorDB) storedDim() (int, error) {
+	stmt, _, err := v.db.Prepare(`SELECT sql FROM sqlite_master WHERE name = 'vec_items'`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare schema lookup: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	if !stmt.Step() {
+		if err := stmt.Err(); err != nil {
+			return 0, fmt.Errorf("schema lookup: %w", err)
+		}
+
+		return 0, fmt.Errorf("%w: missing vec_items table", ErrNotVectorDB)
+	}
+
+	m := vecDimRE.FindStringSubmatch(stmt.ColumnText(0))
+	if m == nil {
+		return 0, fmt.Errorf("%w: unknown vec_items schema", ErrNotVectorDB)
+	}
+
+	return strconv.Atoi(m[1])
+}
+
+// Dim returns the embedding dimension of the database.
+func (v *VectorDB) Dim() int { return v.dim }
+
+// Model returns the embedding model the database was built with,
+// or "" if it was not recorded.
+func (v *VectorDB) Model() string { return v.model }
+
+// Metric returns the distance metric used for vector search.
+func (*VectorDB) Metric() string { return MetricL2 }
+
+// Close closes the database. A file-backed database opened for writing
+// checkpoints its write-ahead log into the database file first,
+// truncating the -wal file.
 func (v *VectorDB) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
 	if v.db == nil {
 		return nil
 	}
 
-	return v.db.Close()
+	if v.ro == v.db {
+		return v.db.Close()
+	}
+
+	// the reader is closed first, so it does not hold back the checkpoint
+	v.roMu.Lock()
+	err := v.ro.Close()
+	v.roMu.Unlock()
+
+	if cerr := v.db.Exec("PRAGMA wal_checkpoint(TRUNCATE);"); cerr != nil {
+		err = errors.Join(err, fmt.Errorf("checkpoint: %w", cerr))
+	}
+
+	return errors.Join(err, v.db.Close())
 }
 
 type (
@@ -98,7 +358,26 @@ type SearchResult struct {
 	Meta     json.RawMessage
 }
 
+// Score maps a [MetricL2] distance to a similarity score in (0, 1],
+// where 1 is an exact match: 1/(1+distance).
+func Score(distance float64) float64 { return 1 / (1 + distance) }
+
+// FilterMinScore returns the results scoring at least minScore, keeping their order.
+// A zero minScore keeps all results.
+func FilterMinScore(results []SearchResult, minScore float64) []SearchResult {
+	if minScore <= 0 {
+		return results
+	}
+
+	return slices.DeleteFunc(slices.Clone(results), func(r SearchResult) bool {
+		return Score(r.Distance) < minScore
+	})
+}
+
 func (v *VectorDB) Insert(chunks []Chunk) (retErr error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
 	if err := v.db.Exec("BEGIN"); err != nil {
 		return fmt.Errorf("begin: %w", err)
 	}
@@ -111,6 +390,20 @@ func (v *VectorDB) Insert(chunks []Chunk) (retErr error) {
 		}
 	}()
 
+	if err := v.insertChunks(chunks); err != nil {
+		return err
+	}
+
+	if err := v.db.Exec("COMMIT"); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	return nil
+}
+
+// insertChunks inserts chunks, their vectors and keyword index entries
+// within the running transaction.
+func (v *VectorDB) insertChunks(chunks []Chunk) (retErr error) {
 	stmt, _, err := v.db.Prepare(`INSERT INTO chunks (content, meta) VALUES (?, ?) RETURNING rowid`)
 	if err != nil {
 		return err
@@ -122,7 +415,10 @@ func (v *VectorDB) Insert(chunks []Chunk) (retErr error) {
 		}
 	}()
 
-	items := make(map[rid]Vector, len(chunks))
+	var (
+		items    = make(map[rid]Vector, len(chunks))
+		contents = make(map[rid]string, len(chunks))
+	)
 
 	for _, c := range chunks {
 		stmt.BindText(1, c.Content)
@@ -131,6 +427,7 @@ func (v *VectorDB) Insert(chunks []Chunk) (retErr error) {
 		for stmt.Step() {
 			rowid := rid(stmt.ColumnInt64(0))
 			items[rowid] = c.Vec
+			contents[rowid] = c.Content
 		}
 
 		if err := stmt.Err(); err != nil {
@@ -144,8 +441,8 @@ func (v *VectorDB) Insert(chunks []Chunk) (retErr error) {
 		return fmt.Errorf("insert vectors: %w", err)
 	}
 
-	if err := v.db.Exec("COMMIT"); err != nil {
-		return fmt.Errorf("commit: %w", err)
+	if err := v.insertFTS(contents); err != nil {
+		return fmt.Errorf("insert fts: %w", err)
 	}
 
 	return nil
@@ -186,6 +483,374 @@ func (v *VectorDB) insertItems(items map[rid]Vector) (retErr error) {
 	return nil
 }
 
+// insertFTS indexes the content of the given chunks for keyword search.
+func (v *VectorDB) insertFTS(contents map[rid]string) (retErr error) {
+	stmt, _, err := v.db.Prepare("INSERT INTO chunks_fts(rowid, content) VALUES (?, ?)")
+	if err != nil {
+		return fmt.Errorf("prepare insert: %w", err)
+	}
+
+	defer func() {
+		if err := stmt.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("insert fts close stmt: %w", err))
+		}
+	}()
+
+	for rid, content := range contents {
+		stmt.BindInt64(1, int64(rid))
+		stmt.BindText(2, content)
+
+		if err := stmt.Exec(); err != nil {
+			return fmt.Errorf("exec insert rowid=%d: %w", rid, err)
+		}
+
+		stmt.Reset()
+	}
+
+	return nil
+}
+
+// DeleteBySource removes the chunks of source, along with their vectors
+// and keyword index entries, and returns the number of deleted chunks.
+func (v *VectorDB) DeleteBySource(source string) (n int, retErr error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.db.Exec("BEGIN"); err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+
+	defer func() {
+		if retErr != nil {
+			if err := v.db.Exec("ROLLBACK"); err != nil {
+				retErr = errors.Join(retErr, fmt.Errorf("rollback: %w", err))
+			}
+		}
+	}()
+
+	// vec_items and the keyword index are keyed by the chunk rowid,
+	// so the rowids must be collected before the chunks are deleted.
+	contents, err := v.chunksBySource(source)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := v.deleteChunks(contents); err != nil {
+		return 0, err
+	}
+
+	if err := v.db.Exec("COMMIT"); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+
+	return len(contents), nil
+}
+
+// ReplaceSource replaces the stored chunks of source of the given kind
+// with chunks in a single transaction, so that the old chunks are kept if
+// the insert fails, and returns the number of replaced chunks.
+// The content chunks of a source have an empty kind.
+func (v *VectorDB) ReplaceSource(source, kind string, chunks []Chunk) (n int, retErr error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.db.Exec("BEGIN"); err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+
+	defer func() {
+		if retErr != nil {
+			if err := v.db.Exec("ROLLBACK"); err != nil {
+				retErr = errors.Join(retErr, fmt.Errorf("rollback: %w", err))
+			}
+		}
+	}()
+
+	contents, err := v.chunksBySourceKind(source, kind)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := v.deleteChunks(contents); err != nil {
+		return 0, err
+	}
+
+	if err := v.insertChunks(chunks); err != nil {
+		return 0, err
+	}
+
+	if err := v.db.Exec("COMMIT"); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+
+	return len(contents), nil
+}
+
+// deleteChunks removes the given chunks, along with their vectors
+// and keyword index entries, within the running transaction.
+func (v *VectorDB) deleteChunks(contents map[rid]string) error {
+	if err := v.deleteFTS(contents); err != nil {
+		return fmt.Errorf("delete fts: %w", err)
+	}
+
+	for _, table := range []string{"vec_items", "chunks"} {
+		if err := v.deleteRows(table, contents); err != nil {
+			return fmt.Errorf("delete %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// chunksBySource returns the content of the chunks of source by rowid.
+func (v *VectorDB) chunksBySource(source string) (map[rid]string, error) {
+	stmt, _, err := v.db.Prepare(`SELECT rowid, content FROM chunks WHERE json_extract(meta, '$.path') = ?`)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	stmt.BindText(1, source)
+
+	contents := make(map[rid]string)
+
+	for stmt.Step() {
+		contents[rid(stmt.ColumnInt64(0))] = stmt.ColumnText(1)
+	}
+
+	if err := stmt.Err(); err != nil {
+		return nil, fmt.Errorf("select chunks: %w", err)
+	}
+
+	return contents, nil
+}
+
+// chunksBySourceKind returns the content of the chunks of source
+// of the given kind by rowid.
+func (v *VectorDB) chunksBySourceKind(source, kind string) (map[rid]string, error) {
+	stmt, _, err := v.db.Prepare(`SELECT rowid, content FROM chunks WHERE json_extract(meta, '$.path') = ? AND coalesce(json_extract(meta, '$.kind'), '') = ?`)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	stmt.BindText(1, source)
+	stmt.BindText(2, kind)
+
+	contents := make(map[rid]string)
+
+	for stmt.Step() {
+		contents[rid(stmt.ColumnInt64(0))] = stmt.ColumnText(1)
+	}
+
+	if err := stmt.Err(); err != nil {
+		return nil, fmt.Errorf("select chunks: %w", err)
+	}
+
+	return contents, nil
+}
+
+// deleteFTS removes the given chunks from the keyword index.
+// The index is an external content table, so the original content is required.
+func (v *VectorDB) deleteFTS(contents map[rid]string) (retErr error) {
+	stmt, _, err := v.db.Prepare("INSERT INTO chunks_fts(chunks_fts, rowid, content) VALUES ('delete', ?, ?)")
+	if err != nil {
+		return fmt.Errorf("prepare delete: %w", err)
+	}
+
+	defer func() {
+		if err := stmt.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("delete fts close stmt: %w", err))
+		}
+	}()
+
+	for rid, content := range contents {
+		stmt.BindInt64(1, int64(rid))
+		stmt.BindText(2, content)
+
+		if err := stmt.Exec(); err != nil {
+			return fmt.Errorf("exec delete rowid=%d: %w", rid, err)
+		}
+
+		stmt.Reset()
+	}
+
+	return nil
+}
+
+// deleteRows removes the given rowids from table.
+func (v *VectorDB) deleteRows(table string, rows map[rid]string) (retErr error) {
+	stmt, _, err := v.db.Prepare("DELETE FROM " + table + " WHERE rowid = ?")
+	if err != nil {
+		return fmt.Errorf("prepare delete: %w", err)
+	}
+
+	defer func() {
+		if err := stmt.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("delete rows close stmt: %w", err))
+		}
+	}()
+
+	for rid := range rows {
+		stmt.BindInt64(1, int64(rid))
+
+		if err := stmt.Exec(); err != nil {
+			return fmt.Errorf("exec delete rowid=%d: %w", rid, err)
+		}
+
+		stmt.Reset()
+	}
+
+	return nil
+}
+
+// Clear removes all chunks, vectors and their keyword index.
+func (v *VectorDB) Clear() (retErr error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.db.Exec("BEGIN"); err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+
+	defer func() {
+		if retErr != nil {
+			if err := v.db.Exec("ROLLBACK"); err != nil {
+				retErr = errors.Join(retErr, fmt.Errorf("rollback: %w", err))
+			}
+		}
+	}()
+
+	err := v.db.Exec(`
+INSERT INTO chunks_fts(chunks_fts) VALUES ('delete-all');
+DELETE FROM vec_items;
+DELETE FROM chunks;`)
+	if err != nil {
+		return fmt.Errorf("clear: %w", err)
+	}
+
+	if err := v.db.Exec("COMMIT"); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	return nil
+}
+
+// Count returns the total number of stored chunks.
+func (v *VectorDB) Count() (n int, err error) {
+	err = v.read(func(conn *sqlite3.Conn) error {
+		stmt, _, err := conn.Prepare(`SELECT count(*) FROM chunks`)
+		if err != nil {
+			return fmt.Errorf("prepare count: %w", err)
+		}
+		defer func() { _ = stmt.Close() }()
+
+		if !stmt.Step() {
+			return fmt.Errorf("count: %w", stmt.Err())
+		}
+
+		n = stmt.ColumnInt(0)
+
+		return nil
+	})
+
+	return n, err
+}
+
+// SourceStat is the number of chunks stored for a single source.
+type SourceStat struct {
+	Source string `json:"source"`
+	Chunks int    `json:"chunks"`
+}
+
+const sourcesQuery = `
+SELECT
+	json_extract(meta, '$.path'),
+	count(*)
+FROM
+	chunks
+GROUP BY
+	1
+ORDER BY
+	1`
+
+// Sources returns the per-source chunk counts, ordered by source.
+// Chunks without a source are grouped under an empty source.
+func (v *VectorDB) Sources() (out []SourceStat, err error) {
+	err = v.read(func(conn *sqlite3.Conn) error {
+		stmt, _, err := conn.Prepare(sourcesQuery)
+		if err != nil {
+			return fmt.Errorf("prepare sources: %w", err)
+		}
+		defer func() { _ = stmt.Close() }()
+
+		for stmt.Step() {
+			out = append(out, SourceStat{
+				Source: stmt.ColumnText(0),
+				Chunks: stmt.ColumnInt(1),
+			})
+		}
+
+		if err := stmt.Err(); err != nil {
+			return fmt.Errorf("sources: %w", err)
+		}
+
+		return nil
+	})
+
+	return out, err
+}
+
+// SourceStamp is the modification time, in Unix nanoseconds, and the size
+// a source file had when its chunks were stored, along with the fingerprint
+// of the config it was chunked with. It is zero for sources stored without
+// a stamp, e.g. URLs and piped data.
+type SourceStamp struct {
+	ModTime  int64
+	Size     int64
+	Chunking string
+}
+
+const sourceStampsQuery = `
+SELECT
+	json_extract(meta, '$.path'),
+	max(json_extract(meta, '$.mtime')),
+	max(json_extract(meta, '$.size')),
+	max(json_extract(meta, '$.chunking'))
+FROM
+	chunks
+GROUP BY
+	1`
+
+// SourceStamps returns the stamps of all stored sources by source.
+func (v *VectorDB) SourceStamps() (out map[string]SourceStamp, err error) {
+	out = make(map[string]SourceStamp)
+
+	err = v.read(func(conn *sqlite3.Conn) error {
+		stmt, _, err := conn.Prepare(sourceStampsQuery)
+		if err != nil {
+			return fmt.Errorf("prepare source stamps: %w", err)
+		}
+		defer func() { _ = stmt.Close() }()
+
+		for stmt.Step() {
+			out[stmt.ColumnText(0)] = SourceStamp{
+				ModTime:  stmt.ColumnInt64(1),
+				Size:     stmt.ColumnInt64(2),
+				Chunking: stmt.ColumnText(3),
+			}
+		}
+
+		if err := stmt.Err(); err != nil {
+			return fmt.Errorf("source stamps: %w", err)
+		}
+
+		return nil
+	})
+
+	return out, err
+}
+
 const searchKNNQuery = `
 SELECT
 	c.rowid,
@@ -215,29 +880,210 @@ func (v *VectorDB) SearchKNN(q Vector, k int) ([]SearchResult, error) {
 		return nil, fmt.Errorf("serialize knn search query: %w", err)
 	}
 
-	stmt, _, err := v.db.Prepare(searchKNNQuery)
+	out := make([]SearchResult, 0, k)
+
+	err = v.read(func(conn *sqlite3.Conn) error {
+		stmt, _, err := conn.Prepare(searchKNNQuery)
+		if err != nil {
+			return fmt.Errorf("prepare search: %w", err)
+		}
+		defer stmt.Close()
+
+		stmt.BindBlob(1, query)
+		stmt.BindInt(2, k)
+
+		for stmt.Step() {
+			out = append(out, SearchResult{
+				ID:       rid(stmt.ColumnInt64(0)),
+				Content:  stmt.ColumnText(1),
+				Meta:     json.RawMessage(stmt.ColumnText(2)),
+				Distance: stmt.ColumnFloat(3),
+			})
+		}
+
+		if err := stmt.Err(); err != nil {
+			return fmt.Errorf("query step: %w", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("prepare search: %w", err)
+		return nil, err
 	}
-	defer stmt.Close()
 
-	stmt.BindBlob(1, query)
-	stmt.BindInt(2, k)
+	return out, nil
+}
 
-	out := make([]SearchResult, 0, k)
+const searchFTSQuery = `
+SELECT
+	c.rowid,
+	c.content,
+	c.meta
+FROM
+	chunks_fts AS f
+	JOIN chunks AS c ON c.rowid = f.rowid
+WHERE
+	chunks_fts MATCH ?
+ORDER BY
+	bm25(chunks_fts)
+LIMIT
+	?`
 
-	for stmt.Step() {
-		out = append(out, SearchResult{
-			ID:       rid(stmt.ColumnInt64(0)),
-			Content:  stmt.ColumnText(1),
-			Meta:     json.RawMessage(stmt.ColumnText(2)),
-			Distance: stmt.ColumnFloat(3),
-		})
+// searchFTS returns up to k chunks matching any of the terms of text,
+// ordered by their BM25 score. The distance of the results is not set.
+func (v *VectorDB) searchFTS(text string, k int) ([]SearchResult, error) {
+	match := ftsQuery(text)
+	if match == "" {
+		return nil, nil
 	}
 
-	if err := stmt.Err(); err != nil {
-		return nil, fmt.Errorf("query step: %w", err)
+	out := make([]SearchResult, 0, k)
+
+	err := v.read(func(conn *sqlite3.Conn) error {
+		stmt, _, err := conn.Prepare(searchFTSQuery)
+		if err != nil {
+			return fmt.Errorf("prepare fts search: %w", err)
+		}
+		defer stmt.Close()
+
+		stmt.BindText(1, match)
+		stmt.BindInt(2, k)
+
+		for stmt.Step() {
+			out = append(out, SearchResult{
+				ID:      rid(stmt.ColumnInt64(0)),
+				Content: stmt.ColumnText(1),
+				Meta:    json.RawMessage(stmt.ColumnText(2)),
+			})
+		}
+
+		if err := stmt.Err(); err != nil {
+			return fmt.Errorf("fts query step: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return out, nil
 }
+
+// ftsQuery turns free text into an FTS5 query matching any of its terms.
+// Each term is quoted so that FTS5 syntax in the input is taken literally.
+func ftsQuery(text string) string {
+	terms := strings.Fields(text)
+
+	for i, t := range terms {
+		terms[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+
+	return strings.Join(terms, " OR ")
+}
+
+func (v *VectorDB) distance(q []byte, id rid) (d float64, err error) {
+	err = v.read(func(conn *sqlite3.Conn) error {
+		stmt, _, err := conn.Prepare("SELECT vec_distance_l2(embedding, ?) FROM vec_items WHERE rowid = ?")
+		if err != nil {
+			return fmt.Errorf("prepare distance: %w", err)
+		}
+		defer stmt.Close()
+
+		stmt.BindBlob(1, q)
+		stmt.BindInt64(2, int64(id))
+
+		if stmt.Step() {
+			d = stmt.ColumnFloat(0)
+		}
+
+		if err := stmt.Err(); err != nil {
+			return fmt.Errorf("distance query step: %w", err)
+		}
+
+		return nil
+	})
+
+	return d, err
+}
+
+const (
+	// rrfK is the reciprocal rank fusion smoothing constant.
+	rrfK = 60
+
+	// hybridPoolFactor scales k to the number of candidates
+	// fetched from each of the rankings before fusion.
+	hybridPoolFactor = 4
+)
+
+// SearchHybrid combines vector and keyword (BM25) search over the chunks
+// using weighted reciprocal rank fusion, and returns the top k results.
+//
+// alpha weights the vector ranking against the keyword ranking:
+// 1 is pure vector search, 0 is pure keyword search.
+func (v *VectorDB) SearchHybrid(q Vector, text string, k int, alpha float64) ([]SearchResult, error) {
+	if alpha < 0 || alpha > 1 {
+		return nil, ErrInvalidAlpha
+	}
+
+	if k <= 0 {
+		k = 5
+	}
+
+	pool := k * hybridPoolFactor
+
+	vecHits, err := v.SearchKNN(q, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	ftsHits, err := v.searchFTS(text, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		scores = make(map[rid]float64, len(vecHits)+len(ftsHits))
+		hits   = make(map[rid]SearchResult, len(vecHits)+len(ftsHits))
+	)
+
+	for i, h := range vecHits {
+		scores[h.ID] += alpha / float64(rrfK+i+1)
+		hits[h.ID] = h
+	}
+
+	query, err := sqlite_vec.SerializeFloat32(q)
+	if err != nil {
+		return nil, fmt.Errorf("serialize hybrid search query: %w", err)
+	}
+
+	for i, h := range ftsHits {
+		scores[h.ID] += (1 - alpha) / float64(rrfK+i+1)
+
+		if _, ok := hits[h.ID]; ok {
+			continue
+		}
+
+		// keyword only hit; resolve its vector distance
+		if h.Distance, err = v.distance(query, h.ID); err != nil {
+			return nil, err
+		}
+
+		hits[h.ID] = h
+	}
+
+	out := make([]SearchResult, 0, len(hits))
+	for _, h := range hits {
+		out = append(out, h)
+	}
+
+	slices.SortFunc(out, func(a, b SearchResult) int {
+		if c := cmp.Compare(scores[b.ID], scores[a.ID]); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(a.Distance, b.Distance)
+	})
+
+	return out[:min(k, len(out))], nil
+}
@@ -0,0 +1,506 @@
+package vecdb_test
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ladzaretti/ragx-cli/vecdb"
+)
+
+func newTestDB(t *testing.T, chunks []vecdb.Chunk) *vecdb.VectorDB {
+	t.Helper()
+
+	db, err := vecdb.New(2)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := db.Insert(chunks); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	return db
+}
+
+func TestSearchHybrid_ExactTokenRanksFirst(t *testing.T) {
+	chunks := []vecdb.Chunk{
+		{Content: "general configuration of the tool", Vec: vecdb.Vector{1, 0}},
+		{Content: "the request fails with ERR_FOO_42 on startup", Vec: vecdb.Vector{0, 1}},
+		{Content: "unrelated notes about logging", Vec: vecdb.Vector{0.7, 0.7}},
+	}
+
+	var (
+		db    = newTestDB(t, chunks)
+		q     = vecdb.Vector{0.9, 0.1}
+		text  = "ERR_FOO_42"
+		exact = chunks[1].Content
+	)
+
+	knn, err := db.SearchKNN(q, 3)
+	if err != nil {
+		t.Fatalf("search knn: %v", err)
+	}
+
+	if len(knn) == 0 || knn[0].Content == exact {
+		t.Fatalf("expected vector search not to rank the exact match first, got: %+v", knn)
+	}
+
+	hybrid, err := db.SearchHybrid(q, text, 3, 0.5)
+	if err != nil {
+		t.Fatalf("search hybrid: %v", err)
+	}
+
+	if len(hybrid) != 3 {
+		t.Fatalf("want 3 results, got %d", len(hybrid))
+	}
+
+	if got := hybrid[0].Content; got != exact {
+		t.Errorf("want first hybrid result: %q, got: %q", exact, got)
+	}
+
+	if hybrid[0].Distance == 0 {
+		t.Errorf("want vector distance set on hybrid results, got 0")
+	}
+}
+
+func TestSearchHybrid_InvalidAlpha(t *testing.T) {
+	db := newTestDB(t, nil)
+
+	if _, err := db.SearchHybrid(vecdb.Vector{1, 0}, "foo", 3, 1.5); err == nil {
+		t.Errorf("expected error for alpha out of range")
+	}
+}
+
+func TestClear(t *testing.T) {
+	db := newTestDB(t, []vecdb.Chunk{
+		{Content: "foo bar", Vec: vecdb.Vector{1, 0}},
+	})
+
+	if err := db.Clear(); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+
+	hits, err := db.SearchHybrid(vecdb.Vector{1, 0}, "foo", 3, 0.5)
+	if err != nil {
+		t.Fatalf("search hybrid: %v", err)
+	}
+
+	if len(hits) != 0 {
+		t.Errorf("want no results after clear, got: %+v", hits)
+	}
+}
+
+func TestOpen_Stats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foo.db")
+
+	db, err := vecdb.New(2, vecdb.WithPath(path))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	err = db.Insert([]vecdb.Chunk{
+		{Content: "foo", Vec: vecdb.Vector{1, 0}, Meta: vecdb.Meta{Source: "a.md", Index: 0}},
+		{Content: "bar", Vec: vecdb.Vector{0, 1}, Meta: vecdb.Meta{Source: "a.md", Index: 1}},
+		{Content: "baz", Vec: vecdb.Vector{1, 1}, Meta: vecdb.Meta{Source: "b.md", Index: 0}},
+	})
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	db, err = vecdb.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	if got := db.Dim(); got != 2 {
+		t.Errorf("want dim 2, got: %d", got)
+	}
+
+	n, err := db.Count()
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+
+	if n != 3 {
+		t.Errorf("want 3 chunks, got: %d", n)
+	}
+
+	sources, err := db.Sources()
+	if err != nil {
+		t.Fatalf("sources: %v", err)
+	}
+
+	want := []vecdb.SourceStat{{Source: "a.md", Chunks: 2}, {Source: "b.md", Chunks: 1}}
+	if !slices.Equal(want, sources) {
+		t.Errorf("want sources: %+v, got: %+v", want, sources)
+	}
+
+	if err := db.Insert([]vecdb.Chunk{{Content: "qux", Vec: vecdb.Vector{0, 0}}}); err == nil {
+		t.Error("want insert into a read-only database to fail")
+	}
+}
+
+func TestOpen_MissingFile(t *testing.T) {
+	if _, err := vecdb.Open(filepath.Join(t.TempDir(), "missing.db")); err == nil {
+		t.Error("want error opening a missing database")
+	}
+}
+
+func TestClose_CheckpointsWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foo.db")
+
+	db, err := vecdb.New(2, vecdb.WithPath(path))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	if err := db.Insert([]vecdb.Chunk{{Content: "foo", Vec: vecdb.Vector{1, 0}, Meta: vecdb.Meta{Source: "a.md"}}}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if fi, err := os.Stat(path + "-wal"); err == nil && fi.Size() > 0 {
+		t.Errorf("want an empty or removed wal file after close, got %d bytes", fi.Size())
+	}
+
+	db, err = vecdb.New(2, vecdb.WithPath(path))
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	n, err := db.Count()
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+
+	if n != 1 {
+		t.Errorf("want 1 chunk after reopening, got: %d", n)
+	}
+}
+
+func TestDeleteBySource(t *testing.T) {
+	db := newTestDB(t, []vecdb.Chunk{
+		{Content: "foo one", Vec: vecdb.Vector{1, 0}, Meta: vecdb.Meta{Source: "a.md", Index: 0}},
+		{Content: "foo two", Vec: vecdb.Vector{0.9, 0.1}, Meta: vecdb.Meta{Source: "a.md", Index: 1}},
+		{Content: "bar", Vec: vecdb.Vector{0, 1}, Meta: vecdb.Meta{Source: "b.md", Index: 0}},
+	})
+
+	n, err := db.DeleteBySource("a.md")
+	if err != nil {
+		t.Fatalf("delete by source: %v", err)
+	}
+
+	if n != 2 {
+		t.Errorf("want 2 deleted chunks, got: %d", n)
+	}
+
+	hits, err := db.SearchKNN(vecdb.Vector{1, 0}, 5)
+	if err != nil {
+		t.Fatalf("search knn: %v", err)
+	}
+
+	if len(hits) != 1 || hits[0].Content != "bar" {
+		t.Fatalf("want only the b.md chunk to survive, got: %+v", hits)
+	}
+
+	hybrid, err := db.SearchHybrid(vecdb.Vector{1, 0}, "foo", 5, 0)
+	if err != nil {
+		t.Fatalf("search hybrid: %v", err)
+	}
+
+	for _, h := range hybrid {
+		if h.Content != "bar" {
+			t.Errorf("want deleted chunks removed from the keyword index, got: %+v", h)
+		}
+	}
+
+	if n, err := db.DeleteBySource("missing.md"); err != nil || n != 0 {
+		t.Errorf("want no chunks deleted for an unknown source, got: %d, %v", n, err)
+	}
+}
+
+func TestReplaceSource(t *testing.T) {
+	db := newTestDB(t, []vecdb.Chunk{
+		{Content: "foo one", Vec: vecdb.Vector{1, 0}, Meta: vecdb.Meta{Source: "a.md", Index: 0}},
+		{Content: "foo two", Vec: vecdb.Vector{0.9, 0.1}, Meta: vecdb.Meta{Source: "a.md", Index: 1}},
+		{Content: "file: a.md", Vec: vecdb.Vector{0.5, 0.5}, Meta: vecdb.Meta{Source: "a.md", Kind: vecdb.KindPath}},
+		{Content: "bar", Vec: vecdb.Vector{0, 1}, Meta: vecdb.Meta{Source: "b.md", Index: 0}},
+	})
+
+	contents := func() []string {
+		t.Helper()
+
+		hits, err := db.SearchKNN(vecdb.Vector{1, 0}, 10)
+		if err != nil {
+			t.Fatalf("search knn: %v", err)
+		}
+
+		out := make([]string, 0, len(hits))
+		for _, h := range hits {
+			out = append(out, h.Content)
+		}
+
+		slices.Sort(out)
+
+		return out
+	}
+
+	// a vector of the wrong dim fails the insert, which keeps the old chunks
+	_, err := db.ReplaceSource("a.md", "", []vecdb.Chunk{{Content: "baz", Vec: vecdb.Vector{1, 0, 0}, Meta: vecdb.Meta{Source: "a.md"}}})
+	if !errors.Is(err, vecdb.ErrDimMismatch) {
+		t.Fatalf("want ErrDimMismatch, got: %v", err)
+	}
+
+	if got, want := contents(), []string{"bar", "file: a.md", "foo one", "foo two"}; !slices.Equal(want, got) {
+		t.Fatalf("after a failed replace: want chunks: %q, got: %q", want, got)
+	}
+
+	n, err := db.ReplaceSource("a.md", "", []vecdb.Chunk{{Content: "baz", Vec: vecdb.Vector{1, 0}, Meta: vecdb.Meta{Source: "a.md"}}})
+	if err != nil {
+		t.Fatalf("replace source: %v", err)
+	}
+
+	if n != 2 {
+		t.Errorf("want 2 replaced chunks, got: %d", n)
+	}
+
+	// the path chunk is of another kind, so it is kept
+	if got, want := contents(), []string{"bar", "baz", "file: a.md"}; !slices.Equal(want, got) {
+		t.Fatalf("want chunks: %q, got: %q", want, got)
+	}
+
+	hybrid, err := db.SearchHybrid(vecdb.Vector{0, 1}, "foo", 5, 0)
+	if err != nil {
+		t.Fatalf("search hybrid: %v", err)
+	}
+
+	for _, h := range hybrid {
+		if strings.HasPrefix(h.Content, "foo") {
+			t.Errorf("want replaced chunks removed from the keyword index, got: %+v", h)
+		}
+	}
+}
+
+func TestSourceStamps(t *testing.T) {
+	db := newTestDB(t, []vecdb.Chunk{
+		{Content: "foo one", Vec: vecdb.Vector{1, 0}, Meta: vecdb.Meta{Source: "a.md", Index: 0, ModTime: 42, Size: 7}},
+		{Content: "foo two", Vec: vecdb.Vector{0.9, 0.1}, Meta: vecdb.Meta{Source: "a.md", Index: 1, ModTime: 42, Size: 7}},
+		{Content: "file: a.md", Vec: vecdb.Vector{0.5, 0.5}, Meta: vecdb.Meta{Source: "a.md", Kind: vecdb.KindPath}},
+		{Content: "bar", Vec: vecdb.Vector{0, 1}, Meta: vecdb.Meta{Source: "piped-data", Index: 0}},
+	})
+
+	got, err := db.SourceStamps()
+	if err != nil {
+		t.Fatalf("source stamps: %v", err)
+	}
+
+	want := map[string]vecdb.SourceStamp{
+		"a.md":       {ModTime: 42, Size: 7},
+		"piped-data": {},
+	}
+
+	if !maps.Equal(want, got) {
+		t.Errorf("want stamps: %+v, got: %+v", want, got)
+	}
+}
+
+func TestNew_ExistingDimMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foo.db")
+
+	db, err := vecdb.New(2, vecdb.WithPath(path))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if _, err := vecdb.New(3, vecdb.WithPath(path)); !errors.Is(err, vecdb.ErrDimMismatch) {
+		t.Errorf("want ErrDimMismatch, got: %v", err)
+	}
+}
+
+func TestNew_ExistingModelMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foo.db")
+
+	db, err := vecdb.New(2, vecdb.WithPath(path), vecdb.WithModel("foo"))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if _, err := vecdb.New(2, vecdb.WithPath(path), vecdb.WithModel("bar")); !errors.Is(err, vecdb.ErrModelMismatch) {
+		t.Errorf("want ErrModelMismatch, got: %v", err)
+	}
+
+	ro, err := vecdb.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	defer func() { _ = ro.Close() }()
+
+	if got, want := ro.Model(), "foo"; got != want {
+		t.Errorf("want model %q, got %q", want, got)
+	}
+}
+
+func TestFilterMinScore(t *testing.T) {
+	results := []vecdb.SearchResult{
+		{Content: "exact", Distance: 0},
+		{Content: "near", Distance: 0.5},
+		{Content: "far", Distance: 3},
+	}
+
+	tests := []struct {
+		name     string
+		minScore float64
+		want     []string
+	}{
+		{name: "zero keeps all", minScore: 0, want: []string{"exact", "near", "far"}},
+		{name: "drops far", minScore: 0.5, want: []string{"exact", "near"}},
+		{name: "inclusive threshold", minScore: vecdb.Score(0.5), want: []string{"exact", "near"}},
+		{name: "drops all", minScore: 1.1, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, r := range vecdb.FilterMinScore(results, tt.minScore) {
+				got = append(got, r.Content)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+
+	if len(results) != 3 {
+		t.Errorf("want the input unchanged, got: %d results", len(results))
+	}
+}
+
+func TestConcurrentReadWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []vecdb.Opt
+	}{
+		{name: "in memory"},
+		{name: "file", opts: []vecdb.Opt{vecdb.WithPath(filepath.Join(t.TempDir(), "foo.db"))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := vecdb.New(2, tt.opts...)
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+
+			t.Cleanup(func() { _ = db.Close() })
+
+			const (
+				writes  = 20
+				readers = 4
+			)
+
+			var (
+				wg   sync.WaitGroup
+				errs = make(chan error, writes+readers)
+				done = make(chan struct{})
+			)
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				defer close(done)
+
+				for i := range writes {
+					source := fmt.Sprintf("%d.md", i)
+
+					err := db.Insert([]vecdb.Chunk{
+						{Content: "foo " + source, Vec: vecdb.Vector{1, float32(i)}, Meta: vecdb.Meta{Source: source}},
+					})
+					if err != nil {
+						errs <- fmt.Errorf("insert: %w", err)
+						return
+					}
+
+					if i%2 == 1 {
+						if _, err := db.DeleteBySource(source); err != nil {
+							errs <- fmt.Errorf("delete: %w", err)
+							return
+						}
+					}
+				}
+			}()
+
+			for range readers {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					for {
+						select {
+						case <-done:
+							return
+						default:
+						}
+
+						if _, err := db.SearchKNN(vecdb.Vector{1, 0}, 3); err != nil {
+							errs <- fmt.Errorf("search knn: %w", err)
+							return
+						}
+
+						if _, err := db.SearchHybrid(vecdb.Vector{1, 0}, "foo", 3, 0.5); err != nil {
+							errs <- fmt.Errorf("search hybrid: %w", err)
+							return
+						}
+					}
+				}()
+			}
+
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Error(err)
+			}
+
+			n, err := db.Count()
+			if err != nil {
+				t.Fatalf("count: %v", err)
+			}
+
+			if want := writes / 2; n != want {
+				t.Errorf("want %d chunks, got: %d", want, n)
+			}
+		})
+	}
+}